@@ -0,0 +1,176 @@
+package ev
+
+import (
+	"time"
+	"unsafe"
+)
+
+// readBufferSize is the size of the buffer each read from a connection
+// goes into.
+// TODO: Find the correct size for this buffer
+const readBufferSize = 2000
+
+// ReplyMode is set by CLIENT REPLY to turn off the replies to a
+// connection.
+type ReplyMode int
+
+const (
+	ReplyOn ReplyMode = iota
+	ReplyOff
+	// ReplySkipNext is set by CLIENT REPLY SKIP, and becomes ReplySkip
+	// once that command is handled
+	ReplySkipNext
+	ReplySkip
+)
+
+// Tracking holds the options of CLIENT TRACKING, for a connection that
+// tracks the keys it reads to be told when they change.
+type Tracking struct {
+	// Redirect is the id of the connection the invalidation messages are
+	// sent to instead, 0 for none, and RedirectBroken is set once that
+	// connection is gone
+	Redirect       int64
+	RedirectBroken bool
+	// Bcast tracks all the keys starting with one of the Prefixes rather
+	// than the keys read
+	Bcast    bool
+	Prefixes []string
+	OptIn    bool
+	OptOut   bool
+	NoLoop   bool
+	// Caching is set by CLIENT CACHING for the next command only
+	Caching bool
+}
+
+// Client is the per-connection state kept by the event loop.
+type Client struct {
+	// Id is unique across the lifetime of the server
+	Id int64
+	Fd int
+	// Addr is the address of the peer, and LocalAddr the address it
+	// connected to, as ip:port
+	Addr      string
+	LocalAddr string
+	// Name is set by the connection to identify itself
+	Name string
+	// User is the user the connection is authenticated as, once
+	// Authenticated is set or when no password is required
+	User          string
+	Authenticated bool
+	// Db is the index of the database selected by the connection.
+	Db int
+	// Resp is the version of the protocol the connection speaks, 2 unless
+	// it switched to 3 with HELLO
+	Resp            int
+	Created         time.Time
+	LastInteraction time.Time
+	// LastCmd is the name of the last command run by the connection
+	LastCmd string
+	// QueryBufPeak is the largest request read from the connection, and
+	// OutputBufPeak the largest reply written to it.
+	QueryBufPeak  int
+	OutputBufPeak int
+	// Monitor is set once the connection runs MONITOR
+	Monitor bool
+	// NoEvict is set by CLIENT NO-EVICT
+	NoEvict bool
+	Reply   ReplyMode
+	// Channels are the channels the connection subscribed to with
+	// SUBSCRIBE, and Patterns the patterns it subscribed to with
+	// PSUBSCRIBE
+	Channels map[string]bool
+	Patterns map[string]bool
+	// Tracking is set while CLIENT TRACKING is on
+	Tracking *Tracking
+	// Asking is set by ASKING, for the next command to be served by the
+	// node importing the slot of its keys
+	Asking bool
+
+	// out holds the data pushed to the connection outside of replies, and
+	// what it did not take of the replies, until the event loop writes it
+	out []byte
+	// deferred are the requests to handle again later, see Defer
+	deferred  [][]byte
+	deferNow  bool
+	closeAsap bool
+	closed    bool
+	// handling is set while the handler runs on a request of the client
+	handling bool
+	// tls is the TLS layer of the connections accepted on the TLS port
+	tls *tlsConn
+	// notify tells the event loop the client has pushed data or is to be
+	// closed
+	notify func(c *Client)
+}
+
+func NewClient(fd int) *Client {
+	now := time.Now()
+	return &Client{
+		Fd:              fd,
+		User:            "default",
+		Resp:            2,
+		Created:         now,
+		LastInteraction: now,
+	}
+}
+
+// MemoryUsage estimates the memory the connection needs at its peak: the
+// client itself, the read buffer, the largest reply so far and the data
+// not written yet.
+func (c *Client) MemoryUsage() int {
+	return int(unsafe.Sizeof(*c)) + readBufferSize + c.OutputBufPeak + len(c.out)
+}
+
+// Push queues data to be written to the connection once the request being
+// handled is replied to.
+func (c *Client) Push(data string) {
+	if len(c.out) == 0 {
+		c.notifyLoop()
+	}
+	c.out = append(c.out, data...)
+}
+
+// PendingOutput is the number of bytes pushed or replied to the connection
+// and not written yet.
+func (c *Client) PendingOutput() int {
+	return len(c.out)
+}
+
+// Defer makes the event loop keep the request being handled, along with
+// any that follow it, and hand it to the handler again later instead of
+// replying to it.
+func (c *Client) Defer() {
+	c.deferNow = true
+}
+
+// IsDeferred reports whether the connection has requests waiting to be
+// handled again.
+func (c *Client) IsDeferred() bool {
+	return len(c.deferred) > 0
+}
+
+// CloseAsap closes the connection once the request being handled is
+// replied to.
+func (c *Client) CloseAsap() {
+	if c.closeAsap {
+		return
+	}
+	c.closeAsap = true
+	c.notifyLoop()
+}
+
+// IsClosing reports whether the connection is closed or about to be.
+func (c *Client) IsClosing() bool {
+	return c.closeAsap || c.closed
+}
+
+// Closed reports whether the connection was closed.
+func (c *Client) Closed() bool {
+	return c.closed
+}
+
+func (c *Client) notifyLoop() {
+	if c.notify != nil {
+		c.notify(c)
+	}
+}
@@ -1,19 +1,35 @@
 package ev
 
 import (
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// Port is the port the server listens on unless SetPort is called.
+const Port = 6379
+
 type SysCall interface {
 	Socket(int, int, int) (int, error)
 	Bind(int, syscall.Sockaddr) error
 	Listen(int, int) error
+	SetReuseAddr(int) error
 	SetNonblock(int, bool) error
 	Accept(int) (int, syscall.Sockaddr, error)
 	Read(int, []byte) (int, error)
 	Write(int, []byte) (int, error)
 	Close(int) error
+	Getsockname(int) (syscall.Sockaddr, error)
+	SetKeepAlive(int, bool) error
+	SetKeepAlivePeriod(int, int) error
+	Getrlimit(int, *syscall.Rlimit) error
+	Setrlimit(int, *syscall.Rlimit) error
+	Pipe([]int) error
 	Kqueue() (int, error)
 	Kevent(int, []syscall.Kevent_t, []syscall.Kevent_t, *syscall.Timespec) (n int, err error)
 }
@@ -24,24 +40,202 @@ type SysCallError interface {
 }
 
 type EventLoop interface {
-	Run(func([]byte) string) error
+	Run(func(*Client, StringReader) string) error
 }
 
 type SocketEventLoop struct {
-	handler func(StringReader) string
-	cfds    []int
-	sys     SysCall
-	kq      int
-	sfd     int
+	handler     func(*Client, StringReader) string
+	beforeSleep func() bool
+	onClose     func(*Client)
+	// idleTimeout is how long a client may stay idle before it is closed,
+	// and keepAlive the period of the TCP keepalive probes. Both are
+	// disabled when 0.
+	idleTimeout time.Duration
+	keepAlive   time.Duration
+	// maxClients is the most clients connected at once, 0 for no limit
+	maxClients int
+	// port is where the plain connections are accepted, when not 0
+	port int
+	// tlsPort is where the TLS connections are accepted, with tlsConfig,
+	// when not 0
+	tlsPort   int
+	tlsConfig *tls.Config
+	clients   map[int]*Client
+	// handshakes are the TLS clients whose handshake is not done yet
+	handshakes map[int]*Client
+	nextId     int64
+	// timers run on the loop, see AddTimer. laterTimers are those taken
+	// out of the heap by processTimers until it is done with them.
+	timers       timerHeap
+	laterTimers  []*timer
+	nextTimerId  int64
+	runningTimer *timer
+	// pending are the clients with data pushed to them or to be closed,
+	// and deferred the ones with requests to handle again
+	pending  []*Client
+	deferred []*Client
+	stats    Stats
+	sys      SysCall
+	kq       int
+	sfd      int
+	tfd      int
+	// wakeR is the read end of a pipe that Stop writes to, so that the
+	// loop does not sleep through it. Stop may run on any goroutine, so
+	// stopping and wakeW are only accessed atomically.
+	wakeR    int
+	wakeW    int32
+	stopping int32
 }
 
 func NewSocketEventLoop(sys SysCall) SocketEventLoop {
 	return SocketEventLoop{
-		sys: sys,
+		sys:        sys,
+		port:       Port,
+		clients:    make(map[int]*Client),
+		handshakes: make(map[int]*Client),
+	}
+}
+
+// SetBeforeSleep registers a function to run each time the loop is about to
+// wait for events. When it reports that it has work left, the loop only
+// polls for events so that the work can continue while it is idle.
+func (el *SocketEventLoop) SetBeforeSleep(fn func() bool) {
+	el.beforeSleep = fn
+}
+
+// SetOnClose registers fn to run on each client the loop closes, once the
+// connection is closed.
+func (el *SocketEventLoop) SetOnClose(fn func(*Client)) {
+	el.onClose = fn
+}
+
+// SetIdleTimeout makes the loop close the clients that send nothing for
+// longer than d, 0 disables it.
+func (el *SocketEventLoop) SetIdleTimeout(d time.Duration) {
+	el.idleTimeout = d
+}
+
+// SetKeepAlive enables TCP keepalive with the period d on the connections
+// accepted from now on, 0 disables it.
+func (el *SocketEventLoop) SetKeepAlive(d time.Duration) {
+	el.keepAlive = d
+}
+
+// SetMaxClients limits the number of clients connected at once. The limit
+// of open files is raised to fit when the loop starts, see Run.
+func (el *SocketEventLoop) SetMaxClients(n int) {
+	el.maxClients = n
+}
+
+// SetPort makes the loop accept plain connections on port rather than on
+// Port, or none when it is 0.
+func (el *SocketEventLoop) SetPort(port int) {
+	el.port = port
+}
+
+// SetTls makes the loop accept TLS connections on port too, with config.
+// The certificates can be changed while the loop runs through the
+// GetConfigForClient hook of config.
+func (el *SocketEventLoop) SetTls(port int, config *tls.Config) {
+	el.tlsPort = port
+	el.tlsConfig = config
+}
+
+// ChangePort makes the running loop accept the plain connections on port,
+// 0 to stop accepting them. The clients connected already are kept. The
+// port in use is kept when the new one can not be listened on.
+func (el *SocketEventLoop) ChangePort(port int) error {
+	fd, err := el.changeListener(el.port, el.sfd, port)
+	if err != nil {
+		return err
+	}
+	el.port, el.sfd = port, fd
+	return nil
+}
+
+// ChangeTls is ChangePort for the TLS connections, which are accepted with
+// config from now on.
+func (el *SocketEventLoop) ChangeTls(port int, config *tls.Config) error {
+	fd, err := el.changeListener(el.tlsPort, el.tfd, port)
+	if err != nil {
+		return err
+	}
+	el.tlsPort, el.tfd = port, fd
+	if config != nil {
+		el.tlsConfig = config
+	}
+	return nil
+}
+
+// changeListener replaces the socket fd listening on oldPort by one
+// listening on port, and returns it.
+func (el *SocketEventLoop) changeListener(oldPort int, fd int, port int) (int, error) {
+	if port == oldPort {
+		return fd, nil
+	}
+	newFd := 0
+	if port > 0 {
+		var err error
+		newFd, err = el.listen(port)
+		if err != nil {
+			return 0, err
+		}
+		err = el.addKqEvent(newFd)
+		if err != nil {
+			el.sys.Close(newFd)
+			return 0, err
+		}
+	}
+	// closing the socket removes its event from the kqueue
+	if oldPort > 0 {
+		el.sys.Close(fd)
 	}
+	return newFd, nil
+}
+
+// ChangeMaxClients changes the limit of clients of the running loop. The
+// clients connected already are kept when there are more. It fails, and
+// leaves the limit as it was, when the limit of open files can not be
+// raised to fit.
+func (el *SocketEventLoop) ChangeMaxClients(n int) error {
+	old := el.maxClients
+	el.maxClients = n
+	err := el.adjustOpenFilesLimit()
+	if err == nil && el.maxClients < n {
+		err = fmt.Errorf("the operating system is not able to handle the specified number of clients, try with %d", el.maxClients)
+	}
+	if err != nil {
+		el.maxClients = old
+	}
+	return err
+}
+
+// MaxClients is the limit of clients connected at once, which may be lower
+// than asked for when the limit of open files could not be raised.
+func (el *SocketEventLoop) MaxClients() int {
+	return el.maxClients
+}
+
+// Clients returns the connected clients.
+func (el *SocketEventLoop) Clients() []*Client {
+	clients := make([]*Client, 0, len(el.clients))
+	for _, c := range el.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func (el *SocketEventLoop) Stats() Stats {
+	return el.stats
+}
+
+func (el *SocketEventLoop) ResetStats() {
+	el.stats = Stats{}
 }
 
-func (el *SocketEventLoop) Run(handler func(StringReader) string) error {
+// Run serves the connections with handler until Stop is called, then
+// closes them all and returns.
+func (el *SocketEventLoop) Run(handler func(*Client, StringReader) string) error {
 	el.handler = handler
 	err := el.create()
 	if err != nil {
@@ -49,12 +243,63 @@ func (el *SocketEventLoop) Run(handler func(StringReader) string) error {
 	}
 	fmt.Println("Server started")
 
-	for {
+	for !el.Stopping() {
 		err = el.execute()
 		if err != nil {
 			return err
 		}
 	}
+	return el.shutdown()
+}
+
+// Stop makes Run return once the request being handled, if any, is
+// replied to. It is safe to call from any goroutine, such as the one
+// handling signals.
+func (el *SocketEventLoop) Stop() {
+	if !atomic.CompareAndSwapInt32(&el.stopping, 0, 1) {
+		return
+	}
+	el.wake()
+}
+
+// wake makes the loop return from waiting for events. It is safe to call
+// from any goroutine.
+func (el *SocketEventLoop) wake() {
+	if fd := atomic.LoadInt32(&el.wakeW); fd > 0 {
+		el.sys.Write(int(fd), []byte{0})
+	}
+}
+
+// Stopping reports whether Stop was called.
+func (el *SocketEventLoop) Stopping() bool {
+	return atomic.LoadInt32(&el.stopping) == 1
+}
+
+// shutdown stops accepting connections, makes one last attempt at writing
+// the data pushed to the clients, and closes every file the loop opened.
+// It carries on past errors and returns the first one.
+func (el *SocketEventLoop) shutdown() error {
+	var err error
+	setErr := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	if el.port > 0 {
+		setErr(el.sys.Close(el.sfd))
+	}
+	if el.tlsPort > 0 {
+		setErr(el.sys.Close(el.tfd))
+	}
+
+	setErr(el.handlePending())
+	for _, c := range el.clients {
+		setErr(el.closeClient(c))
+	}
+	setErr(el.sys.Close(el.wakeR))
+	setErr(el.sys.Close(int(atomic.SwapInt32(&el.wakeW, 0))))
+	setErr(el.sys.Close(el.kq))
+	return err
 }
 
 func (el *SocketEventLoop) addKqEvent(fd int) error {
@@ -72,82 +317,244 @@ func (el *SocketEventLoop) addKqEvent(fd int) error {
 }
 
 func (el *SocketEventLoop) create() error {
-	sfd, err := el.sys.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	err := el.adjustOpenFilesLimit()
+	if err != nil {
+		return err
+	}
+
+	if el.port > 0 {
+		el.sfd, err = el.listen(el.port)
+		if err != nil {
+			return err
+		}
+	}
+	if el.tlsPort > 0 {
+		el.tfd, err = el.listen(el.tlsPort)
+		if err != nil {
+			return err
+		}
+	}
+
+	kq, err := el.sys.Kqueue()
 	if err != nil {
 		return err
 	}
-	el.sfd = sfd
+	el.kq = kq
+
+	if el.port > 0 {
+		err = el.addKqEvent(el.sfd)
+		if err != nil {
+			return err
+		}
+	}
+	if el.tlsPort > 0 {
+		err = el.addKqEvent(el.tfd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return el.createWakePipe()
+}
+
+// listen opens a non-blocking socket listening on port. The socket is
+// closed when it fails, as the loop may carry on, see ChangePort.
+func (el *SocketEventLoop) listen(port int) (int, error) {
+	fd, err := el.sys.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return 0, err
+	}
+	fail := func(err error) (int, error) {
+		el.sys.Close(fd)
+		return 0, err
+	}
+
+	// as in redis, the port can be listened on again while the
+	// connections accepted on it before are still open, see ChangePort
+	err = el.sys.SetReuseAddr(fd)
+	if err != nil {
+		return fail(err)
+	}
 
-	// TODO: Port needs to be configurable
 	sa := syscall.SockaddrInet4{
-		Port: 6379,
+		Port: port,
 		Addr: [4]byte{0, 0, 0, 0},
 	}
 
-	err = el.sys.Bind(sfd, &sa)
+	err = el.sys.Bind(fd, &sa)
 	if err != nil {
-		return err
+		return fail(err)
 	}
 
 	// Setting backlog to something acceptable to redis-benchmark command
 	// Needs more thoughts on what should be the ideal value here.
-	err = el.sys.Listen(sfd, 50)
+	err = el.sys.Listen(fd, 50)
 	if err != nil {
-		return err
+		return fail(err)
 	}
 
-	err = el.sys.SetNonblock(sfd, true)
+	err = el.sys.SetNonblock(fd, true)
 	if err != nil {
-		return err
+		return fail(err)
 	}
+	return fd, nil
+}
 
-	kq, err := el.sys.Kqueue()
+func (el *SocketEventLoop) createWakePipe() error {
+	p := make([]int, 2)
+	err := el.sys.Pipe(p)
 	if err != nil {
 		return err
 	}
-	el.kq = kq
-
-	err = el.addKqEvent(sfd)
+	for _, fd := range p {
+		err = el.sys.SetNonblock(fd, true)
+		if err != nil {
+			return err
+		}
+	}
+	err = el.addKqEvent(p[0])
 	if err != nil {
 		return err
 	}
-
+	el.wakeR = p[0]
+	atomic.StoreInt32(&el.wakeW, int32(p[1]))
 	return nil
 }
 
+const (
+	// reservedFds are the files kept open besides the clients: the
+	// listening socket, the kqueue and the like.
+	reservedFds = 32
+	// adjustFdsStep is how much the limit of open files asked for is
+	// lowered each time raising it fails.
+	adjustFdsStep = 16
+
+	maxClientsReply = "-ERR max number of clients reached\r\n"
+
+	// deferredRetryInterval is how long the loop waits for events before
+	// handling the deferred requests again.
+	deferredRetryInterval = 10 * time.Millisecond
+)
+
 func (el *SocketEventLoop) execute() error {
+	err := el.processDeferred()
+	if err != nil {
+		return err
+	}
+
+	// wait for events until the next timer is due at most
+	timeout := el.timersTimeout(time.Now())
+	if el.beforeSleep != nil && el.beforeSleep() {
+		timeout = &syscall.Timespec{}
+	} else if len(el.pending) > 0 {
+		// beforeSleep pushed data to clients, which is written right
+		// after polling
+		timeout = &syscall.Timespec{}
+	} else if len(el.deferred) > 0 && (timeout == nil || timeout.Nano() > int64(deferredRetryInterval)) {
+		ts := syscall.NsecToTimespec(int64(deferredRetryInterval))
+		timeout = &ts
+	}
+
 	events := make([]syscall.Kevent_t, 10)
-	n, err := el.sys.Kevent(el.kq, nil, events, nil)
+	n, err := el.sys.Kevent(el.kq, nil, events, timeout)
 
 	if err != nil && !shouldRetry(err) {
 		return err
 	}
+	err = el.dispatch(events[:n])
+	if err != nil {
+		return err
+	}
+
+	el.processTimers(time.Now())
+	// timers may push data to clients too
+	return el.handlePending()
+}
 
-	for i := 0; i < n; i++ {
+// dispatch accepts the connections, and handles the requests of the
+// clients the events are for. The client whose request is being handled
+// already, when called by ProcessEventsWhileBlocked, is left for later.
+func (el *SocketEventLoop) dispatch(events []syscall.Kevent_t) error {
+	// the events left once stopping are for connections about to close
+	for i := 0; i < len(events) && !el.Stopping(); i++ {
 		fid := int(events[i].Ident)
 
-		if fid == el.sfd {
-			err = el.accept()
+		if el.port > 0 && fid == el.sfd || el.tlsPort > 0 && fid == el.tfd {
+			err := el.accept(fid)
 			if err != nil {
 				return err
 			}
-		} else {
-			ctd, _ := el.process(fid)
+		} else if fid == el.wakeR {
+			// Run checks for Stop once this returns
+			el.read(el.wakeR)
+			err := el.processHandshakes()
+			if err != nil {
+				return err
+			}
+		} else if c, ok := el.clients[fid]; ok && !c.handling {
+			ctd, _ := el.process(c)
 
 			if !ctd {
-				err = el.sys.Close(fid)
+				err := el.closeClient(c)
 				if err != nil {
 					return err
 				}
 			}
 
+			err := el.handlePending()
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func (el *SocketEventLoop) accept() error {
-	cfd, _, err := el.sys.Accept(el.sfd)
+// ProcessEventsWhileBlocked handles the events that arrived while the
+// handler is busy with a long request, such as a script, without waiting
+// for more. The handler is called again meanwhile, for the requests of
+// the other clients. The timers do not run.
+func (el *SocketEventLoop) ProcessEventsWhileBlocked() error {
+	events := make([]syscall.Kevent_t, 10)
+	n, err := el.sys.Kevent(el.kq, nil, events, &syscall.Timespec{})
+	if err != nil && !shouldRetry(err) {
+		return err
+	}
+	err = el.dispatch(events[:n])
+	if err != nil {
+		return err
+	}
+	return el.handlePending()
+}
+
+// ClientsCron closes the TLS clients whose handshake takes too long, and
+// the clients idle for longer than the idle timeout. Monitors and
+// subscribers only receive, and blocked clients wait on the server, so
+// they are left alone. It is meant to run from a timer, so there is no one
+// to report a failure to close a connection to, which is not fatal anyway.
+func (el *SocketEventLoop) ClientsCron() {
+	now := time.Now()
+	for _, c := range el.handshakes {
+		if now.Sub(c.Created) > tlsHandshakeTimeout {
+			el.closeClient(c)
+		}
+	}
+	if el.idleTimeout == 0 {
+		return
+	}
+	for _, c := range el.clients {
+		if c.Monitor || len(c.Channels)+len(c.Patterns) > 0 || c.IsDeferred() ||
+			now.Sub(c.LastInteraction) <= el.idleTimeout {
+			continue
+		}
+		el.closeClient(c)
+	}
+}
+
+// accept accepts a connection on the listening socket lfd, which is either
+// the plain one or the TLS one.
+func (el *SocketEventLoop) accept(lfd int) error {
+	cfd, sa, err := el.sys.Accept(lfd)
 	isNew := true
 	if err != nil {
 		isNew = false
@@ -156,6 +563,16 @@ func (el *SocketEventLoop) accept() error {
 		}
 	}
 
+	if isNew && el.maxClients > 0 && len(el.clients) >= el.maxClients {
+		// best effort, the connection is closed either way. A TLS client
+		// could not read the reply before the handshake.
+		if lfd != el.tfd {
+			el.sys.Write(cfd, []byte(maxClientsReply))
+		}
+		el.stats.RejectedConnections++
+		return el.sys.Close(cfd)
+	}
+
 	if isNew {
 		err = el.sys.SetNonblock(cfd, true)
 		if err != nil {
@@ -165,13 +582,146 @@ func (el *SocketEventLoop) accept() error {
 		if err != nil {
 			return err
 		}
+		if el.keepAlive > 0 {
+			el.setKeepAlive(cfd)
+		}
+		el.nextId++
+		c := NewClient(cfd)
+		c.Id = el.nextId
+		c.Addr = sockaddrString(sa)
+		if lsa, err := el.sys.Getsockname(cfd); err == nil {
+			c.LocalAddr = sockaddrString(lsa)
+		}
+		c.notify = el.addPending
+		if el.tlsPort > 0 && lfd == el.tfd {
+			c.tls = newTlsConn(el.tlsConfig, el.wake)
+			el.handshakes[cfd] = c
+		}
+		el.clients[cfd] = c
+		el.stats.ConnectionsReceived++
+	}
+	return nil
+}
+
+// adjustOpenFilesLimit raises the limit of open files to fit maxClients.
+// When the limit can not be raised that far, it is raised as far as it can
+// be and maxClients is lowered to fit.
+func (el *SocketEventLoop) adjustOpenFilesLimit() error {
+	if el.maxClients == 0 {
+		return nil
+	}
+	want := uint64(el.maxClients + reservedFds)
+
+	var lim syscall.Rlimit
+	err := el.sys.Getrlimit(syscall.RLIMIT_NOFILE, &lim)
+	if err != nil {
+		return err
+	}
+	if lim.Cur >= want {
+		return nil
+	}
+
+	old := lim.Cur
+	best := want
+	for best > old {
+		err = el.sys.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: best, Max: best})
+		if err == nil {
+			break
+		}
+		if best < adjustFdsStep {
+			best = old
+			break
+		}
+		best -= adjustFdsStep
+	}
+	if best < old {
+		best = old
+	}
+
+	if best < want {
+		if best <= reservedFds {
+			return fmt.Errorf("open files limit %d leaves no room for clients", best)
+		}
+		el.maxClients = int(best) - reservedFds
+		fmt.Printf("Open files limit is %d, maxclients lowered to %d\n", best, el.maxClients)
+	}
+	return nil
+}
+
+// setKeepAlive turns on TCP keepalive for the connection. It is best
+// effort, the connection is still served when it fails.
+func (el *SocketEventLoop) setKeepAlive(fd int) {
+	if el.sys.SetKeepAlive(fd, true) != nil {
+		return
+	}
+	secs := int(el.keepAlive / time.Second)
+	if secs == 0 {
+		secs = 1
+	}
+	el.sys.SetKeepAlivePeriod(fd, secs)
+}
+
+func (el *SocketEventLoop) closeClient(c *Client) error {
+	delete(el.clients, c.Fd)
+	if c.tls != nil {
+		delete(el.handshakes, c.Fd)
+		c.tls.close()
+	}
+	c.closed = true
+	err := el.sys.Close(c.Fd)
+	if el.onClose != nil {
+		el.onClose(c)
+	}
+	return err
+}
+
+func (el *SocketEventLoop) addPending(c *Client) {
+	el.pending = append(el.pending, c)
+}
+
+// handlePending writes the data pushed to clients while handling a request,
+// and closes the clients that asked to. A client that can not take all of
+// its data right away keeps the rest until the next time.
+// TODO: Wait for the connection to be writable instead
+func (el *SocketEventLoop) handlePending() error {
+	pending := el.pending
+	el.pending = nil
+	for _, c := range pending {
+		if c.closed {
+			continue
+		}
+		if len(c.out) > 0 || c.tls != nil {
+			n, err := el.write(c, c.out)
+			if err != nil && !shouldRetry(err) {
+				err = el.closeClient(c)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if n > 0 {
+				el.stats.NetOutputBytes += int64(n)
+				c.out = c.out[n:]
+			}
+			if len(c.out) > 0 || el.tlsPending(c) {
+				el.pending = append(el.pending, c)
+				continue
+			}
+			c.out = nil
+		}
+		if c.closeAsap {
+			err := el.closeClient(c)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (el *SocketEventLoop) process(cfd int) (bool, error) {
+func (el *SocketEventLoop) process(c *Client) (bool, error) {
 	ctd := true
-	data, err := el.read(cfd)
+	data, err := el.read(c.Fd)
 	if err != nil {
 		if shouldRetry(err) {
 			return ctd, nil
@@ -182,27 +732,207 @@ func (el *SocketEventLoop) process(cfd int) (bool, error) {
 	if len(data) == 0 {
 		return false, nil
 	}
+	if c.tls != nil {
+		c.tls.transport.feed(data)
+		if _, ok := el.handshakes[c.Fd]; ok {
+			// the handshake goroutine takes it from there
+			return ctd, nil
+		}
+		data, err = c.tls.read()
+		if err != nil {
+			return false, nil
+		}
+		if len(data) == 0 {
+			// no complete record yet
+			return ctd, nil
+		}
+	}
+	return el.received(c, data)
+}
+
+// received handles the data read from the client, decrypted already for
+// the TLS ones.
+func (el *SocketEventLoop) received(c *Client, data []byte) (bool, error) {
+	ctd := true
+	el.stats.NetInputBytes += int64(len(data))
+	if len(data) > c.QueryBufPeak {
+		c.QueryBufPeak = len(data)
+	}
+	c.LastInteraction = time.Now()
+
+	if c.IsDeferred() {
+		// keep the requests in order
+		c.deferred = append(c.deferred, data)
+		return ctd, nil
+	}
+	deferred, err := el.handle(c, data)
+	if deferred {
+		el.deferred = append(el.deferred, c)
+	}
+	return ctd, err
+}
 
+// handle runs the handler on a request and writes the reply, unless the
+// handler deferred the request, which it reports. What the connection does
+// not take of the reply is kept with the pushed data, ahead of what was
+// pushed while handling the request, and written later by handlePending.
+func (el *SocketEventLoop) handle(c *Client, data []byte) (bool, error) {
 	sr := NewArrayStringReader(data)
-	res := el.handler(sr)
+	// queued is the data the connection did not take yet, which the reply
+	// has to wait for
+	queued := len(c.out)
+	c.handling = true
+	res := el.handler(c, sr)
+	c.handling = false
+	if c.deferNow {
+		c.deferNow = false
+		c.deferred = append([][]byte{data}, c.deferred...)
+		return true, nil
+	}
+	if len(res) == 0 {
+		return false, nil
+	}
 
-	data = []byte(res)
-	n, err := el.sys.Write(cfd, data)
-	if err != nil {
-		return ctd, err
+	out := []byte(res)
+	if len(out) > c.OutputBufPeak {
+		c.OutputBufPeak = len(out)
+	}
+	if queued > 0 {
+		c.out = append(c.out[:queued:queued], append(out, c.out[queued:]...)...)
+		return false, nil
+	}
+	n, err := el.write(c, out)
+	if err != nil && !shouldRetry(err) {
+		return false, err
+	}
+	if n < 0 {
+		n = 0
 	}
+	el.stats.NetOutputBytes += int64(n)
 
-	if n != len(data) {
-		// TODO: Retry rest of the bytes
-		return ctd, fmt.Errorf("incomplete write")
+	if n != len(out) {
+		if len(c.out) == 0 {
+			el.addPending(c)
+		}
+		c.out = append(out[n:len(out):len(out)], c.out...)
 	}
+	return false, nil
+}
 
-	return ctd, nil
+// processDeferred hands the deferred requests to the handler again, in
+// order, until one of them is deferred again.
+func (el *SocketEventLoop) processDeferred() error {
+	clients := el.deferred
+	el.deferred = nil
+	for _, c := range clients {
+		for !c.closed && c.IsDeferred() {
+			data := c.deferred[0]
+			c.deferred = c.deferred[1:]
+			if len(c.deferred) == 0 {
+				c.deferred = nil
+			}
+			deferred, err := el.handle(c, data)
+			if err != nil {
+				err = el.closeClient(c)
+				if err != nil {
+					return err
+				}
+				break
+			}
+			if deferred {
+				el.deferred = append(el.deferred, c)
+				break
+			}
+		}
+	}
+	return el.handlePending()
+}
+
+// write writes data to the client and returns how much of it was. The data
+// of the TLS clients is taken whole, encrypted, and what the socket can not
+// take yet is kept to flush later, see tlsPending.
+func (el *SocketEventLoop) write(c *Client, data []byte) (int, error) {
+	if c.tls == nil {
+		return el.sys.Write(c.Fd, data)
+	}
+	if len(data) > 0 {
+		if _, err := c.tls.conn.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), el.flushTls(c)
+}
+
+// flushTls writes what crypto/tls wrote for the client to the socket, as
+// much as it takes.
+func (el *SocketEventLoop) flushTls(c *Client) error {
+	out := c.tls.transport.output()
+	if len(out) == 0 {
+		return nil
+	}
+	n, err := el.sys.Write(c.Fd, out)
+	if n > 0 {
+		c.tls.transport.consume(n)
+	}
+	if err != nil && !shouldRetry(err) {
+		return err
+	}
+	return nil
+}
+
+// tlsPending reports whether the client has encrypted data the socket did
+// not take yet.
+func (el *SocketEventLoop) tlsPending(c *Client) bool {
+	return c.tls != nil && len(c.tls.transport.output()) > 0
+}
+
+// processHandshakes writes what the handshakes in progress wrote, and moves
+// the connections whose handshake is done along: a failed handshake closes
+// the connection, and the requests sent right after a successful one are
+// handled.
+func (el *SocketEventLoop) processHandshakes() error {
+	for _, c := range el.handshakes {
+		if err := el.flushTls(c); err != nil {
+			if err = el.closeClient(c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		state, _ := c.tls.handshakeState()
+		switch state {
+		case tlsHandshaking:
+			continue
+		case tlsFailed:
+			if err := el.closeClient(c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		delete(el.handshakes, c.Fd)
+		if el.tlsPending(c) {
+			el.addPending(c)
+		}
+		data, err := c.tls.read()
+		if err == nil && len(data) > 0 {
+			var ctd bool
+			ctd, err = el.received(c, data)
+			if !ctd {
+				err = io.EOF
+			}
+		}
+		if err != nil {
+			if err = el.closeClient(c); err != nil {
+				return err
+			}
+		}
+	}
+	return el.handlePending()
 }
 
 func (el *SocketEventLoop) read(cfd int) ([]byte, error) {
-	// TODO: Find the correct size for this buffer
-	data := make([]byte, 2000)
+	data := make([]byte, readBufferSize)
 	n, err := el.sys.Read(cfd, data)
 	if err != nil {
 		return data, err
@@ -210,6 +940,16 @@ func (el *SocketEventLoop) read(cfd int) ([]byte, error) {
 	return data[:n], nil
 }
 
+func sockaddrString(sa syscall.Sockaddr) string {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return net.IP(sa.Addr[:]).String() + ":" + strconv.Itoa(sa.Port)
+	case *syscall.SockaddrInet6:
+		return "[" + net.IP(sa.Addr[:]).String() + "]:" + strconv.Itoa(sa.Port)
+	}
+	return ""
+}
+
 func shouldRetry(err error) bool {
 	sce, ok := err.(SysCallError)
 	if !ok {
@@ -1,10 +1,12 @@
 package ev
 
 import (
+	"crypto/tls"
 	"fmt"
 	"redis-go/app/mocks"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -20,16 +22,49 @@ func TestCreate(t *testing.T) {
 	sa.Addr = [4]byte{0, 0, 0, 0}
 
 	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
 	sc.EXPECT().Bind(254, &sa).Return(nil)
 	sc.EXPECT().Listen(254, 50).Return(nil)
 	sc.EXPECT().SetNonblock(254, true).Return(nil)
 	sc.EXPECT().Kqueue().Return(375, nil)
 	sc.EXPECT().Kevent(375, eventsFor(254), nil, nil).Return(0, nil)
+	sc.EXPECT().Pipe(gomock.Len(2)).DoAndReturn(funcPipe(255, 256))
+	sc.EXPECT().SetNonblock(255, true).Return(nil)
+	sc.EXPECT().SetNonblock(256, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(255), nil, nil).Return(0, nil)
 
 	err := el.create()
 	assert.Nil(t, err)
 	assert.True(t, el.sfd > 0)
 	assert.True(t, el.kq > 0)
+	assert.Equal(t, 255, el.wakeR)
+	assert.Equal(t, int32(256), el.wakeW)
+}
+
+func TestCreateError_Pipe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
+	sc.EXPECT().Bind(254, gomock.Any()).Return(nil)
+	sc.EXPECT().Listen(254, 50).Return(nil)
+	sc.EXPECT().SetNonblock(254, true).Return(nil)
+	sc.EXPECT().Kqueue().Return(375, nil)
+	sc.EXPECT().Kevent(375, eventsFor(254), nil, nil).Return(0, nil)
+	sc.EXPECT().Pipe(gomock.Len(2)).Return(fmt.Errorf("pipe error"))
+
+	err := el.create()
+	assert.NotNil(t, err)
+}
+
+func funcPipe(r, w int) func([]int) error {
+	return func(p []int) error {
+		p[0] = r
+		p[1] = w
+		return nil
+	}
 }
 
 func TestCreateError_Socket(t *testing.T) {
@@ -54,7 +89,9 @@ func TestCreateError_Bind(t *testing.T) {
 	sa.Addr = [4]byte{0, 0, 0, 0}
 
 	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
 	sc.EXPECT().Bind(254, &sa).Return(fmt.Errorf("bind error"))
+	sc.EXPECT().Close(254).Return(nil)
 
 	err := el.create()
 	assert.NotNil(t, err)
@@ -70,8 +107,10 @@ func TestCreateError_Listen(t *testing.T) {
 	sa.Addr = [4]byte{0, 0, 0, 0}
 
 	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
 	sc.EXPECT().Bind(254, &sa).Return(nil)
 	sc.EXPECT().Listen(254, 50).Return(fmt.Errorf("listen error"))
+	sc.EXPECT().Close(254).Return(nil)
 
 	err := el.create()
 	assert.NotNil(t, err)
@@ -87,9 +126,11 @@ func TestCreateError_SetNonblock(t *testing.T) {
 	sa.Addr = [4]byte{0, 0, 0, 0}
 
 	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
 	sc.EXPECT().Bind(254, &sa).Return(nil)
 	sc.EXPECT().Listen(254, 50).Return(nil)
 	sc.EXPECT().SetNonblock(254, true).Return(fmt.Errorf("non-block error"))
+	sc.EXPECT().Close(254).Return(nil)
 
 	err := el.create()
 	assert.NotNil(t, err)
@@ -105,6 +146,7 @@ func TestCreateError_Kqueue(t *testing.T) {
 	sa.Addr = [4]byte{0, 0, 0, 0}
 
 	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
 	sc.EXPECT().Bind(254, &sa).Return(nil)
 	sc.EXPECT().Listen(254, 50).Return(nil)
 	sc.EXPECT().SetNonblock(254, true).Return(nil)
@@ -124,6 +166,7 @@ func TestCreateError_Kevent(t *testing.T) {
 	sa.Addr = [4]byte{0, 0, 0, 0}
 
 	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
 	sc.EXPECT().Bind(254, &sa).Return(nil)
 	sc.EXPECT().Listen(254, 50).Return(nil)
 	sc.EXPECT().SetNonblock(254, true).Return(nil)
@@ -149,6 +192,70 @@ func TestExecuteNoEvents(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestExecuteBeforeSleep(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	called := false
+	el.SetBeforeSleep(func() bool {
+		called = true
+		return false
+	})
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).Return(0, nil)
+
+	err := el.execute()
+	assert.Nil(t, err)
+	assert.True(t, called)
+}
+
+func TestExecuteBeforeSleepPending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.SetBeforeSleep(func() bool {
+		return true
+	})
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, &syscall.Timespec{}).Return(0, nil)
+
+	err := el.execute()
+	assert.Nil(t, err)
+}
+
+func TestExecuteBeforeSleepPushes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	c := NewClient(455)
+	c.notify = el.addPending
+	el.clients[c.Fd] = c
+	el.SetBeforeSleep(func() bool {
+		c.Push("+message\r\n")
+		return false
+	})
+
+	// the loop does not block with data to write
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, &syscall.Timespec{}).Return(0, nil)
+	sc.EXPECT().Write(455, []byte("+message\r\n")).Return(10, nil)
+
+	err := el.execute()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, c.PendingOutput())
+}
+
 func TestExecuteError_Temporary(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	sc := mocks.NewMockSysCall(ctrl)
@@ -192,12 +299,20 @@ func TestExecuteSfdEvent(t *testing.T) {
 	events := make([]syscall.Kevent_t, 10)
 	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(245))
 
-	sc.EXPECT().Accept(245).Return(455, nil, nil)
+	sa := &syscall.SockaddrInet4{Port: 51234, Addr: [4]byte{127, 0, 0, 1}}
+	sc.EXPECT().Accept(245).Return(455, sa, nil)
 	sc.EXPECT().SetNonblock(455, true).Return(nil)
 	sc.EXPECT().Kevent(375, eventsFor(455), nil, nil).Return(0, nil)
+	lsa := &syscall.SockaddrInet4{Port: 6379, Addr: [4]byte{127, 0, 0, 1}}
+	sc.EXPECT().Getsockname(455).Return(lsa, nil)
 
 	err := el.execute()
 	assert.Nil(t, err)
+	assert.Equal(t, 455, el.clients[455].Fd)
+	assert.Equal(t, int64(1), el.clients[455].Id)
+	assert.Equal(t, "127.0.0.1:51234", el.clients[455].Addr)
+	assert.Equal(t, "127.0.0.1:6379", el.clients[455].LocalAddr)
+	assert.Equal(t, int64(1), el.Stats().ConnectionsReceived)
 }
 
 func TestExecuteError_Kevent(t *testing.T) {
@@ -296,6 +411,7 @@ func TestExecuteCfd(t *testing.T) {
 	el := NewSocketEventLoop(sc)
 	el.sfd = 245
 	el.kq = 375
+	el.clients[495] = NewClient(495)
 
 	events := make([]syscall.Kevent_t, 10)
 	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(495))
@@ -313,6 +429,7 @@ func TestExecuteCfdDisconnected(t *testing.T) {
 	el := NewSocketEventLoop(sc)
 	el.sfd = 245
 	el.kq = 375
+	el.clients[495] = NewClient(495)
 
 	events := make([]syscall.Kevent_t, 10)
 	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(495))
@@ -321,7 +438,7 @@ func TestExecuteCfdDisconnected(t *testing.T) {
 
 	err := el.execute()
 	assert.Nil(t, err)
-	assert.Equal(t, 0, len(el.cfds))
+	assert.Equal(t, 0, len(el.clients))
 }
 
 func TestExecuteDisconnected_CloseError(t *testing.T) {
@@ -331,6 +448,7 @@ func TestExecuteDisconnected_CloseError(t *testing.T) {
 	el := NewSocketEventLoop(sc)
 	el.sfd = 245
 	el.kq = 375
+	el.clients[495] = NewClient(495)
 
 	events := make([]syscall.Kevent_t, 10)
 	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(495))
@@ -381,7 +499,7 @@ func TestProcess(t *testing.T) {
 		return 3, nil
 	})
 
-	el.handler = func(sr StringReader) string {
+	el.handler = func(_ *Client, sr StringReader) string {
 		str, err := sr.ReadString('\n')
 		assert.Nil(t, err)
 		assert.Equal(t, "Ch\n", str)
@@ -393,9 +511,14 @@ func TestProcess(t *testing.T) {
 	res := []byte("+OK")
 	sc.EXPECT().Write(455, res).Return(len(res), nil)
 
-	ctd, err := el.process(455)
+	c := NewClient(455)
+	ctd, err := el.process(c)
 	assert.Nil(t, err)
 	assert.Equal(t, true, ctd)
+	assert.Equal(t, 3, c.QueryBufPeak)
+	assert.Equal(t, 3, c.OutputBufPeak)
+	assert.Equal(t, int64(3), el.Stats().NetInputBytes)
+	assert.Equal(t, int64(3), el.Stats().NetOutputBytes)
 }
 
 func TestProcessError_Read(t *testing.T) {
@@ -405,7 +528,7 @@ func TestProcessError_Read(t *testing.T) {
 	el := NewSocketEventLoop(sc)
 	sc.EXPECT().Read(455, gomock.Any()).Return(-1, fmt.Errorf("read error"))
 
-	_, err := el.process(455)
+	_, err := el.process(NewClient(455))
 	assert.NotNil(t, err)
 }
 
@@ -418,7 +541,7 @@ func TestProcessError_ReadRetry(t *testing.T) {
 	sce.EXPECT().Temporary().Return(true)
 	sc.EXPECT().Read(455, gomock.Any()).Return(-1, sce)
 
-	ctd, err := el.process(455)
+	ctd, err := el.process(NewClient(455))
 	assert.Nil(t, err)
 	assert.True(t, ctd)
 }
@@ -430,7 +553,7 @@ func TestProcessError_Disconnected(t *testing.T) {
 	el := NewSocketEventLoop(sc)
 	sc.EXPECT().Read(455, gomock.Any()).Return(0, nil)
 
-	ctd, err := el.process(455)
+	ctd, err := el.process(NewClient(455))
 	assert.Nil(t, err)
 	assert.False(t, ctd)
 }
@@ -442,29 +565,87 @@ func TestProcessError_Write(t *testing.T) {
 	el := NewSocketEventLoop(sc)
 	sc.EXPECT().Read(455, gomock.Any()).Return(3, nil)
 
-	el.handler = func(sr StringReader) string {
+	el.handler = func(_ *Client, sr StringReader) string {
 		return "Ok"
 	}
 	sc.EXPECT().Write(455, gomock.Any()).Return(3, fmt.Errorf("write error"))
 
-	_, err := el.process(455)
+	_, err := el.process(NewClient(455))
 	assert.NotNil(t, err)
 }
 
-func TestProcessError_WriteIncomplete(t *testing.T) {
+func TestProcessWriteIncomplete(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	sc := mocks.NewMockSysCall(ctrl)
 
 	el := NewSocketEventLoop(sc)
+	c := NewClient(455)
+	c.notify = el.addPending
+	el.handler = func(c *Client, sr StringReader) string {
+		c.Push("+pushed\r\n")
+		return "+reply\r\n"
+	}
+
+	// the rest of the reply is written before what was pushed meanwhile
 	sc.EXPECT().Read(455, gomock.Any()).Return(3, nil)
+	sc.EXPECT().Write(455, []byte("+reply\r\n")).Return(2, nil)
+	ctd, err := el.process(c)
+	assert.Nil(t, err)
+	assert.True(t, ctd)
+	assert.Equal(t, "eply\r\n+pushed\r\n", string(c.out))
+	assert.Equal(t, []*Client{c}, el.pending)
 
-	el.handler = func(sr StringReader) string {
-		return "Ok"
+	// the next replies wait for the data not written yet
+	sc.EXPECT().Read(455, gomock.Any()).Return(3, nil)
+	ctd, err = el.process(c)
+	assert.Nil(t, err)
+	assert.True(t, ctd)
+	assert.Equal(t, "eply\r\n+pushed\r\n+reply\r\n+pushed\r\n", string(c.out))
+
+	sc.EXPECT().Write(455, []byte("eply\r\n+pushed\r\n+reply\r\n+pushed\r\n")).Return(32, nil)
+	assert.Nil(t, el.handlePending())
+	assert.Empty(t, el.pending)
+	assert.Nil(t, c.out)
+	assert.Equal(t, int64(34), el.Stats().NetOutputBytes)
+}
+
+func TestProcessWriteWouldBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	c := NewClient(455)
+	el.handler = func(_ *Client, sr StringReader) string {
+		return "+reply\r\n"
 	}
-	sc.EXPECT().Write(455, gomock.Any()).Return(1, nil)
+	sc.EXPECT().Read(455, gomock.Any()).Return(3, nil)
+	sc.EXPECT().Write(455, []byte("+reply\r\n")).Return(-1, syscall.EAGAIN)
+	ctd, err := el.process(c)
+	assert.Nil(t, err)
+	assert.True(t, ctd)
+	assert.Equal(t, "+reply\r\n", string(c.out))
+	assert.Equal(t, []*Client{c}, el.pending)
+}
 
-	_, err := el.process(455)
-	assert.NotNil(t, err)
+func TestClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	assert.Empty(t, el.Clients())
+
+	el.clients[495] = NewClient(495)
+	el.clients[496] = NewClient(496)
+	assert.ElementsMatch(t, []*Client{el.clients[495], el.clients[496]}, el.Clients())
+}
+
+func TestClientMemoryUsage(t *testing.T) {
+	c := NewClient(455)
+	idle := c.MemoryUsage()
+	assert.Greater(t, idle, readBufferSize)
+
+	c.OutputBufPeak = 100
+	assert.Equal(t, idle+100, c.MemoryUsage())
 }
 
 func TestAddKqEvent(t *testing.T) {
@@ -505,3 +686,558 @@ func funcKevent(ident int) func(int, []syscall.Kevent_t, []syscall.Kevent_t, *sy
 		return 1, nil
 	}
 }
+
+func TestResetStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.stats.ConnectionsReceived = 4
+	el.stats.NetInputBytes = 100
+	el.ResetStats()
+	assert.Equal(t, Stats{}, el.Stats())
+}
+
+func TestExecuteCfdHandlesPending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.clients[495] = NewClient(495)
+	monitor := NewClient(496)
+	monitor.notify = el.addPending
+	el.clients[496] = monitor
+	el.handler = func(_ *Client, sr StringReader) string {
+		monitor.Push("+pushed\r\n")
+		return "+OK\r\n"
+	}
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(495))
+	sc.EXPECT().Read(495, gomock.Any()).Return(3, nil)
+	gomock.InOrder(
+		sc.EXPECT().Write(495, []byte("+OK\r\n")).Return(5, nil),
+		sc.EXPECT().Write(496, []byte("+pushed\r\n")).Return(9, nil),
+	)
+
+	err := el.execute()
+	assert.Nil(t, err)
+	assert.Empty(t, el.pending)
+	assert.Empty(t, monitor.out)
+}
+
+func TestProcessEventsWhileBlocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.clients[495] = NewClient(495)
+	el.clients[496] = NewClient(496)
+	var handled []int
+	el.handler = func(c *Client, sr StringReader) string {
+		handled = append(handled, c.Fd)
+		if c.Fd == 495 {
+			// the request of 495 is not handled again meanwhile
+			assert.Nil(t, el.ProcessEventsWhileBlocked())
+		}
+		return "+OK\r\n"
+	}
+
+	events := make([]syscall.Kevent_t, 10)
+	gomock.InOrder(
+		sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(495)),
+		sc.EXPECT().Kevent(375, nil, events, &syscall.Timespec{}).DoAndReturn(
+			func(_ int, _ []syscall.Kevent_t, events []syscall.Kevent_t, _ *syscall.Timespec) (int, error) {
+				events[0].Ident = 495
+				events[1].Ident = 496
+				return 2, nil
+			}),
+	)
+	sc.EXPECT().Read(495, gomock.Any()).Return(3, nil)
+	sc.EXPECT().Read(496, gomock.Any()).Return(3, nil)
+	gomock.InOrder(
+		sc.EXPECT().Write(496, []byte("+OK\r\n")).Return(5, nil),
+		sc.EXPECT().Write(495, []byte("+OK\r\n")).Return(5, nil),
+	)
+
+	err := el.execute()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{495, 496}, handled)
+	assert.False(t, el.clients[495].handling)
+}
+
+func TestHandlePendingPartialWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+	sce := mocks.NewMockSysCallError(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	c := NewClient(496)
+	c.notify = el.addPending
+	el.clients[496] = c
+	c.Push("hello")
+	c.Push(" world")
+
+	sc.EXPECT().Write(496, []byte("hello world")).Return(5, nil)
+	assert.Nil(t, el.handlePending())
+	assert.Equal(t, " world", string(c.out))
+	assert.Equal(t, []*Client{c}, el.pending)
+
+	sce.EXPECT().Temporary().Return(true)
+	sc.EXPECT().Write(496, []byte(" world")).Return(-1, sce)
+	assert.Nil(t, el.handlePending())
+	assert.Equal(t, []*Client{c}, el.pending)
+
+	sc.EXPECT().Write(496, []byte(" world")).Return(6, nil)
+	assert.Nil(t, el.handlePending())
+	assert.Empty(t, el.pending)
+	assert.Equal(t, int64(11), el.Stats().NetOutputBytes)
+}
+
+func TestHandlePendingWriteErrorClosesClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	c := NewClient(496)
+	c.notify = el.addPending
+	el.clients[496] = c
+	c.Push("hello")
+
+	sc.EXPECT().Write(496, []byte("hello")).Return(-1, fmt.Errorf("broken pipe"))
+	sc.EXPECT().Close(496).Return(nil)
+	assert.Nil(t, el.handlePending())
+	assert.True(t, c.Closed())
+	assert.Equal(t, 0, len(el.clients))
+}
+
+func TestHandlePendingCloseAsap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	c := NewClient(496)
+	c.notify = el.addPending
+	el.clients[496] = c
+	c.Push("bye")
+	c.CloseAsap()
+	c.CloseAsap()
+	assert.True(t, c.IsClosing())
+
+	gomock.InOrder(
+		sc.EXPECT().Write(496, []byte("bye")).Return(3, nil),
+		sc.EXPECT().Close(496).Return(nil),
+	)
+	assert.Nil(t, el.handlePending())
+	assert.True(t, c.Closed())
+	assert.Empty(t, el.pending)
+	assert.Equal(t, 0, len(el.clients))
+}
+
+func TestProcessEmptyReply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	sc.EXPECT().Read(455, gomock.Any()).Return(3, nil)
+	el.handler = func(_ *Client, sr StringReader) string {
+		return ""
+	}
+
+	ctd, err := el.process(NewClient(455))
+	assert.Nil(t, err)
+	assert.True(t, ctd)
+}
+
+func TestProcessDeferred(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	c := NewClient(455)
+	c.notify = el.addPending
+	el.clients[455] = c
+
+	paused := true
+	var handled []string
+	el.handler = func(c *Client, sr StringReader) string {
+		str, _ := sr.ReadString('\n')
+		if paused {
+			c.Defer()
+			return ""
+		}
+		handled = append(handled, str)
+		return "+" + str
+	}
+
+	readLine := func(line string) {
+		sc.EXPECT().Read(455, gomock.Any()).DoAndReturn(func(_ int, data []byte) (int, error) {
+			return copy(data, line), nil
+		})
+		_, err := el.process(c)
+		assert.Nil(t, err)
+	}
+	readLine("a\n")
+	readLine("b\n")
+	assert.True(t, c.IsDeferred())
+	assert.Equal(t, []*Client{c}, el.deferred)
+	assert.Equal(t, [][]byte{[]byte("a\n"), []byte("b\n")}, c.deferred)
+
+	// still paused, nothing is replied to
+	assert.Nil(t, el.processDeferred())
+	assert.Equal(t, []*Client{c}, el.deferred)
+	assert.Equal(t, [][]byte{[]byte("a\n"), []byte("b\n")}, c.deferred)
+
+	paused = false
+	gomock.InOrder(
+		sc.EXPECT().Write(455, []byte("+a\n")).Return(3, nil),
+		sc.EXPECT().Write(455, []byte("+b\n")).Return(3, nil),
+	)
+	assert.Nil(t, el.processDeferred())
+	assert.Equal(t, []string{"a\n", "b\n"}, handled)
+	assert.False(t, c.IsDeferred())
+	assert.Empty(t, el.deferred)
+}
+
+func TestExecuteDeferredTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.kq = 375
+	c := NewClient(455)
+	el.clients[455] = c
+	el.handler = func(c *Client, sr StringReader) string {
+		c.Defer()
+		return ""
+	}
+	c.deferred = [][]byte{[]byte("a")}
+	el.deferred = []*Client{c}
+
+	ts := syscall.NsecToTimespec(int64(deferredRetryInterval))
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, &ts).Return(0, nil)
+	assert.Nil(t, el.execute())
+	assert.Equal(t, []*Client{c}, el.deferred)
+}
+
+func TestExecuteSfdEventKeepAlive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.SetKeepAlive(300 * time.Second)
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(245))
+	sc.EXPECT().Accept(245).Return(455, &syscall.SockaddrInet4{}, nil)
+	sc.EXPECT().SetNonblock(455, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(455), nil, nil).Return(0, nil)
+	sc.EXPECT().SetKeepAlive(455, true).Return(nil)
+	sc.EXPECT().SetKeepAlivePeriod(455, 300).Return(nil)
+	sc.EXPECT().Getsockname(455).Return(nil, fmt.Errorf("getsockname error"))
+
+	assert.Nil(t, el.execute())
+	assert.Equal(t, "", el.clients[455].LocalAddr)
+}
+
+func TestExecuteSfdEventKeepAliveError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.SetKeepAlive(time.Second)
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(245))
+	sc.EXPECT().Accept(245).Return(455, &syscall.SockaddrInet4{}, nil)
+	sc.EXPECT().SetNonblock(455, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(455), nil, nil).Return(0, nil)
+	sc.EXPECT().SetKeepAlive(455, true).Return(fmt.Errorf("setsockopt error"))
+	sc.EXPECT().Getsockname(455).Return(&syscall.SockaddrInet4{}, nil)
+
+	// the connection is served without keepalive
+	assert.Nil(t, el.execute())
+	assert.Equal(t, 1, len(el.clients))
+}
+
+func TestClientsCron(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	idle := NewClient(455)
+	idle.LastInteraction = time.Now().Add(-2 * time.Minute)
+	active := NewClient(456)
+	monitor := NewClient(457)
+	monitor.Monitor = true
+	monitor.LastInteraction = idle.LastInteraction
+	blocked := NewClient(458)
+	blocked.LastInteraction = idle.LastInteraction
+	blocked.deferred = [][]byte{[]byte("a")}
+	for _, c := range []*Client{idle, active, monitor, blocked} {
+		el.clients[c.Fd] = c
+	}
+
+	// no idle timeout
+	el.ClientsCron()
+	assert.Equal(t, 4, len(el.clients))
+
+	el.SetIdleTimeout(time.Minute)
+	var closed []*Client
+	el.SetOnClose(func(c *Client) {
+		closed = append(closed, c)
+	})
+	sc.EXPECT().Close(455).Return(fmt.Errorf("close error"))
+	el.ClientsCron()
+	assert.True(t, idle.Closed())
+	assert.Equal(t, 3, len(el.clients))
+	assert.Equal(t, []*Client{idle}, closed)
+}
+
+func TestClientsCronKeepsSubscribers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.SetIdleTimeout(time.Minute)
+	subscriber := NewClient(455)
+	subscriber.Channels = map[string]bool{"news": true}
+	psubscriber := NewClient(456)
+	psubscriber.Patterns = map[string]bool{"news.*": true}
+	for _, c := range []*Client{subscriber, psubscriber} {
+		c.LastInteraction = time.Now().Add(-2 * time.Minute)
+		el.clients[c.Fd] = c
+	}
+
+	el.ClientsCron()
+	assert.Equal(t, 2, len(el.clients))
+
+	// once they unsubscribed, they are idle clients like the others
+	subscriber.Channels = map[string]bool{}
+	sc.EXPECT().Close(455).Return(nil)
+	el.ClientsCron()
+	assert.True(t, subscriber.Closed())
+	assert.False(t, psubscriber.Closed())
+}
+
+func TestAdjustOpenFilesLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.SetMaxClients(100)
+	sc.EXPECT().Getrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).DoAndReturn(func(_ int, lim *syscall.Rlimit) error {
+		lim.Cur = 256
+		return nil
+	})
+	assert.Nil(t, el.adjustOpenFilesLimit())
+	assert.Equal(t, 100, el.MaxClients())
+
+	el.SetMaxClients(1000)
+	sc.EXPECT().Getrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).DoAndReturn(func(_ int, lim *syscall.Rlimit) error {
+		lim.Cur = 256
+		return nil
+	})
+	sc.EXPECT().Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: 1032, Max: 1032}).Return(nil)
+	assert.Nil(t, el.adjustOpenFilesLimit())
+	assert.Equal(t, 1000, el.MaxClients())
+}
+
+func TestAdjustOpenFilesLimitLowersMaxClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.SetMaxClients(1000)
+	sc.EXPECT().Getrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).DoAndReturn(func(_ int, lim *syscall.Rlimit) error {
+		lim.Cur = 256
+		return nil
+	})
+	sc.EXPECT().Setrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).DoAndReturn(func(_ int, lim *syscall.Rlimit) error {
+		if lim.Cur > 600 {
+			return syscall.EPERM
+		}
+		return nil
+	}).MinTimes(2)
+	assert.Nil(t, el.adjustOpenFilesLimit())
+	assert.Equal(t, 600-reservedFds, el.MaxClients())
+
+	// the limit can not be raised at all
+	sc = mocks.NewMockSysCall(ctrl)
+	el = NewSocketEventLoop(sc)
+	el.SetMaxClients(1000)
+	sc.EXPECT().Getrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).DoAndReturn(func(_ int, lim *syscall.Rlimit) error {
+		lim.Cur = 20
+		return nil
+	})
+	sc.EXPECT().Setrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).Return(syscall.EPERM).AnyTimes()
+	assert.NotNil(t, el.adjustOpenFilesLimit())
+}
+
+func TestExecuteSfdEventMaxClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.SetMaxClients(1)
+	el.clients[454] = NewClient(454)
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(245))
+	sc.EXPECT().Accept(245).Return(455, &syscall.SockaddrInet4{}, nil)
+	gomock.InOrder(
+		sc.EXPECT().Write(455, []byte("-ERR max number of clients reached\r\n")).Return(-1, syscall.EAGAIN),
+		sc.EXPECT().Close(455).Return(nil),
+	)
+
+	assert.Nil(t, el.execute())
+	assert.Equal(t, 1, len(el.clients))
+	assert.Equal(t, int64(1), el.Stats().RejectedConnections)
+	assert.Equal(t, int64(0), el.Stats().ConnectionsReceived)
+}
+
+func TestStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.wakeW = 256
+	sc.EXPECT().Write(256, []byte{0}).Return(1, nil)
+	assert.False(t, el.Stopping())
+	el.Stop()
+	el.Stop()
+	assert.True(t, el.Stopping())
+}
+
+func TestExecuteWakeEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.wakeR = 255
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(255))
+	sc.EXPECT().Read(255, gomock.Any()).Return(1, nil)
+	assert.Nil(t, el.execute())
+}
+
+func TestShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	el.wakeR = 255
+	el.wakeW = 256
+	c := NewClient(455)
+	c.notify = el.addPending
+	el.clients[455] = c
+	el.clients[456] = NewClient(456)
+	c.Push("bye")
+
+	gomock.InOrder(
+		sc.EXPECT().Close(245).Return(nil),
+		sc.EXPECT().Write(455, []byte("bye")).Return(3, nil),
+	)
+	sc.EXPECT().Close(455).Return(nil)
+	sc.EXPECT().Close(456).Return(fmt.Errorf("close error"))
+	sc.EXPECT().Close(255).Return(nil)
+	sc.EXPECT().Close(256).Return(nil)
+	sc.EXPECT().Close(375).Return(nil)
+
+	err := el.shutdown()
+	assert.Equal(t, "close error", err.Error())
+	assert.Equal(t, 0, len(el.clients))
+	assert.True(t, c.Closed())
+}
+
+func TestChangePort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.sfd = 245
+	el.kq = 375
+	assert.Nil(t, el.ChangePort(Port))
+
+	sa := syscall.SockaddrInet4{Port: 6400}
+	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
+	sc.EXPECT().Bind(254, &sa).Return(nil)
+	sc.EXPECT().Listen(254, 50).Return(nil)
+	sc.EXPECT().SetNonblock(254, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(254), nil, nil).Return(0, nil)
+	sc.EXPECT().Close(245).Return(nil)
+	assert.Nil(t, el.ChangePort(6400))
+	assert.Equal(t, 254, el.sfd)
+
+	// the port in use is kept when the new one is taken
+	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(255, nil)
+	sc.EXPECT().SetReuseAddr(255).Return(nil)
+	sc.EXPECT().Bind(255, gomock.Any()).Return(syscall.EADDRINUSE)
+	sc.EXPECT().Close(255).Return(nil)
+	assert.Equal(t, syscall.EADDRINUSE, el.ChangePort(6401))
+	assert.Equal(t, 254, el.sfd)
+	assert.Equal(t, 6400, el.port)
+
+	sc.EXPECT().Close(254).Return(nil)
+	assert.Nil(t, el.ChangePort(0))
+	assert.Equal(t, 0, el.port)
+}
+
+func TestChangeTls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.kq = 375
+	config := &tls.Config{}
+	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(257, nil)
+	sc.EXPECT().SetReuseAddr(257).Return(nil)
+	sc.EXPECT().Bind(257, &syscall.SockaddrInet4{Port: 6380}).Return(nil)
+	sc.EXPECT().Listen(257, 50).Return(nil)
+	sc.EXPECT().SetNonblock(257, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(257), nil, nil).Return(0, nil)
+	assert.Nil(t, el.ChangeTls(6380, config))
+	assert.Equal(t, 257, el.tfd)
+	assert.Equal(t, config, el.tlsConfig)
+
+	sc.EXPECT().Close(257).Return(nil)
+	assert.Nil(t, el.ChangeTls(0, nil))
+	assert.Equal(t, 0, el.tlsPort)
+	assert.Equal(t, config, el.tlsConfig)
+}
+
+func TestChangeMaxClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.SetMaxClients(100)
+	sc.EXPECT().Getrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).DoAndReturn(func(_ int, lim *syscall.Rlimit) error {
+		lim.Cur = 256
+		return nil
+	}).Times(2)
+	assert.Nil(t, el.ChangeMaxClients(200))
+	assert.Equal(t, 200, el.MaxClients())
+
+	sc.EXPECT().Setrlimit(syscall.RLIMIT_NOFILE, gomock.Any()).Return(syscall.EPERM).AnyTimes()
+	assert.EqualError(t, el.ChangeMaxClients(1000),
+		"the operating system is not able to handle the specified number of clients, try with 224")
+	assert.Equal(t, 200, el.MaxClients())
+}
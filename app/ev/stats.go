@@ -0,0 +1,10 @@
+package ev
+
+// Stats are the counters kept by the event loop.
+type Stats struct {
+	ConnectionsReceived int64
+	// RejectedConnections were closed because of maxclients
+	RejectedConnections int64
+	NetInputBytes       int64
+	NetOutputBytes      int64
+}
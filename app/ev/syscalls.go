@@ -2,6 +2,13 @@ package ev
 
 import "syscall"
 
+// The syscall package only defines these for darwin on arm64, the values
+// are those of netinet/tcp.h.
+const (
+	tcpKeepIntvl = 0x101
+	tcpKeepCnt   = 0x102
+)
+
 type Syscalls struct{}
 
 func (*Syscalls) Socket(domain, typ, proto int) (int, error) {
@@ -36,6 +43,53 @@ func (*Syscalls) Close(fd int) error {
 	return syscall.Close(fd)
 }
 
+func (*Syscalls) Getsockname(fd int) (syscall.Sockaddr, error) {
+	return syscall.Getsockname(fd)
+}
+
+func (*Syscalls) SetReuseAddr(fd int) error {
+	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+}
+
+func (*Syscalls) SetKeepAlive(fd int, keepalive bool) error {
+	on := 0
+	if keepalive {
+		on = 1
+	}
+	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, on)
+}
+
+// SetKeepAlivePeriod sets the idle time before the first probe, then like
+// redis sends the probes a third of that apart and gives up after three.
+// TCP_KEEPALIVE is what darwin calls TCP_KEEPIDLE.
+func (*Syscalls) SetKeepAlivePeriod(fd int, secs int) error {
+	err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPALIVE, secs)
+	if err != nil {
+		return err
+	}
+	intvl := secs / 3
+	if intvl == 0 {
+		intvl = 1
+	}
+	err = syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpKeepIntvl, intvl)
+	if err != nil {
+		return err
+	}
+	return syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpKeepCnt, 3)
+}
+
+func (*Syscalls) Getrlimit(resource int, rlim *syscall.Rlimit) error {
+	return syscall.Getrlimit(resource, rlim)
+}
+
+func (*Syscalls) Setrlimit(resource int, rlim *syscall.Rlimit) error {
+	return syscall.Setrlimit(resource, rlim)
+}
+
+func (*Syscalls) Pipe(p []int) error {
+	return syscall.Pipe(p)
+}
+
 func (*Syscalls) Kqueue() (int, error) {
 	return syscall.Kqueue()
 }
@@ -0,0 +1,139 @@
+package ev
+
+import (
+	"container/heap"
+	"syscall"
+	"time"
+)
+
+// timer runs fn on the loop once its deadline passes. A periodic timer is
+// then scheduled again period later, until it is cancelled.
+type timer struct {
+	id     int64
+	when   time.Time
+	period time.Duration
+	fn     func()
+	// index is the position in the heap, -1 once removed
+	index int
+}
+
+// timerHeap is a min-heap of timers by deadline, see container/heap.
+type timerHeap []*timer
+
+func (h timerHeap) Len() int {
+	return len(h)
+}
+
+func (h timerHeap) Less(i, j int) bool {
+	return h[i].when.Before(h[j].when)
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
+
+// AddTimer runs fn on the loop once, after d, and returns the id to
+// cancel it with.
+func (el *SocketEventLoop) AddTimer(d time.Duration, fn func()) int64 {
+	return el.addTimer(d, 0, fn)
+}
+
+// AddPeriodicTimer runs fn on the loop every period until it is cancelled,
+// and returns the id to cancel it with.
+func (el *SocketEventLoop) AddPeriodicTimer(period time.Duration, fn func()) int64 {
+	return el.addTimer(period, period, fn)
+}
+
+func (el *SocketEventLoop) addTimer(d time.Duration, period time.Duration, fn func()) int64 {
+	el.nextTimerId++
+	t := &timer{
+		id:     el.nextTimerId,
+		when:   time.Now().Add(d),
+		period: period,
+		fn:     fn,
+	}
+	heap.Push(&el.timers, t)
+	return t.id
+}
+
+// CancelTimer stops the timer from running again, and reports whether
+// there was such a timer. A timer may cancel itself, or any other, while
+// it runs.
+func (el *SocketEventLoop) CancelTimer(id int64) bool {
+	for _, t := range el.timers {
+		if t.id == id {
+			heap.Remove(&el.timers, t.index)
+			return true
+		}
+	}
+	for i, t := range el.laterTimers {
+		if t.id == id {
+			el.laterTimers = append(el.laterTimers[:i], el.laterTimers[i+1:]...)
+			return true
+		}
+	}
+	if el.runningTimer != nil && el.runningTimer.id == id {
+		el.runningTimer.period = 0
+		return true
+	}
+	return false
+}
+
+// processTimers runs the timers whose deadline passed. The timers they
+// add wait for the next time, so that a timer adding itself again can
+// not keep the loop from serving the connections.
+func (el *SocketEventLoop) processTimers(now time.Time) {
+	maxId := el.nextTimerId
+	for len(el.timers) > 0 && !el.timers[0].when.After(now) {
+		t := heap.Pop(&el.timers).(*timer)
+		if t.id > maxId {
+			el.laterTimers = append(el.laterTimers, t)
+			continue
+		}
+
+		el.runningTimer = t
+		t.fn()
+		el.runningTimer = nil
+		if t.period > 0 {
+			// scheduled from now rather than from the deadline, so that a
+			// late timer does not run several times in a row to catch up
+			t.when = now.Add(t.period)
+			el.laterTimers = append(el.laterTimers, t)
+		}
+	}
+	for _, t := range el.laterTimers {
+		heap.Push(&el.timers, t)
+	}
+	el.laterTimers = nil
+}
+
+// timersTimeout is how long the loop can wait for events before the next
+// timer is due, or nil when there are no timers.
+func (el *SocketEventLoop) timersTimeout(now time.Time) *syscall.Timespec {
+	if len(el.timers) == 0 {
+		return nil
+	}
+	d := el.timers[0].when.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	ts := syscall.NsecToTimespec(int64(d))
+	return &ts
+}
@@ -0,0 +1,135 @@
+package ev
+
+import (
+	"redis-go/app/mocks"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimersRunInOrder(t *testing.T) {
+	el := NewSocketEventLoop(nil)
+	var ran []string
+	el.AddTimer(30*time.Millisecond, func() { ran = append(ran, "c") })
+	el.AddTimer(10*time.Millisecond, func() { ran = append(ran, "a") })
+	el.AddTimer(20*time.Millisecond, func() { ran = append(ran, "b") })
+	el.AddTimer(time.Hour, func() { ran = append(ran, "later") })
+
+	el.processTimers(time.Now())
+	assert.Empty(t, ran)
+
+	el.processTimers(time.Now().Add(time.Second))
+	assert.Equal(t, []string{"a", "b", "c"}, ran)
+	assert.Equal(t, 1, len(el.timers))
+}
+
+func TestPeriodicTimer(t *testing.T) {
+	el := NewSocketEventLoop(nil)
+	runs := 0
+	id := el.AddPeriodicTimer(100*time.Millisecond, func() { runs++ })
+
+	now := time.Now()
+	el.processTimers(now.Add(100 * time.Millisecond))
+	assert.Equal(t, 1, runs)
+	// a late timer runs once, then period after that
+	el.processTimers(now.Add(time.Second))
+	assert.Equal(t, 2, runs)
+	el.processTimers(now.Add(1050 * time.Millisecond))
+	assert.Equal(t, 2, runs)
+	el.processTimers(now.Add(1100 * time.Millisecond))
+	assert.Equal(t, 3, runs)
+
+	assert.True(t, el.CancelTimer(id))
+	assert.False(t, el.CancelTimer(id))
+	el.processTimers(now.Add(time.Hour))
+	assert.Equal(t, 3, runs)
+}
+
+func TestTimerCancelsItself(t *testing.T) {
+	el := NewSocketEventLoop(nil)
+	runs := 0
+	var id int64
+	id = el.AddPeriodicTimer(time.Millisecond, func() {
+		runs++
+		assert.True(t, el.CancelTimer(id))
+	})
+	el.processTimers(time.Now().Add(time.Second))
+	el.processTimers(time.Now().Add(time.Hour))
+	assert.Equal(t, 1, runs)
+	assert.Empty(t, el.timers)
+}
+
+func TestTimerCancelsOthers(t *testing.T) {
+	el := NewSocketEventLoop(nil)
+	var ran []string
+	periodic := el.AddPeriodicTimer(time.Millisecond, func() { ran = append(ran, "periodic") })
+	var added int64
+	el.AddTimer(2*time.Millisecond, func() {
+		ran = append(ran, "adder")
+		added = el.AddTimer(0, func() { ran = append(ran, "added") })
+	})
+	el.AddTimer(3*time.Millisecond, func() {
+		ran = append(ran, "canceller")
+		// the periodic timer already ran in this pass, and the added one
+		// is due but waits for the next pass
+		assert.True(t, el.CancelTimer(periodic))
+		assert.True(t, el.CancelTimer(added))
+	})
+
+	el.processTimers(time.Now().Add(time.Second))
+	el.processTimers(time.Now().Add(time.Hour))
+	assert.Equal(t, []string{"periodic", "adder", "canceller"}, ran)
+	assert.Empty(t, el.timers)
+}
+
+func TestTimerAddedByTimerWaits(t *testing.T) {
+	el := NewSocketEventLoop(nil)
+	runs := 0
+	var add func()
+	add = func() {
+		runs++
+		el.AddTimer(0, add)
+	}
+	el.AddTimer(0, add)
+
+	el.processTimers(time.Now().Add(time.Second))
+	assert.Equal(t, 1, runs)
+	el.processTimers(time.Now().Add(time.Second))
+	assert.Equal(t, 2, runs)
+}
+
+func TestTimersTimeout(t *testing.T) {
+	el := NewSocketEventLoop(nil)
+	now := time.Now()
+	assert.Nil(t, el.timersTimeout(now))
+
+	el.AddTimer(time.Hour, func() {})
+	el.AddTimer(time.Second, func() {})
+	ts := el.timersTimeout(now)
+	assert.InDelta(t, int64(time.Second), ts.Nano(), float64(100*time.Millisecond))
+
+	assert.Equal(t, syscall.Timespec{}, *el.timersTimeout(now.Add(time.Minute)))
+}
+
+func TestExecuteTimers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.kq = 375
+	c := NewClient(455)
+	c.notify = el.addPending
+	el.clients[455] = c
+	el.AddTimer(0, func() {
+		c.Push("+tick\r\n")
+	})
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, &syscall.Timespec{}).Return(0, nil)
+	sc.EXPECT().Write(455, []byte("+tick\r\n")).Return(7, nil)
+	assert.Nil(t, el.execute())
+	assert.Empty(t, el.timers)
+}
@@ -0,0 +1,200 @@
+package ev
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// errTlsWouldBlock is returned by the reads of tlsTransport once there is
+// nothing left to read. It is a temporary net.Error, so that crypto/tls
+// keeps the partial record it read and the read can be resumed once the
+// socket is readable again.
+var errTlsWouldBlock = &tlsWouldBlockError{}
+
+type tlsWouldBlockError struct{}
+
+func (e *tlsWouldBlockError) Error() string   { return "tls: read would block" }
+func (e *tlsWouldBlockError) Timeout() bool   { return true }
+func (e *tlsWouldBlockError) Temporary() bool { return true }
+
+// tlsHandshakeTimeout is how long a TLS client has to complete its
+// handshake before ClientsCron closes it, which also ends the goroutine of
+// the handshake, whether the idle timeout is set or not.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// tlsState is where a TLS connection is in its life.
+type tlsState int
+
+const (
+	// tlsHandshaking connections feed what they read to the handshake
+	tlsHandshaking tlsState = iota
+	// tlsEstablished connections read and write records on the loop
+	tlsEstablished
+	// tlsFailed connections are to be closed
+	tlsFailed
+)
+
+// tlsTransport is the net.Conn crypto/tls runs over. It holds the bytes
+// the loop reads from the socket until crypto/tls takes them, and the bytes
+// crypto/tls writes until the loop writes them to the socket.
+type tlsTransport struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	in   bytes.Buffer
+	out  bytes.Buffer
+	// blocking reads wait for the loop to feed data rather than return
+	// errTlsWouldBlock, which is needed while the handshake runs
+	blocking bool
+	closed   bool
+	// wake tells the loop there is output to flush or that the handshake
+	// is done, when they happen on the handshake goroutine
+	wake func()
+}
+
+func newTlsTransport(wake func()) *tlsTransport {
+	t := &tlsTransport{blocking: true, wake: wake}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *tlsTransport) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.in.Len() == 0 {
+		if t.closed {
+			return 0, io.EOF
+		}
+		if !t.blocking {
+			return 0, errTlsWouldBlock
+		}
+		t.cond.Wait()
+	}
+	return t.in.Read(p)
+}
+
+func (t *tlsTransport) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	t.out.Write(p)
+	blocking := t.blocking
+	t.mu.Unlock()
+	if blocking {
+		t.wake()
+	}
+	return len(p), nil
+}
+
+// Close makes the reads fail, which ends a handshake waiting for data.
+func (t *tlsTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.cond.Broadcast()
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *tlsTransport) LocalAddr() net.Addr              { return nil }
+func (t *tlsTransport) RemoteAddr() net.Addr             { return nil }
+func (t *tlsTransport) SetDeadline(time.Time) error      { return nil }
+func (t *tlsTransport) SetReadDeadline(time.Time) error  { return nil }
+func (t *tlsTransport) SetWriteDeadline(time.Time) error { return nil }
+
+// feed hands over data read from the socket.
+func (t *tlsTransport) feed(data []byte) {
+	t.mu.Lock()
+	t.in.Write(data)
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// output returns a copy of the data to write to the socket, which stays
+// there until consumed.
+func (t *tlsTransport) output() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte{}, t.out.Bytes()...)
+}
+
+func (t *tlsTransport) consume(n int) {
+	t.mu.Lock()
+	t.out.Next(n)
+	t.mu.Unlock()
+}
+
+// tlsConn is the TLS layer of a client. The handshake of crypto/tls can
+// not be resumed once a read failed, so it runs on a goroutine of its own,
+// with blocking reads the loop feeds as the socket is readable. Once done,
+// the loop reads and writes the records itself, and the reads that would
+// block are resumed later.
+type tlsConn struct {
+	conn      *tls.Conn
+	transport *tlsTransport
+	// state and err are set by the handshake goroutine, and read by the
+	// loop under the lock of the transport
+	state tlsState
+	err   error
+}
+
+// newTlsConn starts the server side handshake, wake being called when the
+// loop has something to do for it.
+func newTlsConn(config *tls.Config, wake func()) *tlsConn {
+	t := newTlsTransport(wake)
+	c := &tlsConn{
+		conn:      tls.Server(t, config),
+		transport: t,
+	}
+	go c.handshake()
+	return c
+}
+
+func (c *tlsConn) handshake() {
+	err := c.conn.Handshake()
+	t := c.transport
+	t.mu.Lock()
+	t.blocking = false
+	if err != nil {
+		c.state = tlsFailed
+		c.err = err
+	} else {
+		c.state = tlsEstablished
+	}
+	t.mu.Unlock()
+	t.wake()
+}
+
+// handshakeState reports the state of the connection, and the reason the
+// handshake failed if it did.
+func (c *tlsConn) handshakeState() (tlsState, error) {
+	c.transport.mu.Lock()
+	defer c.transport.mu.Unlock()
+	return c.state, c.err
+}
+
+// read decrypts what the records fed so far hold, and reports whether the
+// connection can go on.
+func (c *tlsConn) read() ([]byte, error) {
+	var data []byte
+	buf := make([]byte, readBufferSize)
+	for {
+		n, err := c.conn.Read(buf)
+		data = append(data, buf[:n]...)
+		if errors.Is(err, errTlsWouldBlock) {
+			return data, nil
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+}
+
+func (c *tlsConn) close() {
+	c.transport.Close()
+}
@@ -0,0 +1,290 @@
+package ev
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"redis-go/app/mocks"
+	"syscall"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCertificate returns a self-signed certificate for localhost, and
+// the pool a client trusts it with.
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// waitHandshake waits for the handshake goroutine to be done.
+func waitHandshake(t *testing.T, c *tlsConn) tlsState {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if state, _ := c.handshakeState(); state != tlsHandshaking {
+			return state
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("handshake not done")
+	return tlsHandshaking
+}
+
+func TestTlsTransport(t *testing.T) {
+	woken := 0
+	tr := newTlsTransport(func() { woken++ })
+	tr.Write([]byte("hello"))
+	assert.Equal(t, 1, woken)
+	assert.Equal(t, []byte("hello"), tr.output())
+	tr.consume(2)
+	assert.Equal(t, []byte("llo"), tr.output())
+
+	tr.feed([]byte("data"))
+	buf := make([]byte, 10)
+	n, err := tr.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "data", string(buf[:n]))
+
+	// once the handshake is done, reads do not wait for data
+	tr.blocking = false
+	_, err = tr.Read(buf)
+	assert.Equal(t, errTlsWouldBlock, err)
+	tr.Write([]byte("!"))
+	assert.Equal(t, 1, woken)
+
+	tr.Close()
+	_, err = tr.Read(buf)
+	assert.NotNil(t, err)
+	_, err = tr.Write([]byte("x"))
+	assert.NotNil(t, err)
+}
+
+func TestTlsConnCloseEndsHandshake(t *testing.T) {
+	cert, _ := newTestCertificate(t)
+	c := newTlsConn(&tls.Config{Certificates: []tls.Certificate{cert}}, func() {})
+	c.close()
+	assert.Equal(t, tlsFailed, waitHandshake(t, c))
+	_, err := c.handshakeState()
+	assert.NotNil(t, err)
+}
+
+func TestTlsConnHandshakeFailure(t *testing.T) {
+	cert, _ := newTestCertificate(t)
+	c := newTlsConn(&tls.Config{Certificates: []tls.Certificate{cert}}, func() {})
+	// not a ClientHello
+	c.transport.feed([]byte("*1\r\n$4\r\nPING\r\n"))
+	assert.Equal(t, tlsFailed, waitHandshake(t, c))
+}
+
+func TestClientsCronClosesSlowHandshakes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	cert, _ := newTestCertificate(t)
+	el := NewSocketEventLoop(sc)
+	slow := NewClient(455)
+	slow.Created = time.Now().Add(-tlsHandshakeTimeout - time.Second)
+	fresh := NewClient(456)
+	for _, c := range []*Client{slow, fresh} {
+		c.tls = newTlsConn(&tls.Config{Certificates: []tls.Certificate{cert}}, func() {})
+		el.clients[c.Fd] = c
+		el.handshakes[c.Fd] = c
+	}
+
+	// without an idle timeout too
+	sc.EXPECT().Close(455).Return(nil)
+	el.ClientsCron()
+	assert.True(t, slow.Closed())
+	assert.Equal(t, tlsFailed, waitHandshake(t, slow.tls))
+	assert.False(t, fresh.Closed())
+	assert.Equal(t, map[int]*Client{456: fresh}, el.handshakes)
+	fresh.tls.close()
+}
+
+// TestTlsClient runs a crypto/tls client against a client of the loop, over
+// a socket pair standing for the accepted connection.
+func TestTlsClient(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, syscall.SetNonblock(fds[0], true))
+	f := os.NewFile(uintptr(fds[1]), "client")
+	nc, err := net.FileConn(f)
+	assert.Nil(t, err)
+	f.Close()
+	defer nc.Close()
+
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+	woken := make(chan struct{}, 100)
+	sc.EXPECT().Read(fds[0], gomock.Any()).DoAndReturn(syscall.Read).AnyTimes()
+	sc.EXPECT().Write(fds[0], gomock.Any()).DoAndReturn(syscall.Write).AnyTimes()
+	sc.EXPECT().Write(999, gomock.Any()).DoAndReturn(func(int, []byte) (int, error) {
+		woken <- struct{}{}
+		return 1, nil
+	}).AnyTimes()
+	sc.EXPECT().Close(fds[0]).DoAndReturn(syscall.Close)
+
+	cert, pool := newTestCertificate(t)
+	el := NewSocketEventLoop(sc)
+	el.wakeW = 999
+	el.handler = func(c *Client, sr StringReader) string {
+		return "+PONG\r\n"
+	}
+	c := NewClient(fds[0])
+	c.tls = newTlsConn(&tls.Config{Certificates: []tls.Certificate{cert}}, el.wake)
+	el.clients[c.Fd] = c
+	el.handshakes[c.Fd] = c
+
+	client := tls.Client(nc, &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	done := make(chan error, 1)
+	go func() {
+		if err := client.Handshake(); err != nil {
+			done <- err
+			return
+		}
+		if _, err := client.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+			done <- err
+			return
+		}
+		buf := make([]byte, 100)
+		n, err := client.Read(buf)
+		if err == nil && string(buf[:n]) != "+PONG\r\n" {
+			err = assert.AnError
+		}
+		done <- err
+	}()
+
+	// stands for the loop: handle the wakes of the handshake, and the data
+	// the client sends
+	deadline := time.After(5 * time.Second)
+loop:
+	for {
+		select {
+		case <-woken:
+			assert.Nil(t, el.processHandshakes())
+		case err := <-done:
+			assert.Nil(t, err)
+			break loop
+		case <-deadline:
+			t.Fatal("no reply")
+		case <-time.After(time.Millisecond):
+			ctd, err := el.process(c)
+			assert.True(t, ctd)
+			assert.Nil(t, err)
+		}
+	}
+	assert.Empty(t, el.handshakes)
+	assert.Equal(t, int64(len("*1\r\n$4\r\nPING\r\n")), el.Stats().NetInputBytes)
+	assert.Equal(t, int64(len("+PONG\r\n")), el.Stats().NetOutputBytes)
+
+	assert.Nil(t, el.closeClient(c))
+	assert.True(t, c.closed)
+}
+
+func TestCreateTls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.SetTls(6380, &tls.Config{})
+	tsa := syscall.SockaddrInet4{Port: 6380}
+
+	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(254, nil)
+	sc.EXPECT().SetReuseAddr(254).Return(nil)
+	sc.EXPECT().Bind(254, gomock.Any()).Return(nil)
+	sc.EXPECT().Listen(254, 50).Return(nil)
+	sc.EXPECT().SetNonblock(254, true).Return(nil)
+	sc.EXPECT().Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0).Return(257, nil)
+	sc.EXPECT().SetReuseAddr(257).Return(nil)
+	sc.EXPECT().Bind(257, &tsa).Return(nil)
+	sc.EXPECT().Listen(257, 50).Return(nil)
+	sc.EXPECT().SetNonblock(257, true).Return(nil)
+	sc.EXPECT().Kqueue().Return(375, nil)
+	sc.EXPECT().Kevent(375, eventsFor(254), nil, nil).Return(0, nil)
+	sc.EXPECT().Kevent(375, eventsFor(257), nil, nil).Return(0, nil)
+	sc.EXPECT().Pipe(gomock.Len(2)).DoAndReturn(funcPipe(255, 256))
+	sc.EXPECT().SetNonblock(255, true).Return(nil)
+	sc.EXPECT().SetNonblock(256, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(255), nil, nil).Return(0, nil)
+
+	assert.Nil(t, el.create())
+	assert.Equal(t, 254, el.sfd)
+	assert.Equal(t, 257, el.tfd)
+}
+
+func TestExecuteTlsAccept(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	cert, _ := newTestCertificate(t)
+	el := NewSocketEventLoop(sc)
+	el.SetTls(6380, &tls.Config{Certificates: []tls.Certificate{cert}})
+	el.sfd = 245
+	el.tfd = 246
+	el.kq = 375
+
+	events := make([]syscall.Kevent_t, 10)
+	sc.EXPECT().Kevent(375, nil, events, nil).DoAndReturn(funcKevent(246))
+	sa := &syscall.SockaddrInet4{Port: 51234, Addr: [4]byte{127, 0, 0, 1}}
+	sc.EXPECT().Accept(246).Return(455, sa, nil)
+	sc.EXPECT().SetNonblock(455, true).Return(nil)
+	sc.EXPECT().Kevent(375, eventsFor(455), nil, nil).Return(0, nil)
+	sc.EXPECT().Getsockname(455).Return(sa, nil)
+
+	assert.Nil(t, el.execute())
+	c := el.clients[455]
+	assert.NotNil(t, c.tls)
+	assert.Equal(t, c, el.handshakes[455])
+
+	// closing the client ends the handshake waiting for data
+	sc.EXPECT().Close(455).Return(nil)
+	assert.Nil(t, el.closeClient(c))
+	assert.Empty(t, el.handshakes)
+	assert.Equal(t, tlsFailed, waitHandshake(t, c.tls))
+}
+
+func TestAcceptTlsMaxClients(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	sc := mocks.NewMockSysCall(ctrl)
+
+	el := NewSocketEventLoop(sc)
+	el.SetTls(6380, &tls.Config{})
+	el.SetMaxClients(1)
+	el.sfd = 245
+	el.tfd = 246
+	el.clients[455] = NewClient(455)
+
+	// no plain text error to a TLS client
+	sc.EXPECT().Accept(246).Return(456, nil, nil)
+	sc.EXPECT().Close(456).Return(nil)
+	assert.Nil(t, el.accept(246))
+	assert.Equal(t, int64(1), el.Stats().RejectedConnections)
+}
@@ -78,6 +78,35 @@ func (mr *MockSysCallMockRecorder) Close(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockSysCall)(nil).Close), arg0)
 }
 
+// Getrlimit mocks base method.
+func (m *MockSysCall) Getrlimit(arg0 int, arg1 *syscall.Rlimit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Getrlimit", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Getrlimit indicates an expected call of Getrlimit.
+func (mr *MockSysCallMockRecorder) Getrlimit(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Getrlimit", reflect.TypeOf((*MockSysCall)(nil).Getrlimit), arg0, arg1)
+}
+
+// Getsockname mocks base method.
+func (m *MockSysCall) Getsockname(arg0 int) (syscall.Sockaddr, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Getsockname", arg0)
+	ret0, _ := ret[0].(syscall.Sockaddr)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Getsockname indicates an expected call of Getsockname.
+func (mr *MockSysCallMockRecorder) Getsockname(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Getsockname", reflect.TypeOf((*MockSysCall)(nil).Getsockname), arg0)
+}
+
 // Kevent mocks base method.
 func (m *MockSysCall) Kevent(arg0 int, arg1, arg2 []syscall.Kevent_t, arg3 *syscall.Timespec) (int, error) {
 	m.ctrl.T.Helper()
@@ -122,6 +151,20 @@ func (mr *MockSysCallMockRecorder) Listen(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Listen", reflect.TypeOf((*MockSysCall)(nil).Listen), arg0, arg1)
 }
 
+// Pipe mocks base method.
+func (m *MockSysCall) Pipe(arg0 []int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pipe", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Pipe indicates an expected call of Pipe.
+func (mr *MockSysCallMockRecorder) Pipe(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pipe", reflect.TypeOf((*MockSysCall)(nil).Pipe), arg0)
+}
+
 // Read mocks base method.
 func (m *MockSysCall) Read(arg0 int, arg1 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -137,6 +180,34 @@ func (mr *MockSysCallMockRecorder) Read(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockSysCall)(nil).Read), arg0, arg1)
 }
 
+// SetKeepAlive mocks base method.
+func (m *MockSysCall) SetKeepAlive(arg0 int, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetKeepAlive", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetKeepAlive indicates an expected call of SetKeepAlive.
+func (mr *MockSysCallMockRecorder) SetKeepAlive(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetKeepAlive", reflect.TypeOf((*MockSysCall)(nil).SetKeepAlive), arg0, arg1)
+}
+
+// SetKeepAlivePeriod mocks base method.
+func (m *MockSysCall) SetKeepAlivePeriod(arg0, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetKeepAlivePeriod", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetKeepAlivePeriod indicates an expected call of SetKeepAlivePeriod.
+func (mr *MockSysCallMockRecorder) SetKeepAlivePeriod(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetKeepAlivePeriod", reflect.TypeOf((*MockSysCall)(nil).SetKeepAlivePeriod), arg0, arg1)
+}
+
 // SetNonblock mocks base method.
 func (m *MockSysCall) SetNonblock(arg0 int, arg1 bool) error {
 	m.ctrl.T.Helper()
@@ -151,6 +222,34 @@ func (mr *MockSysCallMockRecorder) SetNonblock(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNonblock", reflect.TypeOf((*MockSysCall)(nil).SetNonblock), arg0, arg1)
 }
 
+// SetReuseAddr mocks base method.
+func (m *MockSysCall) SetReuseAddr(arg0 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReuseAddr", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetReuseAddr indicates an expected call of SetReuseAddr.
+func (mr *MockSysCallMockRecorder) SetReuseAddr(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReuseAddr", reflect.TypeOf((*MockSysCall)(nil).SetReuseAddr), arg0)
+}
+
+// Setrlimit mocks base method.
+func (m *MockSysCall) Setrlimit(arg0 int, arg1 *syscall.Rlimit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Setrlimit", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Setrlimit indicates an expected call of Setrlimit.
+func (mr *MockSysCallMockRecorder) Setrlimit(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Setrlimit", reflect.TypeOf((*MockSysCall)(nil).Setrlimit), arg0, arg1)
+}
+
 // Socket mocks base method.
 func (m *MockSysCall) Socket(arg0, arg1, arg2 int) (int, error) {
 	m.ctrl.T.Helper()
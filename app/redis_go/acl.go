@@ -0,0 +1,687 @@
+package redis_go
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"redis-go/app/ev"
+	"sort"
+	"strings"
+	"time"
+)
+
+// aclLogGroupingMaxDelta is how recent an entry of the ACL log has to be
+// for a similar denial to be counted in it rather than logged again.
+const aclLogGroupingMaxDelta = 60 * time.Second
+
+var (
+	errAclSyntax         = errors.New("Syntax error")
+	errAclUnknownCommand = errors.New("Unknown command or category name in ACL")
+	errAclPasswordHash   = errors.New("The password hash must be exactly 64 characters " +
+		"and contain only lowercase hexadecimal characters")
+	errAclNoSuchPassword = errors.New("The password you are trying to remove from the user does not exist")
+	errAclAfterAllKeys   = errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) " +
+		"is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	errAclAfterAllChannels = errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) " +
+		"is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+)
+
+// aclDenial is why the ACL refuses a command to a user.
+type aclDenial int
+
+const (
+	aclAllowed aclDenial = iota
+	aclDeniedCommand
+	aclDeniedKey
+	aclDeniedChannel
+)
+
+// aclKeyPattern grants the read accesses, the write accesses or both to
+// the keys matching the pattern.
+type aclKeyPattern struct {
+	pattern string
+	read    bool
+	write   bool
+}
+
+func (p aclKeyPattern) String() string {
+	switch {
+	case p.read && p.write:
+		return "~" + p.pattern
+	case p.read:
+		return "%R~" + p.pattern
+	}
+	return "%W~" + p.pattern
+}
+
+// aclUser is a user of the ACL, set by the rules of ACL SETUSER.
+type aclUser struct {
+	name    string
+	enabled bool
+	// nopass users authenticate with any password
+	nopass bool
+	// passwords are the hex encoded SHA-256 hashes of the passwords
+	passwords []string
+	// allowed are the commands the user can run, and subcommands the
+	// exceptions made for single subcommands, true when allowed
+	allowed     map[string]bool
+	subcommands map[string]map[string]bool
+	// commandRules are the command rules applied since the last +@all or
+	// -@all, which is how the commands allowed are described
+	commandRules []string
+	keys         []aclKeyPattern
+	channels     []string
+}
+
+// newAclUser creates a user as ACL SETUSER does: disabled, without
+// passwords and allowed nothing.
+func newAclUser(name string) *aclUser {
+	return &aclUser{
+		name:         name,
+		allowed:      map[string]bool{},
+		subcommands:  map[string]map[string]bool{},
+		commandRules: []string{"-@all"},
+	}
+}
+
+// newDefaultAclUser creates the default user, which the connections are
+// authenticated as from the start, allowed everything.
+func newDefaultAclUser() *aclUser {
+	u := newAclUser(defaultUser)
+	for _, rule := range []string{"on", "nopass", "~*", "&*", "+@all"} {
+		u.setRule(rule)
+	}
+	return u
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = append([]string{}, u.passwords...)
+	c.allowed = map[string]bool{}
+	for name := range u.allowed {
+		c.allowed[name] = true
+	}
+	c.subcommands = map[string]map[string]bool{}
+	for name, subs := range u.subcommands {
+		c.subcommands[name] = map[string]bool{}
+		for sub, allow := range subs {
+			c.subcommands[name][sub] = allow
+		}
+	}
+	c.commandRules = append([]string{}, u.commandRules...)
+	c.keys = append([]aclKeyPattern{}, u.keys...)
+	c.channels = append([]string{}, u.channels...)
+	return &c
+}
+
+func hashPassword(pass string) string {
+	h := sha256.Sum256([]byte(pass))
+	return hex.EncodeToString(h[:])
+}
+
+func isValidPasswordHash(h string) bool {
+	if len(h) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(h); i++ {
+		if !(h[i] >= '0' && h[i] <= '9' || h[i] >= 'a' && h[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPassword compares the hash of the password to every hash of the
+// user in constant time, so that neither the time taken nor the length of
+// the password tell how much of a guess was right.
+func (u *aclUser) checkPassword(pass string) bool {
+	h := []byte(hashPassword(pass))
+	ok := false
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare(h, []byte(p)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// setRule applies one of the rules of ACL SETUSER to the user.
+func (u *aclUser) setRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+	case "allkeys":
+		return u.setRule("~*")
+	case "resetkeys":
+		u.keys = nil
+	case "allchannels":
+		return u.setRule("&*")
+	case "resetchannels":
+		u.channels = nil
+	case "allcommands":
+		return u.setRule("+@all")
+	case "nocommands":
+		return u.setRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			u.setRule(r)
+		}
+	default:
+		return u.setPrefixedRule(rule)
+	}
+	return nil
+}
+
+func (u *aclUser) setPrefixedRule(rule string) error {
+	if rule == "" {
+		return errAclSyntax
+	}
+	arg := rule[1:]
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(arg))
+	case '#':
+		if !isValidPasswordHash(arg) {
+			return errAclPasswordHash
+		}
+		u.addPassword(arg)
+	case '<':
+		return u.removePassword(hashPassword(arg))
+	case '!':
+		if !isValidPasswordHash(arg) {
+			return errAclPasswordHash
+		}
+		return u.removePassword(arg)
+	case '~':
+		return u.addKeyPattern(aclKeyPattern{pattern: arg, read: true, write: true})
+	case '%':
+		return u.setKeyPatternRule(arg)
+	case '&':
+		return u.addChannel(arg)
+	case '+', '-':
+		return u.setCommandRule(rule[0] == '+', strings.ToLower(arg))
+	default:
+		return errAclSyntax
+	}
+	return nil
+}
+
+func (u *aclUser) addPassword(h string) {
+	u.nopass = false
+	for _, p := range u.passwords {
+		if p == h {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, h)
+}
+
+func (u *aclUser) removePassword(h string) error {
+	for i, p := range u.passwords {
+		if p == h {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errAclNoSuchPassword
+}
+
+// setKeyPatternRule reads the R, W or RW flags of %<flags>~<pattern>.
+func (u *aclUser) setKeyPatternRule(arg string) error {
+	flags, pattern, ok := strings.Cut(arg, "~")
+	if !ok || flags == "" {
+		return errAclSyntax
+	}
+	p := aclKeyPattern{pattern: pattern}
+	for _, f := range strings.ToUpper(flags) {
+		switch f {
+		case 'R':
+			p.read = true
+		case 'W':
+			p.write = true
+		default:
+			return errAclSyntax
+		}
+	}
+	return u.addKeyPattern(p)
+}
+
+func (u *aclUser) allKeys() bool {
+	return len(u.keys) == 1 && u.keys[0] == aclKeyPattern{pattern: "*", read: true, write: true}
+}
+
+// addKeyPattern adds the pattern, or the accesses it grants to the same
+// pattern already there. ~* replaces the patterns, which it covers all.
+func (u *aclUser) addKeyPattern(p aclKeyPattern) error {
+	all := p == aclKeyPattern{pattern: "*", read: true, write: true}
+	if u.allKeys() && !all {
+		return errAclAfterAllKeys
+	}
+	if all {
+		u.keys = []aclKeyPattern{p}
+		return nil
+	}
+	for i, k := range u.keys {
+		if k.pattern == p.pattern {
+			u.keys[i].read = k.read || p.read
+			u.keys[i].write = k.write || p.write
+			return nil
+		}
+	}
+	u.keys = append(u.keys, p)
+	return nil
+}
+
+func (u *aclUser) addChannel(pattern string) error {
+	all := len(u.channels) == 1 && u.channels[0] == "*"
+	if all && pattern != "*" {
+		return errAclAfterAllChannels
+	}
+	if pattern == "*" {
+		u.channels = []string{pattern}
+		return nil
+	}
+	for _, c := range u.channels {
+		if c == pattern {
+			return nil
+		}
+	}
+	u.channels = append(u.channels, pattern)
+	return nil
+}
+
+// setCommandRule applies +<command>, +<command>|<subcommand>, +@<category>
+// or their - counterparts.
+func (u *aclUser) setCommandRule(allow bool, name string) error {
+	rule := "-" + name
+	if allow {
+		rule = "+" + name
+	}
+
+	if name == "@all" {
+		u.allowed = map[string]bool{}
+		u.subcommands = map[string]map[string]bool{}
+		if allow {
+			for cmd := range commandTable {
+				u.allowed[cmd] = true
+			}
+		}
+		u.commandRules = []string{rule}
+		return nil
+	}
+
+	if strings.HasPrefix(name, "@") {
+		cat, ok := aclCategoryByName(name[1:])
+		if !ok {
+			return errAclUnknownCommand
+		}
+		for cmd, spec := range commandTable {
+			if spec.AclCategories()&cat != 0 {
+				u.allowCommand(cmd, allow)
+			}
+		}
+	} else {
+		cmd, sub, hasSub := strings.Cut(name, "|")
+		spec, ok := commandTable[cmd]
+		if !ok || hasSub && !spec.HasSubcommand(sub) {
+			return errAclUnknownCommand
+		}
+		if hasSub {
+			if u.subcommands[cmd] == nil {
+				u.subcommands[cmd] = map[string]bool{}
+			}
+			u.subcommands[cmd][sub] = allow
+		} else {
+			u.allowCommand(cmd, allow)
+		}
+	}
+
+	// an earlier rule on the same command or category is overridden by
+	// this one, so it is no longer needed to describe the user
+	rules := u.commandRules[:0]
+	for _, r := range u.commandRules {
+		if r[1:] != name {
+			rules = append(rules, r)
+		}
+	}
+	u.commandRules = append(rules, rule)
+	return nil
+}
+
+func (u *aclUser) allowCommand(cmd string, allow bool) {
+	if allow {
+		u.allowed[cmd] = true
+	} else {
+		delete(u.allowed, cmd)
+	}
+	delete(u.subcommands, cmd)
+}
+
+// canRun reports whether the user may run the command. The CmdNoAuth ones
+// are always allowed, so that any user can AUTH as another one.
+func (u *aclUser) canRun(spec *CommandSpec, argv []string) bool {
+	if spec.Is(CmdNoAuth) {
+		return true
+	}
+	if len(argv) > 1 && len(spec.Subcommands) > 0 {
+		if allow, ok := u.subcommands[spec.Name][strings.ToLower(argv[1])]; ok {
+			return allow
+		}
+	}
+	return u.allowed[spec.Name]
+}
+
+func (u *aclUser) canAccessKey(key string, write bool) bool {
+	for _, p := range u.keys {
+		if (write && p.write || !write && p.read) && stringMatch(p.pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessChannel matches a channel against the channel patterns of the
+// user. A pattern given to PSUBSCRIBE has to be one of them as is, unless
+// the user may access all the channels, as redis does.
+func (u *aclUser) canAccessChannel(channel string, pattern bool) bool {
+	for _, p := range u.channels {
+		if p == "*" || p == channel || !pattern && stringMatch(p, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// check tells whether the user may run the command with argv, and when it
+// may not, the key or the channel at fault if that is the reason. The keys
+// of the commands flagged CmdWrite need a write access, the others a read
+// one.
+func (u *aclUser) check(spec *CommandSpec, argv []string) (aclDenial, string) {
+	if !u.canRun(spec, argv) {
+		return aclDeniedCommand, ""
+	}
+	write := spec.Is(CmdWrite)
+	for _, key := range spec.Keys(argv) {
+		if !u.canAccessKey(key, write) {
+			return aclDeniedKey, key
+		}
+	}
+	for _, channel := range spec.Channels(argv) {
+		if !u.canAccessChannel(channel, spec.ChannelPatterns) {
+			return aclDeniedChannel, channel
+		}
+	}
+	return aclAllowed, ""
+}
+
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) describeKeys() string {
+	patterns := make([]string, len(u.keys))
+	for i, p := range u.keys {
+		patterns[i] = p.String()
+	}
+	return strings.Join(patterns, " ")
+}
+
+func (u *aclUser) describeChannels() string {
+	patterns := make([]string, len(u.channels))
+	for i, c := range u.channels {
+		patterns[i] = "&" + c
+	}
+	return strings.Join(patterns, " ")
+}
+
+func (u *aclUser) describeCommands() string {
+	return strings.Join(u.commandRules, " ")
+}
+
+// describe formats the user as the rules that create it, as ACL LIST
+// shows it and ACL SAVE writes it.
+func (u *aclUser) describe() string {
+	parts := u.flags()
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	if keys := u.describeKeys(); keys != "" {
+		parts = append(parts, keys)
+	}
+	if channels := u.describeChannels(); channels != "" {
+		parts = append(parts, channels)
+	} else {
+		parts = append(parts, "resetchannels")
+	}
+	parts = append(parts, u.describeCommands())
+	return strings.Join(parts, " ")
+}
+
+// aclLogEntry is a denial logged for ACL LOG. Similar denials in a short
+// time are counted in the same entry.
+type aclLogEntry struct {
+	count      int
+	reason     string
+	object     string
+	username   string
+	ctime      time.Time
+	clientInfo string
+}
+
+// acl holds the users and the log of the denials.
+type acl struct {
+	users map[string]*aclUser
+	// log is newest first
+	log []*aclLogEntry
+}
+
+// newAcl creates the default user, which requirePass is the password of
+// when set.
+func newAcl(requirePass string) *acl {
+	u := newDefaultAclUser()
+	if requirePass != "" {
+		u.setRule(">" + requirePass)
+	}
+	return &acl{users: map[string]*aclUser{defaultUser: u}}
+}
+
+// setUser applies the rules to the user, which is created if needed. The
+// rules are applied to a copy, so that the user is left as it was when
+// one of them is invalid.
+func (a *acl) setUser(name string, rules []string) error {
+	u, ok := a.users[name]
+	if ok {
+		u = u.clone()
+	} else {
+		u = newAclUser(name)
+	}
+	for _, rule := range rules {
+		if err := u.setRule(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %s", rule, err)
+		}
+	}
+	a.users[name] = u
+	return nil
+}
+
+func (a *acl) sortedUsers() []*aclUser {
+	users := make([]*aclUser, 0, len(a.users))
+	for _, u := range a.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].name < users[j].name
+	})
+	return users
+}
+
+// addLogEntry logs a denial, or counts it in a recent similar entry which
+// moves to the head of the log. The log is trimmed to maxLen entries.
+func (a *acl) addLogEntry(e *aclLogEntry, maxLen int) {
+	for i, old := range a.log {
+		if old.reason == e.reason && old.object == e.object && old.username == e.username &&
+			e.ctime.Sub(old.ctime) < aclLogGroupingMaxDelta {
+			old.count++
+			old.ctime = e.ctime
+			old.clientInfo = e.clientInfo
+			copy(a.log[1:i+1], a.log[:i])
+			a.log[0] = old
+			return
+		}
+	}
+	e.count = 1
+	a.log = append([]*aclLogEntry{e}, a.log...)
+	if len(a.log) > maxLen {
+		a.log = a.log[:maxLen]
+	}
+}
+
+// loadAclFile reads the users of an ACL file, made of lines such as
+// "user alice on #<hash> ~cache:* +get". The default user is the one of
+// newDefaultAclUser when the file does not declare it.
+func loadAclFile(path string) (map[string]*aclUser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading ACLs, opening file '%s': %s", path, err)
+	}
+
+	users := map[string]*aclUser{}
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: should start with user keyword followed by the username", path, i+1)
+		}
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate user '%s' found", path, i+1, name)
+		}
+		u := newAclUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.setRule(rule); err != nil {
+				return nil, fmt.Errorf("%s:%d: Error in applying operation '%s': %s", path, i+1, rule, err)
+			}
+		}
+		users[name] = u
+	}
+	if _, ok := users[defaultUser]; !ok {
+		users[defaultUser] = newDefaultAclUser()
+	}
+	return users, nil
+}
+
+// saveAclFile writes the users to a temporary file first, renamed over the
+// ACL file once complete, so that a failure does not leave it truncated.
+func saveAclFile(path string, users []*aclUser) error {
+	var sb strings.Builder
+	for _, u := range users {
+		sb.WriteString("user " + u.name + " " + u.describe() + "\n")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(sb.String()); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadAclFile replaces the users with the ones of the ACL file, and closes
+// the connections of the users that are gone. The users are left as they
+// were when the file has errors.
+func (s *Server) LoadAclFile() error {
+	users, err := loadAclFile(s.config.AclFile)
+	if err != nil {
+		return err
+	}
+	s.acl.users = users
+	s.closeClientsOfRemovedUsers()
+	return nil
+}
+
+func (s *Server) closeClientsOfRemovedUsers() {
+	for _, c := range s.Clients() {
+		if _, ok := s.acl.users[c.User]; !ok {
+			c.CloseAsap()
+		}
+	}
+}
+
+// aclCommandName is the name ACL rules and denials use for the command,
+// <command>|<subcommand> for the subcommands.
+func aclCommandName(spec *CommandSpec, argv []string) string {
+	if len(argv) > 1 && spec.HasSubcommand(strings.ToLower(argv[1])) {
+		return spec.Name + "|" + strings.ToLower(argv[1])
+	}
+	return spec.Name
+}
+
+// aclCheck returns the NOPERM error to reply when the user of the client
+// is not allowed to run the command, after logging the denial, and an
+// empty string when it is allowed.
+func (s *Server) aclCheck(c Command, cl *ev.Client) string {
+	spec := c.Spec()
+	if spec == nil {
+		return ""
+	}
+	u, ok := s.acl.users[cl.User]
+	if !ok {
+		// the connection is closing, its user was removed
+		return "-NOPERM this user has no permissions to run the '" + spec.Name + "' command"
+	}
+
+	name := aclCommandName(spec, c.Argv())
+	switch denial, key := u.check(spec, c.Argv()); denial {
+	case aclDeniedCommand:
+		s.logAclDenial(cl, "command", name, u.name)
+		return "-NOPERM this user has no permissions to run the '" + name + "' command"
+	case aclDeniedKey:
+		s.logAclDenial(cl, "key", key, u.name)
+		return "-NOPERM this user has no permissions to access one of the keys used as arguments"
+	case aclDeniedChannel:
+		s.logAclDenial(cl, "channel", key, u.name)
+		return "-NOPERM this user has no permissions to access one of the channels used as arguments"
+	}
+	return ""
+}
+
+func (s *Server) logAclDenial(cl *ev.Client, reason string, object string, username string) {
+	now := time.Now()
+	s.acl.addLogEntry(&aclLogEntry{
+		reason:     reason,
+		object:     object,
+		username:   username,
+		ctime:      now,
+		clientInfo: strings.TrimSuffix(clientInfo(cl, now), "\n"),
+	}, s.config.AclLogMaxLen)
+}
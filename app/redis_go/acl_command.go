@@ -0,0 +1,274 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const noAclFileReply = "-ERR This Redis instance is not configured to use an ACL file. " +
+	"You may want to specify users via the ACL SETUSER command and then issue a " +
+	"CONFIG REWRITE (assuming you have a Redis configuration file set) in order to " +
+	"store users in the Redis configuration."
+
+type AclCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+	count      int
+	reset      bool
+}
+
+func NewAclCommand(rr RespReader) *AclCommand {
+	return &AclCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		count:       10,
+	}
+}
+
+func (c *AclCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args = make([]string, len-1)
+	for i := range c.args {
+		c.args[i], err = c.reader.ReadBulkString()
+		if err != nil {
+			return
+		}
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "SETUSER", "DELUSER":
+		if n < 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "GETUSER":
+		if n != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "LIST", "USERS", "WHOAMI", "LOAD", "SAVE":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "CAT":
+		if n > 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "DRYRUN":
+		if n < 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "LOG":
+		if n > 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		if n == 1 {
+			return c.readLogParams(c.args[0])
+		}
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+// readLogParams reads ACL LOG [count|RESET].
+func (c *AclCommand) readLogParams(arg string) error {
+	if strings.ToUpper(arg) == "RESET" {
+		c.reset = true
+		return nil
+	}
+	count, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("value is not an integer or out of range")
+	}
+	if count < 0 {
+		return fmt.Errorf("value is out of range, must be positive")
+	}
+	c.count = count
+	return nil
+}
+
+// setArgv hides the rules of ACL SETUSER, which can hold passwords.
+func (c *AclCommand) setArgv(argv []string) {
+	if len(argv) > 1 && strings.ToUpper(argv[1]) == "SETUSER" {
+		argv = redactArgv(argv, 3)
+	}
+	c.BaseCommand.setArgv(argv)
+}
+
+func (c *AclCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "SETUSER":
+		return c.setUser(srv)
+	case "GETUSER":
+		return c.getUser(srv)
+	case "DELUSER":
+		return c.delUser(srv)
+	case "LIST":
+		var users []string
+		for _, u := range srv.acl.sortedUsers() {
+			users = append(users, "user "+u.name+" "+u.describe())
+		}
+		return encodeBulkStrings(users)
+	case "USERS":
+		var names []string
+		for _, u := range srv.acl.sortedUsers() {
+			names = append(names, u.name)
+		}
+		return encodeBulkStrings(names)
+	case "WHOAMI":
+		return encodeBulkString(cl.User)
+	case "CAT":
+		return c.cat()
+	case "DRYRUN":
+		return c.dryRun(srv)
+	case "LOG":
+		return c.log(srv)
+	case "LOAD":
+		if srv.config.AclFile == "" {
+			return noAclFileReply
+		}
+		if err := srv.LoadAclFile(); err != nil {
+			return "-ERR " + err.Error() + ". WARNING: ACL errors detected, " +
+				"no change to the previously active ACL rules was performed"
+		}
+		return "+OK"
+	}
+
+	if srv.config.AclFile == "" {
+		return noAclFileReply
+	}
+	if err := saveAclFile(srv.config.AclFile, srv.acl.sortedUsers()); err != nil {
+		fmt.Printf("Saving ACLs to %s failed: %s\n", srv.config.AclFile, err)
+		return "-ERR There was an error trying to save the ACLs. Please check the server logs for more information"
+	}
+	return "+OK"
+}
+
+func (c *AclCommand) setUser(srv *Server) string {
+	name := c.args[0]
+	if strings.ContainsAny(name, " \x00") {
+		return "-ERR Usernames can't contain spaces or null characters"
+	}
+	if err := srv.acl.setUser(name, c.args[1:]); err != nil {
+		return "-ERR " + err.Error()
+	}
+	return "+OK"
+}
+
+func (c *AclCommand) getUser(srv *Server) string {
+	u, ok := srv.acl.users[c.args[0]]
+	if !ok {
+		return "$-1"
+	}
+	return encodeArray([]string{
+		encodeBulkString("flags"), encodeBulkStrings(u.flags()),
+		encodeBulkString("passwords"), encodeBulkStrings(u.passwords),
+		encodeBulkString("commands"), encodeBulkString(u.describeCommands()),
+		encodeBulkString("keys"), encodeBulkString(u.describeKeys()),
+		encodeBulkString("channels"), encodeBulkString(u.describeChannels()),
+		encodeBulkString("selectors"), encodeArray([]string{}),
+	})
+}
+
+// delUser removes the users and closes their connections. The default
+// user can not be removed, in which case none are.
+func (c *AclCommand) delUser(srv *Server) string {
+	for _, name := range c.args {
+		if name == defaultUser {
+			return "-ERR The 'default' user cannot be removed"
+		}
+	}
+	deleted := 0
+	for _, name := range c.args {
+		if _, ok := srv.acl.users[name]; ok {
+			delete(srv.acl.users, name)
+			deleted++
+		}
+	}
+	srv.closeClientsOfRemovedUsers()
+	return encodeInt(deleted)
+}
+
+// cat lists the categories, or the commands in the category given.
+func (c *AclCommand) cat() string {
+	if len(c.args) == 0 {
+		return encodeBulkStrings(aclCategoryNames)
+	}
+	cat, ok := aclCategoryByName(strings.ToLower(c.args[0]))
+	if !ok {
+		return fmt.Sprintf("-ERR Unknown category '%s'", c.args[0])
+	}
+	var names []string
+	for name, spec := range commandTable {
+		if spec.AclCategories()&cat != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return encodeBulkStrings(names)
+}
+
+// dryRun tells whether the user could run the command, without running it.
+func (c *AclCommand) dryRun(srv *Server) string {
+	u, ok := srv.acl.users[c.args[0]]
+	if !ok {
+		return fmt.Sprintf("-ERR User '%s' not found", c.args[0])
+	}
+	argv := c.args[1:]
+	spec, ok := commandTable[strings.ToLower(argv[0])]
+	if !ok {
+		return fmt.Sprintf("-ERR Command '%s' not found", argv[0])
+	}
+
+	switch denial, key := u.check(spec, argv); denial {
+	case aclDeniedCommand:
+		return encodeBulkString(fmt.Sprintf("This user has no permissions to run the '%s' command",
+			aclCommandName(spec, argv)))
+	case aclDeniedKey:
+		return encodeBulkString(fmt.Sprintf("This user has no permissions to access the '%s' key", key))
+	case aclDeniedChannel:
+		return encodeBulkString(fmt.Sprintf("This user has no permissions to access the '%s' channel", key))
+	}
+	return "+OK"
+}
+
+func (c *AclCommand) log(srv *Server) string {
+	if c.reset {
+		srv.acl.log = nil
+		return "+OK"
+	}
+
+	now := time.Now()
+	var entries []string
+	for i, e := range srv.acl.log {
+		if i == c.count {
+			break
+		}
+		age := float64(now.Sub(e.ctime).Milliseconds()) / 1000
+		entries = append(entries, encodeArray([]string{
+			encodeBulkString("count"), encodeInt(e.count),
+			encodeBulkString("reason"), encodeBulkString(e.reason),
+			encodeBulkString("context"), encodeBulkString("toplevel"),
+			encodeBulkString("object"), encodeBulkString(e.object),
+			encodeBulkString("username"), encodeBulkString(e.username),
+			encodeBulkString("age-seconds"), encodeBulkString(formatFloat(age)),
+			encodeBulkString("client-info"), encodeBulkString(e.clientInfo),
+		}))
+	}
+	return encodeArray(entries)
+}
@@ -0,0 +1,163 @@
+package redis_go
+
+import (
+	"os"
+	"path/filepath"
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAclCommandSetUserAndGetUser(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "ACL", "SETUSER", "alice", "on", ">secret", "~app:*", "%R~shared:*", "+get"))
+	assert.Equal(t, "*12\r\n"+
+		"$5\r\nflags\r\n*1\r\n$2\r\non\r\n"+
+		"$9\r\npasswords\r\n*1\r\n$64\r\n"+hashPassword("secret")+"\r\n"+
+		"$8\r\ncommands\r\n$10\r\n-@all +get\r\n"+
+		"$4\r\nkeys\r\n$18\r\n~app:* %R~shared:*\r\n"+
+		"$8\r\nchannels\r\n$0\r\n\r\n"+
+		"$9\r\nselectors\r\n*0\r\n",
+		handle(srv, cl, "ACL", "GETUSER", "alice"))
+	assert.Equal(t, "$-1\r\n", handle(srv, cl, "ACL", "GETUSER", "bob"))
+
+	assert.Equal(t, "-ERR Error in ACL SETUSER modifier 'bogus': Syntax error\r\n",
+		handle(srv, cl, "ACL", "SETUSER", "alice", "bogus"))
+	assert.Equal(t, "-ERR Usernames can't contain spaces or null characters\r\n",
+		handle(srv, cl, "ACL", "SETUSER", "a b"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "ACL", "SETUSER"))
+}
+
+func TestAclCommandSetUserRedactsRules(t *testing.T) {
+	c := NewAclCommand(nil)
+	c.setArgv([]string{"ACL", "SETUSER", "alice", "on", ">secret"})
+	assert.Equal(t, []string{"ACL", "SETUSER", "alice", "(redacted)", "(redacted)"}, c.Argv())
+
+	c.setArgv([]string{"ACL", "GETUSER", "alice"})
+	assert.Equal(t, []string{"ACL", "GETUSER", "alice"}, c.Argv())
+}
+
+func TestAclCommandListUsersWhoami(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "ACL", "SETUSER", "bob", "on", "nopass", "+@all", "~*")
+
+	assert.Equal(t, encodeBulkStrings([]string{
+		"user bob on nopass ~* resetchannels +@all",
+		"user default on nopass ~* &* +@all",
+	})+"\r\n", handle(srv, cl, "ACL", "LIST"))
+	assert.Equal(t, encodeBulkStrings([]string{"bob", "default"})+"\r\n", handle(srv, cl, "ACL", "USERS"))
+	assert.Equal(t, "$7\r\ndefault\r\n", handle(srv, cl, "ACL", "WHOAMI"))
+
+	handle(srv, cl, "AUTH", "bob", "any")
+	assert.Equal(t, "$3\r\nbob\r\n", handle(srv, cl, "ACL", "WHOAMI"))
+}
+
+func TestAclCommandDelUser(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	other := ev.NewClient(2)
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{cl, other}})
+	handle(srv, cl, "ACL", "SETUSER", "bob", "on", "nopass", "+@all")
+	handle(srv, cl, "ACL", "SETUSER", "carol")
+	handle(srv, other, "AUTH", "bob", "any")
+
+	assert.Equal(t, "-ERR The 'default' user cannot be removed\r\n",
+		handle(srv, cl, "ACL", "DELUSER", "bob", "default"))
+	assert.Contains(t, srv.acl.users, "bob")
+
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "ACL", "DELUSER", "bob", "carol", "nosuch"))
+	assert.Equal(t, []string{"default"}, strings.Fields(strings.ReplaceAll(
+		handle(srv, cl, "ACL", "USERS"), "\r\n", " "))[2:])
+	assert.True(t, other.IsClosing())
+	assert.False(t, cl.IsClosing())
+}
+
+func TestAclCommandCat(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "ACL", "CAT"), "*21\r\n$8\r\nkeyspace\r\n$4\r\nread\r\n"))
+	assert.Equal(t, "*0\r\n", handle(srv, cl, "ACL", "CAT", "hash"))
+	assert.Equal(t, encodeBulkStrings([]string{"get", "set"})+"\r\n", handle(srv, cl, "ACL", "CAT", "STRING"))
+	assert.Equal(t, "-ERR Unknown category 'nosuch'\r\n", handle(srv, cl, "ACL", "CAT", "nosuch"))
+}
+
+func TestAclCommandDryRun(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "ACL", "SETUSER", "alice", "on", "nopass", "~app:*", "+get")
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "ACL", "DRYRUN", "alice", "GET", "app:1"))
+	assert.Equal(t, "$53\r\nThis user has no permissions to run the 'set' command\r\n",
+		handle(srv, cl, "ACL", "DRYRUN", "alice", "SET", "app:1", "v"))
+	assert.Equal(t, "$54\r\nThis user has no permissions to access the 'other' key\r\n",
+		handle(srv, cl, "ACL", "DRYRUN", "alice", "get", "other"))
+	handle(srv, cl, "ACL", "SETUSER", "alice", "+publish", "&news")
+	assert.Equal(t, "$58\r\nThis user has no permissions to access the 'other' channel\r\n",
+		handle(srv, cl, "ACL", "DRYRUN", "alice", "PUBLISH", "other", "hi"))
+	assert.Equal(t, "-ERR User 'bob' not found\r\n", handle(srv, cl, "ACL", "DRYRUN", "bob", "GET", "k"))
+	assert.Equal(t, "-ERR Command 'nosuch' not found\r\n", handle(srv, cl, "ACL", "DRYRUN", "alice", "nosuch"))
+	// nothing ran, so nothing was logged
+	assert.Empty(t, srv.acl.log)
+}
+
+func TestAclCommandLog(t *testing.T) {
+	srv := NewServer(NewConfig())
+	admin := ev.NewClient(1)
+	cl := ev.NewClient(2)
+	handle(srv, admin, "ACL", "SETUSER", "alice", "on", "nopass", "~app:*", "+get")
+	handle(srv, cl, "AUTH", "alice", "any")
+	handle(srv, cl, "SET", "app:1", "v")
+	handle(srv, cl, "SET", "app:1", "v")
+	handle(srv, cl, "GET", "other")
+
+	res := handle(srv, admin, "ACL", "LOG")
+	assert.True(t, strings.HasPrefix(res, "*2\r\n*14\r\n"+
+		"$5\r\ncount\r\n:1\r\n$6\r\nreason\r\n$3\r\nkey\r\n$7\r\ncontext\r\n$8\r\ntoplevel\r\n"+
+		"$6\r\nobject\r\n$5\r\nother\r\n$8\r\nusername\r\n$5\r\nalice\r\n$11\r\nage-seconds\r\n"), res)
+	assert.Contains(t, res, "$5\r\ncount\r\n:2\r\n$6\r\nreason\r\n$7\r\ncommand\r\n")
+	assert.True(t, strings.HasPrefix(handle(srv, admin, "ACL", "LOG", "1"), "*1\r\n"))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, admin, "ACL", "LOG", "RESET"))
+	assert.Equal(t, "*0\r\n", handle(srv, admin, "ACL", "LOG"))
+	assert.Equal(t, "-ERR value is out of range, must be positive\r\n", handle(srv, admin, "ACL", "LOG", "-1"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", handle(srv, admin, "ACL", "LOG", "x"))
+}
+
+func TestAclCommandSaveAndLoad(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "ACL", "SAVE"), "-ERR This Redis instance is not configured"))
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "ACL", "LOAD"), "-ERR This Redis instance is not configured"))
+
+	path := filepath.Join(t.TempDir(), "users.acl")
+	srv.config.AclFile = path
+	handle(srv, cl, "ACL", "SETUSER", "alice", "on", ">secret", "+@read", "~*")
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "ACL", "SAVE"))
+
+	handle(srv, cl, "ACL", "SETUSER", "bob", "on")
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "ACL", "LOAD"))
+	assert.Equal(t, encodeBulkStrings([]string{"alice", "default"})+"\r\n", handle(srv, cl, "ACL", "USERS"))
+
+	// a broken file leaves the users as they were
+	os.WriteFile(path, []byte("user carol bogus\n"), 0644)
+	assert.Equal(t, "-ERR "+path+":1: Error in applying operation 'bogus': Syntax error. "+
+		"WARNING: ACL errors detected, no change to the previously active ACL rules was performed\r\n",
+		handle(srv, cl, "ACL", "LOAD"))
+	assert.Equal(t, encodeBulkStrings([]string{"alice", "default"})+"\r\n", handle(srv, cl, "ACL", "USERS"))
+}
+
+func TestAclCommandReadParams(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "ACL"))
+	assert.Equal(t, "-ERR unknown subcommand 'nosuch'\r\n", handle(srv, cl, "ACL", "nosuch"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "ACL", "WHOAMI", "x"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "ACL", "GETUSER"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "ACL", "DRYRUN", "default"))
+}
@@ -0,0 +1,311 @@
+package redis_go
+
+import (
+	"os"
+	"path/filepath"
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAclUser(t *testing.T, rules ...string) *aclUser {
+	u := newAclUser("alice")
+	for _, r := range rules {
+		assert.NoError(t, u.setRule(r), r)
+	}
+	return u
+}
+
+func TestCommandSpecKeys(t *testing.T) {
+	assert.Equal(t, []string{"k"}, commandTable["get"].Keys([]string{"GET", "k"}))
+	assert.Nil(t, commandTable["ping"].Keys([]string{"PING"}))
+	assert.Equal(t, []string{"k"}, commandTable["memory"].Keys([]string{"MEMORY", "USAGE", "k", "SAMPLES", "5"}))
+	assert.Nil(t, commandTable["memory"].Keys([]string{"MEMORY", "STATS"}))
+
+	spec := &CommandSpec{}
+	spec.keys(1, -1, 2)
+	assert.Equal(t, []string{"a", "b"}, spec.Keys([]string{"MSET", "a", "1", "b", "2"}))
+}
+
+func TestCommandSpecChannels(t *testing.T) {
+	assert.Equal(t, []string{"news"}, commandTable["publish"].Channels([]string{"PUBLISH", "news", "hi"}))
+	assert.Equal(t, []string{"a", "b"}, commandTable["subscribe"].Channels([]string{"SUBSCRIBE", "a", "b"}))
+	assert.True(t, commandTable["psubscribe"].ChannelPatterns)
+	assert.Nil(t, commandTable["unsubscribe"].Channels([]string{"UNSUBSCRIBE", "a"}))
+}
+
+func TestCommandSpecAclCategories(t *testing.T) {
+	assert.Equal(t, AclRead|AclString|AclFast, commandTable["get"].AclCategories())
+	assert.Equal(t, AclWrite|AclString|AclSlow, commandTable["set"].AclCategories())
+	assert.Equal(t, AclAdmin|AclDangerous|AclSlow, commandTable["shutdown"].AclCategories())
+
+	cat, ok := aclCategoryByName("sortedset")
+	assert.True(t, ok)
+	assert.Equal(t, AclSortedSet, cat)
+	_, ok = aclCategoryByName("nosuch")
+	assert.False(t, ok)
+}
+
+func TestAclUserDescribe(t *testing.T) {
+	assert.Equal(t, "off resetchannels -@all", newAclUser("alice").describe())
+	assert.Equal(t, "on nopass ~* &* +@all", newDefaultAclUser().describe())
+
+	u := newTestAclUser(t, "on", ">secret", "~cache:*", "%R~config:*", "%W~log:*", "%RW~cache:*",
+		"&news", "+@read", "-info", "+get", "-get")
+	assert.Equal(t, "on #"+hashPassword("secret")+" ~cache:* %R~config:* %W~log:* &news -@all +@read -info -get",
+		u.describe())
+
+	u = newTestAclUser(t, "on", "allkeys", "allchannels", "allcommands", "reset")
+	assert.Equal(t, "off resetchannels -@all", u.describe())
+}
+
+func TestAclUserPasswords(t *testing.T) {
+	u := newTestAclUser(t, ">one", ">two", "#"+hashPassword("three"))
+	assert.False(t, u.nopass)
+	assert.True(t, u.checkPassword("one"))
+	assert.True(t, u.checkPassword("three"))
+	assert.False(t, u.checkPassword("four"))
+
+	assert.NoError(t, u.setRule("<one"))
+	assert.NoError(t, u.setRule("!"+hashPassword("three")))
+	assert.False(t, u.checkPassword("one"))
+	assert.Equal(t, []string{hashPassword("two")}, u.passwords)
+
+	assert.Equal(t, errAclNoSuchPassword, u.setRule("<one"))
+	assert.Equal(t, errAclPasswordHash, u.setRule("#abc"))
+	assert.Equal(t, errAclPasswordHash, u.setRule("#"+strings.ToUpper(hashPassword("x"))))
+
+	assert.NoError(t, u.setRule("nopass"))
+	assert.Empty(t, u.passwords)
+	assert.True(t, u.nopass)
+	assert.NoError(t, u.setRule("resetpass"))
+	assert.False(t, u.nopass)
+}
+
+func TestAclUserRuleErrors(t *testing.T) {
+	u := newAclUser("alice")
+	assert.Equal(t, errAclSyntax, u.setRule(""))
+	assert.Equal(t, errAclSyntax, u.setRule("bogus"))
+	assert.Equal(t, errAclSyntax, u.setRule("%X~key"))
+	assert.Equal(t, errAclSyntax, u.setRule("%R"))
+	assert.Equal(t, errAclUnknownCommand, u.setRule("+nosuch"))
+	assert.Equal(t, errAclUnknownCommand, u.setRule("+@nosuch"))
+	assert.Equal(t, errAclUnknownCommand, u.setRule("+config|nosuch"))
+	assert.Equal(t, errAclUnknownCommand, u.setRule("+get|sub"))
+
+	assert.NoError(t, u.setRule("allkeys"))
+	assert.Equal(t, errAclAfterAllKeys, u.setRule("~foo"))
+	assert.NoError(t, u.setRule("~*"))
+	assert.NoError(t, u.setRule("allchannels"))
+	assert.Equal(t, errAclAfterAllChannels, u.setRule("&foo"))
+}
+
+func TestAclUserCheckCommands(t *testing.T) {
+	u := newTestAclUser(t, "allkeys", "+@read", "-dbsize", "+config|resetstat", "+SET")
+	assert.True(t, u.canRun(commandTable["get"], []string{"GET", "k"}))
+	assert.True(t, u.canRun(commandTable["scan"], []string{"SCAN", "0"}))
+	assert.True(t, u.canRun(commandTable["set"], []string{"SET", "k", "v"}))
+	assert.False(t, u.canRun(commandTable["dbsize"], []string{"DBSIZE"}))
+	assert.False(t, u.canRun(commandTable["flushall"], []string{"FLUSHALL"}))
+	assert.True(t, u.canRun(commandTable["config"], []string{"CONFIG", "RESETSTAT"}))
+	assert.True(t, u.canRun(commandTable["auth"], []string{"AUTH", "pass"}))
+
+	u = newTestAclUser(t, "allkeys", "+@all", "-config|resetstat")
+	assert.False(t, u.canRun(commandTable["config"], []string{"config", "resetstat"}))
+	assert.True(t, u.canRun(commandTable["slowlog"], []string{"SLOWLOG", "GET"}))
+	// allowing the command again drops the exception of the subcommand
+	assert.NoError(t, u.setRule("+config"))
+	assert.True(t, u.canRun(commandTable["config"], []string{"CONFIG", "RESETSTAT"}))
+
+	u = newTestAclUser(t, "allkeys", "+@all", "-@dangerous")
+	assert.False(t, u.canRun(commandTable["flushall"], []string{"FLUSHALL"}))
+	assert.False(t, u.canRun(commandTable["monitor"], []string{"MONITOR"}))
+	assert.True(t, u.canRun(commandTable["get"], []string{"GET", "k"}))
+}
+
+func TestAclUserCheckKeys(t *testing.T) {
+	u := newTestAclUser(t, "+@all", "~app:*", "%R~shared:*", "%W~log:*")
+	get := commandTable["get"]
+	set := commandTable["set"]
+
+	denial, key := u.check(get, []string{"GET", "app:1"})
+	assert.Equal(t, aclAllowed, denial)
+	assert.Equal(t, "", key)
+
+	denial, _ = u.check(get, []string{"GET", "shared:1"})
+	assert.Equal(t, aclAllowed, denial)
+	denial, key = u.check(set, []string{"SET", "shared:1", "v"})
+	assert.Equal(t, aclDeniedKey, denial)
+	assert.Equal(t, "shared:1", key)
+
+	denial, _ = u.check(set, []string{"SET", "log:1", "v"})
+	assert.Equal(t, aclAllowed, denial)
+	denial, _ = u.check(get, []string{"GET", "log:1"})
+	assert.Equal(t, aclDeniedKey, denial)
+
+	denial, _ = u.check(get, []string{"GET", "other"})
+	assert.Equal(t, aclDeniedKey, denial)
+
+	assert.NoError(t, u.setRule("-get"))
+	denial, _ = u.check(get, []string{"GET", "app:1"})
+	assert.Equal(t, aclDeniedCommand, denial)
+}
+
+func TestAclUserCheckChannels(t *testing.T) {
+	u := newTestAclUser(t, "+@all", "&news.*")
+	denial, _ := u.check(commandTable["publish"], []string{"PUBLISH", "news.sport", "hi"})
+	assert.Equal(t, aclAllowed, denial)
+	denial, channel := u.check(commandTable["subscribe"], []string{"SUBSCRIBE", "news.sport", "other"})
+	assert.Equal(t, aclDeniedChannel, denial)
+	assert.Equal(t, "other", channel)
+
+	// patterns have to be granted as they are
+	psubscribe := commandTable["psubscribe"]
+	denial, _ = u.check(psubscribe, []string{"PSUBSCRIBE", "news.*"})
+	assert.Equal(t, aclAllowed, denial)
+	denial, _ = u.check(psubscribe, []string{"PSUBSCRIBE", "news.s*"})
+	assert.Equal(t, aclDeniedChannel, denial)
+
+	u = newTestAclUser(t, "+@all", "allchannels")
+	denial, _ = u.check(psubscribe, []string{"PSUBSCRIBE", "news.s*"})
+	assert.Equal(t, aclAllowed, denial)
+}
+
+func TestAclSetUserIsAtomic(t *testing.T) {
+	a := newAcl("")
+	assert.NoError(t, a.setUser("alice", []string{"on", "+get"}))
+	err := a.setUser("alice", []string{"off", "+nosuch"})
+	assert.EqualError(t, err, "Error in ACL SETUSER modifier '+nosuch': Unknown command or category name in ACL")
+	assert.Equal(t, "on resetchannels -@all +get", a.users["alice"].describe())
+
+	// users that fail to be created are not added
+	assert.Error(t, a.setUser("bob", []string{"bogus"}))
+	assert.NotContains(t, a.users, "bob")
+}
+
+func TestNewAclRequirePass(t *testing.T) {
+	a := newAcl("secret")
+	u := a.users[defaultUser]
+	assert.False(t, u.nopass)
+	assert.True(t, u.checkPassword("secret"))
+	assert.Equal(t, "on #"+hashPassword("secret")+" ~* &* +@all", u.describe())
+}
+
+func TestAclLog(t *testing.T) {
+	a := newAcl("")
+	now := time.Now()
+	a.addLogEntry(&aclLogEntry{reason: "command", object: "get", username: "alice", ctime: now}, 2)
+	a.addLogEntry(&aclLogEntry{reason: "key", object: "k", username: "alice", ctime: now}, 2)
+	a.addLogEntry(&aclLogEntry{reason: "command", object: "get", username: "alice", ctime: now.Add(time.Second)}, 2)
+	assert.Len(t, a.log, 2)
+	assert.Equal(t, "get", a.log[0].object)
+	assert.Equal(t, 2, a.log[0].count)
+	assert.Equal(t, now.Add(time.Second), a.log[0].ctime)
+
+	// too old to be grouped, and the oldest entry is dropped
+	a.addLogEntry(&aclLogEntry{reason: "key", object: "k", username: "alice", ctime: now.Add(2 * time.Minute)}, 2)
+	assert.Len(t, a.log, 2)
+	assert.Equal(t, "k", a.log[0].object)
+	assert.Equal(t, 1, a.log[0].count)
+	assert.Equal(t, "get", a.log[1].object)
+}
+
+func TestAclFileSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	a := newAcl("")
+	assert.NoError(t, a.setUser("alice", []string{"on", ">secret", "~cache:*", "&news", "+get"}))
+	assert.NoError(t, saveAclFile(path, a.sortedUsers()))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "user alice on #"+hashPassword("secret")+" ~cache:* &news -@all +get\n"+
+		"user default on nopass ~* &* +@all\n", string(data))
+
+	users, err := loadAclFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, a.users["alice"].describe(), users["alice"].describe())
+	assert.True(t, users["alice"].checkPassword("secret"))
+}
+
+func TestLoadAclFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := loadAclFile(filepath.Join(dir, "missing.acl"))
+	assert.Error(t, err)
+
+	path := filepath.Join(dir, "users.acl")
+	os.WriteFile(path, []byte("user alice on\n\nuser bob bogus\n"), 0644)
+	_, err = loadAclFile(path)
+	assert.EqualError(t, err, path+":3: Error in applying operation 'bogus': Syntax error")
+
+	os.WriteFile(path, []byte("alice on\n"), 0644)
+	_, err = loadAclFile(path)
+	assert.EqualError(t, err, path+":1: should start with user keyword followed by the username")
+
+	os.WriteFile(path, []byte("user alice on\nuser alice off\n"), 0644)
+	_, err = loadAclFile(path)
+	assert.EqualError(t, err, path+":2: duplicate user 'alice' found")
+
+	// the default user is added when the file does not declare it
+	os.WriteFile(path, []byte("user alice on\n"), 0644)
+	users, err := loadAclFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "on nopass ~* &* +@all", users[defaultUser].describe())
+}
+
+func TestServerAclCheck(t *testing.T) {
+	srv := NewServer(NewConfig())
+	assert.NoError(t, srv.acl.setUser("alice", []string{"on", "nopass", "~app:*", "+@read", "+set"}))
+	cl := ev.NewClient(1)
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "AUTH", "alice", "x"))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "SET", "app:1", "v"))
+	assert.Equal(t, "$1\r\nv\r\n", handle(srv, cl, "GET", "app:1"))
+	assert.Equal(t, "-NOPERM this user has no permissions to access one of the keys used as arguments\r\n",
+		handle(srv, cl, "GET", "other"))
+	assert.Equal(t, "-NOPERM this user has no permissions to run the 'flushall' command\r\n",
+		handle(srv, cl, "FLUSHALL"))
+	assert.Equal(t, "-NOPERM this user has no permissions to run the 'config|resetstat' command\r\n",
+		handle(srv, cl, "CONFIG", "RESETSTAT"))
+
+	assert.Len(t, srv.acl.log, 3)
+	assert.Equal(t, "command", srv.acl.log[0].reason)
+	assert.Equal(t, "config|resetstat", srv.acl.log[0].object)
+	assert.Equal(t, "key", srv.acl.log[2].reason)
+	assert.Equal(t, "other", srv.acl.log[2].object)
+	assert.Equal(t, "alice", srv.acl.log[2].username)
+	assert.Contains(t, srv.acl.log[2].clientInfo, "user=alice")
+	assert.Equal(t, int64(1), srv.stats.byCommand["flushall"].rejected)
+	assert.Equal(t, int64(0), srv.stats.byCommand["flushall"].calls)
+
+	assert.NoError(t, srv.acl.setUser("alice", []string{"+@pubsub", "&news"}))
+	assert.Equal(t, ":0\r\n", handle(srv, cl, "PUBLISH", "news", "hi"))
+	assert.Equal(t, "-NOPERM this user has no permissions to access one of the channels used as arguments\r\n",
+		handle(srv, cl, "PUBLISH", "other", "hi"))
+	assert.Equal(t, "channel", srv.acl.log[0].reason)
+	assert.Equal(t, "other", srv.acl.log[0].object)
+}
+
+func TestServerLoadAclFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	os.WriteFile(path, []byte("user bob on nopass +@all ~*\n"), 0644)
+	cfg := NewConfig()
+	cfg.AclFile = path
+	srv := NewServer(cfg)
+	alice := ev.NewClient(1)
+	bob := ev.NewClient(2)
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{alice, bob}})
+	assert.NoError(t, srv.acl.setUser("alice", []string{"on", "nopass"}))
+	assert.True(t, srv.authenticate(alice, "alice", ""))
+	assert.True(t, srv.authenticate(bob, "default", ""))
+
+	assert.NoError(t, srv.LoadAclFile())
+	assert.NotContains(t, srv.acl.users, "alice")
+	assert.Contains(t, srv.acl.users, "bob")
+	// alice is gone, so the connection authenticated as alice is closed
+	assert.True(t, alice.IsClosing())
+	assert.False(t, bob.IsClosing())
+}
@@ -0,0 +1,43 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+)
+
+const (
+	defaultUser = "default"
+
+	wrongPassReply = "-WRONGPASS invalid username-password pair or user is disabled."
+)
+
+// authRequired reports whether the client has to authenticate before it
+// can run commands other than the CmdNoAuth ones, which is the case unless
+// the default user is enabled and needs no password.
+func (s *Server) authRequired(cl *ev.Client) bool {
+	u := s.acl.users[defaultUser]
+	return (!u.nopass || !u.enabled) && !cl.Authenticated
+}
+
+// authenticate checks the password of the user and authenticates the
+// client as that user when it matches. Failures are logged to the ACL
+// log.
+func (s *Server) authenticate(cl *ev.Client, user string, pass string) bool {
+	u, ok := s.acl.users[user]
+	if !ok || !u.enabled || !u.nopass && !u.checkPassword(pass) {
+		s.logAclDenial(cl, "auth", "AUTH", user)
+		return false
+	}
+	cl.User = user
+	cl.Authenticated = true
+	return true
+}
+
+// redactArgv hides the arguments from i on, so that passwords do not
+// show in the slow log or MONITOR.
+func redactArgv(argv []string, i int) []string {
+	redacted := append([]string{}, argv...)
+	for ; i < len(redacted); i++ {
+		redacted[i] = "(redacted)"
+	}
+	return redacted
+}
@@ -0,0 +1,184 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+type AuthCommand struct {
+	BaseCommand
+	reader RespReader
+	user   string
+	pass   string
+	// withUser is the AUTH username password form
+	withUser bool
+}
+
+func NewAuthCommand(rr RespReader) *AuthCommand {
+	return &AuthCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		user:        defaultUser,
+	}
+}
+
+func (c *AuthCommand) ReadParams(len int) (err error) {
+	if len < 1 || len > 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	if len == 2 {
+		c.withUser = true
+		c.user, err = c.reader.ReadBulkString()
+		if err != nil {
+			return
+		}
+	}
+	c.pass, err = c.reader.ReadBulkString()
+	return
+}
+
+func (c *AuthCommand) setArgv(argv []string) {
+	c.BaseCommand.setArgv(redactArgv(argv, 1))
+}
+
+func (c *AuthCommand) Execute(srv *Server, cl *ev.Client) string {
+	if !c.withUser && srv.acl.users[defaultUser].nopass {
+		return "-ERR AUTH <password> called without any password configured for the default user. " +
+			"Are you sure your configuration is correct?"
+	}
+	if !srv.authenticate(cl, c.user, c.pass) {
+		return wrongPassReply
+	}
+	return "+OK"
+}
+
+// HelloCommand switches the connection to RESP3 with HELLO 3. RESP3 is
+// only used where it differs in kind from RESP2, for the maps and for the
+// data pushed by the server, the other replies being the same as in RESP2.
+type HelloCommand struct {
+	BaseCommand
+	reader   RespReader
+	protover int
+	auth     bool
+	user     string
+	pass     string
+	name     string
+	setName  bool
+}
+
+func NewHelloCommand(rr RespReader) *HelloCommand {
+	return &HelloCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *HelloCommand) ReadParams(len int) error {
+	args := make([]string, len)
+	for i := range args {
+		arg, err := c.reader.ReadBulkString()
+		if err != nil {
+			return err
+		}
+		args[i] = arg
+	}
+	if len == 0 {
+		return nil
+	}
+
+	ver, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("Protocol version is not an integer or out of range")
+	}
+	c.protover = ver
+
+	for i := 1; i < len; i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len {
+				return fmt.Errorf("Syntax error in HELLO option 'AUTH'")
+			}
+			c.auth = true
+			c.user = args[i+1]
+			c.pass = args[i+2]
+			i += 2
+		case "SETNAME":
+			if i+1 >= len {
+				return fmt.Errorf("Syntax error in HELLO option 'SETNAME'")
+			}
+			c.name = args[i+1]
+			if !isValidClientName(c.name) {
+				return fmt.Errorf("Client names cannot contain spaces, newlines or special characters.")
+			}
+			c.setName = true
+			i++
+		default:
+			return fmt.Errorf("Syntax error in HELLO option '%s'", args[i])
+		}
+	}
+	return nil
+}
+
+func (c *HelloCommand) setArgv(argv []string) {
+	for i := 2; i+2 < len(argv); i++ {
+		if strings.ToUpper(argv[i]) == "AUTH" {
+			argv = redactArgv(argv, i+1)
+			break
+		}
+	}
+	c.BaseCommand.setArgv(argv)
+}
+
+func (c *HelloCommand) Execute(srv *Server, cl *ev.Client) string {
+	if c.protover != 0 && c.protover != 2 && c.protover != 3 {
+		return "-NOPROTO unsupported protocol version"
+	}
+	if c.auth && !srv.authenticate(cl, c.user, c.pass) {
+		return wrongPassReply
+	}
+	if srv.authRequired(cl) {
+		return "-NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to " +
+			"authenticate the client and select the RESP protocol version at the same time"
+	}
+	if c.setName {
+		cl.Name = c.name
+	}
+	if c.protover != 0 {
+		cl.Resp = c.protover
+	}
+
+	return encodeMap(cl.Resp, []string{
+		encodeBulkString("server"), encodeBulkString("redis"),
+		encodeBulkString("version"), encodeBulkString(Version),
+		encodeBulkString("proto"), encodeInt(cl.Resp),
+		encodeBulkString("id"), encodeInt(int(cl.Id)),
+		encodeBulkString("mode"), encodeBulkString("standalone"),
+		encodeBulkString("role"), encodeBulkString("master"),
+		encodeBulkString("modules"), encodeArray([]string{}),
+	})
+}
+
+type QuitCommand struct {
+	BaseCommand
+}
+
+func NewQuitCommand() *QuitCommand {
+	return &QuitCommand{
+		BaseCommand: NewBaseCommand(),
+	}
+}
+
+func (c *QuitCommand) ReadParams(len int) error {
+	if len != 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	return nil
+}
+
+func (c *QuitCommand) Execute(srv *Server, cl *ev.Client) string {
+	cl.CloseAsap()
+	return "+OK"
+}
@@ -0,0 +1,104 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCommandWithoutRequirePass(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "-ERR AUTH <password> called without any password configured for the default user. "+
+		"Are you sure your configuration is correct?\r\n", handle(srv, cl, "AUTH", "secret"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "AUTH", "default", "secret"))
+	assert.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+		handle(srv, cl, "AUTH", "nobody", "secret"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "AUTH"))
+}
+
+func TestAuthCommandRequirePass(t *testing.T) {
+	cfg := NewConfig()
+	cfg.RequirePass = "secret"
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "-NOAUTH Authentication required.\r\n", handle(srv, cl, "SET", "k", "v"))
+	assert.Equal(t, "-NOAUTH Authentication required.\r\n", handle(srv, cl, "CLIENT", "PAUSE", "1000"))
+	assert.False(t, srv.isPaused())
+	// unknown commands and wrong arguments are reported as such
+	assert.Equal(t, "-ERR unknown command NOPE\r\n", handle(srv, cl, "NOPE"))
+
+	assert.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+		handle(srv, cl, "AUTH", "wrong"))
+	assert.Equal(t, "-NOAUTH Authentication required.\r\n", handle(srv, cl, "GET", "k"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "AUTH", "secret"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "SET", "k", "v"))
+
+	// a failed AUTH keeps the connection authenticated
+	assert.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+		handle(srv, cl, "AUTH", "wrong"))
+	assert.Equal(t, "$1\r\nv\r\n", handle(srv, cl, "GET", "k"))
+
+	assert.Contains(t, srv.Info([]string{"commandstats", "errorstats"}), "cmdstat_set:calls=1,")
+	assert.Contains(t, srv.Info([]string{"commandstats", "errorstats"}), "errorstat_NOAUTH:count=3")
+}
+
+func TestAuthCommandRedacted(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SlowlogLogSlowerThan = 0
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+	monitor := ev.NewClient(2)
+	srv.addMonitor(monitor)
+
+	handle(srv, cl, "AUTH", "default", "secret")
+	handle(srv, cl, "HELLO", "2", "AUTH", "default", "secret", "SETNAME", "x")
+	if assert.Equal(t, 2, len(srv.slowlog.entries)) {
+		assert.Equal(t, []string{"HELLO", "2", "AUTH", "(redacted)", "(redacted)", "(redacted)", "(redacted)"},
+			srv.slowlog.entries[0].argv)
+		assert.Equal(t, []string{"AUTH", "(redacted)", "(redacted)"}, srv.slowlog.entries[1].argv)
+	}
+}
+
+func TestHelloCommand(t *testing.T) {
+	cfg := NewConfig()
+	cfg.RequirePass = "secret"
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+	cl.Id = 7
+
+	assert.Equal(t, "-NOPROTO unsupported protocol version\r\n", handle(srv, cl, "HELLO", "4"))
+	assert.Equal(t, "-ERR Protocol version is not an integer or out of range\r\n", handle(srv, cl, "HELLO", "two"))
+	assert.Equal(t, "-ERR Syntax error in HELLO option 'AUTH'\r\n", handle(srv, cl, "HELLO", "2", "AUTH", "default"))
+	assert.Contains(t, handle(srv, cl, "HELLO"), "-NOAUTH HELLO must be called with the client already authenticated")
+	assert.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+		handle(srv, cl, "HELLO", "2", "AUTH", "default", "wrong"))
+
+	res := handle(srv, cl, "HELLO", "2", "AUTH", "default", "secret", "SETNAME", "worker")
+	assert.Equal(t, "*14\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.0.0\r\n"+
+		"$5\r\nproto\r\n:2\r\n$2\r\nid\r\n:7\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+		"$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", res)
+	assert.Equal(t, "worker", cl.Name)
+	assert.True(t, cl.Authenticated)
+
+	res = handle(srv, cl, "HELLO", "3")
+	assert.Equal(t, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.0.0\r\n"+
+		"$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:7\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n"+
+		"$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", res)
+	assert.Equal(t, 3, cl.Resp)
+	// the version is kept unless given
+	assert.Contains(t, handle(srv, cl, "HELLO"), "$5\r\nproto\r\n:3\r\n")
+}
+
+func TestQuitCommand(t *testing.T) {
+	cfg := NewConfig()
+	cfg.RequirePass = "secret"
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "QUIT"))
+	assert.True(t, cl.IsClosing())
+}
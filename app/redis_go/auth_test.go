@@ -0,0 +1,54 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactArgv(t *testing.T) {
+	argv := []string{"AUTH", "user", "pass"}
+	assert.Equal(t, []string{"AUTH", "(redacted)", "(redacted)"}, redactArgv(argv, 1))
+	assert.Equal(t, []string{"AUTH", "user", "pass"}, argv)
+}
+
+func TestServerAuthenticate(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	assert.False(t, srv.authRequired(cl))
+	// any password matches when none is required
+	assert.True(t, srv.authenticate(cl, "default", "anything"))
+	assert.False(t, srv.authenticate(cl, "other", "anything"))
+
+	cfg := NewConfig()
+	cfg.RequirePass = "secret"
+	srv = NewServer(cfg)
+	cl = ev.NewClient(2)
+	assert.True(t, srv.authRequired(cl))
+	assert.False(t, srv.authenticate(cl, "default", "wrong"))
+	assert.True(t, srv.authRequired(cl))
+	assert.True(t, srv.authenticate(cl, "default", "secret"))
+	assert.False(t, srv.authRequired(cl))
+	assert.Equal(t, "default", cl.User)
+}
+
+func TestServerAuthenticateAclUser(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	assert.NoError(t, srv.acl.setUser("alice", []string{">pass"}))
+	// alice is off until enabled
+	assert.False(t, srv.authenticate(cl, "alice", "pass"))
+
+	assert.NoError(t, srv.acl.setUser("alice", []string{"on"}))
+	assert.False(t, srv.authenticate(cl, "alice", "wrong"))
+	assert.True(t, srv.authenticate(cl, "alice", "pass"))
+	assert.Equal(t, "alice", cl.User)
+
+	// the failures are in the ACL log
+	assert.Len(t, srv.acl.log, 1)
+	assert.Equal(t, "auth", srv.acl.log[0].reason)
+	assert.Equal(t, "AUTH", srv.acl.log[0].object)
+	assert.Equal(t, "alice", srv.acl.log[0].username)
+	assert.Equal(t, 2, srv.acl.log[0].count)
+}
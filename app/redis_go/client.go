@@ -0,0 +1,186 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"sort"
+	"strings"
+	"time"
+)
+
+// clientPause is the state set by CLIENT PAUSE. While it lasts, the
+// commands of the clients are deferred by the event loop and run once it
+// ends.
+type clientPause struct {
+	end time.Time
+	// all pauses every command, not only the writes
+	all bool
+}
+
+// pauseClients pauses the commands of all clients, or only the writes,
+// for d. A pause already in place is only extended, and a pause of all
+// the commands is not narrowed to the writes.
+func (s *Server) pauseClients(d time.Duration, all bool) {
+	end := time.Now().Add(d)
+	if !s.isPaused() {
+		s.pause = clientPause{end: end, all: all}
+		return
+	}
+	if end.After(s.pause.end) {
+		s.pause.end = end
+	}
+	s.pause.all = s.pause.all || all
+}
+
+func (s *Server) unpauseClients() {
+	s.pause = clientPause{}
+}
+
+func (s *Server) isPaused() bool {
+	return time.Now().Before(s.pause.end)
+}
+
+// shouldPause reports whether the command is to wait for the pause to
+// end. CLIENT is never paused, so that a paused server can be unpaused.
+// The scripts are paused with the writes, unless they call a function
+// flagged no-writes.
+func (s *Server) shouldPause(spec *CommandSpec, argv []string) bool {
+	if !s.isPaused() || spec == nil || spec.Name == "client" {
+		return false
+	}
+	if s.pause.all || spec.Is(CmdWrite) {
+		return true
+	}
+	return spec.Is(CmdMayWrite) && !(spec.Name == "fcall" && s.functionNoWrites(argv))
+}
+
+// sortedClients returns the connected clients by ascending id.
+func (s *Server) sortedClients() []*ev.Client {
+	clients := s.Clients()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Id < clients[j].Id
+	})
+	return clients
+}
+
+// clientType is the type CLIENT LIST and CLIENT KILL filter on. There is
+// no replication, so a client is either a normal or a pubsub one.
+func clientType(c *ev.Client) string {
+	if subscriptions(c) > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// isValidClientType accepts the types known to redis, even the ones no
+// client can have yet.
+func isValidClientType(t string) bool {
+	switch t {
+	case "normal", "master", "replica", "slave", "pubsub":
+		return true
+	}
+	return false
+}
+
+func clientFlags(c *ev.Client) string {
+	var flags strings.Builder
+	if c.Monitor {
+		flags.WriteByte('O')
+	}
+	if subscriptions(c) > 0 {
+		flags.WriteByte('P')
+	}
+	if c.IsDeferred() {
+		flags.WriteByte('b')
+	}
+	if c.Tracking != nil {
+		flags.WriteByte('t')
+		if c.Tracking.RedirectBroken {
+			flags.WriteByte('R')
+		}
+		if c.Tracking.Bcast {
+			flags.WriteByte('B')
+		}
+	}
+	if c.NoEvict {
+		flags.WriteByte('e')
+	}
+
+	if c.IsClosing() {
+		flags.WriteByte('A')
+	}
+	if flags.Len() == 0 {
+		return "N"
+	}
+	return flags.String()
+}
+
+// clientInfo formats the client as a line of CLIENT LIST. The fields this
+// server does not track are reported with their idle values.
+func clientInfo(c *ev.Client, now time.Time) string {
+	cmd := c.LastCmd
+	if cmd == "" {
+		cmd = "NULL"
+	}
+	redir := int64(-1)
+	if c.Tracking != nil {
+		redir = c.Tracking.Redirect
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s fd=%d name=%s age=%d idle=%d flags=%s db=%d "+
+		"sub=%d psub=%d ssub=0 multi=-1 qbuf=0 qbuf-free=0 argv-mem=0 multi-mem=0 obl=0 oll=0 "+
+		"omem=%d tot-mem=%d events=r cmd=%s user=%s redir=%d resp=%d\n",
+		c.Id, c.Addr, c.LocalAddr, c.Fd, c.Name,
+		int64(now.Sub(c.Created).Seconds()), int64(now.Sub(c.LastInteraction).Seconds()),
+		clientFlags(c), c.Db, len(c.Channels), len(c.Patterns), c.PendingOutput(), c.MemoryUsage(), cmd, c.User,
+		redir, c.Resp)
+}
+
+// isValidClientName rejects the names that would break the format of
+// CLIENT LIST.
+func isValidClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// clientFilter selects the clients CLIENT KILL closes. Unset fields match
+// every client.
+type clientFilter struct {
+	id     int64
+	hasId  bool
+	addr   string
+	laddr  string
+	user   string
+	typ    string
+	skipMe bool
+}
+
+func (f *clientFilter) match(c *ev.Client, self *ev.Client) bool {
+	switch {
+	case f.skipMe && c == self,
+		f.hasId && c.Id != f.id,
+		f.addr != "" && c.Addr != f.addr,
+		f.laddr != "" && c.LocalAddr != f.laddr,
+		f.user != "" && c.User != f.user,
+		f.typ != "" && clientType(c) != f.typ:
+		return false
+	}
+	return true
+}
+
+// killClients closes the clients matching the filter once the running
+// command is replied to, and returns how many there were.
+func (s *Server) killClients(f *clientFilter, self *ev.Client) int {
+	killed := 0
+	for _, c := range s.Clients() {
+		if c.IsClosing() || !f.match(c, self) {
+			continue
+		}
+		c.CloseAsap()
+		killed++
+	}
+	return killed
+}
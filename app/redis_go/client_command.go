@@ -0,0 +1,458 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ClientCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	name       string
+	typ        string
+	ids        []int64
+	filter     clientFilter
+	// oldKill is the CLIENT KILL addr:port form
+	oldKill bool
+	timeout time.Duration
+	all     bool
+	on      bool
+	reply   ev.ReplyMode
+	// tracking are the options of CLIENT TRACKING
+	tracking ev.Tracking
+}
+
+func NewClientCommand(rr RespReader) *ClientCommand {
+	return &ClientCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ClientCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	args := make([]string, len-1)
+	for i := range args {
+		args[i], err = c.reader.ReadBulkString()
+		if err != nil {
+			return
+		}
+	}
+
+	switch c.subcommand {
+	case "ID", "INFO", "GETNAME", "UNPAUSE", "GETREDIR", "TRACKINGINFO":
+		if len != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "LIST":
+		return c.readListParams(args)
+	case "SETNAME":
+		if len != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		if !isValidClientName(args[0]) {
+			return fmt.Errorf("Client names cannot contain spaces, newlines or special characters.")
+		}
+		c.name = args[0]
+	case "KILL":
+		return c.readKillParams(args)
+	case "PAUSE":
+		return c.readPauseParams(args)
+	case "NO-EVICT":
+		if len != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			c.on = true
+		case "OFF":
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	case "REPLY":
+		if len != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			c.reply = ev.ReplyOn
+		case "OFF":
+			c.reply = ev.ReplyOff
+		case "SKIP":
+			c.reply = ev.ReplySkipNext
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	case "TRACKING":
+		return c.readTrackingParams(args)
+	case "CACHING":
+		if len != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		switch strings.ToUpper(args[0]) {
+		case "YES":
+			c.on = true
+		case "NO":
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+// readTrackingParams reads CLIENT TRACKING ON|OFF [REDIRECT id]
+// [PREFIX prefix ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP].
+func (c *ClientCommand) readTrackingParams(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		c.on = true
+	case "OFF":
+	default:
+		return fmt.Errorf("syntax error")
+	}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i+1 == len(args) {
+				return fmt.Errorf("syntax error")
+			}
+			if c.tracking.Redirect != 0 {
+				return fmt.Errorf("A client can only redirect to a single other client")
+			}
+			i++
+			id, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return fmt.Errorf("value is not an integer or out of range")
+			}
+			c.tracking.Redirect = id
+		case "PREFIX":
+			if i+1 == len(args) {
+				return fmt.Errorf("syntax error")
+			}
+			i++
+			c.tracking.Prefixes = append(c.tracking.Prefixes, args[i])
+		case "BCAST":
+			c.tracking.Bcast = true
+		case "OPTIN":
+			c.tracking.OptIn = true
+		case "OPTOUT":
+			c.tracking.OptOut = true
+		case "NOLOOP":
+			c.tracking.NoLoop = true
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	return nil
+}
+
+// readListParams reads CLIENT LIST [TYPE type] [ID id [id ...]].
+func (c *ClientCommand) readListParams(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch strings.ToUpper(args[0]) {
+	case "TYPE":
+		if len(args) != 2 {
+			return fmt.Errorf("syntax error")
+		}
+		typ, err := readClientType(args[1])
+		if err != nil {
+			return err
+		}
+		c.typ = typ
+	case "ID":
+		if len(args) < 2 {
+			return fmt.Errorf("syntax error")
+		}
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || id <= 0 {
+				return fmt.Errorf("Invalid client ID")
+			}
+			c.ids = append(c.ids, id)
+		}
+	default:
+		return fmt.Errorf("syntax error")
+	}
+	return nil
+}
+
+// readKillParams reads either CLIENT KILL addr:port, or the filters of
+// CLIENT KILL <filter> <value> ...
+func (c *ClientCommand) readKillParams(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	if len(args) == 1 {
+		c.oldKill = true
+		c.filter = clientFilter{addr: args[0]}
+		return nil
+	}
+	if len(args)%2 != 0 {
+		return fmt.Errorf("syntax error")
+	}
+
+	c.filter = clientFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return fmt.Errorf("client-id should be greater than 0")
+			}
+			c.filter.id = id
+			c.filter.hasId = true
+		case "ADDR":
+			c.filter.addr = value
+		case "LADDR":
+			c.filter.laddr = value
+		case "USER":
+			c.filter.user = value
+		case "TYPE":
+			typ, err := readClientType(value)
+			if err != nil {
+				return err
+			}
+			c.filter.typ = typ
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				c.filter.skipMe = true
+			case "no":
+				c.filter.skipMe = false
+			default:
+				return fmt.Errorf("syntax error")
+			}
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	return nil
+}
+
+// readPauseParams reads CLIENT PAUSE timeout [WRITE|ALL], the timeout
+// being in milliseconds.
+func (c *ClientCommand) readPauseParams(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	ms, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || ms < 0 {
+		return fmt.Errorf("timeout is not an integer or out of range")
+	}
+	c.timeout = time.Duration(ms) * time.Millisecond
+
+	c.all = true
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "ALL":
+		case "WRITE":
+			c.all = false
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	return nil
+}
+
+// readClientType checks the type a filter names. slave is the old name
+// of replica.
+func readClientType(t string) (string, error) {
+	t = strings.ToLower(t)
+	if !isValidClientType(t) {
+		return "", fmt.Errorf("Unknown client type '%s'", t)
+	}
+	if t == "slave" {
+		t = "replica"
+	}
+	return t, nil
+}
+
+func (c *ClientCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "ID":
+		return encodeInt(int(cl.Id))
+	case "INFO":
+		return encodeBulkString(clientInfo(cl, time.Now()))
+	case "LIST":
+		return encodeBulkString(c.list(srv))
+	case "SETNAME":
+		cl.Name = c.name
+		return "+OK"
+	case "GETNAME":
+		if cl.Name == "" {
+			return "$-1"
+		}
+		return encodeBulkString(cl.Name)
+	case "KILL":
+		killed := srv.killClients(&c.filter, cl)
+		if !c.oldKill {
+			return encodeInt(killed)
+		}
+		if killed == 0 {
+			return "-ERR No such client"
+		}
+		return "+OK"
+	case "PAUSE":
+		srv.pauseClients(c.timeout, c.all)
+		return "+OK"
+	case "UNPAUSE":
+		srv.unpauseClients()
+		return "+OK"
+	case "NO-EVICT":
+		cl.NoEvict = c.on
+		return "+OK"
+	case "TRACKING":
+		return c.trackingExecute(srv, cl)
+	case "CACHING":
+		return c.caching(cl)
+	case "GETREDIR":
+		if cl.Tracking == nil {
+			return encodeInt(-1)
+		}
+		return encodeInt(int(cl.Tracking.Redirect))
+	case "TRACKINGINFO":
+		return trackingInfo(cl)
+	}
+
+	cl.Reply = c.reply
+	return "+OK"
+}
+
+// trackingExecute turns tracking off, or on after checking that the
+// options agree with the ones of the tracking on already.
+func (c *ClientCommand) trackingExecute(srv *Server, cl *ev.Client) string {
+	if !c.on {
+		srv.disableTracking(cl)
+		return "+OK"
+	}
+
+	t := c.tracking
+	old := cl.Tracking
+	switch {
+	case t.Redirect != 0 && srv.clientById(t.Redirect) == nil:
+		return "-ERR The client ID you want redirect to does not exist"
+	case len(t.Prefixes) > 0 && !t.Bcast:
+		return "-ERR PREFIX option requires BCAST mode to be enabled"
+	case old != nil && old.Bcast != t.Bcast:
+		return "-ERR You can't switch BCAST mode on/off before disabling tracking for this client, " +
+			"and then re-enabling it with a different mode."
+	case t.Bcast && (t.OptIn || t.OptOut):
+		return "-ERR OPTIN and OPTOUT are not compatible with BCAST"
+	case t.OptIn && t.OptOut:
+		return "-ERR You can't use both OPTIN and OPTOUT"
+	case old != nil && (t.OptIn && old.OptOut || t.OptOut && old.OptIn):
+		return "-ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, " +
+			"and then re-enabling it with a different mode."
+	}
+	if t.Bcast {
+		if err := checkPrefixes(cl, t.Prefixes); err != nil {
+			return "-ERR " + err.Error()
+		}
+	}
+
+	srv.enableTracking(cl, t)
+	return "+OK"
+}
+
+// caching sets CLIENT CACHING YES|NO for the next command of the client.
+func (c *ClientCommand) caching(cl *ev.Client) string {
+	t := cl.Tracking
+	switch {
+	case t == nil || !t.OptIn && !t.OptOut:
+		return "-ERR CLIENT CACHING can be called only when the client is in tracking mode " +
+			"with OPTIN or OPTOUT mode enabled"
+	case c.on && !t.OptIn:
+		return "-ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode."
+	case !c.on && !t.OptOut:
+		return "-ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."
+	}
+	t.Caching = true
+	return "+OK"
+}
+
+// trackingInfo is the reply of CLIENT TRACKINGINFO, a map of the flags,
+// the redirection and the prefixes of the client.
+func trackingInfo(cl *ev.Client) string {
+	t := cl.Tracking
+	if t == nil {
+		return encodeMap(cl.Resp, []string{
+			encodeBulkString("flags"), encodeBulkStrings([]string{"off"}),
+			encodeBulkString("redirect"), encodeInt(-1),
+			encodeBulkString("prefixes"), encodeArray(nil),
+		})
+	}
+
+	flags := []string{"on"}
+	if t.Bcast {
+		flags = append(flags, "bcast")
+	}
+	if t.OptIn {
+		flags = append(flags, "optin")
+		if t.Caching {
+			flags = append(flags, "caching-yes")
+		}
+	}
+	if t.OptOut {
+		flags = append(flags, "optout")
+		if t.Caching {
+			flags = append(flags, "caching-no")
+		}
+	}
+	if t.NoLoop {
+		flags = append(flags, "noloop")
+	}
+	if t.RedirectBroken {
+		flags = append(flags, "broken_redirect")
+	}
+	return encodeMap(cl.Resp, []string{
+		encodeBulkString("flags"), encodeBulkStrings(flags),
+		encodeBulkString("redirect"), encodeInt(int(t.Redirect)),
+		encodeBulkString("prefixes"), encodeBulkStrings(trackingPrefixes(t)),
+	})
+}
+
+func (c *ClientCommand) list(srv *Server) string {
+	var sb strings.Builder
+	now := time.Now()
+	for _, cl := range srv.sortedClients() {
+		if c.typ != "" && clientType(cl) != c.typ {
+			continue
+		}
+		if len(c.ids) > 0 && !containsId(c.ids, cl.Id) {
+			continue
+		}
+		sb.WriteString(clientInfo(cl, now))
+	}
+	return sb.String()
+}
+
+func containsId(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientTestServer() (*Server, *ev.Client, *ev.Client) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(5)
+	a.Id = 1
+	a.Addr = "127.0.0.1:5001"
+	b := ev.NewClient(6)
+	b.Id = 2
+	b.Addr = "127.0.0.1:5002"
+	// out of order, LIST sorts by id
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{b, a}})
+	return srv, a, b
+}
+
+func TestClientCommandParamErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, "incorrect number of params"},
+		{[]string{"nope"}, "unknown subcommand 'nope'"},
+		{[]string{"id", "x"}, "incorrect number of params"},
+		{[]string{"setname", "a b"}, "Client names cannot contain spaces, newlines or special characters."},
+		{[]string{"list", "type", "other"}, "Unknown client type 'other'"},
+		{[]string{"list", "id", "0"}, "Invalid client ID"},
+		{[]string{"list", "nope"}, "syntax error"},
+		{[]string{"kill"}, "incorrect number of params"},
+		{[]string{"kill", "id", "1", "addr"}, "syntax error"},
+		{[]string{"kill", "id", "x"}, "client-id should be greater than 0"},
+		{[]string{"kill", "skipme", "maybe"}, "syntax error"},
+		{[]string{"kill", "name", "x"}, "syntax error"},
+		{[]string{"pause", "x"}, "timeout is not an integer or out of range"},
+		{[]string{"pause", "10", "read"}, "syntax error"},
+		{[]string{"no-evict", "maybe"}, "syntax error"},
+		{[]string{"reply", "maybe"}, "syntax error"},
+		{[]string{"tracking"}, "incorrect number of params"},
+		{[]string{"tracking", "maybe"}, "syntax error"},
+		{[]string{"tracking", "on", "nope"}, "syntax error"},
+		{[]string{"tracking", "on", "redirect"}, "syntax error"},
+		{[]string{"tracking", "on", "redirect", "x"}, "value is not an integer or out of range"},
+		{[]string{"tracking", "on", "redirect", "2", "redirect", "3"}, "A client can only redirect to a single other client"},
+		{[]string{"caching", "maybe"}, "syntax error"},
+		{[]string{"getredir", "x"}, "incorrect number of params"},
+	}
+	srv, a, _ := newClientTestServer()
+	for _, tt := range tests {
+		args := append([]string{"CLIENT"}, tt.args...)
+		assert.Equal(t, "-ERR "+tt.err+"\r\n", handle(srv, a, args...), tt.args)
+	}
+}
+
+func TestClientCommandIdAndName(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	assert.Equal(t, ":1\r\n", handle(srv, a, "CLIENT", "ID"))
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "CLIENT", "GETNAME"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "SETNAME", "worker"))
+	assert.Equal(t, "$6\r\nworker\r\n", handle(srv, a, "CLIENT", "GETNAME"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "SETNAME", ""))
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "CLIENT", "GETNAME"))
+}
+
+func TestClientCommandList(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+
+	res := handle(srv, a, "CLIENT", "LIST")
+	lines := strings.Split(strings.TrimSuffix(readBulkReply(t, res), "\n"), "\n")
+	if assert.Equal(t, 2, len(lines)) {
+		assert.True(t, strings.HasPrefix(lines[0], "id=1 addr=127.0.0.1:5001 "))
+		assert.True(t, strings.HasPrefix(lines[1], "id=2 addr=127.0.0.1:5002 "))
+		// the last command is recorded once it ran
+		assert.Contains(t, lines[0], " cmd=NULL ")
+	}
+
+	res = handle(srv, a, "CLIENT", "LIST", "ID", "2", "7")
+	assert.True(t, strings.HasPrefix(readBulkReply(t, res), "id=2 "))
+	assert.Equal(t, 1, strings.Count(res, "id="))
+
+	res = handle(srv, a, "CLIENT", "LIST", "TYPE", "pubsub")
+	assert.Equal(t, "$0\r\n\r\n", res)
+
+	res = handle(srv, a, "CLIENT", "INFO")
+	assert.True(t, strings.HasPrefix(readBulkReply(t, res), "id=1 "))
+	assert.Contains(t, res, " cmd=client ")
+}
+
+func TestClientCommandKill(t *testing.T) {
+	srv, a, b := newClientTestServer()
+	assert.Equal(t, "-ERR No such client\r\n", handle(srv, a, "CLIENT", "KILL", "127.0.0.1:9999"))
+	assert.Equal(t, ":0\r\n", handle(srv, a, "CLIENT", "KILL", "ID", "1"))
+	assert.False(t, a.IsClosing())
+
+	assert.Equal(t, ":1\r\n", handle(srv, a, "CLIENT", "KILL", "USER", "default", "TYPE", "normal"))
+	assert.True(t, b.IsClosing())
+	assert.False(t, a.IsClosing())
+
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "KILL", "127.0.0.1:5001"))
+	assert.True(t, a.IsClosing())
+}
+
+func TestClientCommandPause(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "PAUSE", "60000", "WRITE"))
+
+	// writes are deferred, reads still run
+	assert.Equal(t, "", handle(srv, a, "SET", "k", "v"))
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "GET", "k"))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "UNPAUSE"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "SET", "k", "v"))
+}
+
+func TestClientCommandPauseScripts(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	handle(srv, a, "FUNCTION", "LOAD", "#!lua name=lib\n"+
+		"redis.register_function('set', function(keys) return redis.call('set', keys[1], 'v') end)\n"+
+		"redis.register_function{function_name='get', callback=function(keys) return redis.call('get', keys[1]) end,"+
+		" flags={'no-writes'}}")
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "PAUSE", "60000", "WRITE"))
+
+	// the scripts that may write are deferred, the read-only ones run
+	assert.Equal(t, "", handle(srv, a, "EVAL", "return redis.call('set', 'k', 'v')", "0"))
+	assert.Equal(t, "", handle(srv, a, "EVALSHA", sha1hex("return 1"), "0"))
+	assert.Equal(t, "", handle(srv, a, "FCALL", "set", "1", "k"))
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "EVAL_RO", "return redis.call('get', 'k')", "0"))
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "FCALL", "get", "1", "k"))
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "FCALL_RO", "get", "1", "k"))
+	assert.False(t, srv.Db(a).Exists("k"))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "UNPAUSE"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "FCALL", "set", "1", "k"))
+}
+
+func TestClientCommandNoEvict(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "NO-EVICT", "on"))
+	assert.True(t, a.NoEvict)
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "NO-EVICT", "OFF"))
+	assert.False(t, a.NoEvict)
+}
+
+func TestClientCommandReply(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+
+	assert.Equal(t, "", handle(srv, a, "CLIENT", "REPLY", "OFF"))
+	assert.Equal(t, "", handle(srv, a, "PING"))
+	assert.Equal(t, "", handle(srv, a, "NOPE"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "REPLY", "ON"))
+
+	assert.Equal(t, "", handle(srv, a, "CLIENT", "REPLY", "SKIP"))
+	assert.Equal(t, "", handle(srv, a, "PING"))
+	assert.Equal(t, "+PONG\r\n", handle(srv, a, "PING"))
+}
+
+func TestClientCommandTracking(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	assert.Equal(t, ":-1\r\n", handle(srv, a, "CLIENT", "GETREDIR"))
+	assert.Equal(t, "*6\r\n$5\r\nflags\r\n*1\r\n$3\r\noff\r\n$8\r\nredirect\r\n:-1\r\n$8\r\nprefixes\r\n*0\r\n",
+		handle(srv, a, "CLIENT", "TRACKINGINFO"))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "TRACKING", "on", "REDIRECT", "2", "OPTIN", "NOLOOP"))
+	assert.Equal(t, ":2\r\n", handle(srv, a, "CLIENT", "GETREDIR"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "CACHING", "yes"))
+	assert.Equal(t, "*6\r\n$5\r\nflags\r\n*4\r\n$2\r\non\r\n$5\r\noptin\r\n$11\r\ncaching-yes\r\n"+
+		"$6\r\nnoloop\r\n$8\r\nredirect\r\n:2\r\n$8\r\nprefixes\r\n*0\r\n",
+		handle(srv, a, "CLIENT", "TRACKINGINFO"))
+	assert.Contains(t, readBulkReply(t, handle(srv, a, "CLIENT", "INFO")), " flags=t ")
+
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "TRACKING", "off"))
+	assert.Nil(t, a.Tracking)
+
+	a.Resp = 3
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "CLIENT", "TRACKING", "on", "BCAST", "PREFIX", "b", "PREFIX", "a"))
+	assert.Equal(t, "%3\r\n$5\r\nflags\r\n*2\r\n$2\r\non\r\n$5\r\nbcast\r\n$8\r\nredirect\r\n:0\r\n"+
+		"$8\r\nprefixes\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		handle(srv, a, "CLIENT", "TRACKINGINFO"))
+	assert.Contains(t, readBulkReply(t, handle(srv, a, "CLIENT", "INFO")), " flags=tB ")
+	assert.Contains(t, readBulkReply(t, handle(srv, a, "CLIENT", "INFO")), " redir=0 resp=3\n")
+}
+
+func TestClientCommandTrackingErrors(t *testing.T) {
+	tests := []struct {
+		tracking *ev.Tracking
+		args     []string
+		err      string
+	}{
+		{nil, []string{"tracking", "on", "redirect", "9"}, "The client ID you want redirect to does not exist"},
+		{nil, []string{"tracking", "on", "prefix", "a"}, "PREFIX option requires BCAST mode to be enabled"},
+		{&ev.Tracking{}, []string{"tracking", "on", "bcast"},
+			"You can't switch BCAST mode on/off before disabling tracking for this client, " +
+				"and then re-enabling it with a different mode."},
+		{nil, []string{"tracking", "on", "bcast", "optin"}, "OPTIN and OPTOUT are not compatible with BCAST"},
+		{nil, []string{"tracking", "on", "optin", "optout"}, "You can't use both OPTIN and OPTOUT"},
+		{&ev.Tracking{OptIn: true}, []string{"tracking", "on", "optout"},
+			"You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, " +
+				"and then re-enabling it with a different mode."},
+		{nil, []string{"tracking", "on", "bcast", "prefix", "a", "prefix", "ab"},
+			"Prefix 'a' overlaps with another provided prefix 'ab'. Prefixes for a single client must not overlap."},
+		{nil, []string{"caching", "yes"},
+			"CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled"},
+		{&ev.Tracking{OptOut: true}, []string{"caching", "yes"},
+			"CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode."},
+		{&ev.Tracking{OptIn: true}, []string{"caching", "no"},
+			"CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."},
+	}
+	for _, tt := range tests {
+		srv, a, _ := newClientTestServer()
+		a.Tracking = tt.tracking
+		args := append([]string{"CLIENT"}, tt.args...)
+		assert.Equal(t, "-ERR "+tt.err+"\r\n", handle(srv, a, args...), tt.args)
+	}
+}
+
+// readBulkReply strips the header of a bulk string reply. The lines of
+// CLIENT LIST do not go through RespReader, which reads line by line.
+func readBulkReply(t *testing.T, res string) string {
+	header, body, ok := strings.Cut(res, "\r\n")
+	assert.True(t, ok && strings.HasPrefix(header, "$"))
+	body = strings.TrimSuffix(body, "\r\n")
+	assert.Equal(t, header[1:], strconv.Itoa(len(body)))
+	return body
+}
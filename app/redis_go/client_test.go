@@ -0,0 +1,104 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientInfo(t *testing.T) {
+	now := time.Now()
+	cl := ev.NewClient(8)
+	cl.Id = 3
+	cl.Addr = "127.0.0.1:5000"
+	cl.LocalAddr = "127.0.0.1:6379"
+	cl.Name = "worker"
+	cl.Db = 2
+	cl.Created = now.Add(-10 * time.Second)
+	cl.LastInteraction = now.Add(-2 * time.Second)
+
+	line := clientInfo(cl, now)
+	assert.Contains(t, line, "id=3 addr=127.0.0.1:5000 laddr=127.0.0.1:6379 fd=8 name=worker age=10 idle=2 flags=N db=2 ")
+	assert.Contains(t, line, " cmd=NULL user=default ")
+	assert.True(t, len(line) > 0 && line[len(line)-1] == '\n')
+
+	cl.LastCmd = "get"
+	cl.Monitor = true
+	cl.NoEvict = true
+	line = clientInfo(cl, now)
+	assert.Contains(t, line, " flags=Oe ")
+	assert.Contains(t, line, " cmd=get ")
+
+	cl.Monitor = false
+	cl.Channels = map[string]bool{"a": true, "b": true}
+	cl.Patterns = map[string]bool{"c*": true}
+	line = clientInfo(cl, now)
+	assert.Contains(t, line, " flags=Pe db=2 sub=2 psub=1 ssub=0 ")
+	assert.Equal(t, "pubsub", clientType(cl))
+	assert.Contains(t, line, " redir=-1 resp=2\n")
+
+	cl.Channels = nil
+	cl.Patterns = nil
+	cl.Tracking = &ev.Tracking{Redirect: 4, RedirectBroken: true}
+	cl.Resp = 3
+	line = clientInfo(cl, now)
+	assert.Contains(t, line, " flags=tRe ")
+	assert.Contains(t, line, " redir=4 resp=3\n")
+}
+
+func TestIsValidClientName(t *testing.T) {
+	assert.True(t, isValidClientName("worker-1"))
+	assert.True(t, isValidClientName(""))
+	assert.False(t, isValidClientName("two words"))
+	assert.False(t, isValidClientName("line\n"))
+	assert.False(t, isValidClientName("caf\xc3\xa9"))
+}
+
+func TestServerPauseClients(t *testing.T) {
+	srv := NewServer(NewConfig())
+	set := commandTable["set"]
+	get := commandTable["get"]
+	client := commandTable["client"]
+	assert.False(t, srv.shouldPause(set, nil))
+
+	srv.pauseClients(time.Minute, false)
+	assert.True(t, srv.shouldPause(set, nil))
+	assert.False(t, srv.shouldPause(get, nil))
+	assert.False(t, srv.shouldPause(client, nil))
+
+	// a pause of the writes widens to all the commands, never the reverse
+	srv.pauseClients(time.Second, true)
+	assert.True(t, srv.shouldPause(get, nil))
+	srv.pauseClients(time.Second, false)
+	assert.True(t, srv.shouldPause(get, nil))
+	assert.False(t, srv.shouldPause(client, nil))
+
+	srv.unpauseClients()
+	assert.False(t, srv.shouldPause(set, nil))
+
+	srv.pauseClients(0, true)
+	assert.False(t, srv.shouldPause(set, nil))
+}
+
+func TestServerKillClients(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Id = 1
+	a.Addr = "127.0.0.1:5001"
+	b := ev.NewClient(2)
+	b.Id = 2
+	b.Addr = "127.0.0.1:5002"
+	b.User = "app"
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{a, b}})
+
+	assert.Equal(t, 0, srv.killClients(&clientFilter{user: "nobody"}, a))
+	assert.Equal(t, 1, srv.killClients(&clientFilter{skipMe: true}, a))
+	assert.False(t, a.IsClosing())
+	assert.True(t, b.IsClosing())
+
+	// clients already closing are not counted again
+	assert.Equal(t, 1, srv.killClients(&clientFilter{}, a))
+	assert.True(t, a.IsClosing())
+}
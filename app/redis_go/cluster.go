@@ -0,0 +1,657 @@
+package redis_go
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// clusterPortIncr is added to the port for the cluster bus, unless
+	// cluster-port is set
+	clusterPortIncr = 10000
+	// clusterCronPeriod is how often the cluster pings the other nodes and
+	// handles the messages they sent
+	clusterCronPeriod = 100 * time.Millisecond
+	// clusterFailReportValidityMult and clusterFailUndoTimeMult are the
+	// multiples of the node timeout after which a failure report is
+	// ignored, and a node serving slots is no longer flagged as failed
+	// once it is reachable again
+	clusterFailReportValidityMult = 2
+	clusterFailUndoTimeMult       = 2
+)
+
+// The flags of a node, as shown by CLUSTER NODES.
+const (
+	nodeMyself = 1 << iota
+	nodeMaster
+	// nodePfail nodes do not answer the pings of this node, and nodeFail
+	// ones do not answer those of the majority of the masters
+	nodePfail
+	nodeFail
+	// nodeHandshake nodes have not answered a first ping yet, so their id
+	// is not known
+	nodeHandshake
+	nodeNoAddr
+	// nodeMeet nodes are sent a MEET rather than a PING, so that they add
+	// this node
+	nodeMeet
+)
+
+var nodeFlagNames = []struct {
+	flag int
+	name string
+}{
+	{nodeMyself, "myself"},
+	{nodeMaster, "master"},
+	{nodePfail, "fail?"},
+	{nodeFail, "fail"},
+	{nodeHandshake, "handshake"},
+	{nodeNoAddr, "noaddr"},
+}
+
+// clusterNode is a node of the cluster as known by this one. There is no
+// replication, so every node is a master.
+type clusterNode struct {
+	id          string
+	ip          string
+	port        int
+	cport       int
+	flags       int
+	configEpoch uint64
+	created     time.Time
+	// pingSent is when the ping waiting for a pong was sent, zero when
+	// there is none
+	pingSent     time.Time
+	pongReceived time.Time
+	failTime     time.Time
+	// failReports are the masters that told this node is failing in their
+	// gossip, with when they last did
+	failReports map[string]time.Time
+	// link is the connection this node opened to the node, nil while
+	// there is none
+	link *clusterLink
+}
+
+func newClusterNode(id string, flags int) *clusterNode {
+	return &clusterNode{
+		id:          id,
+		flags:       flags,
+		created:     time.Now(),
+		failReports: map[string]time.Time{},
+	}
+}
+
+func (n *clusterNode) has(flag int) bool {
+	return n.flags&flag != 0
+}
+
+func (n *clusterNode) addr() string {
+	return net.JoinHostPort(n.ip, strconv.Itoa(n.port))
+}
+
+// randomNodeId returns a new node id, 40 hex characters as in redis.
+func randomNodeId() string {
+	id := make([]byte, 20)
+	random.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// cluster is the state of the cluster as known by this node: the nodes
+// and the node serving each slot. It is only accessed by the loop, the
+// bus hands the messages of the other nodes over to clusterCron.
+type cluster struct {
+	myself       *clusterNode
+	currentEpoch uint64
+	nodes        map[string]*clusterNode
+	slots        [clusterSlots]*clusterNode
+	// migrating are the nodes the slots of this node are moved to, and
+	// importing the nodes the slots moved to this node come from, see
+	// CLUSTER SETSLOT
+	migrating [clusterSlots]*clusterNode
+	importing [clusterSlots]*clusterNode
+	ok        bool
+	bus       *clusterBus
+	lastCron  time.Time
+	// Counters for CLUSTER INFO
+	messagesSent     int64
+	messagesReceived int64
+}
+
+func newCluster(config *Config) *cluster {
+	myself := newClusterNode(randomNodeId(), nodeMyself|nodeMaster)
+	myself.port = config.Port
+	myself.cport = config.ClusterPort
+	if myself.cport == 0 {
+		myself.cport = config.Port + clusterPortIncr
+	}
+	return &cluster{
+		myself: myself,
+		nodes:  map[string]*clusterNode{myself.id: myself},
+	}
+}
+
+// StartCluster listens on the port of the cluster bus, when cluster mode
+// is enabled.
+func (s *Server) StartCluster() error {
+	if s.cluster == nil {
+		return nil
+	}
+	bus, err := listenClusterBus(s.cluster.myself.cport)
+	if err != nil {
+		return err
+	}
+	s.cluster.bus = bus
+	return nil
+}
+
+// clusterCron handles the messages received by the bus, connects to the
+// nodes and pings them, and flags the ones that do not answer as failing.
+func (s *Server) clusterCron(now time.Time) {
+	c := s.cluster
+	if c == nil || c.bus == nil || now.Sub(c.lastCron) < clusterCronPeriod {
+		return
+	}
+	c.lastCron = now
+
+	for _, e := range c.bus.events() {
+		if e.msg == nil {
+			if n := e.link.node; n != nil && n.link == e.link {
+				n.link = nil
+			}
+			continue
+		}
+		c.messagesReceived++
+		s.clusterProcessMessage(e, now)
+	}
+
+	timeout := time.Duration(s.config.ClusterNodeTimeout) * time.Millisecond
+	pingInterval := timeout / 2
+	if pingInterval > time.Second {
+		pingInterval = time.Second
+	}
+	handshakeTimeout := timeout
+	if handshakeTimeout < time.Second {
+		handshakeTimeout = time.Second
+	}
+	for _, n := range c.nodes {
+		if n == c.myself || n.has(nodeNoAddr) {
+			continue
+		}
+		if n.has(nodeHandshake) && now.Sub(n.created) > handshakeTimeout {
+			s.clusterDelNode(n)
+			continue
+		}
+		if n.link == nil {
+			n.link = c.bus.connect(n)
+			typ := clusterMsgPing
+			if n.has(nodeMeet) {
+				typ = clusterMsgMeet
+			}
+			s.clusterSendPing(n.link, typ, now)
+		} else if n.pingSent.IsZero() && now.Sub(n.pongReceived) > pingInterval {
+			s.clusterSendPing(n.link, clusterMsgPing, now)
+		}
+		if !n.pingSent.IsZero() && now.Sub(n.pingSent) > timeout && !n.has(nodePfail|nodeFail) {
+			n.flags |= nodePfail
+		}
+	}
+	s.clusterUpdateState()
+}
+
+// clusterProcessMessage handles a message of another node. Only the nodes
+// known already are listened to, besides the MEET of a new one.
+func (s *Server) clusterProcessMessage(e clusterEvent, now time.Time) {
+	c := s.cluster
+	msg := e.msg
+	sender := c.nodes[msg.Sender]
+	if sender != nil && sender.has(nodeHandshake) {
+		sender = nil
+	}
+	if msg.CurrentEpoch > c.currentEpoch {
+		c.currentEpoch = msg.CurrentEpoch
+	}
+
+	if msg.Type == clusterMsgPing || msg.Type == clusterMsgMeet {
+		if c.myself.ip == "" && e.localIp != "" {
+			// the address the other nodes reach this one with
+			c.myself.ip = e.localIp
+		}
+		if sender == nil && msg.Type == clusterMsgMeet {
+			n := newClusterNode(randomNodeId(), nodeHandshake|nodeMaster)
+			n.ip, n.port, n.cport = e.remoteIp, msg.Port, msg.Cport
+			c.nodes[n.id] = n
+			s.clusterProcessGossip(nil, msg, now)
+		}
+		s.clusterSendPing(e.link, clusterMsgPong, now)
+	}
+
+	if msg.Type == clusterMsgPong && e.link.node != nil {
+		n := e.link.node
+		if n.has(nodeHandshake) {
+			if sender != nil || c.nodes[msg.Sender] != nil {
+				// the node is known under its id already
+				s.clusterDelNode(n)
+				return
+			}
+			s.clusterRenameNode(n, msg.Sender)
+			n.flags &^= nodeHandshake | nodeMeet
+			sender = n
+		}
+		if n == sender {
+			n.pongReceived = now
+			n.pingSent = time.Time{}
+			n.flags &^= nodePfail
+			s.clusterClearFailure(n, now)
+		}
+	}
+
+	if sender == nil {
+		return
+	}
+	if msg.Type == clusterMsgFail {
+		if failing := c.nodes[msg.Fail]; failing != nil && failing != c.myself && !failing.has(nodeFail) {
+			failing.flags = failing.flags&^nodePfail | nodeFail
+			failing.failTime = now
+		}
+		return
+	}
+	if msg.ConfigEpoch > sender.configEpoch {
+		sender.configEpoch = msg.ConfigEpoch
+	}
+	s.clusterUpdateSlots(sender, msg.ConfigEpoch, msg.Slots)
+	s.clusterHandleEpochCollision(sender)
+	s.clusterProcessGossip(sender, msg, now)
+}
+
+// clusterProcessGossip learns about the nodes the sender knows: the ones
+// it flags as failing, and the new ones, which this node starts a
+// handshake with.
+func (s *Server) clusterProcessGossip(sender *clusterNode, msg *clusterMsg, now time.Time) {
+	c := s.cluster
+	for _, g := range msg.Gossip {
+		n := c.nodes[g.Id]
+		if n == nil {
+			if g.Ip != "" && g.Flags&(nodeNoAddr|nodeHandshake) == 0 && !s.clusterInHandshake(g.Ip, g.Port) {
+				s.clusterStartHandshake(g.Ip, g.Port, g.Cport, false)
+			}
+			continue
+		}
+		if sender == nil || n == c.myself {
+			continue
+		}
+		if g.Flags&(nodePfail|nodeFail) != 0 {
+			n.failReports[sender.id] = now
+			s.clusterMarkFailing(n, now)
+		} else {
+			delete(n.failReports, sender.id)
+		}
+	}
+}
+
+// clusterMarkFailing flags a node as failed once the majority of the
+// masters serving slots, including this one, report it as failing, and
+// tells every node.
+func (s *Server) clusterMarkFailing(n *clusterNode, now time.Time) {
+	c := s.cluster
+	if !n.has(nodePfail) || n.has(nodeFail) {
+		return
+	}
+	validity := time.Duration(s.config.ClusterNodeTimeout) * time.Millisecond * clusterFailReportValidityMult
+	for id, at := range n.failReports {
+		if now.Sub(at) > validity {
+			delete(n.failReports, id)
+		}
+	}
+	if len(n.failReports)+1 < s.clusterSize()/2+1 {
+		return
+	}
+
+	n.flags = n.flags&^nodePfail | nodeFail
+	n.failTime = now
+	msg := s.clusterMsgHeader(clusterMsgFail)
+	msg.Fail = n.id
+	for _, other := range c.nodes {
+		if other.link != nil && !other.has(nodeHandshake) {
+			s.clusterSend(other.link, msg)
+		}
+	}
+}
+
+// clusterClearFailure forgets that a reachable node failed, at once for a
+// node serving no slots, or after a while for the others so that the
+// failure is seen by the whole cluster.
+func (s *Server) clusterClearFailure(n *clusterNode, now time.Time) {
+	if !n.has(nodeFail) {
+		return
+	}
+	undo := time.Duration(s.config.ClusterNodeTimeout) * time.Millisecond * clusterFailUndoTimeMult
+	if s.clusterNodeSlots(n) == 0 || now.Sub(n.failTime) > undo {
+		n.flags &^= nodeFail
+	}
+}
+
+// clusterUpdateSlots takes the slots the sender claims, from the nodes
+// serving them with an older config. The keys this node had in the slots
+// it lost are deleted.
+func (s *Server) clusterUpdateSlots(sender *clusterNode, epoch uint64, slots []byte) {
+	c := s.cluster
+	var dirty []int
+	for j := 0; j < clusterSlots && j/8 < len(slots); j++ {
+		if slots[j/8]&(1<<(j%8)) == 0 {
+			continue
+		}
+		owner := c.slots[j]
+		if owner == sender || c.importing[j] != nil {
+			continue
+		}
+		if owner != nil && owner.configEpoch >= epoch {
+			continue
+		}
+		if owner == c.myself {
+			if s.dbs[0].CountKeysInSlot(j) > 0 {
+				dirty = append(dirty, j)
+			}
+			c.migrating[j] = nil
+		}
+		c.slots[j] = sender
+	}
+	for _, j := range dirty {
+		s.clusterDelKeysInSlot(j)
+	}
+}
+
+// clusterHandleEpochCollision gives this node a new config epoch when it
+// has the one of the sender, as the configs must be ordered. Only the node
+// with the lower id bumps its epoch.
+func (s *Server) clusterHandleEpochCollision(sender *clusterNode) {
+	c := s.cluster
+	if sender.configEpoch != c.myself.configEpoch || sender.id <= c.myself.id {
+		return
+	}
+	c.currentEpoch++
+	c.myself.configEpoch = c.currentEpoch
+}
+
+// clusterBumpConfigEpoch gives this node the greatest config epoch, so
+// that its claim of the slots it took over wins.
+func (s *Server) clusterBumpConfigEpoch() {
+	c := s.cluster
+	var max uint64
+	for _, n := range c.nodes {
+		if n != c.myself && n.configEpoch > max {
+			max = n.configEpoch
+		}
+	}
+	if c.myself.configEpoch == 0 || c.myself.configEpoch <= max {
+		c.currentEpoch++
+		c.myself.configEpoch = c.currentEpoch
+	}
+}
+
+func (s *Server) clusterDelKeysInSlot(slot int) {
+	db := s.dbs[0]
+	for _, key := range db.KeysInSlot(slot, db.CountKeysInSlot(slot)) {
+		db.Delete(key)
+		s.signalModifiedKey(nil, key)
+	}
+}
+
+// clusterStartHandshake adds a node at the address, which is renamed once
+// it answers with its id. With meet, it is asked to add this node too.
+func (s *Server) clusterStartHandshake(ip string, port int, cport int, meet bool) {
+	n := newClusterNode(randomNodeId(), nodeHandshake|nodeMaster)
+	if meet {
+		n.flags |= nodeMeet
+	}
+	n.ip, n.port, n.cport = ip, port, cport
+	s.cluster.nodes[n.id] = n
+}
+
+func (s *Server) clusterInHandshake(ip string, port int) bool {
+	for _, n := range s.cluster.nodes {
+		if n.has(nodeHandshake) && n.ip == ip && n.port == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) clusterRenameNode(n *clusterNode, id string) {
+	delete(s.cluster.nodes, n.id)
+	n.id = id
+	s.cluster.nodes[id] = n
+}
+
+// clusterDelNode forgets a node, along with the slots it served and the
+// failures it reported.
+func (s *Server) clusterDelNode(n *clusterNode) {
+	c := s.cluster
+	for j := range c.slots {
+		if c.slots[j] == n {
+			c.slots[j] = nil
+		}
+		if c.migrating[j] == n {
+			c.migrating[j] = nil
+		}
+		if c.importing[j] == n {
+			c.importing[j] = nil
+		}
+	}
+	for _, other := range c.nodes {
+		delete(other.failReports, n.id)
+	}
+	if n.link != nil {
+		n.link.close()
+	}
+	delete(c.nodes, n.id)
+}
+
+// clusterNodeSlots is the number of slots a node serves.
+func (s *Server) clusterNodeSlots(n *clusterNode) int {
+	count := 0
+	for _, owner := range s.cluster.slots {
+		if owner == n {
+			count++
+		}
+	}
+	return count
+}
+
+// clusterSize is the number of masters serving slots.
+func (s *Server) clusterSize() int {
+	masters := map[*clusterNode]bool{}
+	for _, owner := range s.cluster.slots {
+		if owner != nil {
+			masters[owner] = true
+		}
+	}
+	return len(masters)
+}
+
+// clusterUpdateState tells whether the cluster can serve the keys: all the
+// slots must be served by a node that did not fail, unless full coverage
+// is not required, and this node must reach the majority of the masters.
+func (s *Server) clusterUpdateState() {
+	c := s.cluster
+	ok := true
+	masters := map[*clusterNode]bool{}
+	for _, owner := range c.slots {
+		if owner == nil || owner.has(nodeFail) {
+			if s.config.ClusterRequireFullCoverage {
+				ok = false
+			}
+			continue
+		}
+		masters[owner] = true
+	}
+
+	reachable := 0
+	for n := range masters {
+		if !n.has(nodePfail) {
+			reachable++
+		}
+	}
+	if reachable < len(masters)/2+1 {
+		ok = false
+	}
+	c.ok = ok
+}
+
+// clusterRedirect returns the error redirecting the command elsewhere, or
+// nothing when this node is to run it: when it serves the slot of the
+// keys, or imports it and the client sent ASKING.
+func (s *Server) clusterRedirect(cmd Command, cl *ev.Client) string {
+	c := s.cluster
+	if c == nil {
+		return ""
+	}
+	spec := cmd.Spec()
+	keys := spec.Keys(cmd.Argv())
+	if len(keys) == 0 {
+		return ""
+	}
+	slot := keyHashSlot(keys[0])
+	for _, key := range keys[1:] {
+		if keyHashSlot(key) != slot {
+			return "-CROSSSLOT Keys in request don't hash to the same slot"
+		}
+	}
+
+	n := c.slots[slot]
+	if n == nil {
+		return "-CLUSTERDOWN Hash slot not served"
+	}
+	if !c.ok {
+		return "-CLUSTERDOWN The cluster is down"
+	}
+
+	migrating := n == c.myself && c.migrating[slot] != nil
+	importing := c.importing[slot] != nil
+	if (migrating || importing) && spec.Name == "migrate" {
+		return ""
+	}
+	missing := 0
+	if migrating || importing {
+		db := s.Db(cl)
+		for _, key := range keys {
+			if !db.Exists(key) {
+				missing++
+			}
+		}
+	}
+	if migrating && missing > 0 {
+		if missing < len(keys) {
+			return "-TRYAGAIN Multiple keys request during rehashing of slot"
+		}
+		return fmt.Sprintf("-ASK %d %s", slot, c.migrating[slot].addr())
+	}
+	if importing && (cl.Asking || spec.Is(CmdAsking)) {
+		if len(keys) > 1 && missing > 0 {
+			return "-TRYAGAIN Multiple keys request during rehashing of slot"
+		}
+		return ""
+	}
+	if n != c.myself {
+		return fmt.Sprintf("-MOVED %d %s", slot, n.addr())
+	}
+	return ""
+}
+
+// clusterNodeFlags formats the flags of a node as CLUSTER NODES does.
+func clusterNodeFlags(n *clusterNode) string {
+	var flags []string
+	for _, f := range nodeFlagNames {
+		if n.has(f.flag) {
+			flags = append(flags, f.name)
+		}
+	}
+	if len(flags) == 0 {
+		return "noflags"
+	}
+	return strings.Join(flags, ",")
+}
+
+// slotRange is a range of slots served by a node, bounds included.
+type slotRange struct {
+	start int
+	end   int
+	node  *clusterNode
+}
+
+// clusterSlotRanges returns the ranges of contiguous slots served by the
+// same node, in order.
+func (s *Server) clusterSlotRanges() []slotRange {
+	var ranges []slotRange
+	for j, owner := range s.cluster.slots {
+		if owner == nil {
+			continue
+		}
+		if l := len(ranges); l > 0 && ranges[l-1].node == owner && ranges[l-1].end == j-1 {
+			ranges[l-1].end = j
+			continue
+		}
+		ranges = append(ranges, slotRange{start: j, end: j, node: owner})
+	}
+	return ranges
+}
+
+// clusterNodeLine formats a node as a line of CLUSTER NODES.
+func (s *Server) clusterNodeLine(n *clusterNode) string {
+	c := s.cluster
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s:%d@%d %s - ", n.id, n.ip, n.port, n.cport, clusterNodeFlags(n))
+
+	var pingSent, pongReceived int64
+	if n != c.myself {
+		if !n.pingSent.IsZero() {
+			pingSent = n.pingSent.UnixMilli()
+		}
+		if !n.pongReceived.IsZero() {
+			pongReceived = n.pongReceived.UnixMilli()
+		}
+	}
+	linkState := "disconnected"
+	if n == c.myself || n.link != nil {
+		linkState = "connected"
+	}
+	fmt.Fprintf(&sb, "%d %d %d %s", pingSent, pongReceived, n.configEpoch, linkState)
+
+	for _, r := range s.clusterSlotRanges() {
+		if r.node != n {
+			continue
+		}
+		if r.start == r.end {
+			fmt.Fprintf(&sb, " %d", r.start)
+		} else {
+			fmt.Fprintf(&sb, " %d-%d", r.start, r.end)
+		}
+	}
+	if n == c.myself {
+		for j := 0; j < clusterSlots; j++ {
+			if c.migrating[j] != nil {
+				fmt.Fprintf(&sb, " [%d->-%s]", j, c.migrating[j].id)
+			}
+			if c.importing[j] != nil {
+				fmt.Fprintf(&sb, " [%d-<-%s]", j, c.importing[j].id)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// clusterMyslotsBitmap is the bitmap of the slots this node serves, as
+// sent to the other nodes.
+func (s *Server) clusterMyslotsBitmap() []byte {
+	bitmap := make([]byte, clusterSlots/8)
+	for j, owner := range s.cluster.slots {
+		if owner == s.cluster.myself {
+			bitmap[j/8] |= 1 << (j % 8)
+		}
+	}
+	return bitmap
+}
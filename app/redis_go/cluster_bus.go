@@ -0,0 +1,280 @@
+package redis_go
+
+import (
+	"encoding/gob"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clusterLinkBuffer is the number of messages queued on a link before the
+// next ones are dropped, as the node is too slow to read them.
+const clusterLinkBuffer = 64
+
+const (
+	clusterMsgPing = iota
+	clusterMsgPong
+	clusterMsgMeet
+	clusterMsgFail
+)
+
+// clusterMsg is a message of the cluster bus. Unlike redis, whose nodes
+// this one can not talk with, the messages are gob encoded.
+type clusterMsg struct {
+	Type         int
+	Sender       string
+	Port         int
+	Cport        int
+	Flags        int
+	CurrentEpoch uint64
+	ConfigEpoch  uint64
+	// Slots is the bitmap of the slots the sender serves
+	Slots  []byte
+	Gossip []clusterGossip
+	// Fail is the id of the node a FAIL message is about
+	Fail string
+}
+
+// clusterGossip is what the sender of a message knows about another node.
+type clusterGossip struct {
+	Id    string
+	Ip    string
+	Port  int
+	Cport int
+	Flags int
+}
+
+// clusterEvent is a message read from a link, or the link being closed
+// when msg is nil, along with the addresses of both ends.
+type clusterEvent struct {
+	link     *clusterLink
+	msg      *clusterMsg
+	remoteIp string
+	localIp  string
+}
+
+// clusterBus accepts the links of the other nodes and connects to them.
+// The links are served by goroutines of their own, which hand the messages
+// over to the loop through the inbox.
+type clusterBus struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	inbox []clusterEvent
+	links map[*clusterLink]bool
+}
+
+func listenClusterBus(port int) (*clusterBus, error) {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, err
+	}
+	b := &clusterBus{ln: ln, links: map[*clusterLink]bool{}}
+	go b.accept()
+	return b, nil
+}
+
+func (b *clusterBus) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.newLink().serve(conn)
+	}
+}
+
+// connect opens a link to a node. Messages can be sent on it right away,
+// they are queued until the node is connected.
+func (b *clusterBus) connect(n *clusterNode) *clusterLink {
+	l := b.newLink()
+	l.node = n
+	addr := net.JoinHostPort(n.ip, strconv.Itoa(n.cport))
+	go func() {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			l.close()
+			return
+		}
+		l.serve(conn)
+	}()
+	return l
+}
+
+func (b *clusterBus) newLink() *clusterLink {
+	l := &clusterLink{
+		bus:  b,
+		out:  make(chan *clusterMsg, clusterLinkBuffer),
+		done: make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.links[l] = true
+	b.mu.Unlock()
+	return l
+}
+
+func (b *clusterBus) post(e clusterEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inbox = append(b.inbox, e)
+	if e.msg == nil {
+		delete(b.links, e.link)
+	}
+}
+
+// events returns the events posted since the last call.
+func (b *clusterBus) events() []clusterEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := b.inbox
+	b.inbox = nil
+	return events
+}
+
+// close stops accepting links and closes the open ones.
+func (b *clusterBus) close() {
+	b.ln.Close()
+	b.mu.Lock()
+	links := make([]*clusterLink, 0, len(b.links))
+	for l := range b.links {
+		links = append(links, l)
+	}
+	b.mu.Unlock()
+	for _, l := range links {
+		l.close()
+	}
+}
+
+// clusterLink is a connection between two nodes. The links a node opens
+// carry its pings and the pongs answering them, those it accepts the pings
+// of the other node.
+type clusterLink struct {
+	bus *clusterBus
+	// node is the node the link was opened to, nil for the links accepted.
+	// It is only accessed by the loop.
+	node *clusterNode
+	out  chan *clusterMsg
+	done chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// send queues a message, which is dropped when the link is closed or too
+// many are queued already.
+func (l *clusterLink) send(msg *clusterMsg) {
+	select {
+	case <-l.done:
+	case l.out <- msg:
+	default:
+	}
+}
+
+func (l *clusterLink) serve(conn net.Conn) {
+	l.mu.Lock()
+	select {
+	case <-l.done:
+		l.mu.Unlock()
+		conn.Close()
+		return
+	default:
+	}
+	l.conn = conn
+	l.mu.Unlock()
+
+	go l.read(conn)
+	enc := gob.NewEncoder(conn)
+	for {
+		select {
+		case msg := <-l.out:
+			if err := enc.Encode(msg); err != nil {
+				l.close()
+				return
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *clusterLink) read(conn net.Conn) {
+	remoteIp, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	localIp, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	dec := gob.NewDecoder(conn)
+	for {
+		msg := &clusterMsg{}
+		if err := dec.Decode(msg); err != nil {
+			l.close()
+			return
+		}
+		l.bus.post(clusterEvent{link: l, msg: msg, remoteIp: remoteIp, localIp: localIp})
+	}
+}
+
+// close closes the connection, and tells the loop the link is gone.
+func (l *clusterLink) close() {
+	l.once.Do(func() {
+		close(l.done)
+		l.mu.Lock()
+		if l.conn != nil {
+			l.conn.Close()
+		}
+		l.mu.Unlock()
+		l.bus.post(clusterEvent{link: l})
+	})
+}
+
+// clusterMsgHeader returns a message of the type telling the other nodes
+// about this one.
+func (s *Server) clusterMsgHeader(typ int) *clusterMsg {
+	c := s.cluster
+	return &clusterMsg{
+		Type:         typ,
+		Sender:       c.myself.id,
+		Port:         c.myself.port,
+		Cport:        c.myself.cport,
+		Flags:        c.myself.flags,
+		CurrentEpoch: c.currentEpoch,
+		ConfigEpoch:  c.myself.configEpoch,
+		Slots:        s.clusterMyslotsBitmap(),
+	}
+}
+
+func (s *Server) clusterSend(l *clusterLink, msg *clusterMsg) {
+	s.cluster.messagesSent++
+	l.send(msg)
+}
+
+// clusterSendPing sends a PING, PONG or MEET, telling about the nodes this
+// one knows. As clusters are small, every node is gossiped about, rather
+// than some of them as in redis.
+func (s *Server) clusterSendPing(l *clusterLink, typ int, now time.Time) {
+	c := s.cluster
+	msg := s.clusterMsgHeader(typ)
+	for _, n := range c.nodes {
+		if n == c.myself || n.has(nodeHandshake|nodeNoAddr) {
+			continue
+		}
+		msg.Gossip = append(msg.Gossip, clusterGossip{
+			Id:    n.id,
+			Ip:    n.ip,
+			Port:  n.port,
+			Cport: n.cport,
+			Flags: n.flags,
+		})
+	}
+	if typ != clusterMsgPong && l.node != nil && l.node.pingSent.IsZero() {
+		l.node.pingSent = now
+	}
+	s.clusterSend(l, msg)
+}
+
+// clusterBroadcastPong tells every node about a change of the slots of
+// this one, rather than waiting for the next pings.
+func (s *Server) clusterBroadcastPong(now time.Time) {
+	for _, n := range s.cluster.nodes {
+		if n.link != nil && !n.has(nodeHandshake) {
+			s.clusterSendPing(n.link, clusterMsgPong, now)
+		}
+	}
+}
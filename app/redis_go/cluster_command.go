@@ -0,0 +1,413 @@
+package redis_go
+
+import (
+	"fmt"
+	"net"
+	"redis-go/app/ev"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errClusterDisabled = "-ERR This instance has cluster support disabled"
+
+type ClusterCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+	slots      []int
+	count      int
+	// ip, port and cport are the address of CLUSTER MEET
+	ip    string
+	port  int
+	cport int
+}
+
+func NewClusterCommand(rr RespReader) *ClusterCommand {
+	return &ClusterCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ClusterCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args, err = readBulkStrings(c.reader, len-1)
+	if err != nil {
+		return
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "MYID", "INFO", "NODES", "SLOTS", "SHARDS":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "MEET":
+		if n != 2 && n != 3 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		return c.readMeetParams()
+	case "ADDSLOTS", "DELSLOTS":
+		if n < 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		seen := map[int]bool{}
+		for _, arg := range c.args {
+			slot, err := readSlot(arg)
+			if err != nil {
+				return err
+			}
+			if seen[slot] {
+				return fmt.Errorf("Slot %d specified multiple times", slot)
+			}
+			seen[slot] = true
+			c.slots = append(c.slots, slot)
+		}
+	case "SETSLOT":
+		return c.readSetslotParams()
+	case "KEYSLOT":
+		if n != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "COUNTKEYSINSLOT":
+		if n != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		slot, err := strconv.Atoi(c.args[0])
+		if err != nil || slot < 0 || slot >= clusterSlots {
+			return fmt.Errorf("Invalid slot")
+		}
+		c.slots = []int{slot}
+	case "GETKEYSINSLOT":
+		if n != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		slot, err := strconv.Atoi(c.args[0])
+		count, errCount := strconv.Atoi(c.args[1])
+		if err != nil || errCount != nil || count < 0 {
+			return fmt.Errorf("Invalid slot or number of keys")
+		}
+		if slot < 0 || slot >= clusterSlots {
+			return fmt.Errorf("Invalid slot")
+		}
+		c.slots, c.count = []int{slot}, count
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+// readMeetParams reads CLUSTER MEET ip port [cport].
+func (c *ClusterCommand) readMeetParams() error {
+	c.ip = c.args[0]
+	port, err := strconv.Atoi(c.args[1])
+	if err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("Invalid base port specified: %s", c.args[1])
+	}
+	c.port, c.cport = port, port+clusterPortIncr
+	if len(c.args) == 3 {
+		cport, err := strconv.Atoi(c.args[2])
+		if err != nil || cport <= 0 || cport > 65535 {
+			return fmt.Errorf("Invalid bus port specified: %s", c.args[2])
+		}
+		c.cport = cport
+	}
+	if net.ParseIP(c.ip) == nil || c.cport > 65535 {
+		return fmt.Errorf("Invalid node address specified: %s:%s", c.args[0], c.args[1])
+	}
+	return nil
+}
+
+// readSetslotParams reads CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE
+// node-id, or CLUSTER SETSLOT slot STABLE.
+func (c *ClusterCommand) readSetslotParams() error {
+	if len(c.args) < 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	slot, err := readSlot(c.args[0])
+	if err != nil {
+		return err
+	}
+	c.slots = []int{slot}
+	c.args[1] = strings.ToUpper(c.args[1])
+	switch c.args[1] {
+	case "IMPORTING", "MIGRATING", "NODE":
+		if len(c.args) != 3 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "STABLE":
+		if len(c.args) != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	default:
+		return fmt.Errorf("Invalid CLUSTER SETSLOT action or number of arguments. " +
+			"Try CLUSTER HELP")
+	}
+	return nil
+}
+
+func readSlot(arg string) (int, error) {
+	slot, err := strconv.Atoi(arg)
+	if err != nil || slot < 0 || slot >= clusterSlots {
+		return 0, fmt.Errorf("Invalid or out of range slot")
+	}
+	return slot, nil
+}
+
+func (c *ClusterCommand) Execute(srv *Server, cl *ev.Client) string {
+	if srv.cluster == nil {
+		return errClusterDisabled
+	}
+
+	switch c.subcommand {
+	case "MYID":
+		return encodeBulkString(srv.cluster.myself.id)
+	case "INFO":
+		return encodeBulkString(srv.clusterInfo())
+	case "NODES":
+		var sb strings.Builder
+		for _, n := range srv.clusterSortedNodes() {
+			sb.WriteString(srv.clusterNodeLine(n))
+			sb.WriteString("\n")
+		}
+		return encodeBulkString(sb.String())
+	case "SLOTS":
+		return srv.clusterSlotsReply(cl)
+	case "SHARDS":
+		return srv.clusterShardsReply(cl)
+	case "MEET":
+		if !srv.clusterInHandshake(c.ip, c.port) {
+			srv.clusterStartHandshake(c.ip, c.port, c.cport, true)
+		}
+		return "+OK"
+	case "ADDSLOTS":
+		return srv.clusterAddSlots(c.slots)
+	case "DELSLOTS":
+		return srv.clusterDelSlots(c.slots)
+	case "SETSLOT":
+		return srv.clusterSetSlot(c.slots[0], c.args[1], c.args[2:])
+	case "KEYSLOT":
+		return encodeInt(keyHashSlot(c.args[0]))
+	case "COUNTKEYSINSLOT":
+		return encodeInt(srv.dbs[0].CountKeysInSlot(c.slots[0]))
+	}
+	return encodeBulkStrings(srv.dbs[0].KeysInSlot(c.slots[0], c.count))
+}
+
+func (s *Server) clusterInfo() string {
+	c := s.cluster
+	state := "fail"
+	if c.ok {
+		state = "ok"
+	}
+	assigned, pfail, fail := 0, 0, 0
+	for _, n := range c.slots {
+		switch {
+		case n == nil:
+			continue
+		case n.has(nodeFail):
+			fail++
+		case n.has(nodePfail):
+			pfail++
+		}
+		assigned++
+	}
+	return fmt.Sprintf("cluster_state:%s\r\n"+
+		"cluster_slots_assigned:%d\r\n"+
+		"cluster_slots_ok:%d\r\n"+
+		"cluster_slots_pfail:%d\r\n"+
+		"cluster_slots_fail:%d\r\n"+
+		"cluster_known_nodes:%d\r\n"+
+		"cluster_size:%d\r\n"+
+		"cluster_current_epoch:%d\r\n"+
+		"cluster_my_epoch:%d\r\n"+
+		"cluster_stats_messages_sent:%d\r\n"+
+		"cluster_stats_messages_received:%d\r\n",
+		state, assigned, assigned-pfail-fail, pfail, fail, len(c.nodes), s.clusterSize(),
+		c.currentEpoch, c.myself.configEpoch, c.messagesSent, c.messagesReceived)
+}
+
+// clusterSortedNodes returns the nodes by id, so that the replies do not
+// change between calls.
+func (s *Server) clusterSortedNodes() []*clusterNode {
+	nodes := make([]*clusterNode, 0, len(s.cluster.nodes))
+	for _, n := range s.cluster.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].id < nodes[j].id
+	})
+	return nodes
+}
+
+func (s *Server) clusterSlotsReply(cl *ev.Client) string {
+	ranges := s.clusterSlotRanges()
+	elems := make([]string, len(ranges))
+	for i, r := range ranges {
+		node := encodeArray([]string{
+			encodeBulkString(r.node.ip),
+			encodeInt(r.node.port),
+			encodeBulkString(r.node.id),
+			encodeMap(cl.Resp, nil),
+		})
+		elems[i] = encodeArray([]string{encodeInt(r.start), encodeInt(r.end), node})
+	}
+	return encodeArray(elems)
+}
+
+// clusterShardsReply lists the shards, each a master and the ranges of
+// slots it serves as there are no replicas.
+func (s *Server) clusterShardsReply(cl *ev.Client) string {
+	ranges := s.clusterSlotRanges()
+	var shards []string
+	for _, n := range s.clusterSortedNodes() {
+		if n.has(nodeHandshake) {
+			continue
+		}
+		var slots []string
+		for _, r := range ranges {
+			if r.node == n {
+				slots = append(slots, encodeInt(r.start), encodeInt(r.end))
+			}
+		}
+		health := "online"
+		if n.has(nodeFail) {
+			health = "fail"
+		}
+		node := encodeMap(cl.Resp, []string{
+			encodeBulkString("id"), encodeBulkString(n.id),
+			encodeBulkString("port"), encodeInt(n.port),
+			encodeBulkString("ip"), encodeBulkString(n.ip),
+			encodeBulkString("endpoint"), encodeBulkString(n.ip),
+			encodeBulkString("role"), encodeBulkString("master"),
+			encodeBulkString("replication-offset"), encodeInt(0),
+			encodeBulkString("health"), encodeBulkString(health),
+		})
+		shards = append(shards, encodeMap(cl.Resp, []string{
+			encodeBulkString("slots"), encodeArray(slots),
+			encodeBulkString("nodes"), encodeArray([]string{node}),
+		}))
+	}
+	return encodeArray(shards)
+}
+
+func (s *Server) clusterAddSlots(slots []int) string {
+	c := s.cluster
+	for _, slot := range slots {
+		if c.slots[slot] != nil {
+			return fmt.Sprintf("-ERR Slot %d is already busy", slot)
+		}
+	}
+	for _, slot := range slots {
+		c.slots[slot] = c.myself
+		c.importing[slot] = nil
+	}
+	s.clusterSlotsChanged()
+	return "+OK"
+}
+
+func (s *Server) clusterDelSlots(slots []int) string {
+	c := s.cluster
+	for _, slot := range slots {
+		if c.slots[slot] == nil {
+			return fmt.Sprintf("-ERR Slot %d is already unassigned", slot)
+		}
+	}
+	for _, slot := range slots {
+		c.slots[slot] = nil
+		c.migrating[slot] = nil
+		c.importing[slot] = nil
+	}
+	s.clusterSlotsChanged()
+	return "+OK"
+}
+
+// clusterSetSlot moves a slot between nodes: the node serving it is set
+// MIGRATING to the target and the target IMPORTING from it, the keys are
+// moved with MIGRATE, then both are told the NODE serving it now.
+func (s *Server) clusterSetSlot(slot int, action string, args []string) string {
+	c := s.cluster
+	var n *clusterNode
+	if len(args) == 1 {
+		if n = c.nodes[args[0]]; n == nil {
+			return fmt.Sprintf("-ERR I don't know about node %s", args[0])
+		}
+	}
+
+	switch action {
+	case "MIGRATING":
+		if c.slots[slot] != c.myself {
+			return fmt.Sprintf("-ERR I'm not the owner of hash slot %d", slot)
+		}
+		c.migrating[slot] = n
+	case "IMPORTING":
+		if c.slots[slot] == c.myself {
+			return fmt.Sprintf("-ERR I'm already the owner of hash slot %d", slot)
+		}
+		c.importing[slot] = n
+	case "STABLE":
+		c.migrating[slot] = nil
+		c.importing[slot] = nil
+	case "NODE":
+		if c.slots[slot] == c.myself && n != c.myself {
+			if s.dbs[0].CountKeysInSlot(slot) > 0 {
+				return fmt.Sprintf("-ERR Can't assign hashslot %d to a different node while I still hold "+
+					"keys for this hash slot.", slot)
+			}
+			c.migrating[slot] = nil
+		}
+		c.slots[slot] = n
+		if n == c.myself && c.importing[slot] != nil {
+			// the slot was imported, the other nodes have to take this
+			// node's word for it
+			c.importing[slot] = nil
+			s.clusterBumpConfigEpoch()
+		}
+	}
+	s.clusterSlotsChanged()
+	return "+OK"
+}
+
+func (s *Server) clusterSlotsChanged() {
+	s.clusterUpdateState()
+	if s.cluster.bus != nil {
+		s.clusterBroadcastPong(time.Now())
+	}
+}
+
+// AskingCommand lets the next command of the client be served by this
+// node while it imports the slot of the keys.
+type AskingCommand struct {
+	BaseCommand
+}
+
+func NewAskingCommand() *AskingCommand {
+	return &AskingCommand{BaseCommand: NewBaseCommand()}
+}
+
+func (c *AskingCommand) ReadParams(len int) error {
+	if len != 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	return nil
+}
+
+func (c *AskingCommand) Execute(srv *Server, cl *ev.Client) string {
+	if srv.cluster == nil {
+		return errClusterDisabled
+	}
+	cl.Asking = true
+	return "+OK"
+}
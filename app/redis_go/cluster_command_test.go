@@ -0,0 +1,157 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newClusterCommandTestServer() (*Server, *ev.Client) {
+	config := NewConfig()
+	config.ClusterEnabled = true
+	return NewServer(config), ev.NewClient(5)
+}
+
+func TestClusterCommandParamErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, "incorrect number of params"},
+		{[]string{"nope"}, "unknown subcommand 'nope'"},
+		{[]string{"nodes", "x"}, "incorrect number of params"},
+		{[]string{"meet", "127.0.0.1"}, "incorrect number of params"},
+		{[]string{"meet", "127.0.0.1", "x"}, "Invalid base port specified: x"},
+		{[]string{"meet", "127.0.0.1", "7000", "0"}, "Invalid bus port specified: 0"},
+		{[]string{"meet", "localhost", "7000"}, "Invalid node address specified: localhost:7000"},
+		{[]string{"meet", "127.0.0.1", "60000"}, "Invalid node address specified: 127.0.0.1:60000"},
+		{[]string{"addslots"}, "incorrect number of params"},
+		{[]string{"addslots", "16384"}, "Invalid or out of range slot"},
+		{[]string{"addslots", "1", "2", "1"}, "Slot 1 specified multiple times"},
+		{[]string{"delslots", "x"}, "Invalid or out of range slot"},
+		{[]string{"setslot", "1"}, "incorrect number of params"},
+		{[]string{"setslot", "1", "stable", "x"}, "incorrect number of params"},
+		{[]string{"setslot", "1", "node"}, "incorrect number of params"},
+		{[]string{"setslot", "1", "nope"}, "Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP"},
+		{[]string{"countkeysinslot", "-1"}, "Invalid slot"},
+		{[]string{"getkeysinslot", "1", "x"}, "Invalid slot or number of keys"},
+		{[]string{"getkeysinslot", "16384", "1"}, "Invalid slot"},
+	}
+	srv, cl := newClusterCommandTestServer()
+	for _, tt := range tests {
+		args := append([]string{"CLUSTER"}, tt.args...)
+		assert.Equal(t, "-ERR "+tt.err+"\r\n", handle(srv, cl, args...), tt.args)
+	}
+}
+
+func TestClusterCommandDisabled(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(5)
+	assert.Equal(t, "-ERR This instance has cluster support disabled\r\n", handle(srv, cl, "CLUSTER", "NODES"))
+	assert.Equal(t, "-ERR This instance has cluster support disabled\r\n", handle(srv, cl, "ASKING"))
+	assert.Contains(t, srv.Info(nil), "cluster_enabled:0\r\n")
+}
+
+func TestClusterCommandSlots(t *testing.T) {
+	srv, cl := newClusterCommandTestServer()
+	id := srv.cluster.myself.id
+	assert.Equal(t, "$40\r\n"+id+"\r\n", handle(srv, cl, "CLUSTER", "MYID"))
+	assert.Contains(t, srv.Info(nil), "cluster_enabled:1\r\n")
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "ADDSLOTS", "0", "1", "2", "5"))
+	assert.Equal(t, "-ERR Slot 2 is already busy\r\n", handle(srv, cl, "CLUSTER", "ADDSLOTS", "3", "2"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "DELSLOTS", "1"))
+	assert.Equal(t, "-ERR Slot 1 is already unassigned\r\n", handle(srv, cl, "CLUSTER", "DELSLOTS", "1"))
+
+	nodes := readBulkReply(t, handle(srv, cl, "CLUSTER", "NODES"))
+	// the address of this node is only known once another one connected
+	assert.Equal(t, id+" :6379@16379 myself,master - 0 0 0 connected 0 2 5\n", nodes)
+	assert.Equal(t, "*3\r\n"+
+		"*3\r\n:0\r\n:0\r\n*4\r\n$0\r\n\r\n:6379\r\n$40\r\n"+id+"\r\n*0\r\n"+
+		"*3\r\n:2\r\n:2\r\n*4\r\n$0\r\n\r\n:6379\r\n$40\r\n"+id+"\r\n*0\r\n"+
+		"*3\r\n:5\r\n:5\r\n*4\r\n$0\r\n\r\n:6379\r\n$40\r\n"+id+"\r\n*0\r\n",
+		handle(srv, cl, "CLUSTER", "SLOTS"))
+
+	shards := handle(srv, cl, "CLUSTER", "SHARDS")
+	assert.True(t, strings.HasPrefix(shards, "*1\r\n*4\r\n$5\r\nslots\r\n*6\r\n:0\r\n:0\r\n:2\r\n:2\r\n:5\r\n:5\r\n"))
+	assert.Contains(t, shards, "$6\r\nhealth\r\n$6\r\nonline\r\n")
+
+	info := readBulkReply(t, handle(srv, cl, "CLUSTER", "INFO"))
+	// not all slots are served
+	assert.Contains(t, info, "cluster_state:fail\r\n")
+	assert.Contains(t, info, "cluster_slots_assigned:3\r\n")
+	assert.Contains(t, info, "cluster_size:1\r\n")
+}
+
+func TestClusterCommandKeys(t *testing.T) {
+	srv, cl := newClusterCommandTestServer()
+	assert.Equal(t, ":12182\r\n", handle(srv, cl, "CLUSTER", "KEYSLOT", "foo"))
+	assert.Equal(t, ":12182\r\n", handle(srv, cl, "CLUSTER", "KEYSLOT", "{foo}bar"))
+
+	db := srv.Db(cl)
+	db.Set("{foo}b", "1")
+	db.Set("{foo}a", "1")
+	db.Set("foo", "1")
+	db.Set("bar", "1")
+	assert.Equal(t, ":3\r\n", handle(srv, cl, "CLUSTER", "COUNTKEYSINSLOT", "12182"))
+	assert.Equal(t, "*2\r\n$3\r\nfoo\r\n$6\r\n{foo}a\r\n", handle(srv, cl, "CLUSTER", "GETKEYSINSLOT", "12182", "2"))
+	db.Delete("foo")
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "CLUSTER", "COUNTKEYSINSLOT", "12182"))
+	handle(srv, cl, "FLUSHALL")
+	assert.Equal(t, ":0\r\n", handle(srv, cl, "CLUSTER", "COUNTKEYSINSLOT", "5061"))
+}
+
+func TestClusterCommandSetslot(t *testing.T) {
+	srv, cl := newClusterCommandTestServer()
+	c := srv.cluster
+	other := newClusterNode("other", nodeMaster)
+	c.nodes[other.id] = other
+	c.slots[1] = other
+
+	assert.Equal(t, "-ERR I don't know about node nope\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "2", "NODE", "nope"))
+	assert.Equal(t, "-ERR I'm not the owner of hash slot 1\r\n",
+		handle(srv, cl, "CLUSTER", "SETSLOT", "1", "MIGRATING", "other"))
+
+	// importing slot 1, then serving it with a config epoch of its own
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "1", "IMPORTING", "other"))
+	assert.Equal(t, other, c.importing[1])
+	assert.Contains(t, readBulkReply(t, handle(srv, cl, "CLUSTER", "NODES")), " [1-<-other]")
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "1", "NODE", c.myself.id))
+	assert.Nil(t, c.importing[1])
+	assert.Equal(t, c.myself, c.slots[1])
+	assert.Equal(t, uint64(1), c.myself.configEpoch)
+	assert.Equal(t, "-ERR I'm already the owner of hash slot 1\r\n",
+		handle(srv, cl, "CLUSTER", "SETSLOT", "1", "IMPORTING", "other"))
+
+	// migrating it back
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "1", "MIGRATING", "other"))
+	assert.Contains(t, readBulkReply(t, handle(srv, cl, "CLUSTER", "NODES")), " [1->-other]")
+	key := keyWithSlot(1)
+	srv.Db(cl).Set(key, "x")
+	assert.Equal(t, "-ERR Can't assign hashslot 1 to a different node while I still hold keys for this hash slot.\r\n",
+		handle(srv, cl, "CLUSTER", "SETSLOT", "1", "NODE", "other"))
+	srv.Db(cl).Delete(key)
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "1", "NODE", "other"))
+	assert.Nil(t, c.migrating[1])
+	assert.Equal(t, other, c.slots[1])
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "1", "IMPORTING", "other"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "SETSLOT", "1", "STABLE"))
+	assert.Nil(t, c.importing[1])
+}
+
+func TestClusterCommandMeet(t *testing.T) {
+	srv, cl := newClusterCommandTestServer()
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "MEET", "127.0.0.1", "7001"))
+	// meeting twice does not start another handshake
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "MEET", "127.0.0.1", "7001"))
+	assert.Len(t, srv.cluster.nodes, 2)
+	for _, n := range srv.cluster.nodes {
+		if n != srv.cluster.myself {
+			assert.Equal(t, nodeHandshake|nodeMaster|nodeMeet, n.flags)
+			assert.Equal(t, 17001, n.cport)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package redis_go
+
+import (
+	"net"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// newClusterTestServer returns a node listening on the loopback, with
+// timeouts short enough for the tests.
+func newClusterTestServer(t *testing.T) *Server {
+	config := NewConfig()
+	config.ClusterEnabled = true
+	config.Port = freePort(t)
+	config.ClusterPort = freePort(t)
+	config.ClusterNodeTimeout = 300
+	srv := NewServer(config)
+	assert.NoError(t, srv.StartCluster())
+	t.Cleanup(srv.cluster.bus.close)
+	return srv
+}
+
+// runClusterCron runs the crons of the nodes until cond holds.
+func runClusterCron(t *testing.T, nodes []*Server, cond func() bool) {
+	for i := 0; i < 300; i++ {
+		for _, srv := range nodes {
+			srv.cluster.lastCron = time.Time{}
+			srv.clusterCron(time.Now())
+		}
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the cluster did not converge")
+}
+
+func knowEachOther(nodes []*Server) func() bool {
+	return func() bool {
+		for _, srv := range nodes {
+			for _, other := range nodes {
+				n := srv.cluster.nodes[other.cluster.myself.id]
+				if n == nil || n.has(nodeHandshake) || (n != srv.cluster.myself && n.link == nil) {
+					return false
+				}
+			}
+			if len(srv.cluster.nodes) != len(nodes) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func meet(t *testing.T, srv *Server, other *Server) {
+	cl := ev.NewClient(5)
+	n := other.cluster.myself
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CLUSTER", "MEET", "127.0.0.1",
+		strconv.Itoa(n.port), strconv.Itoa(n.cport)))
+}
+
+// newTestCluster returns three nodes that met, each serving a third of
+// the slots.
+func newTestCluster(t *testing.T) []*Server {
+	nodes := []*Server{newClusterTestServer(t), newClusterTestServer(t), newClusterTestServer(t)}
+	meet(t, nodes[0], nodes[1])
+	meet(t, nodes[0], nodes[2])
+	runClusterCron(t, nodes, knowEachOther(nodes))
+
+	for i, srv := range nodes {
+		var slots []int
+		for j := i * clusterSlots / 3; j < (i+1)*clusterSlots/3; j++ {
+			slots = append(slots, j)
+		}
+		if i == 2 {
+			slots = append(slots, clusterSlots-1)
+		}
+		assert.Equal(t, "+OK", srv.clusterAddSlots(slots))
+	}
+	runClusterCron(t, nodes, func() bool {
+		for _, srv := range nodes {
+			if !srv.cluster.ok {
+				return false
+			}
+		}
+		return true
+	})
+	return nodes
+}
+
+func TestClusterMeet(t *testing.T) {
+	nodes := newTestCluster(t)
+	for _, srv := range nodes {
+		assert.Equal(t, 3, srv.clusterSize())
+		for _, other := range nodes {
+			n := srv.cluster.nodes[other.cluster.myself.id]
+			assert.Equal(t, "127.0.0.1", n.ip)
+			assert.Equal(t, other.config.Port, n.port)
+			assert.Equal(t, other.cluster.myself.cport, n.cport)
+		}
+	}
+
+	cl := ev.NewClient(5)
+	info := readBulkReply(t, handle(nodes[1], cl, "CLUSTER", "INFO"))
+	assert.Contains(t, info, "cluster_state:ok\r\n")
+	assert.Contains(t, info, "cluster_slots_assigned:16384\r\n")
+	assert.Contains(t, info, "cluster_known_nodes:3\r\n")
+	assert.Contains(t, info, "cluster_size:3\r\n")
+
+	lines := strings.Split(strings.TrimSuffix(readBulkReply(t, handle(nodes[1], cl, "CLUSTER", "NODES")), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if fields[0] == nodes[1].cluster.myself.id {
+			assert.Equal(t, "myself,master", fields[2])
+			assert.Equal(t, "5461-10921", fields[8])
+		}
+		if fields[0] == nodes[2].cluster.myself.id {
+			assert.Equal(t, "master", fields[2])
+			assert.Equal(t, "127.0.0.1:"+strconv.Itoa(nodes[2].config.Port)+"@"+
+				strconv.Itoa(nodes[2].cluster.myself.cport), fields[1])
+			assert.Equal(t, "connected", fields[7])
+			assert.Equal(t, []string{"10922-16383"}, fields[8:])
+		}
+	}
+}
+
+func TestClusterRedirect(t *testing.T) {
+	nodes := newTestCluster(t)
+	cl := ev.NewClient(5)
+
+	// foo is in slot 12182, served by the third node
+	owner := nodes[2].cluster.myself
+	assert.Equal(t, "-MOVED 12182 127.0.0.1:"+strconv.Itoa(owner.port)+"\r\n", handle(nodes[0], cl, "GET", "foo"))
+	assert.Equal(t, "+OK\r\n", handle(nodes[2], cl, "SET", "foo", "bar"))
+	assert.Equal(t, "-CROSSSLOT Keys in request don't hash to the same slot\r\n",
+		handle(nodes[2], cl, "MIGRATE", "127.0.0.1", "1", "", "0", "10", "KEYS", "foo", "bar"))
+	// keyless commands run anywhere
+	assert.Equal(t, "+PONG\r\n", handle(nodes[0], cl, "PING"))
+	assert.Equal(t, "-ERR SELECT is not allowed in cluster mode\r\n", handle(nodes[0], cl, "SELECT", "1"))
+	assert.Contains(t, nodes[0].Info([]string{"errorstats"}), "errorstat_MOVED:count=1")
+}
+
+func TestClusterFailureDetection(t *testing.T) {
+	nodes := newTestCluster(t)
+	failing := nodes[2]
+	failing.cluster.bus.close()
+
+	alive := nodes[:2]
+	runClusterCron(t, alive, func() bool {
+		for _, srv := range alive {
+			if !srv.cluster.nodes[failing.cluster.myself.id].has(nodeFail) {
+				return false
+			}
+		}
+		return true
+	})
+	for _, srv := range alive {
+		// the slots of the failed node are not served anymore
+		assert.False(t, srv.cluster.ok)
+	}
+	cl := ev.NewClient(5)
+	assert.Equal(t, "-CLUSTERDOWN The cluster is down\r\n", handle(nodes[0], cl, "GET", "bar"))
+}
+
+func TestClusterUpdateSlots(t *testing.T) {
+	nodes := newTestCluster(t)
+	a, b := nodes[0], nodes[1]
+	// the node of the larger config epoch wins the slot
+	a.cluster.myself.configEpoch = 10
+	a.cluster.slots[6000] = a.cluster.myself
+	b.Db(ev.NewClient(5)).Set("{"+keyWithSlot(6000)+"}", "x")
+	runClusterCron(t, nodes, func() bool {
+		return b.cluster.slots[6000] == b.cluster.nodes[a.cluster.myself.id] &&
+			nodes[2].cluster.slots[6000] == nodes[2].cluster.nodes[a.cluster.myself.id]
+	})
+	assert.Equal(t, 0, b.dbs[0].CountKeysInSlot(6000))
+}
+
+// keyWithSlot finds a key hashing to the slot.
+func keyWithSlot(slot int) string {
+	for i := 0; ; i++ {
+		if key := strconv.Itoa(i); keyHashSlot(key) == slot {
+			return key
+		}
+	}
+}
+
+func TestClusterRedirectAsk(t *testing.T) {
+	config := NewConfig()
+	config.ClusterEnabled = true
+	config.ClusterRequireFullCoverage = false
+	srv := NewServer(config)
+	c := srv.cluster
+	other := newClusterNode("other", nodeMaster)
+	other.ip, other.port = "127.0.0.1", 7001
+	c.nodes[other.id] = other
+	slot := keyHashSlot("foo")
+	cl := ev.NewClient(5)
+
+	assert.Equal(t, "-CLUSTERDOWN Hash slot not served\r\n", handle(srv, cl, "GET", "foo"))
+
+	c.slots[slot] = c.myself
+	srv.clusterUpdateState()
+	c.migrating[slot] = other
+	assert.Equal(t, "-ASK 12182 127.0.0.1:7001\r\n", handle(srv, cl, "GET", "foo"))
+	srv.Db(cl).Set("foo", "bar")
+	assert.Equal(t, "$3\r\nbar\r\n", handle(srv, cl, "GET", "foo"))
+	// MIGRATE moves the keys that are left, so it runs whichever are missing
+	assert.Equal(t, "-IOERR error or timeout connecting to the client\r\n",
+		handle(srv, cl, "MIGRATE", "127.0.0.1", "1", "", "0", "10", "KEYS", "foo", "{foo}x"))
+
+	c.slots[slot] = other
+	c.migrating[slot] = nil
+	c.importing[slot] = other
+	assert.Equal(t, "-MOVED 12182 127.0.0.1:7001\r\n", handle(srv, cl, "GET", "foo"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "ASKING"))
+	assert.Equal(t, "$3\r\nbar\r\n", handle(srv, cl, "GET", "foo"))
+	// ASKING only holds for one command
+	assert.Equal(t, "-MOVED 12182 127.0.0.1:7001\r\n", handle(srv, cl, "GET", "foo"))
+	payload := dumpPayload("baz")
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "RESTORE-ASKING", "foo", "0", payload, "REPLACE"))
+	assert.Equal(t, "-MOVED 12182 127.0.0.1:7001\r\n", handle(srv, cl, "RESTORE", "foo", "0", payload, "REPLACE"))
+}
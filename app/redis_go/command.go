@@ -2,14 +2,20 @@ package redis_go
 
 import (
 	"fmt"
+	"redis-go/app/ev"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Command interface {
 	ReadParams(len int) error
-	Execute(data *map[string]string) string
+	Execute(srv *Server, cl *ev.Client) string
 	Response() chan string
+	Spec() *CommandSpec
+	setSpec(spec *CommandSpec)
+	Argv() []string
+	setArgv(argv []string)
 }
 
 type CommandReader struct {
@@ -31,41 +37,73 @@ func (cr *CommandReader) Read() (Command, error) {
 		return nil, fmt.Errorf("array length should be at least 1")
 	}
 
-	cs, err := cr.respReader.ReadBulkString()
+	ar := &argvReader{RespReader: cr.respReader}
+	cs, err := ar.ReadBulkString()
 	if err != nil {
 		return nil, err
 	}
 
-	var c Command
-	switch cs {
-	case "PING", "ping":
-		c = NewPingCommand()
-	case "ECHO", "echo":
-		c = NewEchoCommand(cr.respReader)
-	case "SET", "set":
-		c = NewSetCommand(cr.respReader)
-	case "GET", "get":
-		c = NewGetCommand(cr.respReader)
-	default:
+	spec, ok := commandTable[strings.ToLower(cs)]
+	if !ok {
 		return nil, fmt.Errorf("unknown command %s", cs)
 	}
+	c := spec.new(ar)
+	c.setSpec(spec)
 
 	err = c.ReadParams(l - 1)
+	c.setArgv(ar.argv)
 	if err != nil {
-		return nil, err
+		// the command is returned so that the rejection can be counted
+		return c, err
 	}
 
 	return c, nil
 }
 
+// argvReader keeps the bulk strings read through it, which are the name
+// and the arguments of the command being read.
+type argvReader struct {
+	RespReader
+	argv []string
+}
+
+func (r *argvReader) ReadBulkString() (string, error) {
+	s, err := r.RespReader.ReadBulkString()
+	if err == nil {
+		r.argv = append(r.argv, s)
+	}
+	return s, err
+}
+
 type BaseCommand struct {
 	resp chan string
+	spec *CommandSpec
+	argv []string
 }
 
 func (c *BaseCommand) Response() chan string {
 	return c.resp
 }
 
+// Spec is set for the commands created by CommandReader.
+func (c *BaseCommand) Spec() *CommandSpec {
+	return c.spec
+}
+
+func (c *BaseCommand) setSpec(spec *CommandSpec) {
+	c.spec = spec
+}
+
+// Argv is the name and the arguments the command was read from, for the
+// commands created by CommandReader.
+func (c *BaseCommand) Argv() []string {
+	return c.argv
+}
+
+func (c *BaseCommand) setArgv(argv []string) {
+	c.argv = argv
+}
+
 func NewBaseCommand() BaseCommand {
 	return BaseCommand{
 		resp: make(chan string),
@@ -89,7 +127,12 @@ func (c *PingCommand) ReadParams(len int) error {
 	return nil
 }
 
-func (c *PingCommand) Execute(data *map[string]string) string {
+// Execute replies in the format of the messages to a RESP2 connection
+// subscribed to channels, so that it can tell the reply from the messages.
+func (c *PingCommand) Execute(srv *Server, cl *ev.Client) string {
+	if cl.Resp == 2 && subscriptions(cl) > 0 {
+		return encodeBulkStrings([]string{"pong", ""})
+	}
 	return "+PONG"
 }
 
@@ -119,7 +162,7 @@ func (c *EchoCommand) ReadParams(len int) (err error) {
 	return nil
 }
 
-func (c *EchoCommand) Execute(data *map[string]string) string {
+func (c *EchoCommand) Execute(srv *Server, cl *ev.Client) string {
 	return "+" + c.str
 }
 
@@ -180,19 +223,23 @@ func (s *SetCommand) ReadParams(len int) (err error) {
 		return
 	}
 
+	if t <= 0 {
+		return fmt.Errorf("invalid expire time in 'set' command")
+	}
+
 	s.px = t
 
 	return nil
 }
 
-func (s *SetCommand) Execute(data *map[string]string) string {
-	(*data)[s.key] = s.value
-	if s.px != -1 {
-		pxTimer := time.NewTimer(time.Duration(s.px) * time.Millisecond)
-		go func() {
-			<-pxTimer.C
-			delete(*data, s.key)
-		}()
+func (s *SetCommand) Execute(srv *Server, cl *ev.Client) string {
+	db := srv.Db(cl)
+	db.Set(s.key, s.value)
+	srv.signalModifiedKey(cl, s.key)
+	srv.notifyKeyspaceEvent(notifyString, "set", s.key, cl.Db)
+	if s.px > 0 {
+		db.SetExpire(s.key, time.Now().Add(time.Duration(s.px)*time.Millisecond))
+		srv.notifyKeyspaceEvent(notifyGeneric, "expire", s.key, cl.Db)
 	}
 	return "+OK"
 }
@@ -223,9 +270,9 @@ func NewGetCommand(rr RespReader) *GetCommand {
 	}
 }
 
-func (g *GetCommand) Execute(data *map[string]string) string {
-	if val, ok := (*data)[g.key]; ok {
-		return "+" + val
+func (g *GetCommand) Execute(srv *Server, cl *ev.Client) string {
+	if val, ok := srv.Db(cl).Get(g.key); ok {
+		return encodeBulkString(val)
 	}
 	return "$-1"
 }
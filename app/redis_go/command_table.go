@@ -0,0 +1,358 @@
+package redis_go
+
+type CommandFlag int
+
+const (
+	// CmdWrite commands may modify the keyspace
+	CmdWrite CommandFlag = 1 << iota
+	// CmdReadOnly commands only read from the keyspace
+	CmdReadOnly
+	// CmdDenyOom commands may grow the dataset, so they are rejected
+	// when memory is over maxmemory and nothing can be evicted
+	CmdDenyOom
+	// CmdAdmin commands inspect or change the server rather than the
+	// keyspace, they are not shown by MONITOR
+	CmdAdmin
+	// CmdNoAuth commands are allowed before the connection authenticates
+	CmdNoAuth
+	// CmdFast commands run in constant or logarithmic time, the others
+	// are in the @slow ACL category
+	CmdFast
+	// CmdSubscribed commands may run on a connection subscribed to
+	// channels or patterns, which can run no others
+	CmdSubscribed
+	// CmdAsking commands are served by the node importing the slot of
+	// their keys, as if ASKING had been sent first
+	CmdAsking
+	// CmdSentinel commands may run in sentinel mode, which runs no others,
+	// and CmdOnlySentinel ones only in sentinel mode
+	CmdSentinel
+	CmdOnlySentinel
+	// CmdNoScript commands may not be called by scripts
+	CmdNoScript
+	// CmdMayWrite commands run scripts that may call write commands, so
+	// they are paused along with the writes
+	CmdMayWrite
+)
+
+// AclCategory is a set of the categories ACL rules grant or revoke
+// commands by, such as +@read.
+type AclCategory int
+
+const (
+	AclKeyspace AclCategory = 1 << iota
+	AclRead
+	AclWrite
+	AclSet
+	AclSortedSet
+	AclList
+	AclHash
+	AclString
+	AclBitmap
+	AclHyperLogLog
+	AclGeo
+	AclStream
+	AclPubSub
+	AclAdmin
+	AclFast
+	AclSlow
+	AclBlocking
+	AclDangerous
+	AclConnection
+	AclTransaction
+	AclScripting
+)
+
+// aclCategoryNames is in the order ACL CAT lists the categories.
+var aclCategoryNames = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash",
+	"string", "bitmap", "hyperloglog", "geo", "stream", "pubsub", "admin",
+	"fast", "slow", "blocking", "dangerous", "connection", "transaction",
+	"scripting",
+}
+
+func aclCategoryByName(name string) (AclCategory, bool) {
+	for i, n := range aclCategoryNames {
+		if n == name {
+			return 1 << i, true
+		}
+	}
+	return 0, false
+}
+
+// CommandSpec describes a command: how to create it from the request and
+// the flags the dispatch path checks before running it.
+type CommandSpec struct {
+	Name  string
+	Flags CommandFlag
+	// Categories are the ACL categories besides the ones implied by the
+	// flags
+	Categories AclCategory
+	// FirstKey, LastKey and KeyStep are the positions of the keys in the
+	// argv, as in the legacy key specs of redis: a negative LastKey counts
+	// from the end, and a FirstKey of 0 means the command takes no keys.
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+	// getKeys finds the keys of the commands whose keys are not at fixed
+	// positions, such as MIGRATE
+	getKeys func(argv []string) []string
+	// FirstChannel and LastChannel are the positions of the pub/sub
+	// channels in the argv, counted as the keys are, and ChannelPatterns
+	// is set when they are patterns rather than channels.
+	FirstChannel    int
+	LastChannel     int
+	ChannelPatterns bool
+	// Subcommands are the lower case names of the subcommands, for the
+	// commands such as CONFIG that have some
+	Subcommands []string
+	new         func(rr RespReader) Command
+}
+
+func (s *CommandSpec) Is(flag CommandFlag) bool {
+	return s != nil && s.Flags&flag != 0
+}
+
+// AclCategories are the categories of the command, including the ones
+// implied by the flags.
+func (s *CommandSpec) AclCategories() AclCategory {
+	cat := s.Categories
+	if s.Is(CmdWrite) {
+		cat |= AclWrite
+	}
+	if s.Is(CmdReadOnly) {
+		cat |= AclRead
+	}
+	if s.Is(CmdAdmin) {
+		cat |= AclAdmin | AclDangerous
+	}
+	if s.Is(CmdFast) {
+		cat |= AclFast
+	} else {
+		cat |= AclSlow
+	}
+	return cat
+}
+
+// Keys returns the keys among the argv of the command.
+func (s *CommandSpec) Keys(argv []string) []string {
+	if s.getKeys != nil {
+		return s.getKeys(argv)
+	}
+	return argvRange(argv, s.FirstKey, s.LastKey, s.KeyStep)
+}
+
+// Channels returns the channels, or the patterns, among the argv of the
+// command.
+func (s *CommandSpec) Channels(argv []string) []string {
+	return argvRange(argv, s.FirstChannel, s.LastChannel, 1)
+}
+
+func argvRange(argv []string, first int, last int, step int) []string {
+	if first <= 0 {
+		return nil
+	}
+	if last < 0 {
+		last += len(argv)
+	}
+	var args []string
+	for i := first; i <= last && i < len(argv); i += step {
+		args = append(args, argv[i])
+	}
+	return args
+}
+
+// HasSubcommand reports whether sub, in lower case, is a subcommand of
+// the command.
+func (s *CommandSpec) HasSubcommand(sub string) bool {
+	for _, name := range s.Subcommands {
+		if name == sub {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CommandSpec) keys(first int, last int, step int) *CommandSpec {
+	s.FirstKey, s.LastKey, s.KeyStep = first, last, step
+	return s
+}
+
+func (s *CommandSpec) keysWith(getKeys func(argv []string) []string) *CommandSpec {
+	s.getKeys = getKeys
+	return s
+}
+
+func (s *CommandSpec) channels(first int, last int, patterns bool) *CommandSpec {
+	s.FirstChannel, s.LastChannel, s.ChannelPatterns = first, last, patterns
+	return s
+}
+
+func (s *CommandSpec) categories(cat AclCategory) *CommandSpec {
+	s.Categories = cat
+	return s
+}
+
+func (s *CommandSpec) subcommands(names ...string) *CommandSpec {
+	s.Subcommands = names
+	return s
+}
+
+// commandTable is keyed by the lower case command name.
+var commandTable = map[string]*CommandSpec{}
+
+func addCommand(name string, flags CommandFlag, new func(rr RespReader) Command) *CommandSpec {
+	spec := &CommandSpec{
+		Name:  name,
+		Flags: flags,
+		new:   new,
+	}
+	commandTable[name] = spec
+	return spec
+}
+
+func init() {
+	addCommand("ping", CmdFast|CmdSubscribed|CmdSentinel, func(rr RespReader) Command {
+		return NewPingCommand()
+	}).categories(AclConnection)
+	addCommand("echo", CmdFast, func(rr RespReader) Command {
+		return NewEchoCommand(rr)
+	}).categories(AclConnection)
+	addCommand("set", CmdWrite|CmdDenyOom, func(rr RespReader) Command {
+		return NewSetCommand(rr)
+	}).keys(1, 1, 1).categories(AclString)
+	addCommand("get", CmdReadOnly|CmdFast, func(rr RespReader) Command {
+		return NewGetCommand(rr)
+	}).keys(1, 1, 1).categories(AclString)
+	addCommand("select", CmdFast, func(rr RespReader) Command {
+		return NewSelectCommand(rr)
+	}).categories(AclConnection)
+	addCommand("move", CmdWrite|CmdFast, func(rr RespReader) Command {
+		return NewMoveCommand(rr)
+	}).keys(1, 1, 1).categories(AclKeyspace)
+	addCommand("swapdb", CmdWrite|CmdFast, func(rr RespReader) Command {
+		return NewSwapDbCommand(rr)
+	}).categories(AclKeyspace | AclDangerous)
+	addCommand("flushdb", CmdWrite, func(rr RespReader) Command {
+		return NewFlushDbCommand(rr)
+	}).categories(AclKeyspace | AclDangerous)
+	addCommand("flushall", CmdWrite, func(rr RespReader) Command {
+		return NewFlushAllCommand(rr)
+	}).categories(AclKeyspace | AclDangerous)
+	addCommand("dbsize", CmdReadOnly|CmdFast, func(rr RespReader) Command {
+		return NewDbSizeCommand()
+	}).categories(AclKeyspace)
+	addCommand("randomkey", CmdReadOnly, func(rr RespReader) Command {
+		return NewRandomKeyCommand()
+	}).categories(AclKeyspace)
+	addCommand("scan", CmdReadOnly, func(rr RespReader) Command {
+		return NewScanCommand(rr)
+	}).categories(AclKeyspace)
+	addCommand("object", CmdReadOnly, func(rr RespReader) Command {
+		return NewObjectCommand(rr)
+	}).keys(2, 2, 1).categories(AclKeyspace).subcommands("freq", "idletime")
+	addCommand("memory", CmdReadOnly, func(rr RespReader) Command {
+		return NewMemoryCommand(rr)
+	}).keys(2, 2, 1).subcommands("stats", "doctor", "usage")
+	addCommand("info", CmdSentinel, func(rr RespReader) Command {
+		return NewInfoCommand(rr)
+	}).categories(AclDangerous)
+	addCommand("config", CmdAdmin|CmdNoScript, func(rr RespReader) Command {
+		return NewConfigCommand(rr)
+	}).subcommands("get", "set", "rewrite", "resetstat")
+	addCommand("slowlog", CmdAdmin, func(rr RespReader) Command {
+		return NewSlowlogCommand(rr)
+	}).subcommands("len", "reset", "get")
+	addCommand("latency", CmdAdmin, func(rr RespReader) Command {
+		return NewLatencyCommand(rr)
+	}).subcommands("latest", "doctor", "history", "graph", "reset")
+	addCommand("client", CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewClientCommand(rr)
+	}).categories(AclConnection).subcommands(
+		"id", "info", "list", "setname", "getname", "kill", "pause", "unpause", "no-evict", "reply",
+		"tracking", "caching", "getredir", "trackinginfo")
+	addCommand("shutdown", CmdAdmin|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewShutdownCommand(rr)
+	})
+	addCommand("auth", CmdNoAuth|CmdFast|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewAuthCommand(rr)
+	}).categories(AclConnection)
+	addCommand("hello", CmdNoAuth|CmdFast|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewHelloCommand(rr)
+	}).categories(AclConnection)
+	addCommand("quit", CmdNoAuth|CmdFast|CmdSubscribed|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewQuitCommand()
+	}).categories(AclConnection)
+	addCommand("monitor", CmdAdmin|CmdNoScript, func(rr RespReader) Command {
+		return NewMonitorCommand()
+	})
+	addCommand("acl", CmdAdmin|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewAclCommand(rr)
+	}).subcommands("setuser", "getuser", "deluser", "list", "users", "whoami",
+		"cat", "dryrun", "log", "load", "save")
+	addCommand("subscribe", CmdSubscribed|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewSubscribeCommand(rr, false)
+	}).channels(1, -1, false).categories(AclPubSub)
+	addCommand("unsubscribe", CmdSubscribed|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewUnsubscribeCommand(rr, false)
+	}).categories(AclPubSub)
+	addCommand("psubscribe", CmdSubscribed|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewSubscribeCommand(rr, true)
+	}).channels(1, -1, true).categories(AclPubSub)
+	addCommand("punsubscribe", CmdSubscribed|CmdSentinel|CmdNoScript, func(rr RespReader) Command {
+		return NewUnsubscribeCommand(rr, true)
+	}).categories(AclPubSub)
+	addCommand("publish", CmdFast|CmdSentinel, func(rr RespReader) Command {
+		return NewPublishCommand(rr)
+	}).channels(1, 1, false).categories(AclPubSub)
+	addCommand("pubsub", 0, func(rr RespReader) Command {
+		return NewPubsubCommand(rr)
+	}).categories(AclPubSub).subcommands("channels", "numsub", "numpat")
+	addCommand("cluster", 0, func(rr RespReader) Command {
+		return NewClusterCommand(rr)
+	}).subcommands("myid", "info", "nodes", "slots", "shards", "meet", "addslots", "delslots",
+		"setslot", "keyslot", "countkeysinslot", "getkeysinslot")
+	addCommand("asking", CmdFast, func(rr RespReader) Command {
+		return NewAskingCommand()
+	}).categories(AclConnection)
+	addCommand("dump", CmdReadOnly, func(rr RespReader) Command {
+		return NewDumpCommand(rr)
+	}).keys(1, 1, 1).categories(AclKeyspace)
+	addCommand("restore", CmdWrite|CmdDenyOom, func(rr RespReader) Command {
+		return NewRestoreCommand(rr)
+	}).keys(1, 1, 1).categories(AclKeyspace | AclDangerous)
+	addCommand("restore-asking", CmdWrite|CmdDenyOom|CmdAsking, func(rr RespReader) Command {
+		return NewRestoreCommand(rr)
+	}).keys(1, 1, 1).categories(AclKeyspace | AclDangerous)
+	addCommand("migrate", CmdWrite, func(rr RespReader) Command {
+		return NewMigrateCommand(rr)
+	}).keysWith(migrateKeys).categories(AclKeyspace | AclDangerous)
+	addCommand("sentinel", CmdAdmin|CmdSentinel|CmdOnlySentinel, func(rr RespReader) Command {
+		return NewSentinelCommand(rr)
+	}).subcommands("masters", "master", "replicas", "slaves", "sentinels", "get-master-addr-by-name",
+		"is-master-down-by-addr", "myid")
+	addCommand("eval", CmdNoScript|CmdMayWrite, func(rr RespReader) Command {
+		return NewEvalCommand(rr, false, false)
+	}).keysWith(evalKeys).categories(AclScripting)
+	addCommand("evalsha", CmdNoScript|CmdMayWrite, func(rr RespReader) Command {
+		return NewEvalCommand(rr, true, false)
+	}).keysWith(evalKeys).categories(AclScripting)
+	addCommand("eval_ro", CmdNoScript, func(rr RespReader) Command {
+		return NewEvalCommand(rr, false, true)
+	}).keysWith(evalKeys).categories(AclScripting)
+	addCommand("evalsha_ro", CmdNoScript, func(rr RespReader) Command {
+		return NewEvalCommand(rr, true, true)
+	}).keysWith(evalKeys).categories(AclScripting)
+	addCommand("script", CmdNoScript, func(rr RespReader) Command {
+		return NewScriptCommand(rr)
+	}).categories(AclScripting).subcommands("load", "exists", "flush", "kill")
+	addCommand("fcall", CmdNoScript|CmdMayWrite, func(rr RespReader) Command {
+		return NewFcallCommand(rr, false)
+	}).keysWith(evalKeys).categories(AclScripting)
+	addCommand("fcall_ro", CmdNoScript, func(rr RespReader) Command {
+		return NewFcallCommand(rr, true)
+	}).keysWith(evalKeys).categories(AclScripting)
+	addCommand("function", CmdNoScript, func(rr RespReader) Command {
+		return NewFunctionCommand(rr)
+	}).categories(AclScripting).subcommands("load", "list", "delete", "flush", "dump", "restore", "stats", "kill")
+}
@@ -2,6 +2,7 @@ package redis_go
 
 import (
 	"fmt"
+	"redis-go/app/ev"
 	"redis-go/app/mocks"
 	"testing"
 	"time"
@@ -11,54 +12,58 @@ import (
 )
 
 func TestCommandSetAndGetWithoutPx(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	sc := SetCommand{
 		key:   "hello",
 		value: "world",
 		px:    -1,
 	}
-	sc.Execute(&data)
+	sc.Execute(srv, cl)
 	gc := GetCommand{
 		key: "hello",
 	}
-	assert.Equal(t, "+world", gc.Execute(&data))
+	assert.Equal(t, "$5\r\nworld", gc.Execute(srv, cl))
 	time.Sleep(600 * time.Millisecond)
-	assert.Equal(t, "+world", gc.Execute(&data))
+	assert.Equal(t, "$5\r\nworld", gc.Execute(srv, cl))
 }
 
 func TestCommandSetAndGetWithPx(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	sc := SetCommand{
 		key:   "hello",
 		value: "world",
 		px:    500,
 	}
-	sc.Execute(&data)
+	sc.Execute(srv, cl)
 	gc := GetCommand{
 		key: "hello",
 	}
-	assert.Equal(t, "+world", gc.Execute(&data))
+	assert.Equal(t, "$5\r\nworld", gc.Execute(srv, cl))
 	time.Sleep(600 * time.Millisecond)
-	assert.Equal(t, "$-1", gc.Execute(&data))
+	assert.Equal(t, "$-1", gc.Execute(srv, cl))
 }
 
 func TestCommandSetAndGet(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	sc := SetCommand{
 		key:   "hello",
 		value: "world",
 	}
-	sc.Execute(&data)
+	sc.Execute(srv, cl)
 	gc := GetCommand{
 		key: "hello",
 	}
-	assert.Equal(t, "+world", gc.Execute(&data))
+	assert.Equal(t, "$5\r\nworld", gc.Execute(srv, cl))
 }
 
 func TestCommandGet(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	gc := GetCommand{}
-	assert.Equal(t, gc.Execute(&data), "$-1")
+	assert.Equal(t, gc.Execute(srv, cl), "$-1")
 }
 
 func TestGetReadParams(t *testing.T) {
@@ -89,9 +94,10 @@ func TestGetReadParamsKeyReadError(t *testing.T) {
 }
 
 func TestCommandSet(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	sc := SetCommand{}
-	assert.Equal(t, sc.Execute(&data), "+OK")
+	assert.Equal(t, sc.Execute(srv, cl), "+OK")
 }
 
 func TestSetReadParams(t *testing.T) {
@@ -135,15 +141,17 @@ func TestSetReadParamsValueReadError(t *testing.T) {
 }
 
 func TestCommandEchoExecute(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	ec := EchoCommand{str: "Hello World!"}
-	assert.Equal(t, ec.Execute(&data), "+Hello World!")
+	assert.Equal(t, ec.Execute(srv, cl), "+Hello World!")
 }
 
 func TestCommandPingExecute(t *testing.T) {
-	data := make(map[string]string)
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
 	pc := PingCommand{}
-	assert.Equal(t, pc.Execute(&data), "+PONG")
+	assert.Equal(t, pc.Execute(srv, cl), "+PONG")
 }
 
 func TestCommandReaderGet(t *testing.T) {
@@ -194,6 +202,7 @@ func TestCommandReaderSet(t *testing.T) {
 	assert.Equal(t, ec.key, "Hello")
 	assert.Equal(t, ec.value, "World")
 	assert.Equal(t, ec.px, -1)
+	assert.Equal(t, []string{"SET", "Hello", "World"}, c.Argv())
 }
 
 func TestCommandReaderSmallCase(t *testing.T) {
@@ -461,3 +470,16 @@ func TestEchoReadParamsLenError(t *testing.T) {
 	assert.NotNil(t, pc.ReadParams(0))
 	mrr.EXPECT().ReadBulkString().Times(0)
 }
+
+func TestCommandReaderSetPxZeroError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+	cr := NewCommandReader(rr)
+
+	mockReadCommand(mr, nil, 5,
+		"set", "Lewis", "Hamilton", "px", "0")
+
+	_, err := cr.Read()
+	assert.NotNil(t, err)
+}
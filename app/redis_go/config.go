@@ -0,0 +1,134 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	// ConfigFile is the absolute path of the file the config was loaded
+	// from, which CONFIG REWRITE writes to, none when empty
+	ConfigFile string
+	// Port accepts plain connections when not 0
+	Port      int
+	Databases int
+	// Timeout is the seconds a client may stay idle before it is closed,
+	// and TcpKeepAlive the period of the TCP keepalive probes in seconds.
+	// Both are disabled when 0.
+	Timeout      int
+	TcpKeepAlive int
+	// MaxClients is the most clients connected at once
+	MaxClients int
+	// Hz is how many times per second the server cron runs
+	Hz int
+	// RequirePass is the password of the default user, the connections
+	// have to AUTH with it first unless it is empty
+	RequirePass string
+	// TlsPort accepts TLS connections when not 0, with the certificate and
+	// key of TlsCertFile and TlsKeyFile. TlsAuthClients is yes, optional
+	// or no, whether the clients need a certificate signed by the CA of
+	// TlsCaCertFile.
+	TlsPort        int
+	TlsCertFile    string
+	TlsKeyFile     string
+	TlsCaCertFile  string
+	TlsAuthClients string
+	// AclFile is where ACL LOAD and ACL SAVE read and write the users,
+	// none when empty
+	AclFile string
+	// AclLogMaxLen is the number of entries kept in the ACL log
+	AclLogMaxLen int
+	// MaxMemory is the limit in bytes for the dataset, 0 means no limit
+	MaxMemory        int64
+	MaxMemoryPolicy  string
+	MaxMemorySamples int
+	// SlowlogLogSlowerThan is in microseconds, a negative value disables
+	// the slow log
+	SlowlogLogSlowerThan int64
+	SlowlogMaxLen        int
+	// LatencyMonitorThreshold is in milliseconds, 0 disables the latency
+	// monitor
+	LatencyMonitorThreshold int64
+	// LatencyTrackingInfoPercentiles are reported by INFO latencystats
+	LatencyTrackingInfoPercentiles []float64
+	// NotifyKeyspaceEvents are the classes of keyspace events published,
+	// see notify.go
+	NotifyKeyspaceEvents int
+	// TrackingTableMaxKeys is the number of keys remembered for client side
+	// caching, 0 means no limit
+	TrackingTableMaxKeys int
+	ClusterEnabled       bool
+	// ClusterPort is the port of the cluster bus, 0 for port + 10000
+	ClusterPort int
+	// ClusterNodeTimeout is in milliseconds, the time after which a node
+	// not answering is considered failing
+	ClusterNodeTimeout int64
+	// ClusterRequireFullCoverage stops serving the keys once some slots
+	// are not served
+	ClusterRequireFullCoverage bool
+	// BusyReplyThreshold is in milliseconds, the time after which a running
+	// script lets the other clients in, to be told the server is busy and
+	// to kill the script
+	BusyReplyThreshold int64
+	// Sentinel runs the server as a sentinel, monitoring the masters of
+	// SentinelMasters rather than serving keys
+	Sentinel        bool
+	SentinelMasters []*SentinelMasterConfig
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Port:             ev.Port,
+		Databases:        16,
+		TcpKeepAlive:     300,
+		MaxClients:       10000,
+		Hz:               10,
+		AclLogMaxLen:     128,
+		TlsAuthClients:   "yes",
+		MaxMemoryPolicy:  PolicyNoEviction,
+		MaxMemorySamples: 5,
+
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+
+		LatencyTrackingInfoPercentiles: []float64{50, 99, 99.9},
+
+		TrackingTableMaxKeys: 1000000,
+
+		ClusterNodeTimeout:         15000,
+		ClusterRequireFullCoverage: true,
+
+		BusyReplyThreshold: 5000,
+	}
+}
+
+// ParseMemory parses a size such as 100mb. As in redis, k, m and g are
+// powers of 1000 and kb, mb and gb powers of 1024.
+func ParseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	str := strings.ToLower(s)
+	mul := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSuffix(str, u.suffix)
+			mul = u.mul
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size %s", s)
+	}
+	return n * mul, nil
+}
@@ -0,0 +1,111 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strings"
+)
+
+type ConfigCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+}
+
+func NewConfigCommand(rr RespReader) *ConfigCommand {
+	return &ConfigCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ConfigCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args = make([]string, len-1)
+	for i := range c.args {
+		c.args[i], err = c.reader.ReadBulkString()
+		if err != nil {
+			return
+		}
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "GET":
+		if n < 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "SET":
+		if n < 2 || n%2 != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "REWRITE", "RESETSTAT":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+// setArgv hides the values CONFIG SET gives to sensitive configs, such as
+// requirepass.
+func (c *ConfigCommand) setArgv(argv []string) {
+	if len(argv) > 1 && strings.ToUpper(argv[1]) == "SET" {
+		argv = append([]string{}, argv...)
+		for i := 2; i+1 < len(argv); i += 2 {
+			if e, ok := configByName[strings.ToLower(argv[i])]; ok && e.flags&configSensitive != 0 {
+				argv[i+1] = "(redacted)"
+			}
+		}
+	}
+	c.BaseCommand.setArgv(argv)
+}
+
+func (c *ConfigCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "GET":
+		return encodeBulkStrings(srv.getConfig(c.args))
+	case "SET":
+		if err := srv.SetConfig(c.args); err != nil {
+			return "-ERR " + err.Error()
+		}
+		return "+OK"
+	case "REWRITE":
+		if srv.config.ConfigFile == "" {
+			return "-ERR The server is running without a config file"
+		}
+		if err := rewriteConfigFile(srv.config); err != nil {
+			return "-ERR Rewriting config file: " + err.Error()
+		}
+		return "+OK"
+	}
+	srv.ResetStats()
+	return "+OK"
+}
+
+// getConfig returns the names and values of the configs matching any of
+// patterns, in the order of the table.
+func (s *Server) getConfig(patterns []string) []string {
+	res := []string{}
+	for _, e := range configTable {
+		for _, p := range patterns {
+			if stringMatch(strings.ToLower(p), e.name) {
+				res = append(res, e.name, e.get(s.config))
+				break
+			}
+		}
+	}
+	return res
+}
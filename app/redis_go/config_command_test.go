@@ -0,0 +1,101 @@
+package redis_go
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"strings"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandConfigResetStat(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.stats.call("get", 0, "+OK")
+
+	cc := ConfigCommand{subcommand: "RESETSTAT"}
+	assert.Equal(t, "+OK", cc.Execute(srv, cl))
+	assert.Empty(t, srv.stats.byCommand)
+}
+
+func TestConfigReadParamsResetStat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	cc := NewConfigCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("resetstat", nil)
+	assert.Nil(t, cc.ReadParams(1))
+	assert.Equal(t, "RESETSTAT", cc.subcommand)
+}
+
+func TestConfigReadParamsUnknownSubcommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	cc := NewConfigCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("foo", nil)
+	assert.NotNil(t, cc.ReadParams(1))
+}
+
+func TestConfigReadParamsLenError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	cc := NewConfigCommand(mrr)
+	assert.NotNil(t, cc.ReadParams(0))
+}
+
+func TestConfigCommandGet(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, encodeBulkStrings([]string{"maxmemory", "0", "maxmemory-policy", "noeviction", "maxmemory-samples", "5"})+"\r\n",
+		handle(srv, cl, "CONFIG", "GET", "MAXMEMORY*"))
+	assert.Equal(t, encodeBulkStrings([]string{"port", "6379", "hz", "10"})+"\r\n",
+		handle(srv, cl, "CONFIG", "GET", "hz", "port", "h?"))
+	assert.Equal(t, "*0\r\n", handle(srv, cl, "CONFIG", "GET", "nosuch"))
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "CONFIG", "GET", "*"), fmt.Sprintf("*%d\r\n", 2*len(configTable))))
+}
+
+func TestConfigCommandSet(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CONFIG", "SET", "hz", "20", "maxmemory", "1mb"))
+	assert.Equal(t, encodeBulkStrings([]string{"hz", "20", "maxmemory", "1048576"})+"\r\n",
+		handle(srv, cl, "CONFIG", "GET", "hz", "maxmemory"))
+	assert.Equal(t, "-ERR CONFIG SET failed (possibly related to argument 'hz') - argument must be between 1 and 500 inclusive\r\n",
+		handle(srv, cl, "CONFIG", "SET", "hz", "0"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "CONFIG", "SET", "hz"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "CONFIG", "GET"))
+}
+
+func TestConfigCommandSetRedactsSensitive(t *testing.T) {
+	c := NewConfigCommand(nil)
+	c.setArgv([]string{"CONFIG", "SET", "hz", "20", "RequirePass", "secret"})
+	assert.Equal(t, []string{"CONFIG", "SET", "hz", "20", "RequirePass", "(redacted)"}, c.Argv())
+
+	c.setArgv([]string{"CONFIG", "GET", "requirepass"})
+	assert.Equal(t, []string{"CONFIG", "GET", "requirepass"}, c.Argv())
+}
+
+func TestConfigCommandRewrite(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	assert.Equal(t, "-ERR The server is running without a config file\r\n", handle(srv, cl, "CONFIG", "REWRITE"))
+
+	srv.config.ConfigFile = filepath.Join(t.TempDir(), "redis.conf")
+	os.WriteFile(srv.config.ConfigFile, []byte("# keep me\nhz 20\n"), 0644)
+	handle(srv, cl, "CONFIG", "SET", "hz", "30", "maxmemory-policy", "allkeys-lfu")
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "CONFIG", "REWRITE"))
+	data, _ := os.ReadFile(srv.config.ConfigFile)
+	assert.Equal(t, "# keep me\nhz 30\n# Generated by CONFIG REWRITE\nmaxmemory-policy allkeys-lfu\n", string(data))
+
+	srv.config.ConfigFile = filepath.Join(t.TempDir(), "nosuchdir", "redis.conf")
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "CONFIG", "REWRITE"), "-ERR Rewriting config file: "))
+}
@@ -0,0 +1,377 @@
+package redis_go
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configRewriteSignature marks where CONFIG REWRITE appended the configs
+// missing from the file.
+const configRewriteSignature = "# Generated by CONFIG REWRITE"
+
+// maxIncludeDepth bounds the nesting of include directives, which would
+// otherwise recurse forever on a file including itself.
+const maxIncludeDepth = 16
+
+var (
+	errUnbalancedQuotes = errors.New("Unbalanced quotes in configuration line")
+	errBadDirective     = errors.New("Bad directive or wrong number of arguments")
+)
+
+// ConfigError is a line of the config that could not be applied.
+type ConfigError struct {
+	// Source is the file the line is from, empty for the command line
+	Source string
+	Line   int
+	Text   string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	source := "the command line"
+	if e.Source != "" {
+		source = "the configuration file " + e.Source
+	}
+	return fmt.Sprintf("\n*** FATAL CONFIG FILE ERROR (Redis %s) ***\n"+
+		"Reading %s, at line %d\n>>> '%s'\n%s", Version, source, e.Line, e.Text, e.Err)
+}
+
+// ParseArgs splits the command line into the config file, when the first
+// argument does not start with --, and the options following it, such as
+// --port 7000, which it returns in the format of the config file.
+func ParseArgs(args []string) (string, string) {
+	file := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		file = args[0]
+		args = args[1:]
+	}
+
+	var b strings.Builder
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(arg[2:])
+		} else {
+			b.WriteString(" ")
+			b.WriteString(quoteConfigArg(arg))
+		}
+	}
+	return file, b.String()
+}
+
+// LoadConfig sets config from file, when not empty, then from options,
+// which are in the format of the file, see ParseArgs.
+func LoadConfig(config *Config, file string, options string) error {
+	if file != "" {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		config.ConfigFile = path
+		if err := loadConfigFile(config, path, 0); err != nil {
+			return err
+		}
+	}
+	return loadConfigString(config, "", options, 0)
+}
+
+func loadConfigFile(config *Config, path string, depth int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Fatal error, can't open config file '%s': %s", path, err)
+	}
+	return loadConfigString(config, path, string(data), depth)
+}
+
+// loadConfigString applies the lines of text, which come from source. The
+// included files are applied where they are included, so that the lines
+// after an include directive override its configs.
+func loadConfigString(config *Config, source string, text string, depth int) error {
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fail := func(err error) error {
+			return &ConfigError{Source: source, Line: i + 1, Text: line, Err: err}
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			return fail(err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToLower(args[0])
+		if name == "include" && len(args) == 2 {
+			if depth >= maxIncludeDepth {
+				return fail(errors.New("include nesting is too deep"))
+			}
+			if err := loadConfigIncludes(config, args[1], depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if name == "sentinel" {
+			if err := loadSentinelDirective(config, args[1:]); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+
+		e, ok := configByName[name]
+		if !ok || len(args) < 2 || e.flags&configMultiArg == 0 && len(args) != 2 {
+			return fail(errBadDirective)
+		}
+		if err := e.set(config, strings.Join(args[1:], " ")); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// loadConfigIncludes applies the files matching pattern, in order. A
+// pattern with no wildcard must name a file that exists.
+func loadConfigIncludes(config *Config, pattern string, depth int) error {
+	paths := []string{pattern}
+	if strings.ContainsAny(pattern, "*?[") {
+		var err error
+		paths, err = filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("Fatal error, invalid include pattern '%s': %s", pattern, err)
+		}
+	}
+	for _, path := range paths {
+		if err := loadConfigFile(config, path, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitArgs splits a line of the config file into its arguments, as
+// sdssplitargs in redis. The arguments are separated by spaces, and may be
+// quoted: "double quoted" ones handle escapes such as \n and \x41, 'single
+// quoted' ones only \'. A closing quote must be followed by a space.
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	i := 0
+	for {
+		for i < len(line) && isConfigSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg []byte
+		switch line[i] {
+		case '"':
+			for i++; ; i++ {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '"' {
+					break
+				}
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					arg = append(arg, byte(n))
+					i += 3
+					continue
+				}
+				if c == '\\' && i+1 < len(line) {
+					i++
+					c = unescapeConfigChar(line[i])
+				}
+				arg = append(arg, c)
+			}
+			i++
+		case '\'':
+			for i++; ; i++ {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\'' {
+					break
+				}
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				}
+				arg = append(arg, line[i])
+			}
+			i++
+		default:
+			for i < len(line) && !isConfigSpace(line[i]) {
+				arg = append(arg, line[i])
+				i++
+			}
+			args = append(args, string(arg))
+			continue
+		}
+
+		if i < len(line) && !isConfigSpace(line[i]) {
+			return nil, errUnbalancedQuotes
+		}
+		args = append(args, string(arg))
+	}
+}
+
+func isConfigSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == 0
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unescapeConfigChar(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return c
+}
+
+// quoteConfigArg quotes arg when splitArgs would not read it back as is.
+func quoteConfigArg(arg string) string {
+	plain := arg != ""
+	for i := 0; i < len(arg) && plain; i++ {
+		c := arg[i]
+		plain = c > ' ' && c < 0x7f && c != '"' && c != '\'' && c != '\\'
+	}
+	if plain {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\a':
+			b.WriteString("\\a")
+		case '\b':
+			b.WriteString("\\b")
+		default:
+			if c < ' ' || c >= 0x7f {
+				fmt.Fprintf(&b, "\\x%02x", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// configLine is the line of the config file setting e to its value in
+// config.
+func configLine(e *configEntry, config *Config) string {
+	value := e.get(config)
+	if e.flags&configMultiArg == 0 || value == "" {
+		value = quoteConfigArg(value)
+	}
+	return e.name + " " + value
+}
+
+// rewriteConfigFile writes config to the file it was loaded from. The
+// comments, the include directives and the lines the server does not know
+// are kept. The first line of each config is updated in place and the
+// others are removed, then the configs not in the file yet are appended
+// when they differ from their default.
+func rewriteConfigFile(config *Config) error {
+	path := config.ConfigFile
+	mode := os.FileMode(0644)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	out := make([]string, 0, len(lines))
+	written := map[string]bool{}
+	signed := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == configRewriteSignature {
+			signed = true
+		}
+		var e *configEntry
+		if trimmed != "" && trimmed[0] != '#' {
+			if args, err := splitArgs(trimmed); err == nil && len(args) > 0 {
+				e = configByName[strings.ToLower(args[0])]
+			}
+		}
+		if e == nil {
+			out = append(out, line)
+			continue
+		}
+		if !written[e.name] {
+			written[e.name] = true
+			out = append(out, configLine(e, config))
+		}
+	}
+
+	defaults := NewConfig()
+	for _, e := range configTable {
+		if written[e.name] || e.get(config) == e.get(defaults) {
+			continue
+		}
+		if !signed {
+			out = append(out, configRewriteSignature)
+			signed = true
+		}
+		out = append(out, configLine(e, config))
+	}
+
+	// the file is replaced at once, so that it is never found half written
+	f, err := os.CreateTemp(filepath.Dir(path), ".redis-rewrite-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Join(out, "\n") + "\n")
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
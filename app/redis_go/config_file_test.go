@@ -0,0 +1,169 @@
+package redis_go
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := map[string][]string{
+		"":                          {},
+		"port 7000":                 {"port", "7000"},
+		"  hz\t20  ":                {"hz", "20"},
+		`requirepass "a b"`:         {"requirepass", "a b"},
+		`requirepass ""`:            {"requirepass", ""},
+		`x "\x41\n\"\\"`:            {"x", "A\n\"\\"},
+		`x 'it\'s' 'a\nb'`:          {"x", "it's", `a\nb`},
+		`percentiles 50 99 "99.9"`:  {"percentiles", "50", "99", "99.9"},
+		`x "\xZZ"`:                  {"x", "xZZ"},
+		"include /etc/redis/*.conf": {"include", "/etc/redis/*.conf"},
+	}
+	for line, args := range cases {
+		res, err := splitArgs(line)
+		assert.Nil(t, err, line)
+		assert.Equal(t, args, res, line)
+	}
+
+	for _, line := range []string{`x "abc`, `x 'abc`, `x "a"b`, `x 'a'b`} {
+		_, err := splitArgs(line)
+		assert.Equal(t, errUnbalancedQuotes, err, line)
+	}
+}
+
+func TestQuoteConfigArg(t *testing.T) {
+	assert.Equal(t, "abc", quoteConfigArg("abc"))
+	assert.Equal(t, `""`, quoteConfigArg(""))
+	assert.Equal(t, `"a b"`, quoteConfigArg("a b"))
+	assert.Equal(t, `"\"\\\n\x01\xff"`, quoteConfigArg("\"\\\n\x01\xff"))
+
+	for _, arg := range []string{"", "a b", "it's", "\"\\\n\x01\xff", "\t"} {
+		args, err := splitArgs("x " + quoteConfigArg(arg))
+		assert.Nil(t, err, arg)
+		assert.Equal(t, []string{"x", arg}, args, arg)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	file, options := ParseArgs([]string{"redis.conf", "--port", "7000", "--requirepass", "a b", "--latency-tracking-info-percentiles", "50", "99"})
+	assert.Equal(t, "redis.conf", file)
+	assert.Equal(t, "port 7000\nrequirepass \"a b\"\nlatency-tracking-info-percentiles 50 99", options)
+
+	file, options = ParseArgs([]string{"--hz", "20"})
+	assert.Equal(t, "", file)
+	assert.Equal(t, "hz 20", options)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.conf"), []byte("hz 30\nmaxmemory 1mb\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.conf"), []byte("maxmemory 2mb\n"), 0644)
+	path := filepath.Join(dir, "redis.conf")
+	os.WriteFile(path, []byte("# a comment\n\n"+
+		"PORT 7000\n"+
+		"requirepass \"a b\"\n"+
+		"include "+filepath.Join(dir, "*.conf.d")+"\n"+
+		"include "+filepath.Join(dir, "[ab].conf")+"\n"+
+		"maxmemory-policy ALLKEYS-LRU\n"+
+		"latency-tracking-info-percentiles 90 99.5\n"), 0644)
+
+	cfg := NewConfig()
+	assert.Nil(t, LoadConfig(cfg, path, "hz 40"))
+	assert.Equal(t, path, cfg.ConfigFile)
+	assert.Equal(t, 7000, cfg.Port)
+	assert.Equal(t, "a b", cfg.RequirePass)
+	assert.Equal(t, int64(2<<20), cfg.MaxMemory)
+	assert.Equal(t, PolicyAllKeysLru, cfg.MaxMemoryPolicy)
+	assert.Equal(t, []float64{90, 99.5}, cfg.LatencyTrackingInfoPercentiles)
+	assert.Equal(t, 40, cfg.Hz)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "redis.conf")
+	cases := map[string]string{
+		"port 7000\nnosuch 1":     "Reading the configuration file " + path + ", at line 2\n>>> 'nosuch 1'\nBad directive or wrong number of arguments",
+		"port 1 2":                ">>> 'port 1 2'\nBad directive or wrong number of arguments",
+		"port":                    ">>> 'port'\nBad directive or wrong number of arguments",
+		"port 70000":              "argument must be between 0 and 65535 inclusive",
+		"hz x":                    "argument couldn't be parsed into an integer",
+		"maxmemory lots":          "argument must be a memory value",
+		"maxmemory-policy random": "argument(s) must be one of the following: volatile-lru",
+		"requirepass \"abc":       "Unbalanced quotes in configuration line",
+		"include " + path:         "include nesting is too deep",
+		"include " + filepath.Join(dir, "missing.conf"): "Fatal error, can't open config file",
+	}
+	for text, msg := range cases {
+		os.WriteFile(path, []byte(text), 0644)
+		err := LoadConfig(NewConfig(), path, "")
+		assert.NotNil(t, err, text)
+		if err != nil {
+			assert.Contains(t, err.Error(), msg, text)
+		}
+	}
+
+	err := LoadConfig(NewConfig(), "", "hz 1000")
+	assert.Equal(t, "\n*** FATAL CONFIG FILE ERROR (Redis 7.0.0) ***\n"+
+		"Reading the command line, at line 1\n>>> 'hz 1000'\nargument must be between 1 and 500 inclusive", err.Error())
+}
+
+func TestRewriteConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "redis.conf")
+	extra := filepath.Join(dir, "extra.conf")
+	os.WriteFile(extra, []byte("timeout 60\n"), 0644)
+	os.WriteFile(path, []byte("# the port\n"+
+		"port 7000\n"+
+		"\n"+
+		"include "+extra+"\n"+
+		"hz 20\n"+
+		"hz 30\n"+
+		"maxmemory 1mb\n"), 0600)
+
+	cfg := NewConfig()
+	assert.Nil(t, LoadConfig(cfg, path, ""))
+	cfg.Port = 7001
+	cfg.MaxMemory = 0
+	cfg.RequirePass = "a b"
+	cfg.LatencyTrackingInfoPercentiles = []float64{50}
+	assert.Nil(t, rewriteConfigFile(cfg))
+
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "# the port\n"+
+		"port 7001\n"+
+		"\n"+
+		"include "+extra+"\n"+
+		"hz 30\n"+
+		"maxmemory 0\n"+
+		"# Generated by CONFIG REWRITE\n"+
+		// as in redis, the configs of the included files are not rewritten
+		// there but in the main file
+		"timeout 60\n"+
+		"requirepass \"a b\"\n"+
+		"latency-tracking-info-percentiles 50\n", string(data))
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the file reads back the same config, and the next rewrite appends
+	// after the signature
+	loaded := NewConfig()
+	assert.Nil(t, LoadConfig(loaded, path, ""))
+	assert.Equal(t, cfg, loaded)
+	cfg.Hz = 10
+	cfg.TlsAuthClients = "no"
+	assert.Nil(t, rewriteConfigFile(cfg))
+	data, _ = os.ReadFile(path)
+	assert.Contains(t, string(data), "hz 10\n")
+	assert.Contains(t, string(data), "latency-tracking-info-percentiles 50\ntls-auth-clients no\n")
+}
+
+func TestRewriteConfigFileMissing(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ConfigFile = filepath.Join(t.TempDir(), "redis.conf")
+	cfg.Hz = 20
+	assert.Nil(t, rewriteConfigFile(cfg))
+	data, _ := os.ReadFile(cfg.ConfigFile)
+	assert.Equal(t, "# Generated by CONFIG REWRITE\nhz 20\n", string(data))
+}
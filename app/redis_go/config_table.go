@@ -0,0 +1,423 @@
+package redis_go
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configFlag describes how a config may be changed.
+type configFlag int
+
+const (
+	// configImmutable configs are only set at startup
+	configImmutable configFlag = 1 << iota
+	// configSensitive values are hidden from the slow log and MONITOR
+	configSensitive
+	// configMultiArg values are given as several arguments in the config
+	// file, such as the list of percentiles
+	configMultiArg
+)
+
+// configEntry is a config of the table, read and written as a string by
+// CONFIG GET, CONFIG SET and the config file.
+type configEntry struct {
+	name  string
+	flags configFlag
+	get   func(c *Config) string
+	// set parses and validates the value before changing the config
+	set func(c *Config, value string) error
+	// apply makes a change take effect on the running server, it is nil
+	// for the configs read where they are used
+	apply func(s *Server) error
+}
+
+func (e *configEntry) immutable() *configEntry {
+	e.flags |= configImmutable
+	return e
+}
+
+func (e *configEntry) sensitive() *configEntry {
+	e.flags |= configSensitive
+	return e
+}
+
+func (e *configEntry) applyWith(fn func(s *Server) error) *configEntry {
+	e.apply = fn
+	return e
+}
+
+// configTable holds the configs in the order CONFIG GET and CONFIG
+// REWRITE list them, and configByName the same configs by name.
+var (
+	configTable  []*configEntry
+	configByName = map[string]*configEntry{}
+)
+
+func addConfig(e *configEntry) *configEntry {
+	configTable = append(configTable, e)
+	configByName[e.name] = e
+	return e
+}
+
+func intConfig(name string, field func(c *Config) *int, min int, max int) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			return strconv.Itoa(*field(c))
+		},
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			if n < min || n > max {
+				return fmt.Errorf("argument must be between %d and %d inclusive", min, max)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func int64Config(name string, field func(c *Config) *int64, min int64, max int64) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			return strconv.FormatInt(*field(c), 10)
+		},
+		set: func(c *Config, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+			if n < min || n > max {
+				return fmt.Errorf("argument must be between %d and %d inclusive", min, max)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func memoryConfig(name string, field func(c *Config) *int64) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			return strconv.FormatInt(*field(c), 10)
+		},
+		set: func(c *Config, value string) error {
+			n, err := ParseMemory(value)
+			if err != nil {
+				return errors.New("argument must be a memory value")
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func boolConfig(name string, field func(c *Config) *bool) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			if *field(c) {
+				return "yes"
+			}
+			return "no"
+		},
+		set: func(c *Config, value string) error {
+			switch strings.ToLower(value) {
+			case "yes":
+				*field(c) = true
+			case "no":
+				*field(c) = false
+			default:
+				return errors.New("argument must be 'yes' or 'no'")
+			}
+			return nil
+		},
+	}
+}
+
+func stringConfig(name string, field func(c *Config) *string) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			return *field(c)
+		},
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func enumConfig(name string, field func(c *Config) *string, values ...string) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			return *field(c)
+		},
+		set: func(c *Config, value string) error {
+			value = strings.ToLower(value)
+			for _, v := range values {
+				if v == value {
+					*field(c) = value
+					return nil
+				}
+			}
+			return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(values, ", "))
+		},
+	}
+}
+
+func percentilesConfig(name string, field func(c *Config) *[]float64) *configEntry {
+	return &configEntry{
+		name:  name,
+		flags: configMultiArg,
+		get: func(c *Config) string {
+			ps := make([]string, len(*field(c)))
+			for i, p := range *field(c) {
+				ps[i] = formatFloat(p)
+			}
+			return strings.Join(ps, " ")
+		},
+		set: func(c *Config, value string) error {
+			ps := []float64{}
+			for _, f := range strings.Fields(value) {
+				p, err := strconv.ParseFloat(f, 64)
+				if err != nil || p < 0 || p > 100 {
+					return errors.New("argument(s) must be percentiles between 0 and 100")
+				}
+				ps = append(ps, p)
+			}
+			*field(c) = ps
+			return nil
+		},
+	}
+}
+
+func keyspaceEventsConfig(name string, field func(c *Config) *int) *configEntry {
+	return &configEntry{
+		name: name,
+		get: func(c *Config) string {
+			return formatKeyspaceEvents(*field(c))
+		},
+		set: func(c *Config, value string) error {
+			flags, err := parseKeyspaceEvents(value)
+			if err != nil {
+				return err
+			}
+			*field(c) = flags
+			return nil
+		},
+	}
+}
+
+func init() {
+	addConfig(intConfig("port", func(c *Config) *int { return &c.Port }, 0, 65535)).
+		applyWith((*Server).applyPort)
+	addConfig(intConfig("databases", func(c *Config) *int { return &c.Databases }, 1, math.MaxInt32)).
+		immutable()
+	addConfig(intConfig("timeout", func(c *Config) *int { return &c.Timeout }, 0, math.MaxInt32)).
+		applyWith((*Server).applyTimeout)
+	addConfig(intConfig("tcp-keepalive", func(c *Config) *int { return &c.TcpKeepAlive }, 0, math.MaxInt32)).
+		applyWith((*Server).applyTcpKeepAlive)
+	addConfig(intConfig("maxclients", func(c *Config) *int { return &c.MaxClients }, 1, math.MaxInt32)).
+		applyWith((*Server).applyMaxClients)
+	addConfig(intConfig("hz", func(c *Config) *int { return &c.Hz }, 1, 500)).
+		applyWith((*Server).applyHz)
+	addConfig(stringConfig("requirepass", func(c *Config) *string { return &c.RequirePass })).
+		sensitive().applyWith((*Server).applyRequirePass)
+	addConfig(stringConfig("aclfile", func(c *Config) *string { return &c.AclFile })).
+		immutable()
+	addConfig(intConfig("acllog-max-len", func(c *Config) *int { return &c.AclLogMaxLen }, 0, math.MaxInt32))
+	addConfig(intConfig("tls-port", func(c *Config) *int { return &c.TlsPort }, 0, 65535)).
+		applyWith((*Server).applyTlsPort)
+	addConfig(stringConfig("tls-cert-file", func(c *Config) *string { return &c.TlsCertFile })).
+		applyWith((*Server).applyTls)
+	addConfig(stringConfig("tls-key-file", func(c *Config) *string { return &c.TlsKeyFile })).
+		applyWith((*Server).applyTls)
+	addConfig(stringConfig("tls-ca-cert-file", func(c *Config) *string { return &c.TlsCaCertFile })).
+		applyWith((*Server).applyTls)
+	addConfig(enumConfig("tls-auth-clients", func(c *Config) *string { return &c.TlsAuthClients },
+		"yes", "no", "optional")).
+		applyWith((*Server).applyTls)
+	addConfig(memoryConfig("maxmemory", func(c *Config) *int64 { return &c.MaxMemory })).
+		applyWith((*Server).applyMaxMemory)
+	addConfig(enumConfig("maxmemory-policy", func(c *Config) *string { return &c.MaxMemoryPolicy },
+		PolicyVolatileLru, PolicyVolatileLfu, PolicyVolatileRandom, PolicyVolatileTtl,
+		PolicyAllKeysLru, PolicyAllKeysLfu, PolicyAllKeysRandom, PolicyNoEviction))
+	addConfig(intConfig("maxmemory-samples", func(c *Config) *int { return &c.MaxMemorySamples }, 1, 64))
+	addConfig(int64Config("slowlog-log-slower-than", func(c *Config) *int64 { return &c.SlowlogLogSlowerThan },
+		-1, math.MaxInt64))
+	addConfig(intConfig("slowlog-max-len", func(c *Config) *int { return &c.SlowlogMaxLen }, 0, math.MaxInt32))
+	addConfig(int64Config("latency-monitor-threshold", func(c *Config) *int64 { return &c.LatencyMonitorThreshold },
+		0, math.MaxInt64))
+	addConfig(percentilesConfig("latency-tracking-info-percentiles",
+		func(c *Config) *[]float64 { return &c.LatencyTrackingInfoPercentiles }))
+	addConfig(keyspaceEventsConfig("notify-keyspace-events", func(c *Config) *int { return &c.NotifyKeyspaceEvents }))
+	addConfig(intConfig("tracking-table-max-keys", func(c *Config) *int { return &c.TrackingTableMaxKeys },
+		0, math.MaxInt32))
+	addConfig(boolConfig("cluster-enabled", func(c *Config) *bool { return &c.ClusterEnabled })).
+		immutable()
+	addConfig(intConfig("cluster-port", func(c *Config) *int { return &c.ClusterPort }, 0, 65535)).
+		immutable()
+	addConfig(int64Config("cluster-node-timeout", func(c *Config) *int64 { return &c.ClusterNodeTimeout },
+		0, math.MaxInt64))
+	addConfig(boolConfig("cluster-require-full-coverage",
+		func(c *Config) *bool { return &c.ClusterRequireFullCoverage }))
+	addConfig(int64Config("busy-reply-threshold", func(c *Config) *int64 { return &c.BusyReplyThreshold },
+		0, math.MaxInt64))
+}
+
+// errConfigSet is the reply of CONFIG SET when name could not be set.
+func errConfigSet(name string, err error) error {
+	return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %s", name, err)
+}
+
+// SetConfig sets the configs of values, a list of names and values, and
+// applies them to the running server. It is all or nothing: when a value is
+// not valid or can not be applied, the configs are all left as they were.
+func (s *Server) SetConfig(values []string) error {
+	entries := make([]*configEntry, 0, len(values)/2)
+	seen := map[string]bool{}
+	for i := 0; i < len(values); i += 2 {
+		name := strings.ToLower(values[i])
+		e, ok := configByName[name]
+		if !ok {
+			return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", values[i])
+		}
+		if e.flags&configImmutable != 0 {
+			return errConfigSet(name, errors.New("can't set immutable config"))
+		}
+		if seen[name] {
+			return errConfigSet(name, errors.New("duplicate parameter"))
+		}
+		seen[name] = true
+		entries = append(entries, e)
+	}
+
+	old := make([]string, len(entries))
+	restore := func() {
+		for i, e := range entries {
+			e.set(s.config, old[i])
+		}
+	}
+	for i, e := range entries {
+		old[i] = e.get(s.config)
+		if err := e.set(s.config, values[2*i+1]); err != nil {
+			restore()
+			return errConfigSet(e.name, err)
+		}
+	}
+
+	// the configs are all set before any is applied, as some are applied
+	// together, such as tls-port with the certificate files
+	for i, e := range entries {
+		if e.apply == nil {
+			continue
+		}
+		if err := e.apply(s); err != nil {
+			restore()
+			// best effort, the old values were applied already
+			for _, applied := range entries[:i] {
+				if applied.apply != nil {
+					applied.apply(s)
+				}
+			}
+			return errConfigSet(e.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) applyPort() error {
+	if s.conns == nil {
+		return nil
+	}
+	if err := s.conns.ChangePort(s.config.Port); err != nil {
+		return fmt.Errorf("Unable to listen on this port: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) applyTlsPort() error {
+	if s.conns == nil {
+		return nil
+	}
+	if s.config.TlsPort == 0 {
+		return s.conns.ChangeTls(0, nil)
+	}
+	config, err := s.TlsConfig()
+	if err != nil {
+		return err
+	}
+	if err := s.conns.ChangeTls(s.config.TlsPort, config); err != nil {
+		return fmt.Errorf("Unable to listen on this port: %s", err)
+	}
+	return nil
+}
+
+// applyTls loads the certificates again, once TLS is enabled. Until then,
+// they are only loaded when tls-port is set.
+func (s *Server) applyTls() error {
+	ctx := s.tls.Load()
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Configure(s.config)
+}
+
+func (s *Server) applyTimeout() error {
+	if s.conns != nil {
+		s.conns.SetIdleTimeout(time.Duration(s.config.Timeout) * time.Second)
+	}
+	return nil
+}
+
+func (s *Server) applyTcpKeepAlive() error {
+	if s.conns != nil {
+		s.conns.SetKeepAlive(time.Duration(s.config.TcpKeepAlive) * time.Second)
+	}
+	return nil
+}
+
+func (s *Server) applyMaxClients() error {
+	if s.conns == nil {
+		return nil
+	}
+	return s.conns.ChangeMaxClients(s.config.MaxClients)
+}
+
+func (s *Server) applyHz() error {
+	if s.conns != nil {
+		s.conns.CancelTimer(s.cronTimer)
+		s.scheduleCron()
+	}
+	return nil
+}
+
+// applyRequirePass makes requirepass the only password of the default
+// user, or lets it in without one when empty.
+func (s *Server) applyRequirePass() error {
+	u := s.acl.users[defaultUser]
+	if s.config.RequirePass == "" {
+		return u.setRule("nopass")
+	}
+	if err := u.setRule("resetpass"); err != nil {
+		return err
+	}
+	return u.setRule(">" + s.config.RequirePass)
+}
+
+// applyMaxMemory evicts keys right away when the dataset is over the new
+// limit, rather than on the next write.
+func (s *Server) applyMaxMemory() error {
+	s.freeMemoryIfNeeded()
+	return nil
+}
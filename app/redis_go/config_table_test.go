@@ -0,0 +1,140 @@
+package redis_go
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigTableDefaults(t *testing.T) {
+	cfg := NewConfig()
+	for _, e := range configTable {
+		// the defaults are valid values of their config
+		other := NewConfig()
+		assert.Nil(t, e.set(other, e.get(cfg)), e.name)
+		assert.Equal(t, cfg, other, e.name)
+	}
+	assert.Equal(t, "50 99 99.9", configByName["latency-tracking-info-percentiles"].get(cfg))
+	assert.Equal(t, "6379", configByName["port"].get(cfg))
+}
+
+func TestSetConfig(t *testing.T) {
+	srv := NewServer(NewConfig())
+	assert.Nil(t, srv.SetConfig([]string{"MaxMemory", "1mb", "maxmemory-policy", "ALLKEYS-LRU", "slowlog-log-slower-than", "-1"}))
+	assert.Equal(t, int64(1<<20), srv.config.MaxMemory)
+	assert.Equal(t, PolicyAllKeysLru, srv.config.MaxMemoryPolicy)
+	assert.Equal(t, int64(-1), srv.config.SlowlogLogSlowerThan)
+
+	assert.Nil(t, srv.SetConfig([]string{"latency-tracking-info-percentiles", ""}))
+	assert.Empty(t, srv.config.LatencyTrackingInfoPercentiles)
+
+	assert.Nil(t, srv.SetConfig([]string{"cluster-require-full-coverage", "NO"}))
+	assert.False(t, srv.config.ClusterRequireFullCoverage)
+}
+
+func TestSetConfigErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cases := map[string][]string{
+		"Unknown option or number of arguments for CONFIG SET - 'NoSuch'":                           {"hz", "20", "NoSuch", "1"},
+		"CONFIG SET failed (possibly related to argument 'databases') - can't set immutable config": {"databases", "4"},
+		"CONFIG SET failed (possibly related to argument 'hz') - duplicate parameter":               {"hz", "20", "HZ", "30"},
+		"CONFIG SET failed (possibly related to argument 'maxmemory') - argument must be a memory value": {
+			"hz", "20", "maxmemory", "lots"},
+		"CONFIG SET failed (possibly related to argument 'tls-auth-clients') - argument(s) must be one of the following: yes, no, optional": {
+			"tls-auth-clients", "maybe"},
+		"CONFIG SET failed (possibly related to argument 'cluster-require-full-coverage') - argument must be 'yes' or 'no'": {
+			"cluster-require-full-coverage", "maybe"},
+		"CONFIG SET failed (possibly related to argument 'cluster-enabled') - can't set immutable config": {
+			"cluster-enabled", "yes"},
+	}
+	for msg, args := range cases {
+		assert.EqualError(t, srv.SetConfig(args), msg, args)
+		// nothing was changed
+		assert.Equal(t, NewConfig(), srv.config, args)
+	}
+}
+
+func TestSetConfigApplies(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	assert.Equal(t, 100*time.Millisecond, conns.cronPeriod)
+
+	assert.Nil(t, srv.SetConfig([]string{"hz", "20", "timeout", "30", "tcp-keepalive", "60", "maxclients", "5", "port", "7000"}))
+	assert.Equal(t, 50*time.Millisecond, conns.cronPeriod)
+	assert.Equal(t, 30*time.Second, conns.idleTimeout)
+	assert.Equal(t, time.Minute, conns.keepAlive)
+	assert.Equal(t, 5, conns.maxClients)
+	assert.Equal(t, 7000, conns.port)
+
+	// a change that can not be applied undoes the others
+	conns.portErr = errors.New("address already in use")
+	assert.EqualError(t, srv.SetConfig([]string{"hz", "40", "port", "7001"}),
+		"CONFIG SET failed (possibly related to argument 'port') - Unable to listen on this port: address already in use")
+	assert.Equal(t, 20, srv.config.Hz)
+	assert.Equal(t, 7000, srv.config.Port)
+	assert.Equal(t, 50*time.Millisecond, conns.cronPeriod)
+}
+
+func TestSetConfigTls(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+
+	// the certificates are needed to enable TLS
+	assert.EqualError(t, srv.SetConfig([]string{"tls-port", "6380"}),
+		"CONFIG SET failed (possibly related to argument 'tls-port') - tls-cert-file and tls-key-file are required for TLS")
+	assert.Equal(t, 0, srv.config.TlsPort)
+	assert.Nil(t, srv.tls.Load())
+
+	dir := t.TempDir()
+	cert, key := writeTestCertificate(t, dir, "old")
+	assert.Nil(t, srv.SetConfig([]string{"tls-port", "6380", "tls-cert-file", cert, "tls-key-file", key, "tls-auth-clients", "no"}))
+	assert.Equal(t, 6380, conns.tlsPort)
+	ctx := srv.tls.Load()
+	assert.Equal(t, "old", currentCertName(t, ctx))
+
+	// the certificate files are loaded as they are set
+	newCert, newKey := writeTestCertificate(t, dir, "new")
+	assert.Nil(t, srv.SetConfig([]string{"tls-cert-file", newCert, "tls-key-file", newKey}))
+	assert.Equal(t, "new", currentCertName(t, ctx))
+	assert.NotNil(t, srv.SetConfig([]string{"tls-cert-file", filepath.Join(dir, "missing.crt")}))
+	assert.Equal(t, newCert, srv.config.TlsCertFile)
+	enabled, err := srv.ReloadTls()
+	assert.True(t, enabled)
+	assert.Nil(t, err)
+	assert.Equal(t, "new", currentCertName(t, ctx))
+
+	assert.Nil(t, srv.SetConfig([]string{"tls-port", "0"}))
+	assert.Equal(t, 0, conns.tlsPort)
+}
+
+func TestSetConfigRequirePass(t *testing.T) {
+	srv := NewServer(NewConfig())
+	assert.Nil(t, srv.SetConfig([]string{"requirepass", "secret"}))
+	u := srv.acl.users[defaultUser]
+	assert.False(t, u.nopass)
+	assert.True(t, u.checkPassword("secret"))
+
+	assert.Nil(t, srv.SetConfig([]string{"requirepass", "other"}))
+	assert.False(t, u.checkPassword("secret"))
+	assert.True(t, u.checkPassword("other"))
+
+	assert.Nil(t, srv.SetConfig([]string{"requirepass", ""}))
+	assert.True(t, u.nopass)
+}
+
+func TestSetConfigMaxMemoryEvicts(t *testing.T) {
+	srv := newEvictionServer(PolicyAllKeysRandom)
+	for i := 0; i < 10; i++ {
+		srv.dbs[0].Set(strconv.Itoa(i), "value")
+	}
+	limit := srv.UsedMemory() / 2
+	assert.Nil(t, srv.SetConfig([]string{"maxmemory", strconv.FormatInt(limit, 10)}))
+	assert.LessOrEqual(t, srv.UsedMemory(), limit)
+	assert.Greater(t, srv.stats.evicted, int64(0))
+}
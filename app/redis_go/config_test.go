@@ -0,0 +1,35 @@
+package redis_go
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMemory(t *testing.T) {
+	cases := map[string]int64{
+		"0":     0,
+		"100":   100,
+		"100b":  100,
+		"1k":    1000,
+		"1kb":   1024,
+		"2mb":   2 << 20,
+		"2M":    2000 * 1000,
+		"1gb":   1 << 30,
+		"3GB":   3 << 30,
+		"1g":    1000 * 1000 * 1000,
+		"512KB": 512 << 10,
+	}
+	for s, n := range cases {
+		m, err := ParseMemory(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, n, m, s)
+	}
+}
+
+func TestParseMemoryError(t *testing.T) {
+	for _, s := range []string{"", "mb", "-1", "1tb", "1.5mb"} {
+		_, err := ParseMemory(s)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,45 @@
+package redis_go
+
+import "strings"
+
+// clusterSlots is the number of hash slots the keys of a cluster are
+// spread over.
+const clusterSlots = 16384
+
+// crc16Table is the table of the CRC16 XMODEM variant redis hashes the
+// keys with: polynomial 0x1021, initial value 0.
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// keyHashSlot returns the slot of key. When the key has a hash tag, that
+// is a non empty part between the first { and the next }, only the tag is
+// hashed, so that related keys can be kept in the same slot.
+func keyHashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) & (clusterSlots - 1)
+}
@@ -0,0 +1,22 @@
+package redis_go
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrc16(t *testing.T) {
+	assert.Equal(t, uint16(0x31c3), crc16("123456789"))
+	assert.Equal(t, uint16(0), crc16(""))
+}
+
+func TestKeyHashSlot(t *testing.T) {
+	assert.Equal(t, 12182, keyHashSlot("foo"))
+	assert.Equal(t, 5061, keyHashSlot("bar"))
+	assert.Equal(t, keyHashSlot("user1000"), keyHashSlot("{user1000}.following"))
+	assert.Equal(t, keyHashSlot("user1000"), keyHashSlot("x{user1000}{other}"))
+	// without a tag the whole key is hashed
+	assert.Equal(t, int(crc16("foo{}{bar}")&16383), keyHashSlot("foo{}{bar}"))
+	assert.Equal(t, int(crc16("foo{bar")&16383), keyHashSlot("foo{bar"))
+}
@@ -0,0 +1,44 @@
+package redis_go
+
+import "time"
+
+// cronExpirePerc is the share of each cron period that removing expired
+// keys may take, as in redis.
+const cronExpirePerc = 25
+
+// Cron does the periodic work of the server: closing the idle clients,
+// sampling the rates reported by INFO, removing expired keys, talking
+// with the other nodes of the cluster and monitoring the masters in
+// sentinel mode. The event loop runs it Hz times per second.
+func (s *Server) Cron() {
+	now := time.Now()
+	if s.conns != nil {
+		s.conns.ClientsCron()
+	}
+	s.trackInstantaneousMetrics(now)
+	s.databasesCron(now)
+	s.clusterCron(now)
+	s.sentinelTimer(now)
+}
+
+func (s *Server) trackInstantaneousMetrics(now time.Time) {
+	net := s.netStats()
+	s.stats.opsPerSec.track(s.stats.commands, now)
+	s.stats.inputPerSec.track(net.NetInputBytes, now)
+	s.stats.outputPerSec.track(net.NetOutputBytes, now)
+}
+
+// databasesCron removes expired keys for longer than BeforeSleep can, so
+// that they do not pile up when the server is busy serving clients. Like
+// BeforeSleep, it leaves the keys alone while clients are paused.
+func (s *Server) databasesCron(now time.Time) {
+	if s.isPaused() {
+		return
+	}
+	period := time.Second / time.Duration(s.config.Hz)
+	deadline := now.Add(period * cronExpirePerc / 100)
+	for _, db := range s.dbs {
+		db.ActiveExpire(deadline)
+	}
+	s.latencyAddSampleIfNeeded(latencyEventExpireCycle, time.Since(now))
+}
@@ -0,0 +1,72 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerCron(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	db := srv.dbs[0]
+	db.Set("gone", "value")
+	db.SetExpire("gone", time.Now().Add(-time.Second))
+	db.Set("kept", "value")
+
+	srv.Cron()
+	assert.Equal(t, 1, conns.cronRuns)
+	assert.Equal(t, 1, db.Size())
+	assert.Equal(t, int64(1), db.expired)
+}
+
+func TestServerCronPaused(t *testing.T) {
+	srv := NewServer(NewConfig())
+	db := srv.dbs[0]
+	db.Set("gone", "value")
+	db.SetExpire("gone", time.Now().Add(-time.Second))
+
+	srv.pauseClients(time.Minute, false)
+	srv.Cron()
+	assert.Equal(t, 1, db.Size())
+}
+
+func TestInstantaneousMetric(t *testing.T) {
+	var m instantaneousMetric
+	now := time.Now()
+	m.track(100, now)
+	assert.Equal(t, 0.0, m.rate())
+
+	// 1600 a second over one sample out of 16
+	m.track(260, now.Add(100*time.Millisecond))
+	assert.InDelta(t, 100.0, m.rate(), 0.001)
+
+	for i := 2; i <= instantaneousSamples+1; i++ {
+		m.track(100+int64(i)*160, now.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	assert.InDelta(t, 1600.0, m.rate(), 0.001)
+}
+
+func TestServerInfoInstantaneousMetrics(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	cl := ev.NewClient(1)
+
+	now := time.Now()
+	srv.trackInstantaneousMetrics(now)
+	for i := 0; i < 16; i++ {
+		handle(srv, cl, "PING")
+	}
+	conns.stats.NetInputBytes = 1024 * 16
+	srv.trackInstantaneousMetrics(now.Add(time.Second))
+
+	info := srv.Info([]string{"stats", "server"})
+	assert.Contains(t, info, "instantaneous_ops_per_sec:1\r\n")
+	assert.Contains(t, info, "instantaneous_input_kbps:1.00\r\n")
+	assert.Contains(t, info, "instantaneous_output_kbps:0.00\r\n")
+	assert.Contains(t, info, "hz:10\r\n")
+}
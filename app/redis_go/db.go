@@ -0,0 +1,314 @@
+package redis_go
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// activeExpireSamples is the number of keys with a time to live
+	// checked by each round of ActiveExpire.
+	activeExpireSamples = 20
+)
+
+// Db is a single numbered keyspace. Keys with a time to live are also
+// recorded in expires. They are removed when they are accessed, or when
+// ActiveExpire finds them while sampling.
+type Db struct {
+	data    *Dict[*Object]
+	expires *Dict[time.Time]
+	// memory is the estimated size of the entries in both dicts
+	memory int64
+	// avgTtl is a running estimate of the time to live of the volatile
+	// keys, updated by ActiveExpire
+	avgTtl time.Duration
+	// Counters for INFO
+	hits    int64
+	misses  int64
+	expired int64
+	// id is the number of the db, which notify is called with for the
+	// keyspace events of the db itself: the new keys, the key misses and
+	// the expired keys
+	id     int
+	notify func(class int, event string, key string, dbid int)
+	// modified is called for the keys the db removes on its own, once
+	// they expired
+	modified func(key string)
+	// slotKeys are the keys by hash slot, only kept in cluster mode, see
+	// indexSlots
+	slotKeys map[int]map[string]bool
+}
+
+func NewDb() *Db {
+	return &Db{
+		data:    NewDict[*Object](),
+		expires: NewDict[time.Time](),
+	}
+}
+
+// Get returns the value at key and records the access for eviction.
+func (d *Db) Get(key string) (string, bool) {
+	o, ok := d.Object(key)
+	if !ok {
+		d.misses++
+		d.notifyEvent(notifyKeyMiss, "keymiss", key)
+		return "", false
+	}
+	d.hits++
+	o.touch()
+	return o.value, true
+}
+
+// Object returns the object at key without recording an access.
+func (d *Db) Object(key string) (*Object, bool) {
+	if d.expireIfNeeded(key) {
+		return nil, false
+	}
+	return d.data.Get(key)
+}
+
+func (d *Db) Exists(key string) bool {
+	_, ok := d.Object(key)
+	return ok
+}
+
+// Set stores the value and clears any time to live the key had. The
+// access frequency of a value that is overwritten carries over.
+func (d *Db) Set(key string, value string) {
+	o := NewObject(value)
+	if old, ok := d.data.Get(key); ok {
+		o.freq = old.freq
+		o.freqTime = old.freqTime
+		o.touch()
+		d.memory -= old.size(key)
+	} else {
+		d.notifyEvent(notifyNew, "new", key)
+		d.addSlotKey(key)
+	}
+	d.data.Set(key, o)
+	d.memory += o.size(key)
+	d.deleteExpire(key)
+}
+
+func (d *Db) SetExpire(key string, at time.Time) {
+	if _, ok := d.data.Get(key); !ok {
+		return
+	}
+	if d.expires.Set(key, at) {
+		d.memory += expireOverhead
+	}
+}
+
+func (d *Db) Expire(key string) (time.Time, bool) {
+	return d.expires.Get(key)
+}
+
+func (d *Db) Delete(key string) bool {
+	o, ok := d.data.Get(key)
+	if !ok {
+		return false
+	}
+	d.data.Delete(key)
+	d.memory -= o.size(key)
+	d.deleteExpire(key)
+	d.deleteSlotKey(key)
+	return true
+}
+
+func (d *Db) deleteExpire(key string) {
+	if d.expires.Delete(key) {
+		d.memory -= expireOverhead
+	}
+}
+
+// Size includes keys that have expired but are not yet removed.
+func (d *Db) Size() int {
+	return d.data.Len()
+}
+
+// ExpiresSize is the number of keys with a time to live.
+func (d *Db) ExpiresSize() int {
+	return d.expires.Len()
+}
+
+// AvgTtl estimates the average time to live of the keys that have one.
+func (d *Db) AvgTtl() time.Duration {
+	return d.avgTtl
+}
+
+// Memory estimates the memory used by the keys and values in the db.
+func (d *Db) Memory() int64 {
+	return d.memory
+}
+
+// Type returns the type name of the value at key, or "none" if there is
+// no such key.
+func (d *Db) Type(key string) string {
+	if !d.Exists(key) {
+		return "none"
+	}
+	return "string"
+}
+
+// RandomKey returns a random key that has not expired.
+func (d *Db) RandomKey() (string, bool) {
+	for {
+		key, ok := d.data.RandomKey()
+		if !ok {
+			return "", false
+		}
+		// an expired key is removed, so this always terminates
+		if !d.expireIfNeeded(key) {
+			return key, true
+		}
+	}
+}
+
+// ActiveExpire removes expired keys found by sampling the keys with a time
+// to live. It keeps sampling while more than a quarter of a sample had
+// expired, until the deadline passes, and reports whether it stopped
+// because of the deadline.
+func (d *Db) ActiveExpire(deadline time.Time) bool {
+	for {
+		keys := d.expires.SampleKeys(activeExpireSamples)
+		if len(keys) == 0 {
+			return false
+		}
+
+		expired := 0
+		var ttlSum time.Duration
+		ttls := 0
+		now := time.Now()
+		for _, key := range keys {
+			if d.expireIfNeeded(key) {
+				expired++
+			} else if at, ok := d.expires.Get(key); ok {
+				ttlSum += at.Sub(now)
+				ttls++
+			}
+		}
+		if ttls > 0 {
+			// weigh each sample like redis does, so the estimate follows
+			// the keyspace without jumping around
+			avg := ttlSum / time.Duration(ttls)
+			if d.avgTtl == 0 {
+				d.avgTtl = avg
+			} else {
+				d.avgTtl = d.avgTtl/50*49 + avg/50
+			}
+		}
+		if expired*4 <= len(keys) {
+			return false
+		}
+		if !time.Now().Before(deadline) {
+			return true
+		}
+	}
+}
+
+// Rehash moves the resize of both tables forward until the deadline and
+// reports whether either still has buckets to move.
+func (d *Db) Rehash(deadline time.Time) bool {
+	pending := d.data.RehashUntil(deadline)
+	return d.expires.RehashUntil(deadline) || pending
+}
+
+// Scan visits the keys in one bucket of the keyspace, see Dict.Scan.
+func (d *Db) Scan(cursor uint64, fn func(key string)) uint64 {
+	return d.data.Scan(cursor, func(key string, _ *Object) {
+		fn(key)
+	})
+}
+
+// Flush drops both tables at once. Reclaiming the old entries is left to
+// the garbage collector, so this never walks the keyspace.
+func (d *Db) Flush() {
+	d.data = NewDict[*Object]()
+	d.expires = NewDict[time.Time]()
+	d.memory = 0
+	d.avgTtl = 0
+	if d.slotKeys != nil {
+		d.slotKeys = map[int]map[string]bool{}
+	}
+}
+
+// indexSlots starts keeping the keys by hash slot, for the commands of
+// the cluster that look the keys of a slot up.
+func (d *Db) indexSlots() {
+	d.slotKeys = map[int]map[string]bool{}
+	add := func(key string, _ *Object) {
+		d.addSlotKey(key)
+	}
+	for cursor := d.data.Scan(0, add); cursor != 0; {
+		cursor = d.data.Scan(cursor, add)
+	}
+}
+
+func (d *Db) addSlotKey(key string) {
+	if d.slotKeys == nil {
+		return
+	}
+	slot := keyHashSlot(key)
+	keys, ok := d.slotKeys[slot]
+	if !ok {
+		keys = map[string]bool{}
+		d.slotKeys[slot] = keys
+	}
+	keys[key] = true
+}
+
+func (d *Db) deleteSlotKey(key string) {
+	if d.slotKeys == nil {
+		return
+	}
+	slot := keyHashSlot(key)
+	delete(d.slotKeys[slot], key)
+	if len(d.slotKeys[slot]) == 0 {
+		delete(d.slotKeys, slot)
+	}
+}
+
+// CountKeysInSlot includes the keys that have expired but are not yet
+// removed.
+func (d *Db) CountKeysInSlot(slot int) int {
+	return len(d.slotKeys[slot])
+}
+
+// KeysInSlot returns up to count keys of the slot, sorted.
+func (d *Db) KeysInSlot(slot int, count int) []string {
+	keys := make([]string, 0, len(d.slotKeys[slot]))
+	for key := range d.slotKeys[slot] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > count {
+		keys = keys[:count]
+	}
+	return keys
+}
+
+func (d *Db) resetStats() {
+	d.hits = 0
+	d.misses = 0
+	d.expired = 0
+}
+
+func (d *Db) expireIfNeeded(key string) bool {
+	at, ok := d.expires.Get(key)
+	if !ok || time.Now().Before(at) {
+		return false
+	}
+	d.Delete(key)
+	d.expired++
+	if d.modified != nil {
+		d.modified(key)
+	}
+	d.notifyEvent(notifyExpired, "expired", key)
+	return true
+}
+
+func (d *Db) notifyEvent(class int, event string, key string) {
+	if d.notify != nil {
+		d.notify(class, event, key, d.id)
+	}
+}
@@ -0,0 +1,266 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+type SelectCommand struct {
+	BaseCommand
+	reader RespReader
+	index  int
+}
+
+func NewSelectCommand(rr RespReader) *SelectCommand {
+	return &SelectCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *SelectCommand) ReadParams(len int) (err error) {
+	if len != 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	c.index, err = readDbIndex(c.reader)
+	return
+}
+
+func (c *SelectCommand) Execute(srv *Server, cl *ev.Client) string {
+	if srv.cluster != nil && c.index != 0 {
+		return "-ERR SELECT is not allowed in cluster mode"
+	}
+	if _, ok := srv.DbAt(c.index); !ok {
+		return "-ERR DB index is out of range"
+	}
+	cl.Db = c.index
+	return "+OK"
+}
+
+type MoveCommand struct {
+	BaseCommand
+	reader RespReader
+	key    string
+	index  int
+}
+
+func NewMoveCommand(rr RespReader) *MoveCommand {
+	return &MoveCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *MoveCommand) ReadParams(len int) (err error) {
+	if len != 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	key, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.key = key
+
+	c.index, err = readDbIndex(c.reader)
+	return
+}
+
+func (c *MoveCommand) Execute(srv *Server, cl *ev.Client) string {
+	if srv.cluster != nil {
+		return "-ERR MOVE is not allowed in cluster mode"
+	}
+	dst, ok := srv.DbAt(c.index)
+	if !ok {
+		return "-ERR DB index is out of range"
+	}
+	if c.index == cl.Db {
+		return "-ERR source and destination objects are the same"
+	}
+
+	src := srv.Db(cl)
+	val, ok := src.Get(c.key)
+	if !ok || dst.Exists(c.key) {
+		return ":0"
+	}
+
+	dst.Set(c.key, val)
+	if at, ok := src.Expire(c.key); ok {
+		dst.SetExpire(c.key, at)
+	}
+	src.Delete(c.key)
+	srv.signalModifiedKey(cl, c.key)
+	srv.notifyKeyspaceEvent(notifyGeneric, "move_from", c.key, cl.Db)
+	srv.notifyKeyspaceEvent(notifyGeneric, "move_to", c.key, c.index)
+	return ":1"
+}
+
+type SwapDbCommand struct {
+	BaseCommand
+	reader RespReader
+	first  int
+	second int
+}
+
+func NewSwapDbCommand(rr RespReader) *SwapDbCommand {
+	return &SwapDbCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *SwapDbCommand) ReadParams(len int) (err error) {
+	if len != 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	c.first, err = readDbIndex(c.reader)
+	if err != nil {
+		return fmt.Errorf("invalid first DB index")
+	}
+
+	c.second, err = readDbIndex(c.reader)
+	if err != nil {
+		return fmt.Errorf("invalid second DB index")
+	}
+	return nil
+}
+
+func (c *SwapDbCommand) Execute(srv *Server, cl *ev.Client) string {
+	if srv.cluster != nil {
+		return "-ERR SWAPDB is not allowed in cluster mode"
+	}
+	if !srv.SwapDb(c.first, c.second) {
+		return "-ERR DB index is out of range"
+	}
+	return "+OK"
+}
+
+type FlushDbCommand struct {
+	BaseCommand
+	reader RespReader
+}
+
+func NewFlushDbCommand(rr RespReader) *FlushDbCommand {
+	return &FlushDbCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *FlushDbCommand) ReadParams(len int) error {
+	return readFlushMode(c.reader, len)
+}
+
+func (c *FlushDbCommand) Execute(srv *Server, cl *ev.Client) string {
+	srv.Db(cl).Flush()
+	srv.trackingInvalidateAll()
+	return "+OK"
+}
+
+type FlushAllCommand struct {
+	BaseCommand
+	reader RespReader
+}
+
+func NewFlushAllCommand(rr RespReader) *FlushAllCommand {
+	return &FlushAllCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *FlushAllCommand) ReadParams(len int) error {
+	return readFlushMode(c.reader, len)
+}
+
+func (c *FlushAllCommand) Execute(srv *Server, cl *ev.Client) string {
+	srv.FlushAll()
+	srv.trackingInvalidateAll()
+	return "+OK"
+}
+
+type DbSizeCommand struct {
+	BaseCommand
+}
+
+func NewDbSizeCommand() *DbSizeCommand {
+	return &DbSizeCommand{
+		BaseCommand: NewBaseCommand(),
+	}
+}
+
+func (c *DbSizeCommand) ReadParams(len int) error {
+	if len != 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	return nil
+}
+
+func (c *DbSizeCommand) Execute(srv *Server, cl *ev.Client) string {
+	return ":" + strconv.Itoa(srv.Db(cl).Size())
+}
+
+type RandomKeyCommand struct {
+	BaseCommand
+}
+
+func NewRandomKeyCommand() *RandomKeyCommand {
+	return &RandomKeyCommand{
+		BaseCommand: NewBaseCommand(),
+	}
+}
+
+func (c *RandomKeyCommand) ReadParams(len int) error {
+	if len != 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	return nil
+}
+
+func (c *RandomKeyCommand) Execute(srv *Server, cl *ev.Client) string {
+	key, ok := srv.Db(cl).RandomKey()
+	if !ok {
+		return "$-1"
+	}
+	return encodeBulkString(key)
+}
+
+func readDbIndex(rr RespReader) (int, error) {
+	str, err := rr.ReadBulkString()
+	if err != nil {
+		return -1, err
+	}
+
+	idx, err := strconv.Atoi(str)
+	if err != nil {
+		return -1, fmt.Errorf("value is not an integer or out of range")
+	}
+	return idx, nil
+}
+
+// readFlushMode accepts the optional SYNC / ASYNC argument of FLUSHDB and
+// FLUSHALL. Flushing never walks the keyspace (see Db.Flush), so both modes
+// behave the same.
+func readFlushMode(rr RespReader, len int) error {
+	if len == 0 {
+		return nil
+	}
+	if len != 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	mode, err := rr.ReadBulkString()
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToUpper(mode) {
+	case "SYNC", "ASYNC":
+		return nil
+	}
+	return fmt.Errorf("syntax error")
+}
@@ -0,0 +1,266 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandSelect(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	sc := SelectCommand{index: 3}
+	assert.Equal(t, "+OK", sc.Execute(srv, cl))
+	assert.Equal(t, 3, cl.Db)
+
+	stc := SetCommand{key: "hello", value: "world"}
+	stc.Execute(srv, cl)
+	cl.Db = 0
+	gc := GetCommand{key: "hello"}
+	assert.Equal(t, "$-1", gc.Execute(srv, cl))
+}
+
+func TestCommandSelectOutOfRange(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	sc := SelectCommand{index: 16}
+	assert.Equal(t, "-ERR DB index is out of range", sc.Execute(srv, cl))
+	assert.Equal(t, 0, cl.Db)
+}
+
+func TestSelectReadParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSelectCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("7", nil)
+	assert.Nil(t, sc.ReadParams(1))
+	assert.Equal(t, 7, sc.index)
+}
+
+func TestSelectReadParamsNotInteger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSelectCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("abc", nil)
+	assert.NotNil(t, sc.ReadParams(1))
+}
+
+func TestSelectReadParamsLenError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSelectCommand(mrr)
+	assert.NotNil(t, sc.ReadParams(0))
+}
+
+func TestCommandMove(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	at := time.Now().Add(time.Minute)
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[0].SetExpire("hello", at)
+
+	mc := MoveCommand{key: "hello", index: 2}
+	assert.Equal(t, ":1", mc.Execute(srv, cl))
+	assert.False(t, srv.dbs[0].Exists("hello"))
+
+	val, _ := srv.dbs[2].Get("hello")
+	assert.Equal(t, "world", val)
+	exp, _ := srv.dbs[2].Expire("hello")
+	assert.Equal(t, at, exp)
+}
+
+func TestCommandMoveExisting(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[2].Set("hello", "there")
+
+	mc := MoveCommand{key: "hello", index: 2}
+	assert.Equal(t, ":0", mc.Execute(srv, cl))
+	assert.True(t, srv.dbs[0].Exists("hello"))
+}
+
+func TestCommandMoveMissing(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MoveCommand{key: "hello", index: 2}
+	assert.Equal(t, ":0", mc.Execute(srv, cl))
+}
+
+func TestCommandMoveSameDb(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MoveCommand{key: "hello", index: 0}
+	assert.Equal(t, "-ERR source and destination objects are the same",
+		mc.Execute(srv, cl))
+}
+
+func TestCommandMoveOutOfRange(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MoveCommand{key: "hello", index: 20}
+	assert.Equal(t, "-ERR DB index is out of range", mc.Execute(srv, cl))
+}
+
+func TestMoveReadParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMoveCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("hello", nil)
+	mrr.EXPECT().ReadBulkString().Return("3", nil)
+	assert.Nil(t, mc.ReadParams(2))
+	assert.Equal(t, "hello", mc.key)
+	assert.Equal(t, 3, mc.index)
+}
+
+func TestMoveReadParamsKeyReadError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMoveCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("", fmt.Errorf("read error"))
+	assert.NotNil(t, mc.ReadParams(2))
+}
+
+func TestCommandSwapDb(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.dbs[1].Set("hello", "world")
+
+	sc := SwapDbCommand{first: 0, second: 1}
+	assert.Equal(t, "+OK", sc.Execute(srv, cl))
+
+	gc := GetCommand{key: "hello"}
+	assert.Equal(t, "$5\r\nworld", gc.Execute(srv, cl))
+}
+
+func TestCommandSwapDbOutOfRange(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	sc := SwapDbCommand{first: 0, second: 16}
+	assert.Equal(t, "-ERR DB index is out of range", sc.Execute(srv, cl))
+}
+
+func TestSwapDbReadParamsSecondError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSwapDbCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("0", nil)
+	mrr.EXPECT().ReadBulkString().Return("x", nil)
+	err := sc.ReadParams(2)
+	assert.Equal(t, "invalid second DB index", err.Error())
+}
+
+func TestCommandFlushDb(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[1].Set("hello", "world")
+
+	fc := FlushDbCommand{}
+	assert.Equal(t, "+OK", fc.Execute(srv, cl))
+	assert.Equal(t, 0, srv.dbs[0].Size())
+	assert.Equal(t, 1, srv.dbs[1].Size())
+}
+
+func TestCommandFlushAll(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[1].Set("hello", "world")
+
+	fc := FlushAllCommand{}
+	assert.Equal(t, "+OK", fc.Execute(srv, cl))
+	assert.Equal(t, 0, srv.dbs[0].Size())
+	assert.Equal(t, 0, srv.dbs[1].Size())
+}
+
+func TestFlushReadParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	fc := NewFlushDbCommand(mrr)
+	assert.Nil(t, fc.ReadParams(0))
+
+	mrr.EXPECT().ReadBulkString().Return("async", nil)
+	assert.Nil(t, fc.ReadParams(1))
+
+	mrr.EXPECT().ReadBulkString().Return("SYNC", nil)
+	assert.Nil(t, fc.ReadParams(1))
+
+	mrr.EXPECT().ReadBulkString().Return("LATER", nil)
+	assert.NotNil(t, fc.ReadParams(1))
+	assert.NotNil(t, fc.ReadParams(2))
+}
+
+func TestCommandDbSize(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[0].Set("foo", "bar")
+
+	dc := DbSizeCommand{}
+	assert.Equal(t, ":2", dc.Execute(srv, cl))
+}
+
+func TestCommandReaderSelect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+	cr := NewCommandReader(rr)
+
+	mockReadCommand(mr, nil, 2, "select", "2")
+
+	c, err := cr.Read()
+	assert.Nil(t, err)
+
+	sc := c.(*SelectCommand)
+	assert.Equal(t, 2, sc.index)
+}
+
+func TestCommandReaderFlushAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+	cr := NewCommandReader(rr)
+
+	mockReadCommand(mr, nil, 2, "FLUSHALL", "ASYNC")
+
+	c, err := cr.Read()
+	assert.Nil(t, err)
+
+	_, ok := c.(*FlushAllCommand)
+	assert.True(t, ok)
+}
+
+func TestCommandRandomKey(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	rc := RandomKeyCommand{}
+	assert.Equal(t, "$-1", rc.Execute(srv, cl))
+
+	srv.Db(cl).Set("hello", "world")
+	assert.Equal(t, "$5\r\nhello", rc.Execute(srv, cl))
+}
+
+func TestRandomKeyReadParamsLenError(t *testing.T) {
+	rc := NewRandomKeyCommand()
+	assert.NotNil(t, rc.ReadParams(1))
+}
@@ -0,0 +1,170 @@
+package redis_go
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbSetGet(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+
+	val, ok := db.Get("hello")
+	assert.True(t, ok)
+	assert.Equal(t, "world", val)
+	assert.Equal(t, 1, db.Size())
+}
+
+func TestDbGetExpired(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+	db.SetExpire("hello", time.Now().Add(-time.Millisecond))
+
+	_, ok := db.Get("hello")
+	assert.False(t, ok)
+	assert.Equal(t, 0, db.Size())
+}
+
+func TestDbSetClearsExpire(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+	db.SetExpire("hello", time.Now().Add(time.Minute))
+	db.Set("hello", "again")
+
+	_, ok := db.Expire("hello")
+	assert.False(t, ok)
+}
+
+func TestDbSetExpireMissingKey(t *testing.T) {
+	db := NewDb()
+	db.SetExpire("hello", time.Now().Add(time.Minute))
+
+	_, ok := db.Expire("hello")
+	assert.False(t, ok)
+}
+
+func TestDbDelete(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+
+	assert.True(t, db.Delete("hello"))
+	assert.False(t, db.Delete("hello"))
+	assert.False(t, db.Exists("hello"))
+}
+
+func TestDbFlush(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+	db.SetExpire("hello", time.Now().Add(time.Minute))
+	db.Flush()
+
+	assert.Equal(t, 0, db.Size())
+	_, ok := db.Expire("hello")
+	assert.False(t, ok)
+}
+
+func TestServerSwapDb(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Databases = 4
+	srv := NewServer(cfg)
+	srv.dbs[0].Set("hello", "world")
+
+	assert.True(t, srv.SwapDb(0, 3))
+	assert.False(t, srv.dbs[0].Exists("hello"))
+	assert.True(t, srv.dbs[3].Exists("hello"))
+	assert.False(t, srv.SwapDb(0, 4))
+	assert.False(t, srv.SwapDb(-1, 0))
+}
+
+func TestServerFlushAll(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Databases = 2
+	srv := NewServer(cfg)
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[1].Set("hello", "world")
+	srv.FlushAll()
+
+	assert.Equal(t, 0, srv.dbs[0].Size())
+	assert.Equal(t, 0, srv.dbs[1].Size())
+}
+
+func TestDbRandomKeySkipsExpired(t *testing.T) {
+	db := NewDb()
+	db.Set("old", "value")
+	db.SetExpire("old", time.Now().Add(-time.Second))
+	db.Set("new", "value")
+
+	for i := 0; i < 10; i++ {
+		key, ok := db.RandomKey()
+		assert.True(t, ok)
+		assert.Equal(t, "new", key)
+	}
+}
+
+func TestDbRandomKeyAllExpired(t *testing.T) {
+	db := NewDb()
+	db.Set("old", "value")
+	db.SetExpire("old", time.Now().Add(-time.Second))
+
+	_, ok := db.RandomKey()
+	assert.False(t, ok)
+}
+
+func TestDbActiveExpire(t *testing.T) {
+	db := NewDb()
+	past := time.Now().Add(-time.Second)
+	for i := 0; i < 200; i++ {
+		key := strconv.Itoa(i)
+		db.Set(key, "value")
+		db.SetExpire(key, past)
+	}
+	db.Set("persistent", "value")
+
+	// a cycle can stop early when its sample misses the remaining keys,
+	// later cycles pick them up
+	for i := 0; i < 100 && db.Size() > 1; i++ {
+		assert.False(t, db.ActiveExpire(time.Now().Add(time.Second)))
+	}
+	assert.Equal(t, 1, db.Size())
+	assert.True(t, db.Exists("persistent"))
+}
+
+func TestDbActiveExpireKeepsVolatile(t *testing.T) {
+	db := NewDb()
+	db.Set("volatile", "value")
+	db.SetExpire("volatile", time.Now().Add(time.Minute))
+
+	assert.False(t, db.ActiveExpire(time.Now().Add(time.Second)))
+	assert.True(t, db.Exists("volatile"))
+}
+
+func TestServerBeforeSleep(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Databases = 1
+	srv := NewServer(cfg)
+	db := srv.dbs[0]
+	for i := 0; i < 100; i++ {
+		db.Set(strconv.Itoa(i), "value")
+	}
+	for i := 0; i < 100; i++ {
+		db.Delete(strconv.Itoa(i))
+	}
+	for srv.BeforeSleep() {
+	}
+	assert.False(t, db.data.IsRehashing())
+	assert.Equal(t, dictInitialSize, len(db.data.tables[0].buckets))
+}
+
+func TestDbKeyspaceHitsAndMisses(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+	db.Get("hello")
+	db.Get("missing")
+	db.Object("hello")
+
+	assert.Equal(t, int64(1), db.hits)
+	assert.Equal(t, int64(1), db.misses)
+}
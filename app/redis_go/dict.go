@@ -0,0 +1,414 @@
+package redis_go
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand"
+	"time"
+	"unsafe"
+)
+
+const (
+	dictInitialSize = 4
+	// dictFairSampleSize is the number of keys RandomKey picks from.
+	dictFairSampleSize = 15
+)
+
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+type dictEntry[V any] struct {
+	key  string
+	val  V
+	next *dictEntry[V]
+}
+
+type dictTable[V any] struct {
+	buckets []*dictEntry[V]
+	used    int
+}
+
+func (t *dictTable[V]) mask() uint64 {
+	return uint64(len(t.buckets) - 1)
+}
+
+// Dict is a chained hash table that grows and shrinks incrementally. While
+// resizing, entries live in two tables and every operation moves one more
+// bucket from the old table to the new one, so no single call has to
+// rehash the whole table.
+type Dict[V any] struct {
+	tables [2]dictTable[V]
+	// rehashIdx is the next bucket of tables[0] to move, or -1 when the
+	// dict is not being resized.
+	rehashIdx int
+	seed      maphash.Seed
+}
+
+func NewDict[V any]() *Dict[V] {
+	return &Dict[V]{
+		rehashIdx: -1,
+		seed:      maphash.MakeSeed(),
+	}
+}
+
+func (d *Dict[V]) Len() int {
+	return d.tables[0].used + d.tables[1].used
+}
+
+// Overhead is the memory used by the dict itself and its buckets, not
+// counting the entries.
+func (d *Dict[V]) Overhead() int64 {
+	buckets := len(d.tables[0].buckets) + len(d.tables[1].buckets)
+	return int64(unsafe.Sizeof(*d)) + int64(buckets)*int64(unsafe.Sizeof(d.tables[0].buckets[0]))
+}
+
+func (d *Dict[V]) IsRehashing() bool {
+	return d.rehashIdx != -1
+}
+
+func (d *Dict[V]) Get(key string) (V, bool) {
+	d.rehashStep()
+	if e := d.find(key); e != nil {
+		return e.val, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set adds the key or replaces its value, and reports whether it was added.
+func (d *Dict[V]) Set(key string, val V) bool {
+	d.rehashStep()
+	if e := d.find(key); e != nil {
+		e.val = val
+		return false
+	}
+
+	d.expandIfNeeded()
+	t := &d.tables[0]
+	if d.IsRehashing() {
+		t = &d.tables[1]
+	}
+	idx := d.hash(key) & t.mask()
+	t.buckets[idx] = &dictEntry[V]{key: key, val: val, next: t.buckets[idx]}
+	t.used++
+	return true
+}
+
+func (d *Dict[V]) Delete(key string) bool {
+	d.rehashStep()
+	h := d.hash(key)
+	for i := range d.tables {
+		t := &d.tables[i]
+		if len(t.buckets) == 0 {
+			continue
+		}
+		idx := h & t.mask()
+		var prev *dictEntry[V]
+		for e := t.buckets[idx]; e != nil; e = e.next {
+			if e.key == key {
+				if prev == nil {
+					t.buckets[idx] = e.next
+				} else {
+					prev.next = e.next
+				}
+				t.used--
+				d.shrinkIfNeeded()
+				return true
+			}
+			prev = e
+		}
+		if !d.IsRehashing() {
+			break
+		}
+	}
+	return false
+}
+
+// Scan calls fn for every entry in the bucket addressed by cursor and
+// returns the cursor to continue from, or 0 once the whole dict is
+// covered. The cursor is advanced by incrementing its reversed bits, so
+// every entry present for the whole scan is returned at least once even
+// if the table is resized between calls.
+func (d *Dict[V]) Scan(cursor uint64, fn func(key string, val V)) uint64 {
+	if d.Len() == 0 {
+		return 0
+	}
+
+	v := cursor
+	if !d.IsRehashing() {
+		t := &d.tables[0]
+		m := t.mask()
+		emitBucket(t.buckets[v&m], fn)
+		return nextCursor(v, m)
+	}
+
+	small, large := &d.tables[0], &d.tables[1]
+	if len(small.buckets) > len(large.buckets) {
+		small, large = large, small
+	}
+	m0, m1 := small.mask(), large.mask()
+
+	emitBucket(small.buckets[v&m0], fn)
+	// Visit the buckets of the larger table that are the expansion of the
+	// bucket just visited in the smaller one.
+	for {
+		emitBucket(large.buckets[v&m1], fn)
+		v = nextCursor(v, m1)
+		if v&(m0^m1) == 0 {
+			break
+		}
+	}
+	return v
+}
+
+// RandomKey returns a random key. Picking a random bucket and then a random
+// entry of its chain would favour keys in short chains, so the key is
+// picked uniformly from a sample instead.
+func (d *Dict[V]) RandomKey() (string, bool) {
+	keys := d.SampleKeys(dictFairSampleSize)
+	if len(keys) > 0 {
+		return keys[random.Intn(len(keys))], true
+	}
+	// The sample can come back empty on a very sparse table
+	return d.randomEntryKey()
+}
+
+// randomEntryKey picks a random non-empty bucket, then a random entry of
+// its chain.
+func (d *Dict[V]) randomEntryKey() (string, bool) {
+	if d.Len() == 0 {
+		return "", false
+	}
+	d.rehashStep()
+
+	var e *dictEntry[V]
+	t0, t1 := &d.tables[0], &d.tables[1]
+	for e == nil {
+		if d.IsRehashing() {
+			// buckets of the old table below rehashIdx are empty
+			n := len(t0.buckets) + len(t1.buckets) - d.rehashIdx
+			h := d.rehashIdx + random.Intn(n)
+			if h >= len(t0.buckets) {
+				e = t1.buckets[h-len(t0.buckets)]
+			} else {
+				e = t0.buckets[h]
+			}
+		} else {
+			e = t0.buckets[random.Uint64()&t0.mask()]
+		}
+	}
+
+	l := 0
+	for c := e; c != nil; c = c.next {
+		l++
+	}
+	for n := random.Intn(l); n > 0; n-- {
+		e = e.next
+	}
+	return e.key, true
+}
+
+// SampleKeys returns up to count keys taken from consecutive buckets
+// starting at a random position. It is much cheaper than calling RandomKey
+// count times, and is what expiry and eviction use to find candidates. On a
+// sparse table it may return fewer keys than asked for, or none at all.
+func (d *Dict[V]) SampleKeys(count int) []string {
+	if count > d.Len() {
+		count = d.Len()
+	}
+	keys := make([]string, 0, count)
+	if count == 0 {
+		return keys
+	}
+
+	for j := 0; j < count; j++ {
+		d.rehashStep()
+	}
+
+	tables := 1
+	mask := d.tables[0].mask()
+	if d.IsRehashing() {
+		tables = 2
+		if m := d.tables[1].mask(); m > mask {
+			mask = m
+		}
+	}
+
+	i := random.Uint64() & mask
+	emptyLen := 0
+	for steps := count * 10; len(keys) < count && steps > 0; steps-- {
+		for j := 0; j < tables; j++ {
+			// Buckets of the old table below rehashIdx are empty already.
+			// If i is past the end of the new table too, there is nothing
+			// in either table until rehashIdx, so jump there.
+			if tables == 2 && j == 0 && i < uint64(d.rehashIdx) {
+				if i >= uint64(len(d.tables[1].buckets)) {
+					i = uint64(d.rehashIdx)
+				} else {
+					continue
+				}
+			}
+
+			t := &d.tables[j]
+			if i >= uint64(len(t.buckets)) {
+				continue
+			}
+
+			e := t.buckets[i]
+			if e == nil {
+				// Jump somewhere else after a long run of empty buckets
+				emptyLen++
+				if emptyLen >= 5 && emptyLen > count {
+					i = random.Uint64() & mask
+					emptyLen = 0
+				}
+				continue
+			}
+
+			emptyLen = 0
+			for ; e != nil && len(keys) < count; e = e.next {
+				keys = append(keys, e.key)
+			}
+		}
+		i = (i + 1) & mask
+	}
+	return keys
+}
+
+// RehashUntil moves buckets to the new table in batches until the resize
+// completes or the deadline passes, and reports whether there is more to
+// move.
+func (d *Dict[V]) RehashUntil(deadline time.Time) bool {
+	for d.rehash(100) {
+		if !time.Now().Before(deadline) {
+			return true
+		}
+	}
+	return false
+}
+
+func emitBucket[V any](e *dictEntry[V], fn func(key string, val V)) {
+	for e != nil {
+		// fn may delete the entry, so read next first
+		next := e.next
+		fn(e.key, e.val)
+		e = next
+	}
+}
+
+func nextCursor(v uint64, mask uint64) uint64 {
+	v |= ^mask
+	v = bits.Reverse64(v)
+	v++
+	return bits.Reverse64(v)
+}
+
+func (d *Dict[V]) find(key string) *dictEntry[V] {
+	if d.Len() == 0 {
+		return nil
+	}
+	h := d.hash(key)
+	for i := range d.tables {
+		t := &d.tables[i]
+		if len(t.buckets) == 0 {
+			continue
+		}
+		for e := t.buckets[h&t.mask()]; e != nil; e = e.next {
+			if e.key == key {
+				return e
+			}
+		}
+		if !d.IsRehashing() {
+			break
+		}
+	}
+	return nil
+}
+
+func (d *Dict[V]) hash(key string) uint64 {
+	return maphash.String(d.seed, key)
+}
+
+func (d *Dict[V]) expandIfNeeded() {
+	if d.IsRehashing() {
+		return
+	}
+	t := &d.tables[0]
+	if len(t.buckets) == 0 {
+		t.buckets = make([]*dictEntry[V], dictInitialSize)
+		return
+	}
+	if t.used >= len(t.buckets) {
+		d.resize(t.used * 2)
+	}
+}
+
+func (d *Dict[V]) shrinkIfNeeded() {
+	if d.IsRehashing() {
+		return
+	}
+	t := &d.tables[0]
+	if len(t.buckets) > dictInitialSize && t.used*10 < len(t.buckets) {
+		d.resize(t.used)
+	}
+}
+
+// resize starts moving the entries to a table with room for at least size
+// entries.
+func (d *Dict[V]) resize(size int) {
+	n := dictInitialSize
+	for n < size {
+		n *= 2
+	}
+	if n == len(d.tables[0].buckets) {
+		return
+	}
+	d.tables[1] = dictTable[V]{buckets: make([]*dictEntry[V], n)}
+	d.rehashIdx = 0
+}
+
+func (d *Dict[V]) rehashStep() {
+	d.rehash(1)
+}
+
+// rehash moves up to n buckets to the new table and reports whether there
+// is more left to move. To bound the time spent, at most n*10 empty
+// buckets are visited.
+func (d *Dict[V]) rehash(n int) bool {
+	if !d.IsRehashing() {
+		return false
+	}
+
+	emptyVisits := n * 10
+	src, dst := &d.tables[0], &d.tables[1]
+	for ; n > 0 && src.used > 0; n-- {
+		for src.buckets[d.rehashIdx] == nil {
+			d.rehashIdx++
+			emptyVisits--
+			if emptyVisits == 0 {
+				return true
+			}
+		}
+		for e := src.buckets[d.rehashIdx]; e != nil; {
+			next := e.next
+			idx := d.hash(e.key) & dst.mask()
+			e.next = dst.buckets[idx]
+			dst.buckets[idx] = e
+			src.used--
+			dst.used++
+			e = next
+		}
+		src.buckets[d.rehashIdx] = nil
+		d.rehashIdx++
+	}
+
+	if src.used == 0 {
+		d.tables[0] = d.tables[1]
+		d.tables[1] = dictTable[V]{}
+		d.rehashIdx = -1
+		// Deletes during the resize do not start another one, so the new
+		// table may already be too sparse.
+		d.shrinkIfNeeded()
+		return d.IsRehashing()
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package redis_go
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictSetGet(t *testing.T) {
+	d := NewDict[string]()
+	assert.True(t, d.Set("hello", "world"))
+	assert.False(t, d.Set("hello", "there"))
+
+	val, ok := d.Get("hello")
+	assert.True(t, ok)
+	assert.Equal(t, "there", val)
+	assert.Equal(t, 1, d.Len())
+
+	_, ok = d.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestDictDelete(t *testing.T) {
+	d := NewDict[int]()
+	d.Set("a", 1)
+
+	assert.True(t, d.Delete("a"))
+	assert.False(t, d.Delete("a"))
+	assert.Equal(t, 0, d.Len())
+}
+
+func TestDictGrowsIncrementally(t *testing.T) {
+	d := NewDict[int]()
+	rehashed := false
+	for i := 0; i < 1000; i++ {
+		d.Set(strconv.Itoa(i), i)
+		rehashed = rehashed || d.IsRehashing()
+	}
+	assert.True(t, rehashed)
+	assert.Equal(t, 1000, d.Len())
+
+	for i := 0; i < 1000; i++ {
+		val, ok := d.Get(strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, i, val)
+	}
+}
+
+func TestDictShrinks(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 1000; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 990; i++ {
+		assert.True(t, d.Delete(strconv.Itoa(i)))
+	}
+	assert.False(t, d.RehashUntil(time.Now().Add(time.Second)))
+	assert.Equal(t, 10, d.Len())
+	assert.Equal(t, 16, len(d.tables[0].buckets))
+
+	val, ok := d.Get("995")
+	assert.True(t, ok)
+	assert.Equal(t, 995, val)
+}
+
+func TestDictScanEmpty(t *testing.T) {
+	d := NewDict[int]()
+	assert.Equal(t, uint64(0), d.Scan(0, func(string, int) {
+		t.Fail()
+	}))
+}
+
+func TestDictScanReturnsEveryKey(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 500; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		cursor = d.Scan(cursor, func(key string, _ int) {
+			seen[key] = true
+		})
+		if cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, 500, len(seen))
+}
+
+func TestDictScanAcrossResize(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 100; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	for d.rehash(100) {
+	}
+
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	steps := 0
+	for {
+		cursor = d.Scan(cursor, func(key string, _ int) {
+			seen[key] = true
+		})
+		steps++
+		if steps == 5 {
+			// grow the table in the middle of the scan
+			for i := 100; i < 1000; i++ {
+				d.Set(strconv.Itoa(i), i)
+			}
+		}
+		if steps == 20 {
+			// and shrink it again
+			for i := 100; i < 1000; i++ {
+				d.Delete(strconv.Itoa(i))
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, seen[strconv.Itoa(i)], "missing key %d", i)
+	}
+}
+
+func TestDictRandomKey(t *testing.T) {
+	d := NewDict[int]()
+	_, ok := d.RandomKey()
+	assert.False(t, ok)
+
+	for i := 0; i < 100; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key, ok := d.RandomKey()
+		assert.True(t, ok)
+		_, ok = d.Get(key)
+		assert.True(t, ok)
+		seen[key] = true
+	}
+	// any reasonable spread will have seen most keys by now
+	assert.Greater(t, len(seen), 50)
+}
+
+func TestDictSampleKeys(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 3; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	assert.ElementsMatch(t, []string{"0", "1", "2"}, d.SampleKeys(20))
+
+	for i := 3; i < 1000; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	keys := d.SampleKeys(20)
+	assert.Equal(t, 20, len(keys))
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		assert.False(t, seen[key])
+		seen[key] = true
+	}
+}
+
+func TestDictSampleKeysWhileRehashing(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 64; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	for !d.IsRehashing() {
+		d.Set(strconv.Itoa(d.Len()), 0)
+	}
+
+	keys := d.SampleKeys(10)
+	assert.Equal(t, 10, len(keys))
+	for _, key := range keys {
+		_, ok := d.Get(key)
+		assert.True(t, ok)
+	}
+}
+
+func TestDictRandomKeySparse(t *testing.T) {
+	d := NewDict[int]()
+	for i := 0; i < 1000; i++ {
+		d.Set(strconv.Itoa(i), i)
+	}
+	assert.False(t, d.RehashUntil(time.Now().Add(time.Second)))
+	for i := 0; i < 999; i++ {
+		d.Delete(strconv.Itoa(i))
+	}
+
+	for i := 0; i < 100; i++ {
+		key, ok := d.RandomKey()
+		assert.True(t, ok)
+		assert.Equal(t, "999", key)
+	}
+}
+
+func TestDictOverhead(t *testing.T) {
+	d := NewDict[int]()
+	empty := d.Overhead()
+
+	d.Set("a", 1)
+	assert.Equal(t, empty+int64(dictInitialSize*8), d.Overhead())
+}
@@ -0,0 +1,171 @@
+package redis_go
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+const (
+	// rdbVersion is the version of the RDB format the payloads of DUMP
+	// are written in, that of redis 7.2
+	rdbVersion = 11
+	// rdbTypeString is the only type of value there is
+	rdbTypeString = 0
+	// rdbOpcodeFunction2 starts a library in the payloads of FUNCTION DUMP
+	rdbOpcodeFunction2 = 245
+
+	// the RDB length encodings, in the two top bits of the first byte
+	rdbLen6bit  = 0
+	rdbLen14bit = 1
+	rdbLen32bit = 0x80
+	rdbLen64bit = 0x81
+	rdbEncVal   = 3
+	// the special encodings of strings holding integers
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+)
+
+var errDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// crc64Table is the table of the CRC64 Jones variant redis checksums the
+// payloads with, reflected, with initial value 0 and no final xor.
+var crc64Table = func() [256]uint64 {
+	const poly = 0x95ac9329ac4bc9b5 // 0xad93d23594c935a9 reflected
+	var table [256]uint64
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc64(crc uint64, data []byte) uint64 {
+	for _, b := range data {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
+
+// dumpPayload serializes a value as DUMP does, in the format of redis so
+// that the payloads can be restored by either: the value in RDB encoding,
+// then the RDB version and a CRC64 of all that, both little endian.
+func dumpPayload(value string) string {
+	buf := appendRdbString([]byte{rdbTypeString}, value)
+	return string(appendDumpFooter(buf))
+}
+
+// appendDumpFooter ends a payload with the RDB version and the CRC64.
+func appendDumpFooter(buf []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, rdbVersion)
+	return binary.LittleEndian.AppendUint64(buf, crc64(0, buf))
+}
+
+// verifyDumpFooter checks the footer of a payload, and returns what comes
+// before it.
+func verifyDumpFooter(payload string) ([]byte, error) {
+	p := []byte(payload)
+	if len(p) < 10 {
+		return nil, errDumpPayload
+	}
+	body := p[:len(p)-8]
+	if binary.LittleEndian.Uint16(body[len(body)-2:]) > rdbVersion {
+		return nil, errDumpPayload
+	}
+	if crc64(0, body) != binary.LittleEndian.Uint64(p[len(p)-8:]) {
+		return nil, errDumpPayload
+	}
+	return body[:len(body)-2], nil
+}
+
+// verifyDumpPayload checks the footer of a payload, and returns the value
+// serialized in it.
+func verifyDumpPayload(payload string) (string, error) {
+	body, err := verifyDumpFooter(payload)
+	if err != nil {
+		return "", err
+	}
+	value, rest, ok := readRdbString(body)
+	if !ok || len(rest) != 0 {
+		return "", errors.New("Bad data format")
+	}
+	return value, nil
+}
+
+func appendRdbString(buf []byte, s string) []byte {
+	buf = appendRdbLen(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendRdbLen(buf []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(buf, byte(n)|rdbLen6bit<<6)
+	case n < 1<<14:
+		return append(buf, byte(n>>8)|rdbLen14bit<<6, byte(n))
+	case n <= 1<<32-1:
+		return binary.BigEndian.AppendUint32(append(buf, rdbLen32bit), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, rdbLen64bit), n)
+}
+
+// readRdbString reads the type and the string of a payload. The strings
+// holding integers that redis encodes as such are read too, the ones it
+// compresses are not.
+func readRdbString(p []byte) (string, []byte, bool) {
+	if len(p) < 2 || p[0] != rdbTypeString {
+		return "", nil, false
+	}
+	return readRdbRawString(p[1:])
+}
+
+// readRdbRawString reads a string not preceded by its type.
+func readRdbRawString(p []byte) (string, []byte, bool) {
+	if len(p) < 1 {
+		return "", nil, false
+	}
+	kind := p[0] >> 6
+	switch {
+	case kind == rdbLen6bit:
+		return readRdbBytes(p[1:], uint64(p[0]&0x3f))
+	case kind == rdbLen14bit && len(p) >= 2:
+		return readRdbBytes(p[2:], uint64(p[0]&0x3f)<<8|uint64(p[1]))
+	case p[0] == rdbLen32bit && len(p) >= 5:
+		return readRdbBytes(p[5:], uint64(binary.BigEndian.Uint32(p[1:])))
+	case p[0] == rdbLen64bit && len(p) >= 9:
+		return readRdbBytes(p[9:], binary.BigEndian.Uint64(p[1:]))
+	case kind == rdbEncVal:
+		return readRdbInt(p[1:], p[0]&0x3f)
+	}
+	return "", nil, false
+}
+
+func readRdbBytes(p []byte, n uint64) (string, []byte, bool) {
+	if uint64(len(p)) < n {
+		return "", nil, false
+	}
+	return string(p[:n]), p[n:], true
+}
+
+func readRdbInt(p []byte, enc byte) (string, []byte, bool) {
+	var n int64
+	switch {
+	case enc == rdbEncInt8 && len(p) >= 1:
+		n, p = int64(int8(p[0])), p[1:]
+	case enc == rdbEncInt16 && len(p) >= 2:
+		n, p = int64(int16(binary.LittleEndian.Uint16(p))), p[2:]
+	case enc == rdbEncInt32 && len(p) >= 4:
+		n, p = int64(int32(binary.LittleEndian.Uint32(p))), p[4:]
+	default:
+		return "", nil, false
+	}
+	return strconv.FormatInt(n, 10), p, true
+}
@@ -0,0 +1,343 @@
+package redis_go
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DumpCommand struct {
+	BaseCommand
+	reader RespReader
+	key    string
+}
+
+func NewDumpCommand(rr RespReader) *DumpCommand {
+	return &DumpCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *DumpCommand) ReadParams(len int) (err error) {
+	if len != 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	c.key, err = c.reader.ReadBulkString()
+	return
+}
+
+func (c *DumpCommand) Execute(srv *Server, cl *ev.Client) string {
+	val, ok := srv.Db(cl).Get(c.key)
+	if !ok {
+		return "$-1"
+	}
+	return encodeBulkString(dumpPayload(val))
+}
+
+// RestoreCommand is RESTORE, and RESTORE-ASKING which MIGRATE sends in
+// cluster mode so that the target serves it while importing the slot.
+type RestoreCommand struct {
+	BaseCommand
+	reader  RespReader
+	key     string
+	ttl     int64
+	payload string
+	replace bool
+	absTtl  bool
+}
+
+func NewRestoreCommand(rr RespReader) *RestoreCommand {
+	return &RestoreCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+// ReadParams reads RESTORE key ttl payload [REPLACE] [ABSTTL].
+func (c *RestoreCommand) ReadParams(len int) error {
+	if len < 3 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	args, err := readBulkStrings(c.reader, len)
+	if err != nil {
+		return err
+	}
+	c.key, c.payload = args[0], args[2]
+	c.ttl, err = strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("value is not an integer or out of range")
+	}
+	if c.ttl < 0 {
+		return fmt.Errorf("Invalid TTL value, must be >= 0")
+	}
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(arg) {
+		case "REPLACE":
+			c.replace = true
+		case "ABSTTL":
+			c.absTtl = true
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	return nil
+}
+
+func (c *RestoreCommand) Execute(srv *Server, cl *ev.Client) string {
+	db := srv.Db(cl)
+	if !c.replace && db.Exists(c.key) {
+		return "-BUSYKEY Target key name already exists."
+	}
+	val, err := verifyDumpPayload(c.payload)
+	if err != nil {
+		return "-ERR " + err.Error()
+	}
+
+	var at time.Time
+	if c.ttl > 0 {
+		if c.absTtl {
+			at = time.UnixMilli(c.ttl)
+		} else {
+			at = time.Now().Add(time.Duration(c.ttl) * time.Millisecond)
+		}
+	}
+	if !at.IsZero() && !at.After(time.Now()) {
+		// the key expired already, so it is only removed
+		if db.Delete(c.key) {
+			srv.signalModifiedKey(cl, c.key)
+			srv.notifyKeyspaceEvent(notifyGeneric, "del", c.key, cl.Db)
+		}
+		return "+OK"
+	}
+
+	db.Set(c.key, val)
+	if !at.IsZero() {
+		db.SetExpire(c.key, at)
+	}
+	srv.signalModifiedKey(cl, c.key)
+	srv.notifyKeyspaceEvent(notifyGeneric, "restore", c.key, cl.Db)
+	return "+OK"
+}
+
+// MigrateCommand moves keys to another instance: they are sent with
+// RESTORE and removed from this one once the target replied.
+type MigrateCommand struct {
+	BaseCommand
+	reader   RespReader
+	host     string
+	port     string
+	keys     []string
+	db       int
+	timeout  time.Duration
+	copy     bool
+	replace  bool
+	user     string
+	password string
+}
+
+func NewMigrateCommand(rr RespReader) *MigrateCommand {
+	return &MigrateCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+// ReadParams reads MIGRATE host port key|"" destination-db timeout [COPY]
+// [REPLACE] [AUTH password] [AUTH2 username password] [KEYS key ...].
+func (c *MigrateCommand) ReadParams(len int) error {
+	if len < 5 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	args, err := readBulkStrings(c.reader, len)
+	if err != nil {
+		return err
+	}
+	c.host, c.port = args[0], args[1]
+	db, err := strconv.Atoi(args[3])
+	if err != nil {
+		return fmt.Errorf("value is not an integer or out of range")
+	}
+	timeout, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		return fmt.Errorf("value is not an integer or out of range")
+	}
+	if timeout <= 0 {
+		timeout = 1000
+	}
+	c.db, c.timeout = db, time.Duration(timeout)*time.Millisecond
+
+	keysOption := false
+	for i := 5; i < len && !keysOption; i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COPY":
+			c.copy = true
+		case "REPLACE":
+			c.replace = true
+		case "AUTH":
+			if i+1 == len {
+				return fmt.Errorf("syntax error")
+			}
+			i++
+			c.password = args[i]
+		case "AUTH2":
+			if i+2 >= len {
+				return fmt.Errorf("syntax error")
+			}
+			c.user, c.password = args[i+1], args[i+2]
+			i += 2
+		case "KEYS":
+			if args[2] != "" {
+				return fmt.Errorf("When using MIGRATE KEYS option, the key argument must be set to the " +
+					"empty string")
+			}
+			c.keys = args[i+1:]
+			keysOption = true
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	if !keysOption {
+		c.keys = []string{args[2]}
+	}
+	return nil
+}
+
+// migrateKeys finds the keys of MIGRATE, either the third argument or the
+// ones after KEYS.
+func migrateKeys(argv []string) []string {
+	if len(argv) < 6 {
+		return nil
+	}
+	if argv[3] != "" {
+		return []string{argv[3]}
+	}
+	for i := 6; i < len(argv); i++ {
+		switch strings.ToUpper(argv[i]) {
+		case "AUTH":
+			i++
+		case "AUTH2":
+			i += 2
+		case "KEYS":
+			return argv[i+1:]
+		}
+	}
+	return nil
+}
+
+// Execute sends the commands to the target one at a time, waiting for the
+// reply to each, and blocks the loop meanwhile as in redis.
+// setArgv hides the passwords of AUTH and AUTH2, and the user of AUTH2,
+// but not the keys that follow them.
+func (c *MigrateCommand) setArgv(argv []string) {
+	argv = append([]string{}, argv...)
+	for i := 6; i < len(argv); i++ {
+		switch strings.ToUpper(argv[i]) {
+		case "AUTH":
+			if i+1 < len(argv) {
+				argv[i+1] = "(redacted)"
+			}
+			i++
+		case "AUTH2":
+			for j := i + 1; j <= i+2 && j < len(argv); j++ {
+				argv[j] = "(redacted)"
+			}
+			i += 2
+		case "KEYS":
+			i = len(argv)
+		}
+	}
+	c.BaseCommand.setArgv(argv)
+}
+
+func (c *MigrateCommand) Execute(srv *Server, cl *ev.Client) string {
+	db := srv.Db(cl)
+	var keys []string
+	for _, key := range c.keys {
+		if db.Exists(key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "+NOKEY"
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.host, c.port), c.timeout)
+	if err != nil {
+		return "-IOERR error or timeout connecting to the client"
+	}
+	defer conn.Close()
+	target := &migrateTarget{conn: conn, reader: bufio.NewReader(conn), timeout: c.timeout}
+
+	if c.password != "" {
+		auth := []string{"AUTH", c.password}
+		if c.user != "" {
+			auth = []string{"AUTH", c.user, c.password}
+		}
+		if res := target.call(auth); res != "" {
+			return res
+		}
+	}
+	if res := target.call([]string{"SELECT", strconv.Itoa(c.db)}); res != "" {
+		return res
+	}
+
+	restore := "RESTORE"
+	if srv.cluster != nil {
+		restore = "RESTORE-ASKING"
+	}
+	for _, key := range keys {
+		val, ok := db.Get(key)
+		if !ok {
+			continue
+		}
+		var ttl int64
+		if at, ok := db.Expire(key); ok {
+			if ttl = time.Until(at).Milliseconds(); ttl < 1 {
+				ttl = 1
+			}
+		}
+		argv := []string{restore, key, strconv.FormatInt(ttl, 10), dumpPayload(val)}
+		if c.replace {
+			argv = append(argv, "REPLACE")
+		}
+		if res := target.call(argv); res != "" {
+			return res
+		}
+		if !c.copy {
+			db.Delete(key)
+			srv.signalModifiedKey(cl, key)
+			srv.notifyKeyspaceEvent(notifyGeneric, "del", key, cl.Db)
+		}
+	}
+	return "+OK"
+}
+
+// migrateTarget is the connection of MIGRATE to the target instance.
+type migrateTarget struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// call sends a command and reads its status reply, returning the error to
+// reply with when the target could not be reached or failed.
+func (t *migrateTarget) call(argv []string) string {
+	t.conn.SetDeadline(time.Now().Add(t.timeout))
+	if _, err := t.conn.Write([]byte(encodeBulkStrings(argv) + "\r\n")); err != nil {
+		return "-IOERR error or timeout writing to target instance"
+	}
+	line, err := t.reader.ReadString('\n')
+	if err != nil {
+		return "-IOERR error or timeout reading to target instance"
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if strings.HasPrefix(line, "-") {
+		return "-ERR Target instance replied with error: " + line[1:]
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package redis_go
+
+import (
+	"bufio"
+	"net"
+	"redis-go/app/ev"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpRestore(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	assert.Equal(t, "$-1\r\n", handle(srv, a, "DUMP", "foo"))
+	handle(srv, a, "SET", "foo", "bar")
+	payload := readBulkReply(t, handle(srv, a, "DUMP", "foo"))
+	assert.Equal(t, dumpPayload("bar"), payload)
+
+	assert.Equal(t, "-BUSYKEY Target key name already exists.\r\n", handle(srv, a, "RESTORE", "foo", "0", payload))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "RESTORE", "baz", "0", payload))
+	assert.Equal(t, "$3\r\nbar\r\n", handle(srv, a, "GET", "baz"))
+	_, ok := srv.Db(a).Expire("baz")
+	assert.False(t, ok)
+
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "RESTORE", "baz", "5000", dumpPayload("qux"), "REPLACE"))
+	assert.Equal(t, "$3\r\nqux\r\n", handle(srv, a, "GET", "baz"))
+	at, ok := srv.Db(a).Expire("baz")
+	assert.True(t, ok)
+	assert.InDelta(t, 5000, time.Until(at).Milliseconds(), 100)
+
+	// an absolute time in the past only removes the key
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "RESTORE", "baz", "1", payload, "REPLACE", "ABSTTL"))
+	assert.False(t, srv.Db(a).Exists("baz"))
+
+	assert.Equal(t, "-ERR DUMP payload version or checksum are wrong\r\n",
+		handle(srv, a, "RESTORE", "bad", "0", payload[:len(payload)-1]+"x"))
+}
+
+func TestRestoreParamErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"foo", "0"}, "incorrect number of params"},
+		{[]string{"foo", "x", "p"}, "value is not an integer or out of range"},
+		{[]string{"foo", "-1", "p"}, "Invalid TTL value, must be >= 0"},
+		{[]string{"foo", "0", "p", "nope"}, "syntax error"},
+	}
+	srv, a, _ := newClientTestServer()
+	for _, tt := range tests {
+		args := append([]string{"RESTORE"}, tt.args...)
+		assert.Equal(t, "-ERR "+tt.err+"\r\n", handle(srv, a, args...), tt.args)
+	}
+}
+
+func TestMigrateParamErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"host", "1", "foo", "0"}, "incorrect number of params"},
+		{[]string{"host", "1", "foo", "x", "10"}, "value is not an integer or out of range"},
+		{[]string{"host", "1", "foo", "0", "x"}, "value is not an integer or out of range"},
+		{[]string{"host", "1", "foo", "0", "10", "nope"}, "syntax error"},
+		{[]string{"host", "1", "foo", "0", "10", "AUTH"}, "syntax error"},
+		{[]string{"host", "1", "foo", "0", "10", "AUTH2", "user"}, "syntax error"},
+		{[]string{"host", "1", "foo", "0", "10", "KEYS", "bar"},
+			"When using MIGRATE KEYS option, the key argument must be set to the empty string"},
+	}
+	srv, a, _ := newClientTestServer()
+	for _, tt := range tests {
+		args := append([]string{"MIGRATE"}, tt.args...)
+		assert.Equal(t, "-ERR "+tt.err+"\r\n", handle(srv, a, args...), tt.args)
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	assert.Equal(t, []string{"foo"}, migrateKeys([]string{"MIGRATE", "h", "1", "foo", "0", "10"}))
+	assert.Equal(t, []string{"a", "b"}, migrateKeys([]string{"MIGRATE", "h", "1", "", "0", "10", "COPY", "KEYS", "a", "b"}))
+	// a password named KEYS is not the option
+	assert.Equal(t, []string{"a"}, migrateKeys([]string{"MIGRATE", "h", "1", "", "0", "10", "AUTH", "KEYS", "KEYS", "a"}))
+	assert.Nil(t, migrateKeys([]string{"MIGRATE", "h", "1", "", "0", "10"}))
+}
+
+func TestMigrateRedacted(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SlowlogLogSlowerThan = 0
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+	monitor := ev.NewClient(2)
+	srv.addMonitor(monitor)
+
+	handle(srv, cl, "MIGRATE", "127.0.0.1", "1", "", "0", "10", "AUTH", "s3cret", "KEYS", "a", "AUTH")
+	redacted := []string{"MIGRATE", "127.0.0.1", "1", "", "0", "10", "AUTH", "(redacted)", "KEYS", "a", "AUTH"}
+	assert.Equal(t, len(monitorLine(redacted, cl, 0, time.Now())), monitor.PendingOutput())
+	handle(srv, cl, "MIGRATE", "127.0.0.1", "1", "k", "0", "10", "COPY", "AUTH2", "alice", "s3cret")
+	if assert.Equal(t, 2, len(srv.slowlog.entries)) {
+		assert.Equal(t, []string{"MIGRATE", "127.0.0.1", "1", "k", "0", "10", "COPY", "AUTH2", "(redacted)", "(redacted)"},
+			srv.slowlog.entries[0].argv)
+		assert.Equal(t, redacted, srv.slowlog.entries[1].argv)
+	}
+}
+
+// serveMigrateTarget serves the commands of the connections to the target
+// instance, one at a time as the event loop does.
+func serveMigrateTarget(t *testing.T, target *Server) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				cl := ev.NewClient(5)
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := r.Peek(1); err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte(target.Handle(cl, r))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestMigrate(t *testing.T) {
+	srv, a, _ := newClientTestServer()
+	config := NewConfig()
+	config.RequirePass = "secret"
+	target := NewServer(config)
+	port := serveMigrateTarget(t, target)
+
+	assert.Equal(t, "+NOKEY\r\n", handle(srv, a, "MIGRATE", "127.0.0.1", port, "foo", "0", "1000"))
+
+	handle(srv, a, "SET", "foo", "bar", "PX", "10000")
+	assert.Equal(t, "-ERR Target instance replied with error: NOAUTH Authentication required.\r\n",
+		handle(srv, a, "MIGRATE", "127.0.0.1", port, "foo", "0", "1000"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "MIGRATE", "127.0.0.1", port, "foo", "3", "1000", "AUTH", "secret"))
+	assert.False(t, srv.Db(a).Exists("foo"))
+	db, _ := target.DbAt(3)
+	val, ok := db.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, "bar", val)
+	_, ok = db.Expire("foo")
+	assert.True(t, ok)
+
+	handle(srv, a, "SET", "foo", "baz")
+	handle(srv, a, "SET", "qux", "1")
+	assert.Equal(t, "-ERR Target instance replied with error: BUSYKEY Target key name already exists.\r\n",
+		handle(srv, a, "MIGRATE", "127.0.0.1", port, "", "3", "1000", "AUTH2", "default", "secret",
+			"KEYS", "foo", "qux"))
+	assert.Equal(t, "+OK\r\n", handle(srv, a, "MIGRATE", "127.0.0.1", port, "", "3", "1000", "AUTH", "secret",
+		"COPY", "REPLACE", "KEYS", "foo", "qux", "missing"))
+	assert.True(t, srv.Db(a).Exists("foo"))
+	val, _ = db.Get("foo")
+	assert.Equal(t, "baz", val)
+	assert.True(t, db.Exists("qux"))
+
+	assert.Equal(t, "-IOERR error or timeout connecting to the client\r\n",
+		handle(srv, a, "MIGRATE", "127.0.0.1", strconv.Itoa(freePort(t)), "foo", "0", "1000"))
+}
@@ -0,0 +1,53 @@
+package redis_go
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrc64(t *testing.T) {
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), crc64(0, []byte("123456789")))
+}
+
+func TestDumpPayload(t *testing.T) {
+	for _, value := range []string{"", "bar", strings.Repeat("x", 100), strings.Repeat("y", 20000)} {
+		v, err := verifyDumpPayload(dumpPayload(value))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+	assert.Equal(t, "\x00\x03bar\x0b\x00", dumpPayload("bar")[:7])
+}
+
+func TestVerifyDumpPayload(t *testing.T) {
+	// DUMP of the integer 10 by redis
+	v, err := verifyDumpPayload("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", v)
+
+	payload := dumpPayload("bar")
+	_, err = verifyDumpPayload(payload[:len(payload)-1] + "x")
+	assert.EqualError(t, err, "DUMP payload version or checksum are wrong")
+	_, err = verifyDumpPayload("short")
+	assert.EqualError(t, err, "DUMP payload version or checksum are wrong")
+
+	// a newer RDB version
+	body := "\x00\x03bar\x0c\x00"
+	_, err = verifyDumpPayload(body + string(crc64Bytes(body)))
+	assert.EqualError(t, err, "DUMP payload version or checksum are wrong")
+
+	// a length past the end
+	body = "\x00\x05bar\x0b\x00"
+	_, err = verifyDumpPayload(body + string(crc64Bytes(body)))
+	assert.EqualError(t, err, "Bad data format")
+}
+
+func crc64Bytes(s string) []byte {
+	crc := crc64(0, []byte(s))
+	b := make([]byte, 8)
+	for i := range b {
+		b[i] = byte(crc >> (8 * i))
+	}
+	return b
+}
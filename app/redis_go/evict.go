@@ -0,0 +1,229 @@
+package redis_go
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	PolicyNoEviction     = "noeviction"
+	PolicyAllKeysLru     = "allkeys-lru"
+	PolicyVolatileLru    = "volatile-lru"
+	PolicyAllKeysLfu     = "allkeys-lfu"
+	PolicyVolatileLfu    = "volatile-lfu"
+	PolicyAllKeysRandom  = "allkeys-random"
+	PolicyVolatileRandom = "volatile-random"
+	PolicyVolatileTtl    = "volatile-ttl"
+
+	evictionPoolSize = 16
+)
+
+func IsValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyNoEviction, PolicyAllKeysLru, PolicyVolatileLru,
+		PolicyAllKeysLfu, PolicyVolatileLfu, PolicyAllKeysRandom,
+		PolicyVolatileRandom, PolicyVolatileTtl:
+		return true
+	}
+	return false
+}
+
+func isLfuPolicy(policy string) bool {
+	return policy == PolicyAllKeysLfu || policy == PolicyVolatileLfu
+}
+
+// isVolatilePolicy is true for the policies that only evict keys with a
+// time to live.
+func isVolatilePolicy(policy string) bool {
+	switch policy {
+	case PolicyVolatileLru, PolicyVolatileLfu, PolicyVolatileRandom,
+		PolicyVolatileTtl:
+		return true
+	}
+	return false
+}
+
+type evictionCandidate struct {
+	// idle is the score of the key, the higher the better to evict
+	idle uint64
+	key  string
+	db   *Db
+}
+
+// evictionPool keeps the best candidates seen across samples, sorted by
+// ascending idle score. Sampling only a few keys at a time approximates
+// true LRU / LFU much better when good candidates from earlier samples are
+// remembered.
+type evictionPool struct {
+	entries []evictionCandidate
+}
+
+func newEvictionPool() *evictionPool {
+	return &evictionPool{
+		entries: make([]evictionCandidate, 0, evictionPoolSize),
+	}
+}
+
+func (p *evictionPool) insert(c evictionCandidate) {
+	k := 0
+	for k < len(p.entries) && p.entries[k].idle < c.idle {
+		k++
+	}
+	for _, e := range p.entries {
+		if e.key == c.key && e.db == c.db {
+			return
+		}
+	}
+
+	if len(p.entries) == evictionPoolSize {
+		if k == 0 {
+			// worse than every candidate in a full pool
+			return
+		}
+		// drop the worst candidate to make room
+		copy(p.entries, p.entries[1:k])
+		p.entries[k-1] = c
+		return
+	}
+
+	p.entries = append(p.entries, evictionCandidate{})
+	copy(p.entries[k+1:], p.entries[k:])
+	p.entries[k] = c
+}
+
+// pop removes and returns the best candidate.
+func (p *evictionPool) pop() (evictionCandidate, bool) {
+	if len(p.entries) == 0 {
+		return evictionCandidate{}, false
+	}
+	c := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	return c, true
+}
+
+// populate samples keys from db and adds them to the pool.
+func (p *evictionPool) populate(db *Db, policy string, samples int) {
+	var keys []string
+	if isVolatilePolicy(policy) {
+		keys = db.expires.SampleKeys(samples)
+	} else {
+		keys = db.data.SampleKeys(samples)
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		o, ok := db.data.Get(key)
+		if !ok {
+			continue
+		}
+
+		var idle uint64
+		switch policy {
+		case PolicyVolatileTtl:
+			at, _ := db.expires.Get(key)
+			// the sooner the key expires, the better to evict
+			idle = math.MaxUint64 - uint64(at.UnixMilli())
+		case PolicyAllKeysLfu, PolicyVolatileLfu:
+			idle = 255 - uint64(o.decayedFreq(now))
+		default:
+			idle = uint64(now.UnixMilli() - o.access)
+		}
+		p.insert(evictionCandidate{idle: idle, key: key, db: db})
+	}
+}
+
+// UsedMemory estimates the memory used by the dataset.
+func (s *Server) UsedMemory() int64 {
+	var used int64
+	for _, db := range s.dbs {
+		used += db.Memory()
+	}
+	return used
+}
+
+// freeMemoryIfNeeded evicts keys until the used memory is within
+// maxmemory, following the configured policy. It reports false when that
+// is not possible.
+func (s *Server) freeMemoryIfNeeded() bool {
+	if s.config.MaxMemory == 0 {
+		return true
+	}
+
+	start := time.Now()
+	defer func() {
+		s.latencyAddSampleIfNeeded(latencyEventEvictionCycle, time.Since(start))
+	}()
+	for s.UsedMemory() > s.config.MaxMemory {
+		db, key, ok := s.evictionCandidate()
+		if !ok {
+			return false
+		}
+		db.Delete(key)
+		s.stats.evicted++
+		s.signalModifiedKey(nil, key)
+		s.notifyKeyspaceEvent(notifyEvicted, "evicted", key, db.id)
+	}
+	return true
+}
+
+func (s *Server) evictionCandidate() (*Db, string, bool) {
+	policy := s.config.MaxMemoryPolicy
+	switch policy {
+	case PolicyNoEviction:
+		return nil, "", false
+	case PolicyAllKeysRandom, PolicyVolatileRandom:
+		return s.randomEvictionCandidate(policy)
+	}
+
+	for {
+		keys := 0
+		for _, db := range s.dbs {
+			if isVolatilePolicy(policy) {
+				keys += db.expires.Len()
+			} else {
+				keys += db.data.Len()
+			}
+			s.evictionPool.populate(db, policy, s.config.MaxMemorySamples)
+		}
+		if keys == 0 {
+			return nil, "", false
+		}
+
+		// Candidates may have been deleted or updated since they were
+		// added to the pool, skip those.
+		for {
+			c, ok := s.evictionPool.pop()
+			if !ok {
+				break
+			}
+			if _, ok := c.db.data.Get(c.key); !ok {
+				continue
+			}
+			if _, ok := c.db.expires.Get(c.key); !ok && isVolatilePolicy(policy) {
+				continue
+			}
+			return c.db, c.key, true
+		}
+	}
+}
+
+// randomEvictionCandidate picks a random key, visiting the databases in
+// turn across calls so that every one of them gets evicted from.
+func (s *Server) randomEvictionCandidate(policy string) (*Db, string, bool) {
+	for i := 0; i < len(s.dbs); i++ {
+		db := s.dbs[s.nextEvictionDb]
+		s.nextEvictionDb = (s.nextEvictionDb + 1) % len(s.dbs)
+
+		var key string
+		var ok bool
+		if policy == PolicyVolatileRandom {
+			key, ok = db.expires.RandomKey()
+		} else {
+			key, ok = db.data.RandomKey()
+		}
+		if ok {
+			return db, key, true
+		}
+	}
+	return nil, "", false
+}
@@ -0,0 +1,174 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newEvictionServer(policy string) *Server {
+	cfg := NewConfig()
+	cfg.MaxMemoryPolicy = policy
+	return NewServer(cfg)
+}
+
+func TestEvictionPoolOrder(t *testing.T) {
+	db := NewDb()
+	p := newEvictionPool()
+	p.insert(evictionCandidate{idle: 5, key: "b", db: db})
+	p.insert(evictionCandidate{idle: 9, key: "c", db: db})
+	p.insert(evictionCandidate{idle: 1, key: "a", db: db})
+	p.insert(evictionCandidate{idle: 9, key: "c", db: db})
+
+	for _, key := range []string{"c", "b", "a"} {
+		c, ok := p.pop()
+		assert.True(t, ok)
+		assert.Equal(t, key, c.key)
+	}
+	_, ok := p.pop()
+	assert.False(t, ok)
+}
+
+func TestEvictionPoolFull(t *testing.T) {
+	db := NewDb()
+	p := newEvictionPool()
+	for i := 1; i <= evictionPoolSize; i++ {
+		p.insert(evictionCandidate{idle: uint64(i * 10), key: strconv.Itoa(i), db: db})
+	}
+
+	// worse than everything in the pool
+	p.insert(evictionCandidate{idle: 5, key: "low", db: db})
+	assert.Equal(t, evictionPoolSize, len(p.entries))
+	assert.Equal(t, "1", p.entries[0].key)
+
+	// the worst candidate makes room for a better one
+	p.insert(evictionCandidate{idle: 15, key: "mid", db: db})
+	assert.Equal(t, evictionPoolSize, len(p.entries))
+	assert.Equal(t, "mid", p.entries[0].key)
+}
+
+func TestServerEvictAllKeysLru(t *testing.T) {
+	srv := newEvictionServer(PolicyAllKeysLru)
+	// sample every key so that the best candidate is always found
+	srv.config.MaxMemorySamples = 20
+	db := srv.dbs[0]
+	for i := 0; i < 10; i++ {
+		db.Set(strconv.Itoa(i), "value")
+	}
+	db.Set("old", "value")
+	o, _ := db.Object("old")
+	o.access -= 60000
+
+	srv.config.MaxMemory = db.Memory() - 1
+	assert.True(t, srv.freeMemoryIfNeeded())
+	assert.False(t, db.Exists("old"))
+	assert.Equal(t, 10, db.Size())
+}
+
+func TestServerEvictAllKeysLfu(t *testing.T) {
+	srv := newEvictionServer(PolicyAllKeysLfu)
+	// sample every key so that the best candidate is always found
+	srv.config.MaxMemorySamples = 20
+	db := srv.dbs[0]
+	for i := 0; i < 10; i++ {
+		db.Set(strconv.Itoa(i), "value")
+	}
+	db.Set("cold", "value")
+	o, _ := db.Object("cold")
+	o.freq = 0
+
+	srv.config.MaxMemory = db.Memory() - 1
+	assert.True(t, srv.freeMemoryIfNeeded())
+	assert.False(t, db.Exists("cold"))
+}
+
+func TestServerEvictVolatileTtl(t *testing.T) {
+	srv := newEvictionServer(PolicyVolatileTtl)
+	db := srv.dbs[0]
+	db.Set("persistent", "value")
+	db.Set("later", "value")
+	db.SetExpire("later", time.Now().Add(time.Hour))
+	db.Set("sooner", "value")
+	db.SetExpire("sooner", time.Now().Add(time.Minute))
+
+	srv.config.MaxMemory = db.Memory() - 1
+	assert.True(t, srv.freeMemoryIfNeeded())
+	assert.False(t, db.Exists("sooner"))
+	assert.True(t, db.Exists("later"))
+	assert.True(t, db.Exists("persistent"))
+}
+
+func TestServerEvictVolatileOnlyVolatileKeys(t *testing.T) {
+	for _, policy := range []string{PolicyVolatileLru, PolicyVolatileLfu,
+		PolicyVolatileRandom, PolicyVolatileTtl} {
+		srv := newEvictionServer(policy)
+		db := srv.dbs[0]
+		db.Set("persistent", "value")
+		db.Set("volatile", "value")
+		db.SetExpire("volatile", time.Now().Add(time.Hour))
+
+		srv.config.MaxMemory = 1
+		assert.False(t, srv.freeMemoryIfNeeded(), policy)
+		assert.False(t, db.Exists("volatile"), policy)
+		assert.True(t, db.Exists("persistent"), policy)
+	}
+}
+
+func TestServerEvictAllKeysRandom(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Databases = 2
+	cfg.MaxMemoryPolicy = PolicyAllKeysRandom
+	srv := NewServer(cfg)
+	for i := 0; i < 10; i++ {
+		srv.dbs[0].Set(strconv.Itoa(i), "value")
+		srv.dbs[1].Set(strconv.Itoa(i), "value")
+	}
+
+	srv.config.MaxMemory = srv.UsedMemory() / 2
+	assert.True(t, srv.freeMemoryIfNeeded())
+	assert.LessOrEqual(t, srv.UsedMemory(), srv.config.MaxMemory)
+	// the databases are evicted from in turn
+	assert.Less(t, srv.dbs[0].Size(), 10)
+	assert.Less(t, srv.dbs[1].Size(), 10)
+}
+
+func TestServerNoEviction(t *testing.T) {
+	srv := newEvictionServer(PolicyNoEviction)
+	srv.dbs[0].Set("hello", "world")
+
+	srv.config.MaxMemory = 1
+	assert.False(t, srv.freeMemoryIfNeeded())
+	assert.True(t, srv.dbs[0].Exists("hello"))
+}
+
+func TestServerExecuteOom(t *testing.T) {
+	srv := newEvictionServer(PolicyNoEviction)
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+	srv.config.MaxMemory = 1
+
+	sc := &SetCommand{key: "hello", value: "again", px: -1}
+	sc.setSpec(commandTable["set"])
+	assert.Equal(t, "-OOM command not allowed when used memory > 'maxmemory'.",
+		srv.Execute(sc, cl))
+
+	gc := &GetCommand{key: "hello"}
+	gc.setSpec(commandTable["get"])
+	assert.Equal(t, "$5\r\nworld", srv.Execute(gc, cl))
+}
+
+func TestDbMemory(t *testing.T) {
+	db := NewDb()
+	db.Set("hello", "world")
+	o, _ := db.Object("hello")
+	assert.Equal(t, o.size("hello"), db.Memory())
+
+	db.SetExpire("hello", time.Now().Add(time.Minute))
+	assert.Equal(t, o.size("hello")+expireOverhead, db.Memory())
+
+	db.Delete("hello")
+	assert.Equal(t, int64(0), db.Memory())
+}
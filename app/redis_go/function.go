@@ -0,0 +1,457 @@
+package redis_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"redis-go/app/ev"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// functionLoadTimeout bounds the time the code of a library runs for when
+// it is loaded, which is only meant to register its functions
+const functionLoadTimeout = 500 * time.Millisecond
+
+// The flags of the functions, given to redis.register_function.
+const (
+	// fnNoWrites functions may not call write commands, and only they can
+	// be called by FCALL_RO
+	fnNoWrites = 1 << iota
+	// fnAllowOom functions run even when memory is over maxmemory
+	fnAllowOom
+	// fnAllowStale and fnAllowCrossSlotKeys are accepted as in redis, but
+	// there are no replicas to be stale, and the keys of the commands of a
+	// function are checked one command at a time
+	fnAllowStale
+	fnNoCluster
+	fnAllowCrossSlotKeys
+)
+
+var functionFlagNames = []struct {
+	flag int
+	name string
+}{
+	{fnNoWrites, "no-writes"},
+	{fnAllowOom, "allow-oom"},
+	{fnAllowStale, "allow-stale"},
+	{fnNoCluster, "no-cluster"},
+	{fnAllowCrossSlotKeys, "allow-cross-slot-keys"},
+}
+
+// scriptFunction is a function registered by a library.
+type scriptFunction struct {
+	name        string
+	lib         *functionLibrary
+	fn          *lua.LFunction
+	description string
+	flags       int
+}
+
+// functionLibrary is a library loaded by FUNCTION LOAD: its code, and the
+// functions it registered.
+type functionLibrary struct {
+	name      string
+	code      string
+	functions map[string]*scriptFunction
+}
+
+// functionEngine holds the libraries, and the Lua state their code runs in,
+// which is only created once a library is loaded. There is no RDB, AOF or
+// replication, so the libraries only live in memory: they are lost on
+// restart and never sent to replicas, FUNCTION DUMP and RESTORE being the
+// only way to carry them elsewhere.
+type functionEngine struct {
+	L         *lua.LState
+	libraries map[string]*functionLibrary
+	// functions are the functions of all the libraries by name
+	functions map[string]*scriptFunction
+	// loading is the library whose code is being loaded, which
+	// redis.register_function adds to
+	loading *functionLibrary
+}
+
+func newFunctionEngine() *functionEngine {
+	return &functionEngine{
+		libraries: map[string]*functionLibrary{},
+		functions: map[string]*scriptFunction{},
+	}
+}
+
+// functionEngine returns the engine, and creates its Lua state if needed.
+// It is the state of the scripts, with redis.register_function.
+func (s *Server) functionEngine() *functionEngine {
+	fe := s.functions
+	if fe.L == nil {
+		fe.L = s.newLuaState()
+		redis := fe.L.G.Global.RawGetString("redis").(*lua.LTable)
+		redis.RawSetString("register_function", fe.L.NewFunction(fe.luaRegisterFunction))
+	}
+	return fe
+}
+
+// sortedLibraries returns the libraries ordered by name.
+func (fe *functionEngine) sortedLibraries() []*functionLibrary {
+	libs := make([]*functionLibrary, 0, len(fe.libraries))
+	for _, lib := range fe.libraries {
+		libs = append(libs, lib)
+	}
+	sort.Slice(libs, func(i, j int) bool {
+		return libs[i].name < libs[j].name
+	})
+	return libs
+}
+
+// flush removes the libraries, and closes the Lua state so that the next
+// ones are loaded in a new one.
+func (fe *functionEngine) flush() {
+	if fe.L != nil {
+		fe.L.Close()
+		fe.L = nil
+	}
+	fe.libraries = map[string]*functionLibrary{}
+	fe.functions = map[string]*scriptFunction{}
+}
+
+func (fe *functionEngine) deleteLibrary(name string) bool {
+	lib, ok := fe.libraries[name]
+	if !ok {
+		return false
+	}
+	for fname := range lib.functions {
+		delete(fe.functions, fname)
+	}
+	delete(fe.libraries, name)
+	return true
+}
+
+// addLibraries adds libs to the libraries following policy: APPEND refuses
+// the libraries there already, REPLACE replaces them, and FLUSH removes
+// all the others first. It is all or nothing.
+func (fe *functionEngine) addLibraries(libs []*functionLibrary, policy string) error {
+	libraries := map[string]*functionLibrary{}
+	if policy != "FLUSH" {
+		for name, lib := range fe.libraries {
+			libraries[name] = lib
+		}
+	}
+	for _, lib := range libs {
+		if _, ok := libraries[lib.name]; ok && policy != "REPLACE" {
+			return fmt.Errorf("Library '%s' already exists", lib.name)
+		}
+		libraries[lib.name] = lib
+	}
+
+	names := make([]string, 0, len(libraries))
+	for name := range libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	functions := map[string]*scriptFunction{}
+	for _, name := range names {
+		for fname, f := range libraries[name].functions {
+			if _, ok := functions[fname]; ok {
+				return fmt.Errorf("Function %s already exists", fname)
+			}
+			functions[fname] = f
+		}
+	}
+	fe.libraries, fe.functions = libraries, functions
+	return nil
+}
+
+// validFunctionName reports whether name is made of letters, digits and
+// underscores only, as the names of the libraries and functions are.
+func validFunctionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLibraryMetadata reads the name of a library from the first line of
+// its code, such as #!lua name=mylib, and returns it with the code that
+// follows.
+func parseLibraryMetadata(code string) (string, string, error) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", errors.New("Missing library metadata")
+	}
+	line, _, _ := strings.Cut(code, "\n")
+	parts := strings.Fields(line[2:])
+	if len(parts) == 0 {
+		return "", "", errors.New("Missing library metadata")
+	}
+	if !strings.EqualFold(parts[0], "lua") {
+		return "", "", fmt.Errorf("Engine '%s' not found", parts[0])
+	}
+
+	name := ""
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || key != "name" {
+			return "", "", fmt.Errorf("Invalid metadata value given: %s", part)
+		}
+		name = value
+	}
+	if name == "" {
+		return "", "", errors.New("Library name was not given")
+	}
+	if !validFunctionName(name) {
+		return "", "", errors.New("Library names can only contain letters, numbers, or underscores(_) " +
+			"and must be at least one character long")
+	}
+	// the line of the metadata is left empty, so that the lines of the
+	// errors are those of the code
+	return name, code[len(line):], nil
+}
+
+// createLibrary runs the code of a library, which registers its functions.
+// The library is not added to the others.
+func (s *Server) createLibrary(code string) (*functionLibrary, error) {
+	name, body, err := parseLibraryMetadata(code)
+	if err != nil {
+		return nil, err
+	}
+	fe := s.functionEngine()
+	L := fe.L
+	fn, err := L.Load(strings.NewReader(body), "user_function")
+	if err != nil {
+		return nil, fmt.Errorf("Error compiling function: %s", replyLine(strings.TrimSpace(err.Error())))
+	}
+
+	lib := &functionLibrary{name: name, code: code, functions: map[string]*scriptFunction{}}
+	ctx, cancel := context.WithTimeout(context.Background(), functionLoadTimeout)
+	defer cancel()
+	fe.loading = lib
+	L.SetContext(ctx)
+	L.Push(fn)
+	err = L.PCall(0, 0, nil)
+	L.RemoveContext()
+	fe.loading = nil
+	L.SetTop(0)
+
+	if ctx.Err() != nil {
+		return nil, errors.New("Error registering functions: FUNCTION LOAD timeout")
+	}
+	if err != nil {
+		msg, _ := luaErrorMessage(err)
+		return nil, fmt.Errorf("Error registering functions: %s", replyLine(msg))
+	}
+	if len(lib.functions) == 0 {
+		return nil, errors.New("No functions registered")
+	}
+	return lib, nil
+}
+
+// loadLibrary loads a library as FUNCTION LOAD, and returns its name.
+func (s *Server) loadLibrary(code string, replace bool) (string, error) {
+	lib, err := s.createLibrary(code)
+	if err != nil {
+		return "", err
+	}
+	policy := "APPEND"
+	if replace {
+		policy = "REPLACE"
+	}
+	if err := s.functions.addLibraries([]*functionLibrary{lib}, policy); err != nil {
+		return "", err
+	}
+	return lib.name, nil
+}
+
+// luaRegisterFunction is redis.register_function, which takes the name and
+// the callback of a function, or a table with the function_name, callback,
+// flags and description fields.
+func (fe *functionEngine) luaRegisterFunction(L *lua.LState) int {
+	lib := fe.loading
+	if lib == nil {
+		L.RaiseError("redis.register_function can only be called on FUNCTION LOAD command")
+	}
+
+	f := &scriptFunction{lib: lib}
+	switch L.GetTop() {
+	case 1:
+		t, ok := L.Get(1).(*lua.LTable)
+		if !ok {
+			L.RaiseError("calling redis.register_function with a single argument is only applicable to " +
+				"Lua table (representing named arguments).")
+		}
+		fe.registerFunctionArgs(L, t, f)
+	case 2:
+		name, ok := L.Get(1).(lua.LString)
+		if !ok {
+			L.RaiseError("first argument to redis.register_function must be a string")
+		}
+		fn, ok := L.Get(2).(*lua.LFunction)
+		if !ok {
+			L.RaiseError("second argument to redis.register_function must be a function")
+		}
+		f.name, f.fn = string(name), fn
+	default:
+		L.RaiseError("wrong number of arguments to redis.register_function")
+	}
+
+	if f.name == "" {
+		L.RaiseError("redis.register_function must get a function name argument")
+	}
+	if f.fn == nil {
+		L.RaiseError("redis.register_function must get a callback argument")
+	}
+	if !validFunctionName(f.name) {
+		L.RaiseError("Function names can only contain letters, numbers, or underscores(_) " +
+			"and must be at least one character long")
+	}
+	if _, ok := lib.functions[f.name]; ok {
+		L.RaiseError("Function already exists in the library")
+	}
+	lib.functions[f.name] = f
+	return 0
+}
+
+func (fe *functionEngine) registerFunctionArgs(L *lua.LState, t *lua.LTable, f *scriptFunction) {
+	t.ForEach(func(k lua.LValue, v lua.LValue) {
+		key, _ := k.(lua.LString)
+		switch key {
+		case "function_name":
+			name, ok := v.(lua.LString)
+			if !ok {
+				L.RaiseError("function_name argument given to redis.register_function must be a string")
+			}
+			f.name = string(name)
+		case "callback":
+			fn, ok := v.(*lua.LFunction)
+			if !ok {
+				L.RaiseError("callback argument given to redis.register_function must be a function")
+			}
+			f.fn = fn
+		case "description":
+			desc, ok := v.(lua.LString)
+			if !ok {
+				L.RaiseError("description argument given to redis.register_function must be a string")
+			}
+			f.description = string(desc)
+		case "flags":
+			flags, ok := v.(*lua.LTable)
+			if !ok {
+				L.RaiseError("flags argument to redis.register_function must be a table representing function flags")
+			}
+			f.flags = luaFunctionFlags(L, flags)
+		default:
+			L.RaiseError("unknown argument given to redis.register_function")
+		}
+	})
+}
+
+func luaFunctionFlags(L *lua.LState, t *lua.LTable) int {
+	flags := 0
+	for i := 1; i <= t.Len(); i++ {
+		name, ok := t.RawGetInt(i).(lua.LString)
+		if !ok {
+			L.RaiseError("unknown flag given")
+		}
+		known := false
+		for _, f := range functionFlagNames {
+			if f.name == string(name) {
+				flags |= f.flag
+				known = true
+			}
+		}
+		if !known {
+			L.RaiseError("unknown flag given")
+		}
+	}
+	return flags
+}
+
+// functionFlags lists the names of the flags of a function.
+func functionFlags(f *scriptFunction) []string {
+	names := []string{}
+	for _, fl := range functionFlagNames {
+		if f.flags&fl.flag != 0 {
+			names = append(names, fl.name)
+		}
+	}
+	return names
+}
+
+// functionNoWrites reports whether the function FCALL is called with is
+// flagged no-writes.
+func (s *Server) functionNoWrites(argv []string) bool {
+	if len(argv) < 2 {
+		return false
+	}
+	f, ok := s.functions.functions[argv[1]]
+	return ok && f.flags&fnNoWrites != 0
+}
+
+// callFunction runs a function as FCALL, or FCALL_RO with readOnly set,
+// with the keys and the arguments as its two arguments. The flags of the
+// function decide whether it may run.
+func (s *Server) callFunction(cl *ev.Client, argv []string, name string, keys []string, args []string,
+	readOnly bool) string {
+	f, ok := s.functions.functions[name]
+	if !ok {
+		return "-ERR Function not found"
+	}
+	noWrites := f.flags&fnNoWrites != 0
+	if readOnly && !noWrites {
+		return "-ERR Can not execute a script with write flag using *_ro command."
+	}
+	if s.cluster != nil && f.flags&fnNoCluster != 0 {
+		return "-ERR Can not run script on cluster, 'no-cluster' flag is set."
+	}
+	if !noWrites && f.flags&fnAllowOom == 0 && !s.freeMemoryIfNeeded() {
+		return "-OOM command not allowed when used memory > 'maxmemory'."
+	}
+
+	L := s.functions.L
+	r := newScriptRun(s, cl, argv, name, true, noWrites)
+	return s.runScript(L, f.fn, []lua.LValue{luaStrings(L, keys), luaStrings(L, args)}, r)
+}
+
+// dumpFunctions serializes the libraries as FUNCTION DUMP does, in the
+// format of redis: the code of each library after the function opcode,
+// then the footer of the DUMP payloads.
+func (s *Server) dumpFunctions() string {
+	var buf []byte
+	for _, lib := range s.functions.sortedLibraries() {
+		buf = append(buf, rdbOpcodeFunction2)
+		buf = appendRdbString(buf, lib.code)
+	}
+	return string(appendDumpFooter(buf))
+}
+
+// restoreFunctions loads the libraries of a payload of FUNCTION DUMP,
+// following policy as addLibraries does.
+func (s *Server) restoreFunctions(payload string, policy string) error {
+	body, err := verifyDumpFooter(payload)
+	if err != nil {
+		return errDumpPayload
+	}
+	var libs []*functionLibrary
+	for len(body) > 0 {
+		if body[0] != rdbOpcodeFunction2 {
+			return errors.New("given type is not a function")
+		}
+		code, rest, ok := readRdbRawString(body[1:])
+		if !ok {
+			return errors.New("Bad data format")
+		}
+		lib, err := s.createLibrary(code)
+		if err != nil {
+			return err
+		}
+		libs = append(libs, lib)
+		body = rest
+	}
+	return s.functions.addLibraries(libs, policy)
+}
@@ -0,0 +1,222 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FcallCommand is FCALL, and FCALL_RO with readOnly set.
+type FcallCommand struct {
+	BaseCommand
+	reader   RespReader
+	readOnly bool
+	function string
+	keys     []string
+	args     []string
+}
+
+func NewFcallCommand(rr RespReader, readOnly bool) *FcallCommand {
+	return &FcallCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		readOnly:    readOnly,
+	}
+}
+
+func (c *FcallCommand) ReadParams(len int) (err error) {
+	c.function, c.keys, c.args, err = readScriptParams(c.reader, len)
+	return
+}
+
+func (c *FcallCommand) Execute(srv *Server, cl *ev.Client) string {
+	return srv.callFunction(cl, c.Argv(), c.function, c.keys, c.args, c.readOnly)
+}
+
+type FunctionCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+	// replace is set by FUNCTION LOAD REPLACE, and withCode and pattern by
+	// the options of FUNCTION LIST
+	replace  bool
+	withCode bool
+	pattern  string
+	// policy is the policy of FUNCTION RESTORE
+	policy string
+}
+
+func NewFunctionCommand(rr RespReader) *FunctionCommand {
+	return &FunctionCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		policy:      "APPEND",
+	}
+}
+
+func (c *FunctionCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args, err = readBulkStrings(c.reader, len-1)
+	if err != nil {
+		return
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "LOAD":
+		if n == 2 && strings.EqualFold(c.args[0], "replace") {
+			c.replace = true
+			c.args = c.args[1:]
+		} else if n == 2 {
+			return fmt.Errorf("Unknown option given: %s", c.args[0])
+		} else if n != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "LIST":
+		for i := 0; i < n; i++ {
+			switch strings.ToUpper(c.args[i]) {
+			case "WITHCODE":
+				c.withCode = true
+			case "LIBRARYNAME":
+				if i+1 >= n {
+					return fmt.Errorf("library name argument was not given")
+				}
+				i++
+				c.pattern = c.args[i]
+			default:
+				return fmt.Errorf("Unknown argument %s", c.args[i])
+			}
+		}
+	case "DELETE", "RESTORE":
+		if n < 1 || c.subcommand == "DELETE" && n != 1 || n > 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		if n == 2 {
+			c.policy = strings.ToUpper(c.args[1])
+			if c.policy != "APPEND" && c.policy != "REPLACE" && c.policy != "FLUSH" {
+				return fmt.Errorf("Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+			}
+		}
+	case "FLUSH":
+		if n > 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		if n == 1 && !strings.EqualFold(c.args[0], "async") && !strings.EqualFold(c.args[0], "sync") {
+			return fmt.Errorf("FUNCTION FLUSH only supports SYNC|ASYNC option")
+		}
+	case "DUMP", "STATS", "KILL":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+// Execute flushes the libraries at once whether ASYNC is given or not, as
+// there is no background thread to free them.
+func (c *FunctionCommand) Execute(srv *Server, cl *ev.Client) string {
+	fe := srv.functions
+	switch c.subcommand {
+	case "LOAD":
+		name, err := srv.loadLibrary(c.args[0], c.replace)
+		if err != nil {
+			return "-ERR " + err.Error()
+		}
+		return encodeBulkString(name)
+	case "LIST":
+		var elems []string
+		for _, lib := range fe.sortedLibraries() {
+			if c.pattern == "" || stringMatch(c.pattern, lib.name) {
+				elems = append(elems, libraryReply(lib, c.withCode, cl))
+			}
+		}
+		return encodeArray(elems)
+	case "DELETE":
+		if !fe.deleteLibrary(c.args[0]) {
+			return "-ERR Library not found"
+		}
+		return "+OK"
+	case "FLUSH":
+		fe.flush()
+		return "+OK"
+	case "DUMP":
+		return encodeBulkString(srv.dumpFunctions())
+	case "RESTORE":
+		if err := srv.restoreFunctions(c.args[0], c.policy); err != nil {
+			return "-ERR " + err.Error()
+		}
+		return "+OK"
+	case "STATS":
+		return srv.functionStats(cl)
+	}
+	return srv.killScript(true)
+}
+
+// libraryReply describes a library as FUNCTION LIST does.
+func libraryReply(lib *functionLibrary, withCode bool, cl *ev.Client) string {
+	names := make([]string, 0, len(lib.functions))
+	for name := range lib.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	functions := make([]string, len(names))
+	for i, name := range names {
+		f := lib.functions[name]
+		desc := "$-1"
+		if f.description != "" {
+			desc = encodeBulkString(f.description)
+		}
+		functions[i] = encodeMap(cl.Resp, []string{
+			encodeBulkString("name"), encodeBulkString(f.name),
+			encodeBulkString("description"), desc,
+			encodeBulkString("flags"), encodeBulkStrings(functionFlags(f)),
+		})
+	}
+
+	elems := []string{
+		encodeBulkString("library_name"), encodeBulkString(lib.name),
+		encodeBulkString("engine"), encodeBulkString("LUA"),
+		encodeBulkString("functions"), encodeArray(functions),
+	}
+	if withCode {
+		elems = append(elems, encodeBulkString("library_code"), encodeBulkString(lib.code))
+	}
+	return encodeMap(cl.Resp, elems)
+}
+
+// functionStats describes the function running, if any, and the libraries
+// loaded, as FUNCTION STATS does.
+func (s *Server) functionStats(cl *ev.Client) string {
+	running := "$-1"
+	if r := s.scripts.running; r != nil && r.function {
+		running = encodeMap(cl.Resp, []string{
+			encodeBulkString("name"), encodeBulkString(r.name),
+			encodeBulkString("command"), encodeBulkStrings(r.argv),
+			encodeBulkString("duration_ms"), ":" + strconv.FormatInt(time.Since(r.start).Milliseconds(), 10),
+		})
+	}
+	fe := s.functions
+	lua := encodeMap(cl.Resp, []string{
+		encodeBulkString("libraries_count"), encodeInt(len(fe.libraries)),
+		encodeBulkString("functions_count"), encodeInt(len(fe.functions)),
+	})
+	return encodeMap(cl.Resp, []string{
+		encodeBulkString("running_script"), running,
+		encodeBulkString("engines"), encodeMap(cl.Resp, []string{encodeBulkString("LUA"), lua}),
+	})
+}
@@ -0,0 +1,156 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testLibrary = "#!lua name=mylib\n" +
+	"redis.register_function('hello', function(keys, args) return 'hello ' .. args[1] end)\n" +
+	"redis.register_function{function_name='count', callback=function(keys) return #keys end," +
+	" description='counts the keys', flags={'no-writes', 'allow-oom'}}"
+
+func TestFunctionCommandLoad(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "$5\r\nmylib\r\n", handle(srv, cl, "FUNCTION", "LOAD", testLibrary))
+	assert.Equal(t, "$9\r\nhello you\r\n", handle(srv, cl, "FCALL", "hello", "0", "you"))
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "FCALL_RO", "count", "2", "a", "b"))
+	assert.Equal(t, "-ERR Library 'mylib' already exists\r\n", handle(srv, cl, "FUNCTION", "LOAD", testLibrary))
+
+	replaced := "#!lua name=mylib\nredis.register_function('hello', function() return 'hi' end)"
+	assert.Equal(t, "$5\r\nmylib\r\n", handle(srv, cl, "FUNCTION", "LOAD", "replace", replaced))
+	assert.Equal(t, "$2\r\nhi\r\n", handle(srv, cl, "FCALL", "hello", "0"))
+	assert.Equal(t, "-ERR Function not found\r\n", handle(srv, cl, "FCALL", "count", "0"))
+
+	other := "#!lua name=other\nredis.register_function('hello', function() return 'no' end)"
+	assert.Equal(t, "-ERR Function hello already exists\r\n", handle(srv, cl, "FUNCTION", "LOAD", other))
+}
+
+func TestFunctionCommandList(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "FUNCTION", "LOAD", testLibrary)
+	handle(srv, cl, "FUNCTION", "LOAD", "#!lua name=other\nredis.register_function('f', function() end)")
+
+	mylib := "*6\r\n" +
+		"$12\r\nlibrary_name\r\n$5\r\nmylib\r\n" +
+		"$6\r\nengine\r\n$3\r\nLUA\r\n" +
+		"$9\r\nfunctions\r\n*2\r\n" +
+		"*6\r\n$4\r\nname\r\n$5\r\ncount\r\n$11\r\ndescription\r\n$15\r\ncounts the keys\r\n" +
+		"$5\r\nflags\r\n*2\r\n$9\r\nno-writes\r\n$9\r\nallow-oom\r\n" +
+		"*6\r\n$4\r\nname\r\n$5\r\nhello\r\n$11\r\ndescription\r\n$-1\r\n$5\r\nflags\r\n*0\r\n"
+	assert.Equal(t, "*1\r\n"+mylib, handle(srv, cl, "FUNCTION", "LIST", "LIBRARYNAME", "my*"))
+
+	res := handle(srv, cl, "FUNCTION", "LIST")
+	assert.True(t, strings.HasPrefix(res, "*2\r\n"+mylib+"*6\r\n$12\r\nlibrary_name\r\n$5\r\nother\r\n"), res)
+	assert.Equal(t, "*0\r\n", handle(srv, cl, "FUNCTION", "LIST", "libraryname", "nosuch"))
+
+	res = handle(srv, cl, "FUNCTION", "LIST", "WITHCODE", "LIBRARYNAME", "mylib")
+	assert.True(t, strings.HasPrefix(res, "*1\r\n*8\r\n"), res)
+	assert.True(t, strings.HasSuffix(res, "$12\r\nlibrary_code\r\n$"+strconv.Itoa(len(testLibrary))+"\r\n"+testLibrary+"\r\n"), res)
+
+	// RESP3 clients get maps
+	handle(srv, cl, "HELLO", "3")
+	res = handle(srv, cl, "FUNCTION", "LIST", "LIBRARYNAME", "other")
+	assert.True(t, strings.HasPrefix(res, "*1\r\n%3\r\n$12\r\nlibrary_name\r\n"), res)
+}
+
+func TestFunctionCommandDeleteFlush(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "FUNCTION", "LOAD", testLibrary)
+
+	assert.Equal(t, "-ERR Library not found\r\n", handle(srv, cl, "FUNCTION", "DELETE", "nosuch"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "FUNCTION", "DELETE", "mylib"))
+	assert.Equal(t, "-ERR Function not found\r\n", handle(srv, cl, "FCALL", "hello", "0", "you"))
+	assert.Equal(t, "$5\r\nmylib\r\n", handle(srv, cl, "FUNCTION", "LOAD", testLibrary))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "FUNCTION", "FLUSH", "async"))
+	assert.Equal(t, "*0\r\n", handle(srv, cl, "FUNCTION", "LIST"))
+	assert.Nil(t, srv.functions.L)
+}
+
+func TestFunctionCommandDumpRestore(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "FUNCTION", "LOAD", testLibrary)
+
+	payload := srv.dumpFunctions()
+	assert.Equal(t, encodeBulkString(payload)+"\r\n", handle(srv, cl, "FUNCTION", "DUMP"))
+	assert.Equal(t, "-ERR Library 'mylib' already exists\r\n", handle(srv, cl, "FUNCTION", "RESTORE", payload))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "FUNCTION", "RESTORE", payload, "replace"))
+
+	srv = NewServer(NewConfig())
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "FUNCTION", "RESTORE", payload))
+	assert.Equal(t, "$9\r\nhello you\r\n", handle(srv, cl, "FCALL", "hello", "0", "you"))
+	assert.Equal(t, "-ERR DUMP payload version or checksum are wrong\r\n",
+		handle(srv, cl, "FUNCTION", "RESTORE", "bad"))
+}
+
+func TestFunctionCommandStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.config.BusyReplyThreshold = 10
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	cl := ev.NewClient(1)
+	other := ev.NewClient(2)
+	handle(srv, cl, "FUNCTION", "LOAD", testLibrary)
+	handle(srv, cl, "FUNCTION", "LOAD", "#!lua name=loop\n"+
+		"redis.register_function{function_name='spin', callback=function() while true do end end, flags={'no-writes'}}")
+
+	engines := "$7\r\nengines\r\n*2\r\n$3\r\nLUA\r\n*4\r\n$15\r\nlibraries_count\r\n:2\r\n$15\r\nfunctions_count\r\n:3\r\n"
+	assert.Equal(t, "*4\r\n$14\r\nrunning_script\r\n$-1\r\n"+engines, handle(srv, cl, "FUNCTION", "STATS"))
+
+	var replies []string
+	conns.whileBlocked = func() {
+		replies = append(replies,
+			handle(srv, other, "FUNCTION", "STATS"),
+			handle(srv, other, "FUNCTION", "LIST"),
+			handle(srv, other, "SCRIPT", "KILL"),
+			handle(srv, other, "FUNCTION", "KILL"))
+		conns.whileBlocked = nil
+	}
+	assert.Equal(t, "-ERR Script killed by user with SCRIPT KILL...\r\n", handle(srv, cl, "FCALL_RO", "spin", "0"))
+	assert.True(t, strings.HasPrefix(replies[0], "*4\r\n$14\r\nrunning_script\r\n*6\r\n$4\r\nname\r\n$4\r\nspin\r\n"+
+		"$7\r\ncommand\r\n*3\r\n$8\r\nFCALL_RO\r\n$4\r\nspin\r\n$1\r\n0\r\n$11\r\nduration_ms\r\n:"), replies[0])
+	assert.True(t, strings.HasSuffix(replies[0], engines), replies[0])
+	busy := "-BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE.\r\n"
+	assert.Equal(t, []string{busy, busy, "+OK\r\n"}, replies[1:])
+
+	assert.Equal(t, "-NOTBUSY No scripts in execution right now.\r\n", handle(srv, cl, "FUNCTION", "KILL"))
+}
+
+func TestFunctionCommandParamErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	tests := []struct {
+		args []string
+		res  string
+	}{
+		{[]string{"FUNCTION"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"FUNCTION", "LOAD"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"FUNCTION", "LOAD", "now", "code"}, "-ERR Unknown option given: now\r\n"},
+		{[]string{"FUNCTION", "LOAD", "return 1"}, "-ERR Missing library metadata\r\n"},
+		{[]string{"FUNCTION", "LIST", "LIBRARYNAME"}, "-ERR library name argument was not given\r\n"},
+		{[]string{"FUNCTION", "LIST", "all"}, "-ERR Unknown argument all\r\n"},
+		{[]string{"FUNCTION", "DELETE"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"FUNCTION", "DELETE", "a", "b"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"FUNCTION", "RESTORE", "x", "MERGE"},
+			"-ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.\r\n"},
+		{[]string{"FUNCTION", "FLUSH", "now"}, "-ERR FUNCTION FLUSH only supports SYNC|ASYNC option\r\n"},
+		{[]string{"FUNCTION", "DUMP", "x"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"FUNCTION", "nosuch"}, "-ERR unknown subcommand 'nosuch'\r\n"},
+		{[]string{"FCALL", "f"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"FCALL", "f", "2", "a"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.res, handle(srv, cl, test.args...), strings.Join(test.args, " "))
+	}
+}
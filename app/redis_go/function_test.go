@@ -0,0 +1,169 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLibraryMetadata(t *testing.T) {
+	name, body, err := parseLibraryMetadata("#!lua name=mylib\nreturn 1")
+	assert.Nil(t, err)
+	assert.Equal(t, "mylib", name)
+	assert.Equal(t, "\nreturn 1", body)
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{"return 1", "Missing library metadata"},
+		{"#!\nreturn 1", "Missing library metadata"},
+		{"#!js name=lib\n", "Engine 'js' not found"},
+		{"#!lua\n", "Library name was not given"},
+		{"#!lua name=lib version=2\n", "Invalid metadata value given: version=2"},
+		{"#!lua name=my-lib\n", "Library names can only contain letters, numbers, or underscores(_) " +
+			"and must be at least one character long"},
+	}
+	for _, test := range tests {
+		_, _, err := parseLibraryMetadata(test.code)
+		assert.EqualError(t, err, test.err, test.code)
+	}
+}
+
+func TestCreateLibraryErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{"#!lua name=lib\nreturn (", "Error compiling function: user_function at EOF:   syntax error"},
+		{"#!lua name=lib\nlocal x = 1", "No functions registered"},
+		{"#!lua name=lib\nerror('boom')", "Error registering functions: user_function:2: boom"},
+		{"#!lua name=lib\nredis.call('set', 'k', 'v')",
+			"Error registering functions: ERR redis.call can only be called inside a script invocation"},
+		{"#!lua name=lib\nwhile true do end", "Error registering functions: FUNCTION LOAD timeout"},
+		{"#!lua name=lib\nredis.register_function('f', function() end)\n" +
+			"redis.register_function('f', function() end)",
+			"Error registering functions: user_function:3: Function already exists in the library"},
+		{"#!lua name=lib\nredis.register_function('f-g', function() end)",
+			"Error registering functions: user_function:2: Function names can only contain letters, " +
+				"numbers, or underscores(_) and must be at least one character long"},
+		{"#!lua name=lib\nredis.register_function{function_name='f', callback=function() end, flags={'fast'}}",
+			"Error registering functions: user_function:2: unknown flag given"},
+		{"#!lua name=lib\nredis.register_function{function_name='f'}",
+			"Error registering functions: user_function:2: redis.register_function must get a callback argument"},
+	}
+	for _, test := range tests {
+		_, err := srv.createLibrary(test.code)
+		assert.EqualError(t, err, test.err, test.code)
+	}
+	assert.Empty(t, srv.functions.libraries)
+}
+
+func TestFunctionEngineAddLibraries(t *testing.T) {
+	srv := NewServer(NewConfig())
+	fe := srv.functions
+	newLib := func(name string, functions ...string) *functionLibrary {
+		lib := &functionLibrary{name: name, functions: map[string]*scriptFunction{}}
+		for _, f := range functions {
+			lib.functions[f] = &scriptFunction{name: f, lib: lib}
+		}
+		return lib
+	}
+
+	assert.Nil(t, fe.addLibraries([]*functionLibrary{newLib("a", "f1"), newLib("b", "f2")}, "APPEND"))
+	assert.EqualError(t, fe.addLibraries([]*functionLibrary{newLib("a", "f3")}, "APPEND"), "Library 'a' already exists")
+	assert.EqualError(t, fe.addLibraries([]*functionLibrary{newLib("c", "f2")}, "REPLACE"), "Function f2 already exists")
+	assert.Equal(t, "a", fe.functions["f1"].lib.name)
+
+	// a library may take the functions of the library it replaces
+	assert.Nil(t, fe.addLibraries([]*functionLibrary{newLib("a", "f1", "f3")}, "REPLACE"))
+	assert.Len(t, fe.libraries, 2)
+	assert.Len(t, fe.functions, 3)
+
+	assert.Nil(t, fe.addLibraries([]*functionLibrary{newLib("c", "f2")}, "FLUSH"))
+	assert.Len(t, fe.libraries, 1)
+	assert.Equal(t, "c", fe.functions["f2"].lib.name)
+
+	assert.True(t, fe.deleteLibrary("c"))
+	assert.False(t, fe.deleteLibrary("c"))
+	assert.Empty(t, fe.functions)
+}
+
+func TestDumpRestoreFunctions(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	libA := "#!lua name=a\nredis.register_function('fa', function() return 'a' end)"
+	libB := "#!lua name=b\nredis.register_function('fb', function() return 'b' end)"
+	_, err := srv.loadLibrary(libA, false)
+	assert.Nil(t, err)
+	_, err = srv.loadLibrary(libB, false)
+	assert.Nil(t, err)
+
+	payload := srv.dumpFunctions()
+	assert.Equal(t, byte(rdbOpcodeFunction2), payload[0])
+	_, err = verifyDumpFooter(payload)
+	assert.Nil(t, err)
+
+	assert.EqualError(t, srv.restoreFunctions(payload, "APPEND"), "Library 'a' already exists")
+	assert.Nil(t, srv.restoreFunctions(payload, "REPLACE"))
+
+	srv.functions.flush()
+	assert.Nil(t, srv.restoreFunctions(payload, "APPEND"))
+	assert.Equal(t, "$1\r\nb\r\n", handle(srv, cl, "FCALL", "fb", "0"))
+
+	_, err = srv.loadLibrary("#!lua name=c\nredis.register_function('fc', function() end)", false)
+	assert.Nil(t, err)
+	assert.Nil(t, srv.restoreFunctions(payload, "FLUSH"))
+	assert.Len(t, srv.functions.libraries, 2)
+	assert.Nil(t, srv.functions.functions["fc"])
+
+	assert.Equal(t, errDumpPayload, srv.restoreFunctions("bad", "APPEND"))
+	assert.Equal(t, errDumpPayload, srv.restoreFunctions(payload[:len(payload)-1]+"x", "APPEND"))
+
+	// the payloads of DUMP are not libraries
+	assert.EqualError(t, srv.restoreFunctions(dumpPayload("v"), "APPEND"),
+		"given type is not a function")
+}
+
+func TestCallFunctionFlags(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	_, err := srv.loadLibrary("#!lua name=lib\n"+
+		"redis.register_function('set', function(keys, args) return redis.call('set', keys[1], args[1]) end)\n"+
+		"redis.register_function{function_name='get', callback=function(keys) return redis.call('get', keys[1]) end,"+
+		" flags={'no-writes'}}\n"+
+		"redis.register_function{function_name='sneaky', callback=function(keys) return redis.call('set', keys[1], 'w') end,"+
+		" flags={'no-writes'}}\n"+
+		"redis.register_function{function_name='local', callback=function() return 1 end, flags={'no-cluster'}}", false)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "FCALL", "set", "1", "k", "v"))
+	assert.Equal(t, "$1\r\nv\r\n", handle(srv, cl, "FCALL_RO", "get", "1", "k"))
+	assert.Equal(t, "-ERR Can not execute a script with write flag using *_ro command.\r\n",
+		handle(srv, cl, "FCALL_RO", "set", "1", "k", "w"))
+	res := handle(srv, cl, "FCALL", "sneaky", "1", "k")
+	assert.True(t, strings.HasPrefix(res, "-ERR Write commands are not allowed from read-only scripts. script: sneaky"), res)
+	v, _ := srv.Db(cl).Get("k")
+	assert.Equal(t, "v", v)
+	assert.Equal(t, "-ERR Function not found\r\n", handle(srv, cl, "FCALL", "nosuch", "0"))
+
+	// the functions that may write are refused over maxmemory
+	srv.config.MaxMemory = 1
+	assert.Equal(t, "-OOM command not allowed when used memory > 'maxmemory'.\r\n",
+		handle(srv, cl, "FCALL", "set", "1", "k", "w"))
+	assert.Equal(t, "$1\r\nv\r\n", handle(srv, cl, "FCALL", "get", "1", "k"))
+	srv.config.MaxMemory = 0
+
+	config := NewConfig()
+	config.ClusterEnabled = true
+	config.ClusterRequireFullCoverage = false
+	clusterSrv := NewServer(config)
+	clusterSrv.functions = srv.functions
+	assert.Equal(t, "-ERR Can not run script on cluster, 'no-cluster' flag is set.\r\n",
+		handle(clusterSrv, cl, "FCALL", "local", "0"))
+	assert.Equal(t, ":1\r\n", handle(srv, cl, "FCALL", "local", "0"))
+}
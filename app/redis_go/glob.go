@@ -0,0 +1,90 @@
+package redis_go
+
+// stringMatch reports whether str matches the glob-style pattern, using the
+// same rules as redis: '*' matches any sequence, '?' any single character,
+// '[...]' a set or range (negated with '^') and '\' escapes the next
+// character.
+func stringMatch(pattern string, str string) bool {
+	p, s := 0, 0
+	for p < len(pattern) {
+		switch pattern[p] {
+		case '*':
+			for p+1 < len(pattern) && pattern[p+1] == '*' {
+				p++
+			}
+			if p+1 == len(pattern) {
+				return true
+			}
+			for i := s; i <= len(str); i++ {
+				if stringMatch(pattern[p+1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == len(str) {
+				return false
+			}
+			s++
+		case '[':
+			if s == len(str) {
+				return false
+			}
+			var ok bool
+			p, ok = matchSet(pattern, p+1, str[s])
+			if !ok {
+				return false
+			}
+			s++
+		case '\\':
+			if p+1 < len(pattern) {
+				p++
+			}
+			fallthrough
+		default:
+			if s == len(str) || pattern[p] != str[s] {
+				return false
+			}
+			s++
+		}
+		p++
+	}
+	return s == len(str)
+}
+
+// matchSet matches c against the set starting at pattern[p], just after the
+// opening '['. It returns the position of the closing ']' and whether c is
+// in the set.
+func matchSet(pattern string, p int, c byte) (int, bool) {
+	not := p < len(pattern) && pattern[p] == '^'
+	if not {
+		p++
+	}
+
+	match := false
+	for ; p < len(pattern) && pattern[p] != ']'; p++ {
+		if pattern[p] == '\\' && p+1 < len(pattern) {
+			p++
+			if pattern[p] == c {
+				match = true
+			}
+		} else if p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']' {
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				match = true
+			}
+			p += 2
+		} else if pattern[p] == c {
+			match = true
+		}
+	}
+
+	if p == len(pattern) {
+		// an unterminated set runs to the end of the pattern
+		p--
+	}
+	return p, match != not
+}
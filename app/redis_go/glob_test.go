@@ -0,0 +1,43 @@
+package redis_go
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1000", true},
+		{"user:*", "session:1000", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h**llo", "hllo", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"h[\\]]llo", "h]llo", true},
+		{"hello", "hello!", false},
+		{"*o*", "foo", true},
+		{"a*b", "ab", true},
+		{"a*b", "abc", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.match, stringMatch(c.pattern, c.str),
+			"%s %s", c.pattern, c.str)
+	}
+}
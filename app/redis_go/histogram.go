@@ -0,0 +1,78 @@
+package redis_go
+
+import (
+	"math/bits"
+	"time"
+)
+
+// histogramSubBucketBits sets the precision of latencyHistogram: every
+// value is recorded with a relative error below 1/2^(bits-1).
+const histogramSubBucketBits = 7
+
+const histogramHalf = 1 << (histogramSubBucketBits - 1)
+
+// latencyHistogram counts durations the way HdrHistogram does. Buckets
+// cover ranges that double in size, and each is split into the same number
+// of linear sub-buckets, so the memory used only grows with the log of the
+// largest value while percentiles stay accurate to a couple of digits.
+type latencyHistogram struct {
+	// counts is indexed by histogramIndex of the duration in nanoseconds
+	counts []int64
+	total  int64
+}
+
+func histogramIndex(v uint64) int {
+	if v < 2*histogramHalf {
+		return int(v)
+	}
+	exp := bits.Len64(v) - histogramSubBucketBits
+	return (exp+1)*histogramHalf + int(v>>exp) - histogramHalf
+}
+
+// histogramHighest is the largest value recorded at idx.
+func histogramHighest(idx int) uint64 {
+	if idx < 2*histogramHalf {
+		return uint64(idx)
+	}
+	exp := idx/histogramHalf - 1
+	sub := uint64(idx%histogramHalf + histogramHalf)
+	return (sub+1)<<exp - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	idx := histogramIndex(uint64(d))
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+	h.total++
+}
+
+// percentile returns the duration under which p percent of the recorded
+// durations fall.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(p / 100 * float64(h.total))
+	if float64(rank) < p/100*float64(h.total) {
+		rank++
+	}
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for idx, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return time.Duration(histogramHighest(idx))
+		}
+	}
+	return time.Duration(histogramHighest(len(h.counts) - 1))
+}
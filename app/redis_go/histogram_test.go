@@ -0,0 +1,43 @@
+package redis_go
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramIndex(t *testing.T) {
+	// exact below the first doubling
+	for v := uint64(0); v < 2*histogramHalf; v++ {
+		assert.Equal(t, int(v), histogramIndex(v))
+		assert.Equal(t, v, histogramHighest(int(v)))
+	}
+
+	prev := histogramIndex(2*histogramHalf - 1)
+	for _, v := range []uint64{128, 130, 255, 256, 1000, 1 << 20, 1<<40 + 12345} {
+		idx := histogramIndex(v)
+		assert.Greater(t, idx, prev)
+		prev = idx
+
+		// the bucket holds v, within the precision of the histogram
+		high := histogramHighest(idx)
+		assert.GreaterOrEqual(t, high, v)
+		assert.Less(t, float64(high-v)/float64(v), 1.0/histogramHalf)
+	}
+	// buckets are contiguous
+	assert.Equal(t, histogramIndex(histogramHighest(200))+1, histogramIndex(histogramHighest(200)+1))
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var h latencyHistogram
+	assert.Equal(t, time.Duration(0), h.percentile(50))
+
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Microsecond)
+	}
+	assert.InEpsilon(t, float64(500*time.Microsecond), float64(h.percentile(50)), 0.02)
+	assert.InEpsilon(t, float64(990*time.Microsecond), float64(h.percentile(99)), 0.02)
+	assert.InEpsilon(t, float64(999*time.Microsecond), float64(h.percentile(99.9)), 0.02)
+	assert.InEpsilon(t, float64(1000*time.Microsecond), float64(h.percentile(100)), 0.02)
+}
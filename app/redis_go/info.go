@@ -0,0 +1,320 @@
+package redis_go
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Version is the redis version the server reports being compatible with.
+const Version = "7.0.0"
+
+type infoSection struct {
+	name string
+	// dflt sections are the ones reported by INFO without arguments
+	dflt bool
+	// sentinel sections are the only ones reported in sentinel mode
+	sentinel bool
+	write    func(s *Server, b *infoBuilder)
+}
+
+var infoSections = []infoSection{
+	{"server", true, true, (*Server).infoServer},
+	{"clients", true, true, (*Server).infoClients},
+	{"memory", true, false, (*Server).infoMemory},
+	{"persistence", true, false, (*Server).infoPersistence},
+	{"stats", true, true, (*Server).infoStats},
+	{"replication", true, false, (*Server).infoReplication},
+	{"cpu", true, true, (*Server).infoCpu},
+	{"commandstats", false, false, (*Server).infoCommandStats},
+	{"latencystats", false, false, (*Server).infoLatencyStats},
+	{"errorstats", true, false, (*Server).infoErrorStats},
+	{"cluster", true, false, (*Server).infoCluster},
+	{"keyspace", true, false, (*Server).infoKeyspace},
+	{"sentinel", true, true, (*Server).infoSentinel},
+}
+
+type infoBuilder struct {
+	sb strings.Builder
+}
+
+func (b *infoBuilder) field(name string, value interface{}) {
+	fmt.Fprintf(&b.sb, "%s:%v\r\n", name, value)
+}
+
+// Info renders the requested sections of INFO. Besides the section names,
+// "default", "all" and "everything" select groups of sections. Unknown
+// names are ignored.
+func (s *Server) Info(names []string) string {
+	want := map[string]bool{}
+	if len(names) == 0 {
+		want["default"] = true
+	}
+	for _, n := range names {
+		want[strings.ToLower(n)] = true
+	}
+
+	var b infoBuilder
+	for _, sec := range infoSections {
+		if !want[sec.name] && !want["all"] && !want["everything"] &&
+			!(want["default"] && sec.dflt) {
+			continue
+		}
+		if (s.sentinel != nil && !sec.sentinel) || (s.sentinel == nil && sec.name == "sentinel") {
+			continue
+		}
+		if b.sb.Len() > 0 {
+			b.sb.WriteString("\r\n")
+		}
+		b.sb.WriteString("# " + strings.ToUpper(sec.name[:1]) + sec.name[1:] + "\r\n")
+		sec.write(s, &b)
+	}
+	return b.sb.String()
+}
+
+func (s *Server) infoServer(b *infoBuilder) {
+	uptime := time.Since(s.startTime)
+	exe, _ := os.Executable()
+
+	b.field("redis_version", Version)
+	mode := "standalone"
+	if s.cluster != nil {
+		mode = "cluster"
+	} else if s.sentinel != nil {
+		mode = "sentinel"
+	}
+	b.field("redis_mode", mode)
+	b.field("os", runtime.GOOS+" "+runtime.GOARCH)
+	b.field("arch_bits", strconv.IntSize)
+	b.field("multiplexing_api", "kqueue")
+	b.field("go_version", runtime.Version())
+	b.field("process_id", os.Getpid())
+	b.field("run_id", s.runId)
+	b.field("tcp_port", s.config.Port)
+	b.field("server_time_usec", time.Now().UnixMicro())
+	b.field("uptime_in_seconds", int64(uptime.Seconds()))
+	b.field("uptime_in_days", int64(uptime.Hours()/24))
+	b.field("hz", s.config.Hz)
+	b.field("configured_hz", s.config.Hz)
+	b.field("executable", exe)
+	b.field("config_file", s.config.ConfigFile)
+}
+
+func (s *Server) infoClients(b *infoBuilder) {
+	clients := s.Clients()
+	maxIn, maxOut := 0, 0
+	for _, c := range clients {
+		if c.QueryBufPeak > maxIn {
+			maxIn = c.QueryBufPeak
+		}
+		if c.OutputBufPeak > maxOut {
+			maxOut = c.OutputBufPeak
+		}
+	}
+
+	b.field("connected_clients", len(clients))
+	b.field("maxclients", s.maxClients())
+	b.field("client_recent_max_input_buffer", maxIn)
+	b.field("client_recent_max_output_buffer", maxOut)
+	b.field("blocked_clients", 0)
+	b.field("tracking_clients", len(s.tracking.clients))
+}
+
+func (s *Server) infoMemory(b *infoBuilder) {
+	st := s.memoryStats()
+	datasetPct := 0.0
+	if st.netMemory() > 0 {
+		datasetPct = float64(st.dataset) * 100 / float64(st.netMemory())
+	}
+	peakPct := 0.0
+	if st.peak > 0 {
+		peakPct = float64(st.total) * 100 / float64(st.peak)
+	}
+
+	b.field("used_memory", st.total)
+	b.field("used_memory_human", bytesToHuman(st.total))
+	b.field("used_memory_rss", st.heapSys)
+	b.field("used_memory_rss_human", bytesToHuman(st.heapSys))
+	b.field("used_memory_peak", st.peak)
+	b.field("used_memory_peak_human", bytesToHuman(st.peak))
+	b.field("used_memory_peak_perc", fmt.Sprintf("%.2f%%", peakPct))
+	b.field("used_memory_overhead", st.overhead)
+	b.field("used_memory_startup", st.startup)
+	b.field("used_memory_dataset", st.dataset)
+	b.field("used_memory_dataset_perc", fmt.Sprintf("%.2f%%", datasetPct))
+	b.field("maxmemory", s.config.MaxMemory)
+	b.field("maxmemory_human", bytesToHuman(uint64(s.config.MaxMemory)))
+	b.field("maxmemory_policy", s.config.MaxMemoryPolicy)
+	b.field("mem_fragmentation_ratio", fmt.Sprintf("%.2f", st.fragmentation()))
+	b.field("mem_allocator", "go")
+	b.field("number_of_cached_scripts", len(s.scripts.scripts))
+}
+
+// infoPersistence reports that nothing is ever saved, as there is no RDB
+// or AOF support.
+func (s *Server) infoPersistence(b *infoBuilder) {
+	b.field("loading", 0)
+	b.field("rdb_changes_since_last_save", 0)
+	b.field("rdb_bgsave_in_progress", 0)
+	b.field("rdb_last_save_time", s.startTime.Unix())
+	b.field("aof_enabled", 0)
+	b.field("aof_rewrite_in_progress", 0)
+}
+
+func (s *Server) infoStats(b *infoBuilder) {
+	var hits, misses, expired int64
+	for _, db := range s.dbs {
+		hits += db.hits
+		misses += db.misses
+		expired += db.expired
+	}
+	net := s.netStats()
+
+	b.field("total_connections_received", net.ConnectionsReceived)
+	b.field("total_commands_processed", s.stats.commands)
+	b.field("total_net_input_bytes", net.NetInputBytes)
+	b.field("total_net_output_bytes", net.NetOutputBytes)
+	b.field("instantaneous_ops_per_sec", int64(s.stats.opsPerSec.rate()))
+	b.field("instantaneous_input_kbps", fmt.Sprintf("%.2f", s.stats.inputPerSec.rate()/1024))
+	b.field("instantaneous_output_kbps", fmt.Sprintf("%.2f", s.stats.outputPerSec.rate()/1024))
+	b.field("expired_keys", expired)
+	b.field("evicted_keys", s.stats.evicted)
+	b.field("keyspace_hits", hits)
+	b.field("keyspace_misses", misses)
+	b.field("pubsub_channels", len(s.pubsub.channels))
+	b.field("pubsub_patterns", len(s.pubsub.patterns))
+	b.field("tracking_total_keys", len(s.tracking.keys))
+	b.field("tracking_total_items", s.tracking.items)
+	b.field("tracking_total_prefixes", len(s.tracking.prefixes))
+	b.field("rejected_connections", net.RejectedConnections)
+	b.field("total_error_replies", s.stats.errorReplies)
+}
+
+// infoReplication reports a master without replicas, as there is no
+// replication.
+func (s *Server) infoReplication(b *infoBuilder) {
+	b.field("role", "master")
+	b.field("connected_slaves", 0)
+	b.field("master_replid", s.runId)
+	b.field("master_repl_offset", 0)
+}
+
+func (s *Server) infoCpu(b *infoBuilder) {
+	var self, children syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &self)
+	syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children)
+
+	b.field("used_cpu_sys", formatCpu(self.Stime))
+	b.field("used_cpu_user", formatCpu(self.Utime))
+	b.field("used_cpu_sys_children", formatCpu(children.Stime))
+	b.field("used_cpu_user_children", formatCpu(children.Utime))
+}
+
+func (s *Server) infoCommandStats(b *infoBuilder) {
+	for _, name := range s.statsCommandNames() {
+		cs := s.stats.byCommand[name]
+		usec := cs.duration.Microseconds()
+		perCall := 0.0
+		if cs.calls > 0 {
+			perCall = float64(cs.duration) / float64(time.Microsecond) / float64(cs.calls)
+		}
+		b.field("cmdstat_"+name, fmt.Sprintf(
+			"calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			cs.calls, usec, perCall, cs.rejected, cs.failed))
+	}
+}
+
+func (s *Server) infoLatencyStats(b *infoBuilder) {
+	for _, name := range s.statsCommandNames() {
+		cs := s.stats.byCommand[name]
+		if cs.calls == 0 {
+			continue
+		}
+		ps := make([]string, len(s.config.LatencyTrackingInfoPercentiles))
+		for i, p := range s.config.LatencyTrackingInfoPercentiles {
+			usec := float64(cs.latency.percentile(p)) / float64(time.Microsecond)
+			ps[i] = fmt.Sprintf("p%s=%.3f", formatFloat(p), usec)
+		}
+		b.field("latency_percentiles_usec_"+name, strings.Join(ps, ","))
+	}
+}
+
+func (s *Server) statsCommandNames() []string {
+	names := make([]string, 0, len(s.stats.byCommand))
+	for name := range s.stats.byCommand {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) infoErrorStats(b *infoBuilder) {
+	codes := make([]string, 0, len(s.stats.errors))
+	for code := range s.stats.errors {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		b.field("errorstat_"+code, fmt.Sprintf("count=%d", s.stats.errors[code]))
+	}
+}
+
+func (s *Server) infoCluster(b *infoBuilder) {
+	enabled := 0
+	if s.cluster != nil {
+		enabled = 1
+	}
+	b.field("cluster_enabled", enabled)
+}
+
+func (s *Server) infoSentinel(b *infoBuilder) {
+	masters := sortedInstances(s.sentinel.masters)
+	b.field("sentinel_masters", len(masters))
+	b.field("sentinel_tilt", 0)
+	b.field("sentinel_running_scripts", 0)
+	b.field("sentinel_scripts_queue_length", 0)
+	for i, master := range masters {
+		status := "ok"
+		if master.flags&sriOdown != 0 {
+			status = "odown"
+		}
+		ip, port := sentinelCurrentMasterAddress(master)
+		b.field("master"+strconv.Itoa(i), fmt.Sprintf("name=%s,status=%s,address=%s:%d,slaves=%d,sentinels=%d",
+			master.name, status, ip, port, len(master.slaves), len(master.sentinels)+1))
+	}
+}
+
+func (s *Server) infoKeyspace(b *infoBuilder) {
+	for i, db := range s.dbs {
+		if db.Size() == 0 {
+			continue
+		}
+		b.field("db"+strconv.Itoa(i), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=%d",
+			db.Size(), db.ExpiresSize(), db.AvgTtl().Milliseconds()))
+	}
+}
+
+func formatCpu(tv syscall.Timeval) string {
+	return fmt.Sprintf("%.6f", float64(tv.Nano())/float64(time.Second))
+}
+
+// bytesToHuman formats a size the way INFO does, such as 1.50M.
+func bytesToHuman(n uint64) string {
+	units := []string{"K", "M", "G", "T", "P"}
+	if n < 1024 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	f := float64(n) / 1024
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%s", f, units[i])
+}
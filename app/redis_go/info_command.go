@@ -0,0 +1,31 @@
+package redis_go
+
+import "redis-go/app/ev"
+
+type InfoCommand struct {
+	BaseCommand
+	reader   RespReader
+	sections []string
+}
+
+func NewInfoCommand(rr RespReader) *InfoCommand {
+	return &InfoCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *InfoCommand) ReadParams(len int) error {
+	for i := 0; i < len; i++ {
+		sec, err := c.reader.ReadBulkString()
+		if err != nil {
+			return err
+		}
+		c.sections = append(c.sections, sec)
+	}
+	return nil
+}
+
+func (c *InfoCommand) Execute(srv *Server, cl *ev.Client) string {
+	return encodeBulkString(srv.Info(c.sections))
+}
@@ -0,0 +1,41 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"strings"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandInfo(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	ic := InfoCommand{sections: []string{"replication"}}
+	res := ic.Execute(srv, cl)
+	assert.True(t, strings.HasPrefix(res, "$"))
+	assert.Contains(t, res, "\r\n# Replication\r\nrole:master\r\n")
+}
+
+func TestInfoReadParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	ic := NewInfoCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("server", nil)
+	mrr.EXPECT().ReadBulkString().Return("memory", nil)
+	assert.Nil(t, ic.ReadParams(2))
+	assert.Equal(t, []string{"server", "memory"}, ic.sections)
+}
+
+func TestInfoReadParamsNone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	ic := NewInfoCommand(mrr)
+	assert.Nil(t, ic.ReadParams(0))
+	assert.Empty(t, ic.sections)
+}
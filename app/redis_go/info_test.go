@@ -0,0 +1,266 @@
+package redis_go
+
+import (
+	"crypto/tls"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func handle(srv *Server, cl *ev.Client, args ...string) string {
+	req := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, a := range args {
+		req += "$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n"
+	}
+	return srv.Handle(cl, ev.NewArrayStringReader([]byte(req)))
+}
+
+func infoSectionNames(info string) []string {
+	var names []string
+	for _, line := range strings.Split(info, "\r\n") {
+		if strings.HasPrefix(line, "# ") {
+			names = append(names, line[2:])
+		}
+	}
+	return names
+}
+
+func TestServerInfoDefault(t *testing.T) {
+	srv := NewServer(NewConfig())
+	assert.Equal(t, []string{"Server", "Clients", "Memory", "Persistence",
+		"Stats", "Replication", "Cpu", "Errorstats", "Cluster", "Keyspace"},
+		infoSectionNames(srv.Info(nil)))
+}
+
+func TestServerInfoSections(t *testing.T) {
+	srv := NewServer(NewConfig())
+	info := srv.Info([]string{"KEYSPACE", "server", "nosuchsection"})
+	assert.Equal(t, []string{"Server", "Keyspace"}, infoSectionNames(info))
+	assert.Contains(t, info, "redis_version:"+Version+"\r\n")
+	assert.Contains(t, info, "\r\n\r\n# Keyspace\r\n")
+
+	assert.Contains(t, infoSectionNames(srv.Info([]string{"all"})), "Commandstats")
+}
+
+func TestServerInfoStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.SetConnections(&fakeConnections{
+		clients:    []*ev.Client{ev.NewClient(1)},
+		maxClients: 50,
+		stats:      ev.Stats{ConnectionsReceived: 3, RejectedConnections: 2, NetInputBytes: 100, NetOutputBytes: 200},
+	})
+	cl := ev.NewClient(1)
+
+	handle(srv, cl, "SET", "hello", "world")
+	handle(srv, cl, "GET", "hello")
+	handle(srv, cl, "GET", "missing")
+	handle(srv, cl, "NOSUCHCOMMAND")
+	srv.Db(cl).Set("gone", "value")
+	srv.Db(cl).SetExpire("gone", time.Now().Add(-time.Second))
+	srv.Db(cl).Get("gone")
+
+	info := srv.Info([]string{"stats", "clients", "commandstats", "errorstats"})
+	for _, line := range []string{
+		"connected_clients:1",
+		"maxclients:50",
+		"total_connections_received:3",
+		"rejected_connections:2",
+		"total_commands_processed:3",
+		"total_net_input_bytes:100",
+		"total_net_output_bytes:200",
+		"expired_keys:1",
+		"keyspace_hits:1",
+		"keyspace_misses:2",
+		"total_error_replies:1",
+		"errorstat_ERR:count=1",
+	} {
+		assert.Contains(t, info, line+"\r\n")
+	}
+	assert.Contains(t, info, "cmdstat_get:calls=2,usec=")
+	assert.Contains(t, info, "cmdstat_set:calls=1,usec=")
+}
+
+func TestServerInfoCommandStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	handle(srv, cl, "SELECT", "100")
+	handle(srv, cl, "SELECT", "1")
+	handle(srv, cl, "SELECT")
+	srv.config.MaxMemory = 1
+	srv.Db(cl).Set("hello", "world")
+	handle(srv, cl, "SET", "foo", "bar")
+
+	cs := srv.stats.byCommand["select"]
+	assert.Equal(t, int64(2), cs.calls)
+	assert.Equal(t, int64(1), cs.failed)
+	assert.Equal(t, int64(1), cs.rejected)
+	assert.Equal(t, int64(2), cs.latency.total)
+	assert.Equal(t, int64(1), srv.stats.byCommand["set"].rejected)
+	assert.Equal(t, int64(0), srv.stats.byCommand["set"].calls)
+
+	info := srv.Info([]string{"commandstats"})
+	assert.Contains(t, info, ",rejected_calls=1,failed_calls=1\r\n")
+	assert.Contains(t, info, "cmdstat_set:calls=0,usec=0,usec_per_call=0.00,rejected_calls=1,failed_calls=0\r\n")
+}
+
+func TestServerInfoLatencyStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.stats.call("get", 10*time.Microsecond, "+OK")
+	srv.stats.reject("set")
+
+	info := srv.Info([]string{"latencystats"})
+	assert.Contains(t, info, "# Latencystats\r\nlatency_percentiles_usec_get:p50=10.")
+	assert.Contains(t, info, ",p99=10.")
+	assert.Contains(t, info, ",p99.9=10.")
+	assert.NotContains(t, info, "usec_set")
+}
+
+func TestServerResetStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{stats: ev.Stats{ConnectionsReceived: 3}}
+	srv.SetConnections(conns)
+	cl := ev.NewClient(1)
+
+	handle(srv, cl, "GET", "missing")
+	handle(srv, cl, "NOSUCHCOMMAND")
+	srv.ResetStats()
+
+	assert.Equal(t, int64(0), srv.stats.commands)
+	assert.Empty(t, srv.stats.byCommand)
+	assert.Empty(t, srv.stats.errors)
+	assert.Equal(t, int64(0), srv.Db(cl).misses)
+	assert.Equal(t, int64(0), conns.stats.ConnectionsReceived)
+}
+
+func TestServerInfoEvictedKeys(t *testing.T) {
+	srv := newEvictionServer(PolicyAllKeysRandom)
+	srv.dbs[0].Set("hello", "world")
+	srv.config.MaxMemory = 1
+	srv.freeMemoryIfNeeded()
+
+	assert.Contains(t, srv.Info([]string{"stats"}), "evicted_keys:1\r\n")
+}
+
+func TestServerInfoKeyspace(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[3].Set("foo", "bar")
+	srv.dbs[3].SetExpire("foo", time.Now().Add(time.Minute))
+	srv.dbs[3].ActiveExpire(time.Now().Add(time.Millisecond))
+
+	info := srv.Info([]string{"keyspace"})
+	assert.Contains(t, info, "db0:keys=1,expires=0,avg_ttl=0\r\n")
+	assert.Contains(t, info, "db3:keys=1,expires=1,avg_ttl=")
+	assert.NotContains(t, info, "db1:")
+	assert.Greater(t, srv.dbs[3].AvgTtl(), 59*time.Second)
+}
+
+func TestServerHandleErrorReply(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "-ERR unknown command FOO\r\n", handle(srv, cl, "FOO"))
+	assert.Equal(t, "+PONG\r\n", handle(srv, cl, "PING"))
+	assert.Equal(t, int64(1), srv.stats.errors["ERR"])
+}
+
+func TestBytesToHuman(t *testing.T) {
+	assert.Equal(t, "0B", bytesToHuman(0))
+	assert.Equal(t, "1023B", bytesToHuman(1023))
+	assert.Equal(t, "1.50K", bytesToHuman(1536))
+	assert.Equal(t, "100.00M", bytesToHuman(100<<20))
+	assert.Equal(t, "2.00G", bytesToHuman(2<<30))
+}
+
+type fakeConnections struct {
+	clients    []*ev.Client
+	maxClients int
+	stats      ev.Stats
+	stopped    bool
+	cronRuns   int
+	// cronPeriod is the period of the timer running the cron, and the
+	// fields below are set by CONFIG SET
+	cronPeriod  time.Duration
+	idleTimeout time.Duration
+	keepAlive   time.Duration
+	port        int
+	tlsPort     int
+	portErr     error
+	// whileBlocked stands for the requests arriving while a script runs
+	whileBlocked func()
+}
+
+func (f *fakeConnections) Clients() []*ev.Client {
+	return f.clients
+}
+
+func (f *fakeConnections) MaxClients() int {
+	return f.maxClients
+}
+
+func (f *fakeConnections) Stats() ev.Stats {
+	return f.stats
+}
+
+func (f *fakeConnections) ResetStats() {
+	f.stats = ev.Stats{}
+}
+
+func (f *fakeConnections) Stop() {
+	f.stopped = true
+}
+
+func (f *fakeConnections) ClientsCron() {
+	f.cronRuns++
+}
+
+func (f *fakeConnections) AddPeriodicTimer(period time.Duration, fn func()) int64 {
+	f.cronPeriod = period
+	return 1
+}
+
+func (f *fakeConnections) CancelTimer(id int64) bool {
+	f.cronPeriod = 0
+	return true
+}
+
+func (f *fakeConnections) SetIdleTimeout(d time.Duration) {
+	f.idleTimeout = d
+}
+
+func (f *fakeConnections) SetKeepAlive(d time.Duration) {
+	f.keepAlive = d
+}
+
+func (f *fakeConnections) ChangeMaxClients(n int) error {
+	f.maxClients = n
+	return nil
+}
+
+func (f *fakeConnections) ChangePort(port int) error {
+	if f.portErr != nil {
+		return f.portErr
+	}
+	f.port = port
+	return nil
+}
+
+func (f *fakeConnections) ChangeTls(port int, config *tls.Config) error {
+	if f.portErr != nil {
+		return f.portErr
+	}
+	f.tlsPort = port
+	return nil
+}
+
+func (f *fakeConnections) ProcessEventsWhileBlocked() error {
+	if f.whileBlocked != nil {
+		f.whileBlocked()
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package redis_go
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The event classes the latency monitor records. There is no persistence,
+// so unlike redis there are no fork or fsync events.
+const (
+	latencyEventCommand       = "command"
+	latencyEventExpireCycle   = "expire-cycle"
+	latencyEventRehash        = "rehash"
+	latencyEventEvictionCycle = "eviction-cycle"
+)
+
+// latencyHistoryLen is the number of samples kept for each event.
+const latencyHistoryLen = 160
+
+type latencySample struct {
+	// time is in unix seconds and latency in milliseconds
+	time    int64
+	latency int64
+}
+
+type latencyEvent struct {
+	// samples is oldest first, with at most one sample per second
+	samples []latencySample
+	max     int64
+}
+
+func (e *latencyEvent) latest() latencySample {
+	return e.samples[len(e.samples)-1]
+}
+
+// latencyMonitor keeps the recent latency spikes of each event class.
+type latencyMonitor struct {
+	events map[string]*latencyEvent
+}
+
+func newLatencyMonitor() *latencyMonitor {
+	return &latencyMonitor{
+		events: make(map[string]*latencyEvent),
+	}
+}
+
+func (m *latencyMonitor) add(event string, now time.Time, d time.Duration) {
+	e, ok := m.events[event]
+	if !ok {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+
+	ms := d.Milliseconds()
+	if ms > e.max {
+		e.max = ms
+	}
+
+	ts := now.Unix()
+	if n := len(e.samples); n > 0 && e.samples[n-1].time == ts {
+		// keep the worst spike of each second
+		if ms > e.samples[n-1].latency {
+			e.samples[n-1].latency = ms
+		}
+		return
+	}
+	e.samples = append(e.samples, latencySample{time: ts, latency: ms})
+	if len(e.samples) > latencyHistoryLen {
+		e.samples = e.samples[1:]
+	}
+}
+
+// reset drops the given events, or all of them when none is given, and
+// returns the number of events dropped.
+func (m *latencyMonitor) reset(events []string) int {
+	if len(events) == 0 {
+		n := len(m.events)
+		m.events = make(map[string]*latencyEvent)
+		return n
+	}
+	n := 0
+	for _, event := range events {
+		if _, ok := m.events[event]; ok {
+			delete(m.events, event)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *latencyMonitor) eventNames() []string {
+	names := make([]string, 0, len(m.events))
+	for name := range m.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latencyGraphRows is the height of the bars of LATENCY GRAPH.
+const latencyGraphRows = 4
+
+// graph draws the samples of the event as vertical bars, scaled between
+// the lowest and highest sample, with the age of each sample written
+// vertically below it.
+func (e *latencyEvent) graph(event string, now time.Time) string {
+	samples := e.samples
+	if len(samples) > 80 {
+		samples = samples[len(samples)-80:]
+	}
+
+	low, high := int64(math.MaxInt64), int64(0)
+	for _, s := range samples {
+		if s.latency < low {
+			low = s.latency
+		}
+		if s.latency > high {
+			high = s.latency
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s - high %d ms, low %d ms (all time high %d ms)\n",
+		event, high, low, e.max)
+	sb.WriteString(strings.Repeat("-", 80) + "\n")
+
+	// each row is split in two levels: '_' fills half of it, '|' all of it
+	levels := int64(latencyGraphRows * 2)
+	heights := make([]int64, len(samples))
+	for i, s := range samples {
+		heights[i] = levels
+		if high > low {
+			heights[i] = 1 + (s.latency-low)*(levels-1)/(high-low)
+		}
+	}
+	for row := int64(latencyGraphRows - 1); row >= 0; row-- {
+		line := make([]byte, len(samples))
+		for i, h := range heights {
+			switch {
+			case h == row*2+2:
+				line[i] = '#'
+			case h > row*2+2:
+				line[i] = '|'
+			case h == row*2+1:
+				line[i] = '_'
+			default:
+				line[i] = ' '
+			}
+		}
+		sb.WriteString(strings.TrimRight(string(line), " ") + "\n")
+	}
+	sb.WriteString("\n")
+
+	labels := make([]string, len(samples))
+	longest := 0
+	for i, s := range samples {
+		labels[i] = formatAge(now.Unix() - s.time)
+		if len(labels[i]) > longest {
+			longest = len(labels[i])
+		}
+	}
+	for j := 0; j < longest; j++ {
+		line := make([]byte, len(samples))
+		for i, l := range labels {
+			line[i] = ' '
+			if j < len(l) {
+				line[i] = l[j]
+			}
+		}
+		sb.WriteString(strings.TrimRight(string(line), " ") + "\n")
+	}
+	return sb.String()
+}
+
+// formatAge formats a number of seconds in the largest unit that fits.
+func formatAge(secs int64) string {
+	switch {
+	case secs < 60:
+		return fmt.Sprintf("%ds", secs)
+	case secs < 3600:
+		return fmt.Sprintf("%dm", secs/60)
+	case secs < 86400:
+		return fmt.Sprintf("%dh", secs/3600)
+	}
+	return fmt.Sprintf("%dd", secs/86400)
+}
+
+var latencyAdvice = map[string]string{
+	latencyEventCommand: "Check SLOWLOG GET for the commands that are slow to run, " +
+		"and consider sending big commands such as KEYS or FLUSHALL less often " +
+		"or splitting them with SCAN.",
+	latencyEventExpireCycle: "Many keys are expiring at the same time. Consider " +
+		"adding some jitter to the time to live of the keys set together.",
+	latencyEventRehash: "Big hash tables are being resized. This happens once " +
+		"when a database grows or shrinks a lot, and is spread over the " +
+		"time the server is idle.",
+	latencyEventEvictionCycle: "A lot of memory is freed at once to stay within " +
+		"maxmemory. Consider raising maxmemory or writing smaller batches.",
+}
+
+// doctor reports the events seen along with what usually causes them.
+func (m *latencyMonitor) doctor(threshold int64) string {
+	if threshold <= 0 {
+		return "I'm sorry, Dave, I can't do that. Latency monitoring is " +
+			"disabled in this instance. You may start the server with " +
+			"--latency-monitor-threshold <milliseconds> in order to enable it."
+	}
+	if len(m.events) == 0 {
+		return "Dave, no latency spike was observed during the lifetime of " +
+			"this instance, not in the slightest bit. I honestly think you " +
+			"ought to sleep better about this."
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Dave, I have observed latency spikes in this instance. " +
+		"You don't mind talking about it, do you Dave?\n\n")
+	for i, name := range m.eventNames() {
+		e := m.events[name]
+		var sum int64
+		for _, s := range e.samples {
+			sum += s.latency
+		}
+		avg := sum / int64(len(e.samples))
+		var dev int64
+		for _, s := range e.samples {
+			d := s.latency - avg
+			if d < 0 {
+				d = -d
+			}
+			dev += d
+		}
+		dev /= int64(len(e.samples))
+		period := float64(e.latest().time-e.samples[0].time) / float64(len(e.samples))
+
+		fmt.Fprintf(&sb, "%d. %s: %d latency spikes (average %dms, mean "+
+			"deviation %dms, period %.2f sec). Worst all time event %dms.\n",
+			i+1, name, len(e.samples), avg, dev, period, e.max)
+	}
+
+	sb.WriteString("\nI have a few advices for you:\n\n")
+	for _, name := range m.eventNames() {
+		if advice, ok := latencyAdvice[name]; ok {
+			sb.WriteString("- " + advice + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// latencyAddSampleIfNeeded records d for the event if it is above
+// latency-monitor-threshold.
+func (s *Server) latencyAddSampleIfNeeded(event string, d time.Duration) {
+	threshold := s.config.LatencyMonitorThreshold
+	if threshold <= 0 || d.Milliseconds() < threshold {
+		return
+	}
+	s.latency.add(event, time.Now(), d)
+}
@@ -0,0 +1,95 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strings"
+	"time"
+)
+
+type LatencyCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	events     []string
+}
+
+func NewLatencyCommand(rr RespReader) *LatencyCommand {
+	return &LatencyCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *LatencyCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	switch c.subcommand {
+	case "LATEST", "DOCTOR":
+		if len != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "HISTORY", "GRAPH":
+		if len != 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "RESET":
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+
+	for i := 1; i < len; i++ {
+		event, err := c.reader.ReadBulkString()
+		if err != nil {
+			return err
+		}
+		c.events = append(c.events, event)
+	}
+	return nil
+}
+
+func (c *LatencyCommand) Execute(srv *Server, cl *ev.Client) string {
+	m := srv.latency
+	switch c.subcommand {
+	case "LATEST":
+		elems := []string{}
+		for _, name := range m.eventNames() {
+			e := m.events[name]
+			elems = append(elems, encodeArray([]string{
+				encodeBulkString(name),
+				encodeInt(int(e.latest().time)),
+				encodeInt(int(e.latest().latency)),
+				encodeInt(int(e.max)),
+			}))
+		}
+		return encodeArray(elems)
+	case "HISTORY":
+		elems := []string{}
+		if e, ok := m.events[c.events[0]]; ok {
+			for _, s := range e.samples {
+				elems = append(elems, encodeArray([]string{
+					encodeInt(int(s.time)),
+					encodeInt(int(s.latency)),
+				}))
+			}
+		}
+		return encodeArray(elems)
+	case "GRAPH":
+		e, ok := m.events[c.events[0]]
+		if !ok {
+			return fmt.Sprintf("-ERR No samples available for event '%s'", c.events[0])
+		}
+		return encodeBulkString(e.graph(c.events[0], time.Now()))
+	case "DOCTOR":
+		return encodeBulkString(m.doctor(srv.config.LatencyMonitorThreshold))
+	}
+	return encodeInt(m.reset(c.events))
+}
@@ -0,0 +1,81 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandLatencyLatestAndHistory(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	now := time.Unix(1700000000, 0)
+	srv.latency.add("command", now, 300*time.Millisecond)
+	srv.latency.add("command", now.Add(time.Second), 200*time.Millisecond)
+
+	lc := LatencyCommand{subcommand: "LATEST"}
+	assert.Equal(t, "*1\r\n*4\r\n$7\r\ncommand\r\n:1700000001\r\n:200\r\n:300", lc.Execute(srv, cl))
+
+	hc := LatencyCommand{subcommand: "HISTORY", events: []string{"command"}}
+	assert.Equal(t, "*2\r\n*2\r\n:1700000000\r\n:300\r\n*2\r\n:1700000001\r\n:200", hc.Execute(srv, cl))
+
+	hc.events = []string{"rehash"}
+	assert.Equal(t, "*0", hc.Execute(srv, cl))
+}
+
+func TestCommandLatencyGraph(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	gc := LatencyCommand{subcommand: "GRAPH", events: []string{"command"}}
+	assert.Equal(t, "-ERR No samples available for event 'command'", gc.Execute(srv, cl))
+
+	srv.latency.add("command", time.Now(), 300*time.Millisecond)
+	assert.True(t, strings.HasPrefix(gc.Execute(srv, cl), "$"))
+}
+
+func TestCommandLatencyReset(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.latency.add("command", time.Now(), 300*time.Millisecond)
+
+	rc := LatencyCommand{subcommand: "RESET"}
+	assert.Equal(t, ":1", rc.Execute(srv, cl))
+	assert.Equal(t, ":0", rc.Execute(srv, cl))
+}
+
+func TestLatencyReadParamsReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	lc := NewLatencyCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("reset", nil)
+	mrr.EXPECT().ReadBulkString().Return("command", nil)
+	mrr.EXPECT().ReadBulkString().Return("rehash", nil)
+	assert.Nil(t, lc.ReadParams(3))
+	assert.Equal(t, "RESET", lc.subcommand)
+	assert.Equal(t, []string{"command", "rehash"}, lc.events)
+}
+
+func TestLatencyReadParamsHistoryLenError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	lc := NewLatencyCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("history", nil)
+	assert.NotNil(t, lc.ReadParams(1))
+}
+
+func TestLatencyReadParamsUnknownSubcommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	lc := NewLatencyCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("foo", nil)
+	assert.NotNil(t, lc.ReadParams(1))
+}
@@ -0,0 +1,97 @@
+package redis_go
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyMonitorAdd(t *testing.T) {
+	m := newLatencyMonitor()
+	now := time.Unix(1700000000, 0)
+
+	m.add("command", now, 120*time.Millisecond)
+	m.add("command", now, 300*time.Millisecond)
+	m.add("command", now, 200*time.Millisecond)
+	m.add("command", now.Add(time.Second), 150*time.Millisecond)
+
+	e := m.events["command"]
+	assert.Equal(t, []latencySample{
+		{time: 1700000000, latency: 300},
+		{time: 1700000001, latency: 150},
+	}, e.samples)
+	assert.Equal(t, int64(300), e.max)
+}
+
+func TestLatencyMonitorHistoryBounded(t *testing.T) {
+	m := newLatencyMonitor()
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < latencyHistoryLen+10; i++ {
+		m.add("command", now.Add(time.Duration(i)*time.Second), time.Duration(i)*time.Millisecond)
+	}
+
+	e := m.events["command"]
+	assert.Equal(t, latencyHistoryLen, len(e.samples))
+	assert.Equal(t, int64(10), e.samples[0].latency)
+}
+
+func TestLatencyMonitorReset(t *testing.T) {
+	m := newLatencyMonitor()
+	now := time.Now()
+	m.add("command", now, time.Second)
+	m.add("expire-cycle", now, time.Second)
+	m.add("rehash", now, time.Second)
+
+	assert.Equal(t, 1, m.reset([]string{"rehash", "nosuchevent"}))
+	assert.Equal(t, []string{"command", "expire-cycle"}, m.eventNames())
+	assert.Equal(t, 2, m.reset(nil))
+	assert.Empty(t, m.eventNames())
+}
+
+func TestLatencyEventGraph(t *testing.T) {
+	m := newLatencyMonitor()
+	now := time.Unix(1700000000, 0)
+	m.add("command", now.Add(-120*time.Second), 100*time.Millisecond)
+	m.add("command", now.Add(-5*time.Second), 500*time.Millisecond)
+	m.add("command", now, 300*time.Millisecond)
+
+	lines := strings.Split(m.events["command"].graph("command", now), "\n")
+	assert.Equal(t, "command - high 500 ms, low 100 ms (all time high 500 ms)", lines[0])
+	assert.Equal(t, strings.Repeat("-", 80), lines[1])
+	assert.Equal(t, []string{" #", " |", " |#", "_||", "", "250", "mss", ""}, lines[2:])
+}
+
+func TestFormatAge(t *testing.T) {
+	assert.Equal(t, "5s", formatAge(5))
+	assert.Equal(t, "2m", formatAge(150))
+	assert.Equal(t, "3h", formatAge(3*3600+10))
+	assert.Equal(t, "2d", formatAge(2*86400))
+}
+
+func TestLatencyDoctor(t *testing.T) {
+	m := newLatencyMonitor()
+	assert.Contains(t, m.doctor(0), "Latency monitoring is disabled")
+	assert.Contains(t, m.doctor(100), "no latency spike was observed")
+
+	now := time.Unix(1700000000, 0)
+	m.add("command", now, 100*time.Millisecond)
+	m.add("command", now.Add(10*time.Second), 300*time.Millisecond)
+	report := m.doctor(100)
+	assert.Contains(t, report, "1. command: 2 latency spikes (average 200ms, "+
+		"mean deviation 100ms, period 5.00 sec). Worst all time event 300ms.")
+	assert.Contains(t, report, "SLOWLOG GET")
+}
+
+func TestServerLatencyAddSampleIfNeeded(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.latencyAddSampleIfNeeded(latencyEventCommand, time.Second)
+	assert.Empty(t, srv.latency.events)
+
+	srv.config.LatencyMonitorThreshold = 100
+	srv.latencyAddSampleIfNeeded(latencyEventCommand, 50*time.Millisecond)
+	assert.Empty(t, srv.latency.events)
+	srv.latencyAddSampleIfNeeded(latencyEventCommand, 150*time.Millisecond)
+	assert.Equal(t, int64(150), srv.latency.events[latencyEventCommand].max)
+}
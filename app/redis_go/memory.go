@@ -0,0 +1,178 @@
+package redis_go
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// memoryDoctorMinMemory is the heap below which MEMORY DOCTOR has too
+// little to go on.
+const memoryDoctorMinMemory = 5 << 20
+
+type dbMemoryStats struct {
+	index        int
+	mainOverhead int64
+	expOverhead  int64
+}
+
+// memoryStats breaks down the memory in use. The totals come from the Go
+// runtime, while the dataset and overheads are estimated from the keyspace
+// and the client buffers.
+type memoryStats struct {
+	peak        uint64
+	total       uint64
+	startup     uint64
+	heapSys     uint64
+	clients     int64
+	clientCount int
+	dbs         []dbMemoryStats
+	overhead    int64
+	keys        int
+	dataset     int64
+	// scripts are the scripts in the cache of EVAL
+	scripts int
+}
+
+func (s *Server) memoryStats() memoryStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc > s.peakMemory {
+		s.peakMemory = ms.HeapAlloc
+	}
+
+	st := memoryStats{
+		peak:     s.peakMemory,
+		total:    ms.HeapAlloc,
+		startup:  s.startupMemory,
+		heapSys:  ms.HeapSys,
+		overhead: int64(s.startupMemory),
+		scripts:  len(s.scripts.scripts),
+	}
+
+	for _, c := range s.Clients() {
+		st.clients += int64(c.MemoryUsage())
+		st.clientCount++
+	}
+	st.overhead += st.clients
+
+	for i, db := range s.dbs {
+		st.keys += db.Size()
+		st.dataset += db.Memory()
+		if db.Size() == 0 {
+			continue
+		}
+		d := dbMemoryStats{
+			index:        i,
+			mainOverhead: db.data.Overhead(),
+			expOverhead:  db.expires.Overhead(),
+		}
+		st.overhead += d.mainOverhead + d.expOverhead
+		st.dbs = append(st.dbs, d)
+	}
+	return st
+}
+
+// netMemory is the memory used since startup.
+func (st memoryStats) netMemory() uint64 {
+	if st.total < st.startup {
+		return 0
+	}
+	return st.total - st.startup
+}
+
+func (st memoryStats) fragmentation() float64 {
+	if st.total == 0 {
+		return 0
+	}
+	return float64(st.heapSys) / float64(st.total)
+}
+
+func (st memoryStats) encode() string {
+	elems := []string{
+		encodeBulkString("peak.allocated"), encodeInt(int(st.peak)),
+		encodeBulkString("total.allocated"), encodeInt(int(st.total)),
+		encodeBulkString("startup.allocated"), encodeInt(int(st.startup)),
+		// there is no replication or AOF yet
+		encodeBulkString("replication.backlog"), encodeInt(0),
+		encodeBulkString("clients.slaves"), encodeInt(0),
+		encodeBulkString("clients.normal"), encodeInt(int(st.clients)),
+		encodeBulkString("aof.buffer"), encodeInt(0),
+		encodeBulkString("lua.caches"), encodeInt(st.scripts),
+	}
+	for _, d := range st.dbs {
+		elems = append(elems,
+			encodeBulkString("db."+strconv.Itoa(d.index)),
+			encodeArray([]string{
+				encodeBulkString("overhead.hashtable.main"), encodeInt(int(d.mainOverhead)),
+				encodeBulkString("overhead.hashtable.expires"), encodeInt(int(d.expOverhead)),
+			}))
+	}
+
+	perKey, datasetPct, peakPct := 0.0, 0.0, 0.0
+	if st.keys > 0 {
+		perKey = float64(st.netMemory()) / float64(st.keys)
+	}
+	if st.netMemory() > 0 {
+		datasetPct = float64(st.dataset) * 100 / float64(st.netMemory())
+	}
+	if st.peak > 0 {
+		peakPct = float64(st.total) * 100 / float64(st.peak)
+	}
+
+	elems = append(elems,
+		encodeBulkString("overhead.total"), encodeInt(int(st.overhead)),
+		encodeBulkString("keys.count"), encodeInt(st.keys),
+		encodeBulkString("keys.bytes-per-key"), encodeInt(int(perKey)),
+		encodeBulkString("dataset.bytes"), encodeInt(int(st.dataset)),
+		encodeBulkString("dataset.percentage"), encodeBulkString(formatFloat(datasetPct)),
+		encodeBulkString("peak.percentage"), encodeBulkString(formatFloat(peakPct)),
+		encodeBulkString("fragmentation"), encodeBulkString(formatFloat(st.fragmentation())),
+	)
+	return encodeArray(elems)
+}
+
+// doctor looks for the usual causes of memory bloat and describes them.
+func (st memoryStats) doctor() string {
+	if st.total < memoryDoctorMinMemory {
+		return "Hi Sam, this instance is empty or is using very little memory, " +
+			"my issues detector can't be used in these conditions. " +
+			"Please, leave for your mission on Earth and fill it with some data. " +
+			"The new Sam and I will be back to our programming as soon as I " +
+			"finished rebooting."
+	}
+
+	var issues []string
+	if float64(st.peak) > float64(st.total)*1.5 {
+		issues = append(issues, fmt.Sprintf(" * Peak memory: In the past this "+
+			"instance used more than 150%% the memory that is currently using "+
+			"(%d bytes at peak, %d bytes now). The Go runtime may not return "+
+			"the freed memory to the operating system right away, so the "+
+			"process can look bigger than the dataset.", st.peak, st.total))
+	}
+	if st.fragmentation() > 1.4 {
+		issues = append(issues, fmt.Sprintf(" * High fragmentation: This "+
+			"instance has a memory fragmentation greater than 1.4 (this means "+
+			"that the heap reserved from the operating system is %.2f times "+
+			"the memory in use).", st.fragmentation()))
+	}
+	if st.clientCount > 0 && st.clients/int64(st.clientCount) > 200*1024 {
+		issues = append(issues, fmt.Sprintf(" * Big client buffers: The "+
+			"clients output buffers are in general too big, on average each "+
+			"client uses %d bytes. Large replies, such as KEYS or big MGET "+
+			"results, are the usual cause.", st.clients/int64(st.clientCount)))
+	}
+
+	if len(issues) == 0 {
+		return "Hi Sam, I can't find any memory issue in your instance. " +
+			"I can only account for what occurs on this base."
+	}
+	return "Sam, I detected a few issues in this instance memory " +
+		"implementation:\n\n" + strings.Join(issues, "\n\n") +
+		"\n\nI'm here to keep you safe, Sam. I want to help you."
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
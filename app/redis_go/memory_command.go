@@ -0,0 +1,96 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+type MemoryCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	key        string
+	samples    int
+}
+
+func NewMemoryCommand(rr RespReader) *MemoryCommand {
+	return &MemoryCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *MemoryCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	switch c.subcommand {
+	case "STATS", "DOCTOR":
+		if len != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		return nil
+	case "USAGE":
+		return c.readUsageParams(len - 1)
+	}
+	return fmt.Errorf("unknown subcommand '%s'", sub)
+}
+
+func (c *MemoryCommand) readUsageParams(len int) (err error) {
+	if len != 1 && len != 3 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	key, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.key = key
+
+	if len == 1 {
+		return nil
+	}
+	opt, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	if strings.ToUpper(opt) != "SAMPLES" {
+		return fmt.Errorf("syntax error")
+	}
+	val, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.samples, err = strconv.Atoi(val)
+	if err != nil || c.samples < 0 {
+		return fmt.Errorf("value is out of range, must be positive")
+	}
+	return nil
+}
+
+func (c *MemoryCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "STATS":
+		return srv.memoryStats().encode()
+	case "DOCTOR":
+		return encodeBulkString(srv.memoryStats().doctor())
+	}
+
+	// SAMPLES bounds the elements looked at to estimate the size of a
+	// collection. The keyspace only holds strings so far, and their size
+	// is always exact.
+	o, ok := srv.Db(cl).Object(c.key)
+	if !ok {
+		return "$-1"
+	}
+	return encodeInt(int(o.size(c.key)))
+}
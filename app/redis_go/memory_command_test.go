@@ -0,0 +1,104 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"strings"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandMemoryUsage(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+
+	mc := MemoryCommand{subcommand: "USAGE", key: "hello"}
+	assert.Equal(t, encodeInt(int(objectOverhead)+10), mc.Execute(srv, cl))
+
+	srv.Db(cl).Set("hello", strings.Repeat("x", 1000))
+	assert.Equal(t, encodeInt(int(objectOverhead)+1005), mc.Execute(srv, cl))
+}
+
+func TestCommandMemoryUsageMissingKey(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MemoryCommand{subcommand: "USAGE", key: "hello"}
+	assert.Equal(t, "$-1", mc.Execute(srv, cl))
+}
+
+func TestCommandMemoryStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MemoryCommand{subcommand: "STATS"}
+	assert.True(t, strings.HasPrefix(mc.Execute(srv, cl), "*30\r\n$14\r\npeak.allocated\r\n"))
+}
+
+func TestCommandMemoryDoctor(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MemoryCommand{subcommand: "DOCTOR"}
+	assert.True(t, strings.HasPrefix(mc.Execute(srv, cl), "$"))
+}
+
+func TestMemoryReadParamsUsage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMemoryCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("usage", nil)
+	mrr.EXPECT().ReadBulkString().Return("hello", nil)
+	mrr.EXPECT().ReadBulkString().Return("samples", nil)
+	mrr.EXPECT().ReadBulkString().Return("0", nil)
+	assert.Nil(t, mc.ReadParams(4))
+	assert.Equal(t, "USAGE", mc.subcommand)
+	assert.Equal(t, "hello", mc.key)
+	assert.Equal(t, 0, mc.samples)
+}
+
+func TestMemoryReadParamsUsageSamplesError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMemoryCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("usage", nil)
+	mrr.EXPECT().ReadBulkString().Return("hello", nil)
+	mrr.EXPECT().ReadBulkString().Return("samples", nil)
+	mrr.EXPECT().ReadBulkString().Return("-1", nil)
+	assert.NotNil(t, mc.ReadParams(4))
+}
+
+func TestMemoryReadParamsUsageSyntaxError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMemoryCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("usage", nil)
+	mrr.EXPECT().ReadBulkString().Return("hello", nil)
+	mrr.EXPECT().ReadBulkString().Return("count", nil)
+	assert.NotNil(t, mc.ReadParams(4))
+}
+
+func TestMemoryReadParamsStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMemoryCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("stats", nil)
+	assert.Nil(t, mc.ReadParams(1))
+	assert.Equal(t, "STATS", mc.subcommand)
+}
+
+func TestMemoryReadParamsUnknownSubcommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mc := NewMemoryCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("purge", nil)
+	assert.NotNil(t, mc.ReadParams(1))
+}
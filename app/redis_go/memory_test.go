@@ -0,0 +1,86 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerMemoryStats(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	cl.OutputBufPeak = 10
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{cl}})
+
+	srv.dbs[0].Set("hello", "world")
+	srv.dbs[2].Set("foo", "bar")
+	srv.dbs[2].SetExpire("foo", time.Now().Add(time.Minute))
+	handle(srv, cl, "SCRIPT", "LOAD", "return 1")
+
+	st := srv.memoryStats()
+	assert.Equal(t, 2, st.keys)
+	assert.Equal(t, 1, st.scripts)
+	assert.Equal(t, srv.UsedMemory(), st.dataset)
+	assert.Equal(t, int64(cl.MemoryUsage()), st.clients)
+	assert.GreaterOrEqual(t, st.peak, st.total)
+
+	assert.Equal(t, 2, len(st.dbs))
+	assert.Equal(t, 0, st.dbs[0].index)
+	assert.Equal(t, 2, st.dbs[1].index)
+	assert.Equal(t, srv.dbs[2].expires.Overhead(), st.dbs[1].expOverhead)
+
+	overhead := int64(st.startup) + st.clients
+	for _, d := range st.dbs {
+		overhead += d.mainOverhead + d.expOverhead
+	}
+	assert.Equal(t, overhead, st.overhead)
+}
+
+func TestMemoryStatsEncode(t *testing.T) {
+	st := memoryStats{
+		peak:    2000,
+		total:   1000,
+		startup: 500,
+		heapSys: 1500,
+		keys:    10,
+		dataset: 250,
+		dbs:     []dbMemoryStats{{index: 3, mainOverhead: 40, expOverhead: 20}},
+		scripts: 2,
+	}
+	reply := st.encode()
+
+	assert.True(t, strings.HasPrefix(reply, "*32\r\n$14\r\npeak.allocated\r\n:2000\r\n"))
+	assert.Contains(t, reply, "$4\r\ndb.3\r\n*4\r\n$23\r\noverhead.hashtable.main\r\n:40\r\n$26\r\noverhead.hashtable.expires\r\n:20")
+	assert.Contains(t, reply, "$10\r\nlua.caches\r\n:2\r\n")
+	assert.Contains(t, reply, "$18\r\nkeys.bytes-per-key\r\n:50")
+	assert.Contains(t, reply, "$18\r\ndataset.percentage\r\n$2\r\n50")
+	assert.Contains(t, reply, "$15\r\npeak.percentage\r\n$2\r\n50")
+	assert.Contains(t, reply, "$13\r\nfragmentation\r\n$3\r\n1.5")
+}
+
+func TestMemoryDoctorEmpty(t *testing.T) {
+	st := memoryStats{total: 1 << 20, peak: 10 << 20}
+	assert.Contains(t, st.doctor(), "using very little memory")
+}
+
+func TestMemoryDoctorNoIssues(t *testing.T) {
+	st := memoryStats{total: 10 << 20, peak: 10 << 20, heapSys: 11 << 20}
+	assert.Contains(t, st.doctor(), "I can't find any memory issue")
+}
+
+func TestMemoryDoctorIssues(t *testing.T) {
+	st := memoryStats{
+		total:       10 << 20,
+		peak:        20 << 20,
+		heapSys:     20 << 20,
+		clients:     1 << 20,
+		clientCount: 2,
+	}
+	report := st.doctor()
+	assert.Contains(t, report, "Peak memory")
+	assert.Contains(t, report, "High fragmentation")
+	assert.Contains(t, report, "Big client buffers")
+}
@@ -0,0 +1,85 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addMonitor makes the client receive every command run from now on.
+func (s *Server) addMonitor(cl *ev.Client) {
+	if cl.Monitor {
+		return
+	}
+	cl.Monitor = true
+	s.monitors = append(s.monitors, cl)
+}
+
+// feedMonitors pushes a command that ran on db to the monitor clients, in
+// the format of MONITOR.
+func (s *Server) feedMonitors(c Command, cl *ev.Client, db int, start time.Time) {
+	if len(s.monitors) == 0 || c.Spec() == nil || c.Spec().Is(CmdAdmin) {
+		return
+	}
+
+	line := monitorLine(c.Argv(), cl, db, start)
+	monitors := s.monitors[:0]
+	for _, m := range s.monitors {
+		if m.Closed() {
+			continue
+		}
+		monitors = append(monitors, m)
+		m.Push(line)
+	}
+	s.monitors = monitors
+}
+
+func monitorLine(argv []string, cl *ev.Client, db int, start time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "+%d.%06d [%d %s]", start.Unix(), start.Nanosecond()/1000, db, cl.Addr)
+	for _, arg := range argv {
+		sb.WriteString(" ")
+		sb.WriteString(reprString(arg))
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+// reprString quotes s, escaping the quotes, backslashes and any byte that
+// is not printable, so that binary arguments fit on a single line.
+func reprString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch b {
+		case '\\', '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case '\n':
+			sb.WriteString("\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case '\t':
+			sb.WriteString("\\t")
+		case '\a':
+			sb.WriteString("\\a")
+		case '\b':
+			sb.WriteString("\\b")
+		default:
+			if b < 0x20 || b > 0x7e {
+				sb.WriteString("\\x")
+				if b < 0x10 {
+					sb.WriteByte('0')
+				}
+				sb.WriteString(strconv.FormatUint(uint64(b), 16))
+			} else {
+				sb.WriteByte(b)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
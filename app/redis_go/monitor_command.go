@@ -0,0 +1,28 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+)
+
+type MonitorCommand struct {
+	BaseCommand
+}
+
+func NewMonitorCommand() *MonitorCommand {
+	return &MonitorCommand{
+		BaseCommand: NewBaseCommand(),
+	}
+}
+
+func (c *MonitorCommand) ReadParams(len int) error {
+	if len != 0 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	return nil
+}
+
+func (c *MonitorCommand) Execute(srv *Server, cl *ev.Client) string {
+	srv.addMonitor(cl)
+	return "+OK"
+}
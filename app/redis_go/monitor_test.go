@@ -0,0 +1,49 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReprString(t *testing.T) {
+	assert.Equal(t, `"hello"`, reprString("hello"))
+	assert.Equal(t, `"a \"b\" \\c"`, reprString(`a "b" \c`))
+	assert.Equal(t, `"\r\n\t\x00\x7f\xff"`, reprString("\r\n\t\x00\x7f\xff"))
+}
+
+func TestMonitorLine(t *testing.T) {
+	cl := ev.NewClient(2)
+	cl.Addr = "127.0.0.1:5000"
+	line := monitorLine([]string{"SET", "hello", "wor\"ld"}, cl, 5, time.Unix(1700000000, 1500))
+	assert.Equal(t, "+1700000000.000001 [5 127.0.0.1:5000] \"SET\" \"hello\" \"wor\\\"ld\"\r\n", line)
+}
+
+func TestServerFeedMonitors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	monitor := ev.NewClient(1)
+	srv.addMonitor(monitor)
+	srv.addMonitor(monitor)
+	assert.True(t, monitor.Monitor)
+	assert.Equal(t, 1, len(srv.monitors))
+
+	cl := ev.NewClient(2)
+	handle(srv, cl, "SET", "hello", "world")
+	fed := monitor.PendingOutput()
+	assert.Equal(t, len(monitorLine([]string{"SET", "hello", "world"}, cl, 0, time.Now())), fed)
+
+	// admin commands are not shown
+	handle(srv, cl, "CONFIG", "RESETSTAT")
+	assert.Equal(t, fed, monitor.PendingOutput())
+}
+
+func TestCommandMonitor(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	mc := MonitorCommand{}
+	assert.Equal(t, "+OK", mc.Execute(srv, cl))
+	assert.True(t, cl.Monitor)
+}
@@ -0,0 +1,89 @@
+package redis_go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The classes of keyspace events, enabled by the characters of
+// notify-keyspace-events in the order of keyspaceEventChars.
+const (
+	notifyGeneric = 1 << iota
+	notifyString
+	notifyList
+	notifySet
+	notifyHash
+	notifyZset
+	notifyExpired
+	notifyEvicted
+	notifyStream
+	notifyModule
+	notifyKeyspace
+	notifyKeyevent
+	notifyKeyMiss
+	notifyNew
+
+	// notifyAll is what A stands for, leaving out the key misses and the
+	// new keys as redis does
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZset | notifyExpired | notifyEvicted | notifyStream | notifyModule
+)
+
+// keyspaceEventChars are the characters of the classes, at the position
+// of their bit.
+const keyspaceEventChars = "g$lshzxetdKEmn"
+
+// parseKeyspaceEvents parses a value of notify-keyspace-events.
+func parseKeyspaceEvents(s string) (int, error) {
+	flags := 0
+	for _, c := range s {
+		if c == 'A' {
+			flags |= notifyAll
+			continue
+		}
+		i := strings.IndexRune(keyspaceEventChars, c)
+		if i < 0 {
+			return 0, fmt.Errorf("Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+		}
+		flags |= 1 << i
+	}
+	return flags, nil
+}
+
+// formatKeyspaceEvents is the inverse of parseKeyspaceEvents, using A
+// when it can.
+func formatKeyspaceEvents(flags int) string {
+	var sb strings.Builder
+	for i := 0; i < len(keyspaceEventChars); i++ {
+		bit := 1 << i
+		if bit&notifyAll != 0 && flags&notifyAll == notifyAll {
+			if bit == notifyGeneric {
+				sb.WriteByte('A')
+			}
+			continue
+		}
+		if flags&bit != 0 {
+			sb.WriteByte(keyspaceEventChars[i])
+		}
+	}
+	return sb.String()
+}
+
+// notifyKeyspaceEvent publishes an event of the class to key in the db
+// numbered dbid, when notify-keyspace-events enables the class: the event
+// goes to the __keyspace@<db>__:<key> channel with K, and the key to the
+// __keyevent@<db>__:<event> channel with E.
+func (s *Server) notifyKeyspaceEvent(class int, event string, key string, dbid int) {
+	flags := s.config.NotifyKeyspaceEvents
+	if flags&class == 0 {
+		return
+	}
+	db := strconv.Itoa(dbid)
+	if flags&notifyKeyspace != 0 {
+		s.publish("__keyspace@"+db+"__:"+key, event)
+	}
+	if flags&notifyKeyevent != 0 {
+		s.publish("__keyevent@"+db+"__:"+event, key)
+	}
+}
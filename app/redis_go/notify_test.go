@@ -0,0 +1,122 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyspaceEvents(t *testing.T) {
+	flags, err := parseKeyspaceEvents("KEA")
+	assert.Nil(t, err)
+	assert.Equal(t, notifyKeyspace|notifyKeyevent|notifyAll, flags)
+	assert.Equal(t, "AKE", formatKeyspaceEvents(flags))
+
+	flags, err = parseKeyspaceEvents("Ex$gmn")
+	assert.Nil(t, err)
+	assert.Equal(t, notifyKeyevent|notifyExpired|notifyString|notifyGeneric|notifyKeyMiss|notifyNew, flags)
+	assert.Equal(t, "g$xEmn", formatKeyspaceEvents(flags))
+
+	flags, err = parseKeyspaceEvents("")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, flags)
+	assert.Equal(t, "", formatKeyspaceEvents(0))
+
+	_, err = parseKeyspaceEvents("KEq")
+	assert.EqualError(t, err, "Invalid event class character. Use 'Ag$lshzxeKEtmdn'.")
+}
+
+// notifications subscribes a client to all the keyspace events of every
+// db, and returns it along with the length of the messages for event on
+// key.
+func notifications(srv *Server) (*ev.Client, func(event string, key string, db int) int) {
+	cl := ev.NewClient(100)
+	srv.subscribe(cl, "__key*__:*", true)
+	return cl, func(event string, key string, db int) int {
+		id := strconv.Itoa(db)
+		space := "__keyspace@" + id + "__:" + key
+		evt := "__keyevent@" + id + "__:" + event
+		return len(encodeBulkStrings([]string{"pmessage", "__key*__:*", space, event})+"\r\n") +
+			len(encodeBulkStrings([]string{"pmessage", "__key*__:*", evt, key})+"\r\n")
+	}
+}
+
+func TestServerNotifyKeyspaceEvent(t *testing.T) {
+	srv := NewServer(NewConfig())
+	space := ev.NewClient(1)
+	event := ev.NewClient(2)
+	srv.subscribe(space, "__keyspace@0__:k", false)
+	srv.subscribe(event, "__keyevent@0__:set", false)
+
+	// disabled by default
+	srv.notifyKeyspaceEvent(notifyString, "set", "k", 0)
+	assert.Equal(t, 0, space.PendingOutput()+event.PendingOutput())
+
+	srv.config.NotifyKeyspaceEvents = notifyKeyspace | notifyString
+	srv.notifyKeyspaceEvent(notifyGeneric, "expire", "k", 0)
+	assert.Equal(t, 0, space.PendingOutput())
+	srv.notifyKeyspaceEvent(notifyString, "set", "k", 0)
+	assert.Equal(t, len("*3\r\n$7\r\nmessage\r\n$16\r\n__keyspace@0__:k\r\n$3\r\nset\r\n"), space.PendingOutput())
+	assert.Equal(t, 0, event.PendingOutput())
+
+	srv.config.NotifyKeyspaceEvents = notifyKeyevent | notifyAll
+	srv.notifyKeyspaceEvent(notifyString, "set", "k", 0)
+	assert.Equal(t, len("*3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:set\r\n$1\r\nk\r\n"), event.PendingOutput())
+}
+
+func TestKeyspaceEventsOfCommands(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.config.NotifyKeyspaceEvents = notifyKeyspace | notifyKeyevent | notifyAll | notifyKeyMiss | notifyNew
+	sub, size := notifications(srv)
+	cl := ev.NewClient(1)
+
+	handle(srv, cl, "SET", "k", "v")
+	want := size("new", "k", 0) + size("set", "k", 0)
+	assert.Equal(t, want, sub.PendingOutput())
+
+	handle(srv, cl, "SET", "k", "v", "PX", "100")
+	want += size("set", "k", 0) + size("expire", "k", 0)
+	assert.Equal(t, want, sub.PendingOutput())
+
+	handle(srv, cl, "GET", "missing")
+	want += size("keymiss", "missing", 0)
+	assert.Equal(t, want, sub.PendingOutput())
+
+	handle(srv, cl, "MOVE", "k", "3")
+	want += size("new", "k", 3) + size("move_from", "k", 0) + size("move_to", "k", 3)
+	assert.Equal(t, want, sub.PendingOutput())
+}
+
+func TestKeyspaceEventsOfExpiry(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.config.NotifyKeyspaceEvents = notifyKeyspace | notifyKeyevent | notifyExpired
+	sub, size := notifications(srv)
+
+	db := srv.dbs[2]
+	db.Set("k", "v")
+	db.SetExpire("k", time.Now().Add(-time.Second))
+	db.ActiveExpire(time.Now().Add(time.Second))
+	assert.Equal(t, size("expired", "k", 2), sub.PendingOutput())
+
+	// the events follow the number of the db once swapped
+	srv.dbs[2].Set("j", "v")
+	srv.dbs[2].SetExpire("j", time.Now().Add(-time.Second))
+	srv.SwapDb(2, 5)
+	assert.False(t, srv.dbs[5].Exists("j"))
+	assert.Equal(t, size("expired", "k", 2)+size("expired", "j", 5), sub.PendingOutput())
+}
+
+func TestKeyspaceEventsOfEviction(t *testing.T) {
+	srv := newEvictionServer(PolicyAllKeysRandom)
+	srv.config.NotifyKeyspaceEvents = notifyKeyevent | notifyEvicted
+	sub := ev.NewClient(100)
+	srv.subscribe(sub, "__keyevent@0__:evicted", false)
+	srv.dbs[0].Set("k", "v")
+	srv.config.MaxMemory = 1
+
+	srv.freeMemoryIfNeeded()
+	assert.Equal(t, len("*3\r\n$7\r\nmessage\r\n$22\r\n__keyevent@0__:evicted\r\n$1\r\nk\r\n"), sub.PendingOutput())
+}
@@ -0,0 +1,95 @@
+package redis_go
+
+import (
+	"time"
+	"unsafe"
+)
+
+const (
+	lfuInitVal = 5
+	// lfuLogFactor makes the counter grow logarithmically, it takes about
+	// a million accesses to saturate it.
+	lfuLogFactor = 10
+	// lfuDecayMinutes is how long a key has to go without access to have
+	// its counter decremented by one.
+	lfuDecayMinutes = 1
+)
+
+// Object is a value in the keyspace, along with the access information
+// that eviction uses to pick keys.
+type Object struct {
+	value string
+	// access is the unix time of the last access, in milliseconds
+	access int64
+	// freq is a logarithmic access counter, see touch
+	freq uint8
+	// freqTime is the unix time in minutes freq was last decremented
+	freqTime int64
+}
+
+// The sizes of the allocations backing a key, on top of the bytes of the
+// key and value themselves.
+var (
+	objectOverhead = int64(unsafe.Sizeof(dictEntry[*Object]{}) + unsafe.Sizeof(Object{}))
+	expireOverhead = int64(unsafe.Sizeof(dictEntry[time.Time]{}))
+)
+
+func NewObject(value string) *Object {
+	now := time.Now()
+	return &Object{
+		value:    value,
+		access:   now.UnixMilli(),
+		freq:     lfuInitVal,
+		freqTime: now.Unix() / 60,
+	}
+}
+
+// size estimates the memory used to store the object under key.
+func (o *Object) size(key string) int64 {
+	return objectOverhead + int64(len(key)+len(o.value))
+}
+
+func (o *Object) touch() {
+	now := time.Now()
+	o.access = now.UnixMilli()
+	o.freq = lfuLogIncr(o.decayedFreq(now))
+	o.freqTime = now.Unix() / 60
+}
+
+// IdleTime is the time since the object was last accessed.
+func (o *Object) IdleTime() time.Duration {
+	return time.Since(time.UnixMilli(o.access))
+}
+
+// Freq returns the access counter after applying the decay for the time
+// since it was last updated.
+func (o *Object) Freq() uint8 {
+	return o.decayedFreq(time.Now())
+}
+
+func (o *Object) decayedFreq(now time.Time) uint8 {
+	periods := (now.Unix()/60 - o.freqTime) / lfuDecayMinutes
+	if periods <= 0 {
+		return o.freq
+	}
+	if periods >= int64(o.freq) {
+		return 0
+	}
+	return o.freq - uint8(periods)
+}
+
+// lfuLogIncr increments the counter with a probability that gets lower as
+// the counter grows, so 8 bits are enough to tell hot keys from cold ones.
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if random.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
@@ -0,0 +1,67 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strings"
+)
+
+type ObjectCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	key        string
+}
+
+func NewObjectCommand(rr RespReader) *ObjectCommand {
+	return &ObjectCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ObjectCommand) ReadParams(len int) (err error) {
+	if len != 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	switch c.subcommand {
+	case "FREQ", "IDLETIME":
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+
+	key, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.key = key
+	return nil
+}
+
+func (c *ObjectCommand) Execute(srv *Server, cl *ev.Client) string {
+	o, ok := srv.Db(cl).Object(c.key)
+	if !ok {
+		return "$-1"
+	}
+
+	lfu := isLfuPolicy(srv.config.MaxMemoryPolicy)
+	switch c.subcommand {
+	case "FREQ":
+		if !lfu {
+			return "-ERR An LFU maxmemory policy is not selected, access frequency not tracked."
+		}
+		return encodeInt(int(o.Freq()))
+	default:
+		if lfu {
+			return "-ERR An LRU maxmemory policy is selected, object idle time not tracked."
+		}
+		return encodeInt(int(o.IdleTime().Seconds()))
+	}
+}
@@ -0,0 +1,95 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandObjectIdleTime(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+	o, _ := srv.Db(cl).Object("hello")
+	o.access -= 3000
+
+	oc := ObjectCommand{subcommand: "IDLETIME", key: "hello"}
+	assert.Equal(t, ":3", oc.Execute(srv, cl))
+	// OBJECT itself does not count as an access
+	assert.Equal(t, ":3", oc.Execute(srv, cl))
+}
+
+func TestCommandObjectIdleTimeLfu(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MaxMemoryPolicy = PolicyAllKeysLfu
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+
+	oc := ObjectCommand{subcommand: "IDLETIME", key: "hello"}
+	assert.Equal(t,
+		"-ERR An LRU maxmemory policy is selected, object idle time not tracked.",
+		oc.Execute(srv, cl))
+}
+
+func TestCommandObjectFreq(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MaxMemoryPolicy = PolicyVolatileLfu
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+
+	oc := ObjectCommand{subcommand: "FREQ", key: "hello"}
+	assert.Equal(t, ":5", oc.Execute(srv, cl))
+}
+
+func TestCommandObjectFreqLru(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+
+	oc := ObjectCommand{subcommand: "FREQ", key: "hello"}
+	assert.Equal(t,
+		"-ERR An LFU maxmemory policy is not selected, access frequency not tracked.",
+		oc.Execute(srv, cl))
+}
+
+func TestCommandObjectMissingKey(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	oc := ObjectCommand{subcommand: "IDLETIME", key: "hello"}
+	assert.Equal(t, "$-1", oc.Execute(srv, cl))
+}
+
+func TestObjectReadParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	oc := NewObjectCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("freq", nil)
+	mrr.EXPECT().ReadBulkString().Return("hello", nil)
+	assert.Nil(t, oc.ReadParams(2))
+	assert.Equal(t, "FREQ", oc.subcommand)
+	assert.Equal(t, "hello", oc.key)
+}
+
+func TestObjectReadParamsUnknownSubcommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	oc := NewObjectCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("refcount", nil)
+	assert.NotNil(t, oc.ReadParams(2))
+}
+
+func TestObjectReadParamsLenError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	oc := NewObjectCommand(mrr)
+	assert.NotNil(t, oc.ReadParams(1))
+}
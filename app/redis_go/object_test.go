@@ -0,0 +1,47 @@
+package redis_go
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectTouch(t *testing.T) {
+	o := NewObject("value")
+	o.access -= 5000
+	assert.GreaterOrEqual(t, o.IdleTime(), 5*time.Second)
+
+	o.touch()
+	assert.Less(t, o.IdleTime(), time.Second)
+	assert.GreaterOrEqual(t, o.Freq(), uint8(lfuInitVal))
+}
+
+func TestObjectFreqDecays(t *testing.T) {
+	o := NewObject("value")
+	o.freq = 10
+	o.freqTime -= 3 * lfuDecayMinutes
+	assert.Equal(t, uint8(7), o.Freq())
+
+	o.freqTime -= 100 * lfuDecayMinutes
+	assert.Equal(t, uint8(0), o.Freq())
+}
+
+func TestLfuLogIncr(t *testing.T) {
+	// the counter always grows while below the initial value
+	assert.Equal(t, uint8(3), lfuLogIncr(2))
+	assert.Equal(t, uint8(255), lfuLogIncr(255))
+
+	var c uint8 = lfuInitVal
+	for i := 0; i < 1000; i++ {
+		c = lfuLogIncr(c)
+	}
+	// growth is logarithmic, a thousand hits come nowhere near saturating
+	assert.Greater(t, c, uint8(lfuInitVal))
+	assert.Less(t, c, uint8(100))
+}
+
+func TestObjectSize(t *testing.T) {
+	o := NewObject("value")
+	assert.Equal(t, objectOverhead+8, o.size("key"))
+}
@@ -0,0 +1,142 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"sort"
+)
+
+// pubsub holds the clients subscribed to each channel and to each
+// pattern, in the order they subscribed, which is the order messages are
+// delivered in.
+type pubsub struct {
+	channels map[string][]*ev.Client
+	patterns map[string][]*ev.Client
+}
+
+func newPubsub() *pubsub {
+	return &pubsub{
+		channels: map[string][]*ev.Client{},
+		patterns: map[string][]*ev.Client{},
+	}
+}
+
+// subscriptions is the number of channels and patterns the client is
+// subscribed to. A RESP2 client with any may only run the commands
+// flagged CmdSubscribed, as it could not tell the replies from the
+// messages.
+func subscriptions(cl *ev.Client) int {
+	return len(cl.Channels) + len(cl.Patterns)
+}
+
+// subscribe subscribes the client to channel, or to the pattern when
+// pattern is set, and reports whether it was not already.
+func (s *Server) subscribe(cl *ev.Client, channel string, pattern bool) bool {
+	subs, clients := &cl.Channels, s.pubsub.channels
+	if pattern {
+		subs, clients = &cl.Patterns, s.pubsub.patterns
+	}
+	if (*subs)[channel] {
+		return false
+	}
+	if *subs == nil {
+		*subs = map[string]bool{}
+	}
+	(*subs)[channel] = true
+	clients[channel] = append(clients[channel], cl)
+	return true
+}
+
+// unsubscribe undoes subscribe, and reports whether the client was
+// subscribed.
+func (s *Server) unsubscribe(cl *ev.Client, channel string, pattern bool) bool {
+	subs, clients := cl.Channels, s.pubsub.channels
+	if pattern {
+		subs, clients = cl.Patterns, s.pubsub.patterns
+	}
+	if !subs[channel] {
+		return false
+	}
+	delete(subs, channel)
+
+	list := clients[channel]
+	for i, c := range list {
+		if c == cl {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(clients, channel)
+	} else {
+		clients[channel] = list
+	}
+	return true
+}
+
+// subscribed returns the channels or the patterns the client is
+// subscribed to, sorted.
+func subscribed(cl *ev.Client, patterns bool) []string {
+	subs := cl.Channels
+	if patterns {
+		subs = cl.Patterns
+	}
+	res := make([]string, 0, len(subs))
+	for c := range subs {
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// publish sends the message to the clients subscribed to the channel and
+// to the ones subscribed to a matching pattern, and returns how many
+// messages were sent. A client subscribed to both gets the message once
+// for each.
+func (s *Server) publish(channel string, message string) int {
+	n := 0
+	for _, cl := range s.pubsub.channels[channel] {
+		cl.Push(encodePush(cl.Resp, []string{
+			encodeBulkString("message"), encodeBulkString(channel), encodeBulkString(message),
+		}) + "\r\n")
+		n++
+	}
+	for pattern, clients := range s.pubsub.patterns {
+		if !stringMatch(pattern, channel) {
+			continue
+		}
+		for _, cl := range clients {
+			cl.Push(encodePush(cl.Resp, []string{
+				encodeBulkString("pmessage"), encodeBulkString(pattern),
+				encodeBulkString(channel), encodeBulkString(message),
+			}) + "\r\n")
+			n++
+		}
+	}
+	return n
+}
+
+// ClientClosed forgets the subscriptions of a client once its connection
+// is closed, and turns its tracking off. It is meant to be called by the
+// event loop.
+func (s *Server) ClientClosed(cl *ev.Client) {
+	s.disableTracking(cl)
+	for _, c := range subscribed(cl, false) {
+		s.unsubscribe(cl, c, false)
+	}
+	for _, p := range subscribed(cl, true) {
+		s.unsubscribe(cl, p, true)
+	}
+}
+
+// activeChannels returns the channels with subscribers that match the
+// pattern, or all of them when it is empty, sorted.
+func (s *Server) activeChannels(pattern string) []string {
+	res := []string{}
+	for c := range s.pubsub.channels {
+		if pattern == "" || stringMatch(pattern, c) {
+			res = append(res, c)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,208 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strings"
+)
+
+// SubscribeCommand is SUBSCRIBE, or PSUBSCRIBE when patterns is set.
+type SubscribeCommand struct {
+	BaseCommand
+	reader   RespReader
+	patterns bool
+	channels []string
+}
+
+func NewSubscribeCommand(rr RespReader, patterns bool) *SubscribeCommand {
+	return &SubscribeCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		patterns:    patterns,
+	}
+}
+
+func (c *SubscribeCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	c.channels, err = readBulkStrings(c.reader, len)
+	return
+}
+
+// Execute replies with one confirmation for each channel, along with the
+// number of subscriptions of the client so far.
+func (c *SubscribeCommand) Execute(srv *Server, cl *ev.Client) string {
+	kind := "subscribe"
+	if c.patterns {
+		kind = "psubscribe"
+	}
+	replies := make([]string, len(c.channels))
+	for i, ch := range c.channels {
+		srv.subscribe(cl, ch, c.patterns)
+		replies[i] = subscriptionReply(kind, encodeBulkString(ch), cl)
+	}
+	return strings.Join(replies, "\r\n")
+}
+
+// UnsubscribeCommand is UNSUBSCRIBE, or PUNSUBSCRIBE when patterns is
+// set. Without arguments, it unsubscribes from all the channels or all
+// the patterns.
+type UnsubscribeCommand struct {
+	BaseCommand
+	reader   RespReader
+	patterns bool
+	channels []string
+}
+
+func NewUnsubscribeCommand(rr RespReader, patterns bool) *UnsubscribeCommand {
+	return &UnsubscribeCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		patterns:    patterns,
+	}
+}
+
+func (c *UnsubscribeCommand) ReadParams(len int) (err error) {
+	c.channels, err = readBulkStrings(c.reader, len)
+	return
+}
+
+func (c *UnsubscribeCommand) Execute(srv *Server, cl *ev.Client) string {
+	kind := "unsubscribe"
+	if c.patterns {
+		kind = "punsubscribe"
+	}
+	channels := c.channels
+	if len(channels) == 0 {
+		channels = subscribed(cl, c.patterns)
+		if len(channels) == 0 {
+			return subscriptionReply(kind, "$-1", cl)
+		}
+	}
+	replies := make([]string, len(channels))
+	for i, ch := range channels {
+		srv.unsubscribe(cl, ch, c.patterns)
+		replies[i] = subscriptionReply(kind, encodeBulkString(ch), cl)
+	}
+	return strings.Join(replies, "\r\n")
+}
+
+func subscriptionReply(kind string, channel string, cl *ev.Client) string {
+	return encodePush(cl.Resp, []string{encodeBulkString(kind), channel, encodeInt(subscriptions(cl))})
+}
+
+func readBulkStrings(rr RespReader, n int) ([]string, error) {
+	strs := make([]string, n)
+	for i := range strs {
+		s, err := rr.ReadBulkString()
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+type PublishCommand struct {
+	BaseCommand
+	reader  RespReader
+	channel string
+	message string
+}
+
+func NewPublishCommand(rr RespReader) *PublishCommand {
+	return &PublishCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *PublishCommand) ReadParams(len int) (err error) {
+	if len != 2 {
+		return fmt.Errorf("incorrect number of params")
+	}
+	c.channel, err = c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.message, err = c.reader.ReadBulkString()
+	return
+}
+
+func (c *PublishCommand) Execute(srv *Server, cl *ev.Client) string {
+	if srv.sentinel != nil {
+		// the other sentinels send their hello messages directly
+		if c.channel != sentinelHelloChannel {
+			return "-ERR Only HELLO messages are accepted by Sentinel instances."
+		}
+		srv.sentinelProcessHelloMessage(c.message)
+		return encodeInt(1)
+	}
+	return encodeInt(srv.publish(c.channel, c.message))
+}
+
+type PubsubCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+}
+
+func NewPubsubCommand(rr RespReader) *PubsubCommand {
+	return &PubsubCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *PubsubCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args, err = readBulkStrings(c.reader, len-1)
+	if err != nil {
+		return
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "CHANNELS":
+		if n > 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "NUMSUB":
+	case "NUMPAT":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+func (c *PubsubCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "CHANNELS":
+		pattern := ""
+		if len(c.args) == 1 {
+			pattern = c.args[0]
+		}
+		return encodeBulkStrings(srv.activeChannels(pattern))
+	case "NUMSUB":
+		elems := make([]string, 0, 2*len(c.args))
+		for _, ch := range c.args {
+			elems = append(elems, encodeBulkString(ch), encodeInt(len(srv.pubsub.channels[ch])))
+		}
+		return encodeArray(elems)
+	}
+	return encodeInt(len(srv.pubsub.patterns))
+}
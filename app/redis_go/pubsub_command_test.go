@@ -0,0 +1,61 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeCommand(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n",
+		handle(srv, cl, "SUBSCRIBE", "a", "b"))
+	assert.Equal(t, "*3\r\n$10\r\npsubscribe\r\n$2\r\nc*\r\n:3\r\n", handle(srv, cl, "PSUBSCRIBE", "c*"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "SUBSCRIBE"))
+
+	// only the pub/sub commands run once subscribed
+	assert.Equal(t, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET "+
+		"are allowed in this context\r\n", handle(srv, cl, "GET", "k"))
+	assert.Equal(t, int64(1), srv.stats.byCommand["get"].rejected)
+	assert.Equal(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n", handle(srv, cl, "PING"))
+
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:2\r\n", handle(srv, cl, "UNSUBSCRIBE", "b"))
+	assert.Equal(t, "*3\r\n$12\r\npunsubscribe\r\n$2\r\nc*\r\n:1\r\n", handle(srv, cl, "PUNSUBSCRIBE"))
+	assert.Equal(t, "*3\r\n$12\r\npunsubscribe\r\n$-1\r\n:1\r\n", handle(srv, cl, "PUNSUBSCRIBE"))
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:0\r\n", handle(srv, cl, "UNSUBSCRIBE"))
+	assert.Equal(t, "+PONG\r\n", handle(srv, cl, "PING"))
+}
+
+func TestPublishCommand(t *testing.T) {
+	srv := NewServer(NewConfig())
+	sub := ev.NewClient(1)
+	cl := ev.NewClient(2)
+	handle(srv, sub, "SUBSCRIBE", "news")
+	handle(srv, sub, "PSUBSCRIBE", "n*")
+
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "PUBLISH", "news", "hi"))
+	assert.Equal(t, ":0\r\n", handle(srv, cl, "PUBLISH", "other", "hi"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "PUBLISH", "news"))
+}
+
+func TestPubsubCommand(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	b := ev.NewClient(2)
+	handle(srv, a, "SUBSCRIBE", "news", "weather")
+	handle(srv, b, "SUBSCRIBE", "news")
+	handle(srv, b, "PSUBSCRIBE", "n*", "w*")
+	cl := ev.NewClient(3)
+
+	assert.Equal(t, "*2\r\n$4\r\nnews\r\n$7\r\nweather\r\n", handle(srv, cl, "PUBSUB", "CHANNELS"))
+	assert.Equal(t, "*1\r\n$7\r\nweather\r\n", handle(srv, cl, "PUBSUB", "channels", "w*"))
+	assert.Equal(t, "*4\r\n$4\r\nnews\r\n:2\r\n$5\r\nother\r\n:0\r\n", handle(srv, cl, "PUBSUB", "NUMSUB", "news", "other"))
+	assert.Equal(t, "*0\r\n", handle(srv, cl, "PUBSUB", "NUMSUB"))
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "PUBSUB", "NUMPAT"))
+
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "PUBSUB", "NUMPAT", "x"))
+	assert.Equal(t, "-ERR unknown subcommand 'nosuch'\r\n", handle(srv, cl, "PUBSUB", "nosuch"))
+}
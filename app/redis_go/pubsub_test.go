@@ -0,0 +1,71 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerSubscribe(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	b := ev.NewClient(2)
+
+	assert.True(t, srv.subscribe(a, "news", false))
+	assert.False(t, srv.subscribe(a, "news", false))
+	assert.True(t, srv.subscribe(b, "news", false))
+	assert.True(t, srv.subscribe(b, "news", true))
+	assert.Equal(t, []*ev.Client{a, b}, srv.pubsub.channels["news"])
+	assert.Equal(t, 2, subscriptions(b))
+
+	assert.True(t, srv.unsubscribe(a, "news", false))
+	assert.False(t, srv.unsubscribe(a, "news", false))
+	assert.False(t, srv.unsubscribe(b, "news", false) && srv.unsubscribe(b, "news", false))
+	assert.Empty(t, srv.pubsub.channels)
+	assert.Equal(t, []string{"news"}, subscribed(b, true))
+}
+
+func TestServerPublish(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	b := ev.NewClient(2)
+	srv.subscribe(a, "news.sport", false)
+	srv.subscribe(b, "news.sport", false)
+	srv.subscribe(b, "news.*", true)
+	srv.subscribe(b, "weather.*", true)
+
+	assert.Equal(t, 3, srv.publish("news.sport", "goal"))
+	message := "*3\r\n$7\r\nmessage\r\n$10\r\nnews.sport\r\n$4\r\ngoal\r\n"
+	assert.Equal(t, len(message), a.PendingOutput())
+	pmessage := "*4\r\n$8\r\npmessage\r\n$6\r\nnews.*\r\n$10\r\nnews.sport\r\n$4\r\ngoal\r\n"
+	assert.Equal(t, len(message)+len(pmessage), b.PendingOutput())
+
+	assert.Equal(t, 0, srv.publish("other", "x"))
+}
+
+func TestServerClientClosed(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	b := ev.NewClient(2)
+	srv.subscribe(a, "news", false)
+	srv.subscribe(a, "n*", true)
+	srv.subscribe(b, "news", false)
+
+	srv.ClientClosed(a)
+	assert.Equal(t, 0, subscriptions(a))
+	assert.Equal(t, []*ev.Client{b}, srv.pubsub.channels["news"])
+	assert.Empty(t, srv.pubsub.patterns)
+	assert.Equal(t, 1, srv.publish("news", "x"))
+}
+
+func TestServerActiveChannels(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	for _, c := range []string{"news", "weather", "nuts"} {
+		srv.subscribe(cl, c, false)
+	}
+	srv.subscribe(cl, "x*", true)
+	assert.Equal(t, []string{"news", "nuts", "weather"}, srv.activeChannels(""))
+	assert.Equal(t, []string{"news", "nuts"}, srv.activeChannels("n*"))
+}
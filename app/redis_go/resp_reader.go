@@ -1,7 +1,10 @@
 package redis_go
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
@@ -51,16 +54,24 @@ func (r *RespReaderImpl) ReadBulkString() (string, error) {
 		return "", fmt.Errorf("expected bulk string size %d", t)
 	}
 
-	line, err := r.ReadLine()
+	// the string may hold new lines itself, such as the payloads of DUMP,
+	// so lines are read until there is as much as announced
+	n := v.(int)
+	line, err := r.reader.ReadString('\n')
+	for err == nil && len(line) < n+2 {
+		var more string
+		more, err = r.reader.ReadString('\n')
+		line += more
+	}
 	if err != nil {
 		return "", err
 	}
 
-	if len(line) != v.(int) {
-		return "", fmt.Errorf("mismatched line length %d, %d", len(line), v.(int))
+	if len(line) != n+2 || !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("mismatched line length %d, %d", len(line)-2, n)
 	}
 
-	return line, nil
+	return line[:n], nil
 }
 
 func (r *RespReaderImpl) readAndParseLine() (respType, interface{}, error) {
@@ -82,6 +93,9 @@ func (r *RespReaderImpl) ReadLine() (line string, err error) {
 	if err != nil {
 		return
 	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("expected line to end with \\r\\n")
+	}
 
 	// remove \r\n from the end
 	return line[:len(line)-2], nil
@@ -100,6 +114,9 @@ const (
 
 func parse(s string) (respType, interface{}, error) {
 	s = strings.Trim(s, " ")
+	if s == "" {
+		return invalid, nil, fmt.Errorf("unknown type")
+	}
 
 	if s[0] == ':' || s[0] == '*' || s[0] == '$' {
 		n, err := strconv.Atoi(s[1:])
@@ -122,3 +139,90 @@ func parse(s string) (respType, interface{}, error) {
 
 	return invalid, nil, fmt.Errorf("unknown type")
 }
+
+const (
+	// maxReplyBulkLen bounds the bulk strings of the replies read by
+	// readReply, as proto-max-bulk-len does in redis
+	maxReplyBulkLen = 512 * 1024 * 1024
+	// maxReplyArrayLen bounds the elements of their arrays, maps and
+	// pushes, as redis does for the requests
+	maxReplyArrayLen = 1024 * 1024
+)
+
+// replyStatus is a status reply, as read by readReply.
+type replyStatus string
+
+// replyError is an error reply, as read by readReply.
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// readReply reads a reply: a replyStatus, a string for the bulk strings,
+// a replyError, an int64, a []interface{} for the arrays, maps and
+// pushes, or nil for the nulls. The lengths are given by the peer, so
+// they are bounded before anything is read.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("protocol error")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return replyStatus(line), nil
+	case '-':
+		return replyError(line), nil
+	case '_':
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(line, 10, 64)
+	if err != nil {
+		return nil, errors.New("protocol error")
+	}
+	switch kind {
+	case ':':
+		return n, nil
+	case '$':
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxReplyBulkLen {
+			return nil, errors.New("protocol error: invalid bulk length")
+		}
+		// the buffer grows with what is read, rather than with what is
+		// announced
+		var b strings.Builder
+		if _, err := io.CopyN(&b, r, n+2); err != nil {
+			return nil, err
+		}
+		s := b.String()
+		if s[n:] != "\r\n" {
+			return nil, errors.New("protocol error")
+		}
+		return s[:n], nil
+	case '*', '>', '%':
+		if n < 0 {
+			return nil, nil
+		}
+		if kind == '%' {
+			n *= 2
+		}
+		if n > maxReplyArrayLen {
+			return nil, errors.New("protocol error: invalid multibulk length")
+		}
+		elems := make([]interface{}, n)
+		for i := range elems {
+			if elems[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return elems, nil
+	}
+	return nil, fmt.Errorf("protocol error, got '%c' as reply type byte", kind)
+}
@@ -1,8 +1,10 @@
 package redis_go
 
 import (
+	"bufio"
 	"fmt"
 	"redis-go/app/mocks"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -116,13 +118,27 @@ func TestReadBulkStringLenMistmatchError(t *testing.T) {
 	mr := mocks.NewMockStringReader(ctrl)
 	rr := NewRespReader(mr)
 
-	mockReadString(mr, "$13\r\n", nil)
+	mockReadString(mr, "$11\r\n", nil)
 	mockReadString(mr, "Hello World!\r\n", nil)
 
 	_, err := rr.ReadBulkString()
 	assert.NotNil(t, err)
 }
 
+func TestReadBulkStringNewLines(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+
+	mockReadString(mr, "$13\r\n", nil)
+	mockReadString(mr, "Hello\n", nil)
+	mockReadString(mr, "World!\r\r\n", nil)
+
+	str, err := rr.ReadBulkString()
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello\nWorld!\r", str)
+}
+
 func TestReadLine(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mr := mocks.NewMockStringReader(ctrl)
@@ -148,6 +164,18 @@ func TestReadLineReadError(t *testing.T) {
 	assert.NotEqual(t, err, nil)
 }
 
+func TestReadLineMissingCrlf(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+
+	mockReadString(mr, "\n", nil)
+
+	_, err := rr.ReadLine()
+
+	assert.EqualError(t, err, "expected line to end with \\r\\n")
+}
+
 func TestParseInt(t *testing.T) {
 	ty, d, err := parse(":23")
 
@@ -254,3 +282,51 @@ func TestParseBulkStringLenError(t *testing.T) {
 	}
 
 }
+
+func TestParseEmpty(t *testing.T) {
+	_, _, err := parse(" ")
+
+	assert.EqualError(t, err, "unknown type")
+}
+
+func TestReadReply(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("*3\r\n:1\r\n$3\r\nfoo\r\n$-1\r\n-ERR bad\r\n+OK\r\n%1\r\n$1\r\na\r\n_\r\n"))
+	reply, err := readReply(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), "foo", nil}, reply)
+	reply, err = readReply(r)
+	assert.NoError(t, err)
+	assert.Equal(t, replyError("ERR bad"), reply)
+	reply, err = readReply(r)
+	assert.NoError(t, err)
+	assert.Equal(t, replyStatus("OK"), reply)
+	reply, err = readReply(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", nil}, reply)
+	_, err = readReply(r)
+	assert.Error(t, err)
+}
+
+func TestReadReplyErrors(t *testing.T) {
+	tests := []struct {
+		res string
+		err string
+	}{
+		{"?1\r\n", "protocol error, got '?' as reply type byte"},
+		{":abc\r\n", "protocol error"},
+		{"+OK\n", "protocol error"},
+		{"$3\r\nfoobar\r\n", "protocol error"},
+		{"$536870913\r\n", "protocol error: invalid bulk length"},
+		{"*1048577\r\n", "protocol error: invalid multibulk length"},
+		{"%524289\r\n", "protocol error: invalid multibulk length"},
+		{"*9223372036854775807\r\n", "protocol error: invalid multibulk length"},
+	}
+	for _, test := range tests {
+		_, err := readReply(bufio.NewReader(strings.NewReader(test.res)))
+		assert.EqualError(t, err, test.err, test.res)
+	}
+
+	// the length is only trusted as far as there is data
+	_, err := readReply(bufio.NewReader(strings.NewReader("$536870912\r\nabc")))
+	assert.Error(t, err)
+}
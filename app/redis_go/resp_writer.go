@@ -0,0 +1,60 @@
+package redis_go
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The encoders below leave out the trailing \r\n of the reply, which is
+// added once the command has executed. Elements of an array are joined
+// with \r\n, so replies can be nested.
+
+func encodeBulkString(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s
+}
+
+func encodeInt(n int) string {
+	return ":" + strconv.Itoa(n)
+}
+
+func encodeArray(elems []string) string {
+	return encodeAggregate("*", len(elems), elems)
+}
+
+// encodeAggregate encodes the types made of elems, of which there are n
+// for the given type prefix.
+func encodeAggregate(prefix string, n int, elems []string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix + strconv.Itoa(n))
+	for _, e := range elems {
+		sb.WriteString("\r\n")
+		sb.WriteString(e)
+	}
+	return sb.String()
+}
+
+func encodeBulkStrings(strs []string) string {
+	elems := make([]string, len(strs))
+	for i, s := range strs {
+		elems[i] = encodeBulkString(s)
+	}
+	return encodeArray(elems)
+}
+
+// encodeMap encodes the keys and values of elems, in turn, as a map for
+// RESP3 and as a flat array for RESP2.
+func encodeMap(resp int, elems []string) string {
+	if resp < 3 {
+		return encodeArray(elems)
+	}
+	return encodeAggregate("%", len(elems)/2, elems)
+}
+
+// encodePush encodes the data the server sends on its own, such as the
+// pub/sub messages, as a push for RESP3 and as an array for RESP2.
+func encodePush(resp int, elems []string) string {
+	if resp < 3 {
+		return encodeArray(elems)
+	}
+	return encodeAggregate(">", len(elems), elems)
+}
@@ -0,0 +1,34 @@
+package redis_go
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeBulkString(t *testing.T) {
+	assert.Equal(t, "$5\r\nhello", encodeBulkString("hello"))
+	assert.Equal(t, "$0\r\n", encodeBulkString(""))
+}
+
+func TestEncodeInt(t *testing.T) {
+	assert.Equal(t, ":-12", encodeInt(-12))
+}
+
+func TestEncodeArray(t *testing.T) {
+	assert.Equal(t, "*0", encodeArray(nil))
+	assert.Equal(t, "*2\r\n:1\r\n*1\r\n$1\r\na",
+		encodeArray([]string{encodeInt(1), encodeBulkStrings([]string{"a"})}))
+}
+
+func TestEncodeMap(t *testing.T) {
+	elems := []string{encodeBulkString("a"), encodeInt(1)}
+	assert.Equal(t, "*2\r\n$1\r\na\r\n:1", encodeMap(2, elems))
+	assert.Equal(t, "%1\r\n$1\r\na\r\n:1", encodeMap(3, elems))
+}
+
+func TestEncodePush(t *testing.T) {
+	elems := []string{encodeBulkString("a"), encodeInt(1)}
+	assert.Equal(t, "*2\r\n$1\r\na\r\n:1", encodePush(2, elems))
+	assert.Equal(t, ">2\r\n$1\r\na\r\n:1", encodePush(3, elems))
+}
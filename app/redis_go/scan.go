@@ -0,0 +1,124 @@
+package redis_go
+
+import (
+	"fmt"
+	"math"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+type scanParams struct {
+	cursor uint64
+	match  string
+	count  int
+	typ    string
+}
+
+// readScanParams reads the cursor and the MATCH, COUNT and TYPE options of
+// SCAN.
+func readScanParams(rr RespReader, len int) (p scanParams, err error) {
+	if len < 1 || len%2 != 1 {
+		return p, fmt.Errorf("incorrect number of params")
+	}
+
+	cs, err := rr.ReadBulkString()
+	if err != nil {
+		return
+	}
+	p.cursor, err = strconv.ParseUint(cs, 10, 64)
+	if err != nil {
+		return p, fmt.Errorf("invalid cursor")
+	}
+
+	p.count = 10
+	for i := 1; i < len; i += 2 {
+		opt, err := rr.ReadBulkString()
+		if err != nil {
+			return p, err
+		}
+		val, err := rr.ReadBulkString()
+		if err != nil {
+			return p, err
+		}
+
+		switch strings.ToUpper(opt) {
+		case "MATCH":
+			p.match = val
+		case "COUNT":
+			p.count, err = strconv.Atoi(val)
+			if err != nil || p.count < 1 {
+				return p, fmt.Errorf("syntax error")
+			}
+		case "TYPE":
+			p.typ = strings.ToLower(val)
+		default:
+			return p, fmt.Errorf("syntax error")
+		}
+	}
+	return p, nil
+}
+
+func encodeScanReply(cursor uint64, items []string) string {
+	return encodeArray([]string{
+		encodeBulkString(strconv.FormatUint(cursor, 10)),
+		encodeBulkStrings(items),
+	})
+}
+
+type ScanCommand struct {
+	BaseCommand
+	reader RespReader
+	params scanParams
+}
+
+func NewScanCommand(rr RespReader) *ScanCommand {
+	return &ScanCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ScanCommand) ReadParams(len int) (err error) {
+	c.params, err = readScanParams(c.reader, len)
+	return
+}
+
+func (c *ScanCommand) Execute(srv *Server, cl *ev.Client) string {
+	db := srv.Db(cl)
+	p := c.params
+
+	// COUNT is only a hint: visit buckets until enough keys are collected,
+	// giving up after count*10 buckets in case the table is sparse.
+	steps := p.count
+	if steps > math.MaxInt/10 {
+		steps = math.MaxInt
+	} else {
+		steps *= 10
+	}
+	keys := []string{}
+	cursor := p.cursor
+	for i := 0; i < steps; i++ {
+		cursor = db.Scan(cursor, func(key string) {
+			keys = append(keys, key)
+		})
+		if cursor == 0 || len(keys) >= p.count {
+			break
+		}
+	}
+
+	res := keys[:0]
+	for _, key := range keys {
+		if p.match != "" && !stringMatch(p.match, key) {
+			continue
+		}
+		// Type also skips the keys that have expired
+		t := db.Type(key)
+		if t == "none" || (p.typ != "" && t != p.typ) {
+			continue
+		}
+		res = append(res, key)
+	}
+
+	return encodeScanReply(cursor, res)
+}
@@ -0,0 +1,219 @@
+package redis_go
+
+import (
+	"fmt"
+	"math"
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadScanParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mrr.EXPECT().ReadBulkString().Return("17", nil)
+	mrr.EXPECT().ReadBulkString().Return("match", nil)
+	mrr.EXPECT().ReadBulkString().Return("user:*", nil)
+	mrr.EXPECT().ReadBulkString().Return("COUNT", nil)
+	mrr.EXPECT().ReadBulkString().Return("100", nil)
+	mrr.EXPECT().ReadBulkString().Return("type", nil)
+	mrr.EXPECT().ReadBulkString().Return("STRING", nil)
+
+	p, err := readScanParams(mrr, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, scanParams{
+		cursor: 17,
+		match:  "user:*",
+		count:  100,
+		typ:    "string",
+	}, p)
+}
+
+func TestReadScanParamsDefaults(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mrr.EXPECT().ReadBulkString().Return("0", nil)
+
+	p, err := readScanParams(mrr, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, p.count)
+}
+
+func TestReadScanParamsInvalidCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mrr.EXPECT().ReadBulkString().Return("-1", nil)
+
+	_, err := readScanParams(mrr, 1)
+	assert.Equal(t, "invalid cursor", err.Error())
+}
+
+func TestReadScanParamsInvalidCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mrr.EXPECT().ReadBulkString().Return("0", nil)
+	mrr.EXPECT().ReadBulkString().Return("COUNT", nil)
+	mrr.EXPECT().ReadBulkString().Return("0", nil)
+
+	_, err := readScanParams(mrr, 3)
+	assert.NotNil(t, err)
+}
+
+func TestReadScanParamsLenError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	_, err := readScanParams(mrr, 2)
+	assert.NotNil(t, err)
+}
+
+func TestReadScanParamsReadError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	mrr.EXPECT().ReadBulkString().Return("", fmt.Errorf("read error"))
+
+	_, err := readScanParams(mrr, 1)
+	assert.NotNil(t, err)
+}
+
+func TestCommandScan(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	db := srv.Db(cl)
+	for i := 0; i < 100; i++ {
+		db.Set("key:"+strconv.Itoa(i), "value")
+	}
+
+	seen := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		sc := ScanCommand{params: scanParams{cursor: cursor, count: 10}}
+		next, keys := parseScanReply(t, sc.Execute(srv, cl))
+		for _, key := range keys {
+			seen[key] = true
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, 100, len(seen))
+}
+
+func TestCommandScanLargeCount(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	db := srv.Db(cl)
+	for _, key := range []string{"a", "b", "c"} {
+		db.Set(key, "value")
+	}
+
+	sc := ScanCommand{params: scanParams{count: math.MaxInt}}
+	cursor, keys := parseScanReply(t, sc.Execute(srv, cl))
+	assert.Equal(t, uint64(0), cursor)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, keys)
+}
+
+func TestCommandScanMatch(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	db := srv.Db(cl)
+	db.Set("user:1", "a")
+	db.Set("user:2", "b")
+	db.Set("session:1", "c")
+
+	sc := ScanCommand{params: scanParams{count: 100, match: "user:*"}}
+	cursor, keys := parseScanReply(t, sc.Execute(srv, cl))
+	assert.Equal(t, uint64(0), cursor)
+	assert.ElementsMatch(t, []string{"user:1", "user:2"}, keys)
+}
+
+func TestCommandScanType(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	srv.Db(cl).Set("hello", "world")
+
+	sc := ScanCommand{params: scanParams{count: 100, typ: "hash"}}
+	_, keys := parseScanReply(t, sc.Execute(srv, cl))
+	assert.Empty(t, keys)
+
+	sc = ScanCommand{params: scanParams{count: 100, typ: "string"}}
+	_, keys = parseScanReply(t, sc.Execute(srv, cl))
+	assert.Equal(t, []string{"hello"}, keys)
+}
+
+func TestCommandScanSkipsExpired(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	db := srv.Db(cl)
+	db.Set("hello", "world")
+	db.SetExpire("hello", time.Now().Add(-time.Second))
+
+	sc := ScanCommand{params: scanParams{count: 100}}
+	assert.Equal(t, "*2\r\n$1\r\n0\r\n*0", sc.Execute(srv, cl))
+}
+
+func TestCommandElementScanUnsupported(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	// there are no hashes, sets or sorted sets to scan the elements of
+	for _, name := range []string{"HSCAN", "SSCAN", "ZSCAN"} {
+		assert.Equal(t, "-ERR unknown command "+name+"\r\n", handle(srv, cl, name, "k", "0"))
+	}
+}
+
+func TestCommandReaderScan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+	cr := NewCommandReader(rr)
+
+	mockReadCommand(mr, nil, 4, "scan", "12", "MATCH", "a*")
+
+	c, err := cr.Read()
+	assert.Nil(t, err)
+
+	sc := c.(*ScanCommand)
+	assert.Equal(t, uint64(12), sc.params.cursor)
+	assert.Equal(t, "a*", sc.params.match)
+}
+
+func parseScanReply(t *testing.T, res string) (uint64, []string) {
+	ctrl := gomock.NewController(t)
+	mr := mocks.NewMockStringReader(ctrl)
+	rr := NewRespReader(mr)
+	lines := strings.SplitAfter(res+"\r\n", "\r\n")
+	for _, l := range lines[:len(lines)-1] {
+		mockReadString(mr, l, nil)
+	}
+
+	n, err := rr.ReadArrayLen()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	cs, err := rr.ReadBulkString()
+	assert.Nil(t, err)
+	cursor, err := strconv.ParseUint(cs, 10, 64)
+	assert.Nil(t, err)
+
+	n, err = rr.ReadArrayLen()
+	assert.Nil(t, err)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i], err = rr.ReadBulkString()
+		assert.Nil(t, err)
+	}
+	return cursor, keys
+}
@@ -0,0 +1,570 @@
+package redis_go
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// scriptCheckSteps is the number of instructions run between two
+	// checks of the time a script has been running
+	scriptCheckSteps = 10000
+	// scriptEventsPeriod is how often a script running past the
+	// busy-reply-threshold lets the other clients in
+	scriptEventsPeriod = 100 * time.Millisecond
+
+	errNoScript = "-NOSCRIPT No matching script. Please use EVAL."
+)
+
+var errScriptKilled = errors.New("ERR Script killed by user with SCRIPT KILL...")
+
+// luaScript is a script of the cache, compiled once.
+type luaScript struct {
+	body string
+	fn   *lua.LFunction
+}
+
+// scriptEngine runs the scripts, all of them in the same Lua state, one at
+// a time on the loop. The state is only created once a script is run. The
+// functions run in a state of their own, see function.go, but share the
+// client and the script running.
+type scriptEngine struct {
+	L *lua.LState
+	// scripts are the scripts of the cache by SHA1
+	scripts map[string]*luaScript
+	// client runs the commands called by the scripts
+	client *ev.Client
+	// running is the script being run, nil when there is none
+	running *scriptRun
+}
+
+func newScriptEngine() *scriptEngine {
+	client := ev.NewClient(-1)
+	client.Addr = "lua"
+	return &scriptEngine{
+		scripts: map[string]*luaScript{},
+		client:  client,
+	}
+}
+
+// scriptRun is a script being run. It is the context of the Lua state
+// meanwhile, whose Done is checked before every instruction: this is how
+// the other clients are let in once the script runs for long, and how
+// SCRIPT KILL stops it.
+type scriptRun struct {
+	srv    *Server
+	caller *ev.Client
+	// argv is the command running the script, and name the SHA1 of the
+	// script or the name of the function
+	argv     []string
+	name     string
+	function bool
+	start    time.Time
+	// readOnly scripts may not call write commands
+	readOnly bool
+	// wrote is set once the script called a write command, it can not be
+	// killed then
+	wrote bool
+	// timedOut is set once the script runs past the busy-reply-threshold
+	timedOut bool
+	// lastEvents is when the other clients were last let in
+	lastEvents time.Time
+	steps      int
+	killed     chan struct{}
+}
+
+func newScriptRun(srv *Server, cl *ev.Client, argv []string, name string, function bool,
+	readOnly bool) *scriptRun {
+	return &scriptRun{
+		srv:      srv,
+		caller:   cl,
+		argv:     argv,
+		name:     name,
+		function: function,
+		start:    time.Now(),
+		readOnly: readOnly,
+		killed:   make(chan struct{}),
+	}
+}
+
+func (r *scriptRun) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (r *scriptRun) Done() <-chan struct{} {
+	r.steps++
+	if r.steps%scriptCheckSteps == 0 {
+		r.srv.scriptTick(r, time.Now())
+	}
+	return r.killed
+}
+
+func (r *scriptRun) Err() error {
+	if r.isKilled() {
+		return errScriptKilled
+	}
+	return nil
+}
+
+func (r *scriptRun) Value(key interface{}) interface{} {
+	return nil
+}
+
+func (r *scriptRun) isKilled() bool {
+	select {
+	case <-r.killed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *scriptRun) kill() {
+	if !r.isKilled() {
+		close(r.killed)
+	}
+}
+
+// busyReply is the reply to the commands refused while the script runs.
+func (r *scriptRun) busyReply() string {
+	if r.function {
+		return "-BUSY Redis is busy running a script. You can only call FUNCTION KILL or SHUTDOWN NOSAVE."
+	}
+	return "-BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE."
+}
+
+// scriptTick lets the other clients in every scriptEventsPeriod, once the
+// script runs past the busy-reply-threshold. They are replied BUSY, except
+// for SCRIPT KILL and SHUTDOWN NOSAVE. A threshold of 0 disables it.
+func (s *Server) scriptTick(r *scriptRun, now time.Time) {
+	threshold := time.Duration(s.config.BusyReplyThreshold) * time.Millisecond
+	if threshold <= 0 || now.Sub(r.start) < threshold || now.Sub(r.lastEvents) < scriptEventsPeriod {
+		return
+	}
+	if !r.timedOut {
+		r.timedOut = true
+		kill := "SCRIPT KILL"
+		if r.function {
+			kill = "FUNCTION KILL"
+		}
+		fmt.Printf("Slow script detected: still in execution after %d milliseconds. "+
+			"You can try killing the script using the %s command. Script name is: %s\n",
+			now.Sub(r.start).Milliseconds(), kill, r.name)
+	}
+	r.lastEvents = now
+	if s.conns != nil {
+		// the errors are found again by the loop once the script is done
+		s.conns.ProcessEventsWhileBlocked()
+	}
+}
+
+// scriptEngine returns the engine, and creates its Lua state if needed.
+func (s *Server) scriptEngine() *scriptEngine {
+	e := s.scripts
+	if e.L == nil {
+		e.L = s.newLuaState()
+	}
+	return e
+}
+
+// scriptBusy reports whether the command is refused as a script is running.
+// The other clients are only served meanwhile once the script runs past
+// the busy-reply-threshold, and only SCRIPT KILL, FUNCTION KILL, FUNCTION
+// STATS and SHUTDOWN NOSAVE may run then.
+func (s *Server) scriptBusy(c Command) bool {
+	r := s.scripts.running
+	if r == nil {
+		return false
+	}
+	argv := c.Argv()
+	switch c.Spec().Name {
+	case "script":
+		return len(argv) < 2 || !strings.EqualFold(argv[1], "kill")
+	case "function":
+		return len(argv) < 2 || !strings.EqualFold(argv[1], "kill") && !strings.EqualFold(argv[1], "stats")
+	case "shutdown":
+		for _, arg := range argv[1:] {
+			if strings.EqualFold(arg, "nosave") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// killScript stops the running script, or the running function with
+// function set, unless it wrote to the dataset already, in which case it
+// reports the error.
+func (s *Server) killScript(function bool) string {
+	r := s.scripts.running
+	if r == nil {
+		return "-NOTBUSY No scripts in execution right now."
+	}
+	if r.function != function {
+		// SCRIPT KILL does not kill the functions, nor FUNCTION KILL the
+		// scripts
+		return r.busyReply()
+	}
+	if r.wrote {
+		return "-UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+			"You can either wait the script termination or kill the server in a hard way using the " +
+			"SHUTDOWN NOSAVE command."
+	}
+	r.kill()
+	return "+OK"
+}
+
+// flushScripts empties the cache, and closes the Lua state so that the
+// next script runs in a new one.
+func (s *Server) flushScripts() {
+	e := s.scripts
+	if e.L != nil {
+		e.L.Close()
+		e.L = nil
+	}
+	e.scripts = map[string]*luaScript{}
+}
+
+func sha1hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadScript compiles body and adds it to the cache, unless it is there
+// already. It returns the SHA1 of the script, or the error reply.
+func (s *Server) loadScript(body string) (string, *luaScript, string) {
+	sha := sha1hex(body)
+	e := s.scriptEngine()
+	if sc, ok := e.scripts[sha]; ok {
+		return sha, sc, ""
+	}
+	fn, err := e.L.Load(strings.NewReader(body), "user_script")
+	if err != nil {
+		return "", nil, "-ERR Error compiling script (new function): " + replyLine(strings.TrimSpace(err.Error()))
+	}
+	sc := &luaScript{body: body, fn: fn}
+	e.scripts[sha] = sc
+	return sha, sc, ""
+}
+
+// runScript runs fn with args in L, the script or the function of r, and
+// converts what it returns to a reply.
+func (s *Server) runScript(L *lua.LState, fn *lua.LFunction, args []lua.LValue, r *scriptRun) string {
+	e := s.scripts
+	// the commands of the script run on the database and as the user of
+	// the caller
+	e.client.Db = r.caller.Db
+	e.client.User = r.caller.User
+	e.running = r
+	L.SetContext(r)
+	L.Push(fn)
+	for _, arg := range args {
+		L.Push(arg)
+	}
+	err := L.PCall(len(args), 1, nil)
+	L.RemoveContext()
+	e.running = nil
+
+	if r.isKilled() {
+		L.SetTop(0)
+		return "-" + errScriptKilled.Error()
+	}
+	if err != nil {
+		L.SetTop(0)
+		return scriptErrorReply(err, r.name)
+	}
+	res := luaToResp(L.Get(-1))
+	L.SetTop(0)
+	return res
+}
+
+// evalScript runs a script of the cache with KEYS and ARGV set.
+func (s *Server) evalScript(cl *ev.Client, argv []string, sha string, sc *luaScript, keys []string,
+	args []string, readOnly bool) string {
+	L := s.scriptEngine().L
+	L.G.Global.RawSetString("KEYS", luaStrings(L, keys))
+	L.G.Global.RawSetString("ARGV", luaStrings(L, args))
+	return s.runScript(L, sc.fn, nil, newScriptRun(s, cl, argv, sha, false, readOnly))
+}
+
+// scriptErrorReply is the reply of a script that raised an error: the
+// error tables, such as those raised by redis.call, are replied as they
+// are, and the others as ERR.
+func scriptErrorReply(err error, name string) string {
+	msg, isTable := luaErrorMessage(err)
+	if isTable {
+		return "-" + replyLine(msg) + " script: " + name
+	}
+	return "-ERR " + replyLine(msg) + " script: " + name
+}
+
+// luaErrorMessage is the message of an error raised by Lua code, and
+// whether it was an error table.
+func luaErrorMessage(err error) (string, bool) {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok {
+		return err.Error(), false
+	}
+	if t, ok := apiErr.Object.(*lua.LTable); ok {
+		if e, ok := t.RawGetString("err").(lua.LString); ok {
+			return string(e), true
+		}
+	}
+	return apiErr.Object.String(), false
+}
+
+// replyLine makes s fit on the line of a status or error reply.
+func replyLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func luaStrings(L *lua.LState, strs []string) *lua.LTable {
+	t := L.CreateTable(len(strs), 0)
+	for _, s := range strs {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
+
+// newLuaState creates a state with the base, table, string and math
+// libraries, less the functions reaching to the file system, and the redis
+// library. The globals are protected once it is set up, so that a script
+// can not leave state for the next ones.
+func (s *Server) newLuaState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redis := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return s.luaRedisCall(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return s.luaRedisCall(L, false)
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(luaReplyTable(L, "err", L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(luaReplyTable(L, "ok", L.CheckString(1)))
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex(L.CheckString(1))))
+			return 1
+		},
+		"log": luaRedisLog,
+		// there is no replication, so there is nothing to set
+		"set_repl": func(L *lua.LState) int {
+			return 0
+		},
+	})
+	for i, name := range []string{"LOG_DEBUG", "LOG_VERBOSE", "LOG_NOTICE", "LOG_WARNING"} {
+		redis.RawSetString(name, lua.LNumber(i))
+	}
+	for i, name := range []string{"REPL_NONE", "REPL_SLAVE", "REPL_AOF", "REPL_ALL"} {
+		redis.RawSetString(name, lua.LNumber(i))
+	}
+	redis.RawSetString("REPL_REPLICA", redis.RawGetString("REPL_SLAVE"))
+	L.SetGlobal("redis", redis)
+
+	// the globals are protected from then on
+	mt := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"__newindex": func(L *lua.LState) int {
+			L.RaiseError("Script attempted to create global variable '%s'", L.CheckAny(2).String())
+			return 0
+		},
+		"__index": func(L *lua.LState) int {
+			L.RaiseError("Script attempted to access nonexistent global variable '%s'", L.CheckAny(2).String())
+			return 0
+		},
+	})
+	L.SetMetatable(L.G.Global, mt)
+	return L
+}
+
+func luaReplyTable(L *lua.LState, field string, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString(field, lua.LString(msg))
+	return t
+}
+
+// luaRedisLog prints the message of redis.log, as the server logs to the
+// standard output.
+func luaRedisLog(L *lua.LState) int {
+	level := L.CheckInt(1)
+	if level < 0 || level > 3 {
+		L.RaiseError("Invalid debug level.")
+	}
+	parts := make([]string, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		parts = append(parts, L.CheckString(i))
+	}
+	if len(parts) == 0 {
+		L.RaiseError("redis.log() requires two arguments or more.")
+	}
+	fmt.Println(strings.Join(parts, " "))
+	return 0
+}
+
+// luaRedisCall is redis.call, or redis.pcall when raise is not set: it
+// runs a command on the client of the scripts, and converts the reply.
+// The errors are raised by redis.call, and returned as error tables by
+// redis.pcall.
+func (s *Server) luaRedisCall(L *lua.LState, raise bool) int {
+	res := s.scriptCall(L)
+	var reply lua.LValue
+	if r, err := readReply(bufio.NewReader(strings.NewReader(res + "\r\n"))); err != nil {
+		reply = luaReplyTable(L, "err", "ERR "+err.Error())
+	} else {
+		reply = replyToLua(L, r)
+	}
+	if t, ok := reply.(*lua.LTable); ok && raise && t.RawGetString("err") != lua.LNil {
+		L.Error(t, 1)
+	}
+	L.Push(reply)
+	return 1
+}
+
+// scriptCall runs the command of the arguments of redis.call, and returns
+// the reply.
+func (s *Server) scriptCall(L *lua.LState) string {
+	if L.GetTop() == 0 {
+		return "-ERR Please specify at least one argument for this redis lib call"
+	}
+	argv := make([]string, L.GetTop())
+	for i := range argv {
+		switch v := L.Get(i + 1).(type) {
+		case lua.LString:
+			argv[i] = string(v)
+		case lua.LNumber:
+			argv[i] = v.String()
+		default:
+			return "-ERR Lua redis lib command arguments must be strings or integers"
+		}
+	}
+
+	if _, ok := commandTable[strings.ToLower(argv[0])]; !ok {
+		return "-ERR Unknown Redis command called from script"
+	}
+	cr := NewCommandReader(NewRespReader(ev.NewArrayStringReader([]byte(encodeBulkStrings(argv) + "\r\n"))))
+	c, err := cr.Read()
+	if err != nil {
+		return "-ERR " + err.Error()
+	}
+
+	e := s.scripts
+	r := e.running
+	if r == nil {
+		// the code of a library runs when it is loaded
+		return "-ERR redis.call can only be called inside a script invocation"
+	}
+	spec := c.Spec()
+	if spec.Is(CmdNoScript) {
+		return "-ERR This Redis command is not allowed from script"
+	}
+	if spec.Is(CmdWrite) {
+		if r.readOnly {
+			return "-ERR Write commands are not allowed from read-only scripts."
+		}
+		if r.timedOut {
+			// the dataset may not change while the clients are told the
+			// server is busy
+			return "-BUSY Redis is busy running a script."
+		}
+	}
+	if res := s.aclCheck(c, e.client); res != "" {
+		return "-ERR The user executing the script can't run this command or subcommand"
+	}
+	if s.cluster != nil && s.clusterRedirect(c, e.client) != "" {
+		return "-ERR Script attempted to access a non local key in a cluster node"
+	}
+
+	res := s.Execute(c, e.client)
+	if spec.Is(CmdWrite) && !isErrorReply(res) {
+		r.wrote = true
+	}
+	return res
+}
+
+// replyToLua converts a reply read by readReply to a Lua value: the
+// integers to numbers, the bulk strings to strings, the arrays to tables,
+// the nulls to false, and the status and error replies to tables with an
+// ok or an err field.
+func replyToLua(L *lua.LState, reply interface{}) lua.LValue {
+	switch r := reply.(type) {
+	case replyStatus:
+		return luaReplyTable(L, "ok", string(r))
+	case replyError:
+		return luaReplyTable(L, "err", string(r))
+	case int64:
+		return lua.LNumber(r)
+	case string:
+		return lua.LString(r)
+	case []interface{}:
+		t := L.CreateTable(len(r), 0)
+		for _, e := range r {
+			t.Append(replyToLua(L, e))
+		}
+		return t
+	}
+	return lua.LFalse
+}
+
+// luaToResp converts a value returned by a script to a reply: the numbers
+// are truncated to integers, true is 1, and false and nil are null. A
+// table with an ok or an err field is a status or an error reply, and the
+// others are arrays, up to their first nil.
+func luaToResp(v lua.LValue) string {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return ":" + strconv.FormatInt(int64(v), 10)
+	case lua.LString:
+		return encodeBulkString(string(v))
+	case lua.LBool:
+		if v {
+			return ":1"
+		}
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return "-" + replyLine(string(e))
+		}
+		if st, ok := v.RawGetString("ok").(lua.LString); ok {
+			return "+" + replyLine(string(st))
+		}
+		var elems []string
+		for i := 1; ; i++ {
+			e := v.RawGetInt(i)
+			if e == lua.LNil {
+				break
+			}
+			elems = append(elems, luaToResp(e))
+		}
+		return encodeArray(elems)
+	}
+	return "$-1"
+}
@@ -0,0 +1,173 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+// EvalCommand is EVAL and EVALSHA, and their read-only variants EVAL_RO
+// and EVALSHA_RO.
+type EvalCommand struct {
+	BaseCommand
+	reader RespReader
+	// sha is set for EVALSHA, and script for EVAL
+	sha      bool
+	readOnly bool
+	script   string
+	keys     []string
+	args     []string
+}
+
+func NewEvalCommand(rr RespReader, sha bool, readOnly bool) *EvalCommand {
+	return &EvalCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		sha:         sha,
+		readOnly:    readOnly,
+	}
+}
+
+func (c *EvalCommand) ReadParams(len int) (err error) {
+	c.script, c.keys, c.args, err = readScriptParams(c.reader, len)
+	return
+}
+
+// readScriptParams reads the arguments of EVAL and FCALL: the script or the
+// function, the number of keys, the keys and the other arguments.
+func readScriptParams(rr RespReader, len int) (string, []string, []string, error) {
+	if len < 2 {
+		return "", nil, nil, fmt.Errorf("incorrect number of params")
+	}
+	argv, err := readBulkStrings(rr, len)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	numKeys, err := strconv.Atoi(argv[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return "", nil, nil, fmt.Errorf("Number of keys can't be negative")
+	}
+	if numKeys > len-2 {
+		return "", nil, nil, fmt.Errorf("Number of keys can't be greater than number of args")
+	}
+	return argv[0], argv[2 : 2+numKeys], argv[2+numKeys:], nil
+}
+
+func (c *EvalCommand) Execute(srv *Server, cl *ev.Client) string {
+	var sha string
+	var sc *luaScript
+	if c.sha {
+		sha = strings.ToLower(c.script)
+		sc = srv.scripts.scripts[sha]
+		if sc == nil {
+			return errNoScript
+		}
+	} else {
+		var res string
+		sha, sc, res = srv.loadScript(c.script)
+		if res != "" {
+			return res
+		}
+	}
+	return srv.evalScript(cl, c.Argv(), sha, sc, c.keys, c.args, c.readOnly)
+}
+
+// evalKeys finds the keys of EVAL and FCALL, which are counted by their
+// second argument.
+func evalKeys(argv []string) []string {
+	if len(argv) < 3 {
+		return nil
+	}
+	n, err := strconv.Atoi(argv[2])
+	if err != nil || n <= 0 || n > len(argv)-3 {
+		return nil
+	}
+	return argv[3 : 3+n]
+}
+
+type ScriptCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+}
+
+func NewScriptCommand(rr RespReader) *ScriptCommand {
+	return &ScriptCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ScriptCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args, err = readBulkStrings(c.reader, len-1)
+	if err != nil {
+		return
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "LOAD":
+		if n != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "EXISTS":
+		if n < 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "FLUSH":
+		if n > 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		if n == 1 && !strings.EqualFold(c.args[0], "async") && !strings.EqualFold(c.args[0], "sync") {
+			return fmt.Errorf("SCRIPT FLUSH only support SYNC|ASYNC option")
+		}
+	case "KILL":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+// Execute flushes the scripts at once whether ASYNC is given or not, as
+// there is no background thread to free them.
+func (c *ScriptCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "LOAD":
+		sha, _, res := srv.loadScript(c.args[0])
+		if res != "" {
+			return res
+		}
+		return encodeBulkString(sha)
+	case "EXISTS":
+		elems := make([]string, len(c.args))
+		for i, sha := range c.args {
+			elems[i] = ":0"
+			if _, ok := srv.scripts.scripts[strings.ToLower(sha)]; ok {
+				elems[i] = ":1"
+			}
+		}
+		return encodeArray(elems)
+	case "FLUSH":
+		srv.flushScripts()
+		return "+OK"
+	}
+	return srv.killScript(false)
+}
@@ -0,0 +1,92 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalCommand(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n",
+		handle(srv, cl, "EVAL", "return {KEYS[1], KEYS[2], ARGV[1], ARGV[2]}", "2", "a", "b", "c", "d"))
+	assert.Equal(t, ":0\r\n", handle(srv, cl, "EVAL", "return #KEYS + #ARGV", "0"))
+	assert.Equal(t, "-ERR Error compiling script (new function): user_script at EOF:   syntax error\r\n",
+		handle(srv, cl, "EVAL", "return (", "0"))
+
+	// EVAL caches the script
+	sha := sha1hex("return #KEYS + #ARGV")
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "EVALSHA", sha, "1", "a", "b"))
+	assert.Equal(t, ":2\r\n", handle(srv, cl, "EVALSHA", strings.ToUpper(sha), "1", "a", "b"))
+	assert.Equal(t, errNoScript+"\r\n", handle(srv, cl, "EVALSHA", sha1hex("nosuch"), "0"))
+}
+
+func TestEvalCommandParamErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	tests := []struct {
+		args []string
+		res  string
+	}{
+		{[]string{"EVAL", "return 1"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"EVAL", "return 1", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"EVAL", "return 1", "-1"}, "-ERR Number of keys can't be negative\r\n"},
+		{[]string{"EVALSHA", "abc", "2", "a"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.res, handle(srv, cl, test.args...), strings.Join(test.args, " "))
+	}
+}
+
+func TestEvalKeys(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, evalKeys([]string{"eval", "s", "2", "a", "b", "c"}))
+	assert.Nil(t, evalKeys([]string{"eval", "s", "0", "a"}))
+	assert.Nil(t, evalKeys([]string{"eval", "s", "3", "a"}))
+	assert.Nil(t, evalKeys([]string{"eval", "s"}))
+	assert.Equal(t, []string{"a", "b"}, commandTable["evalsha_ro"].Keys([]string{"evalsha_ro", "s", "2", "a", "b"}))
+}
+
+func TestScriptCommand(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	sha := sha1hex("return 'hi'")
+
+	assert.Equal(t, "$40\r\n"+sha+"\r\n", handle(srv, cl, "SCRIPT", "LOAD", "return 'hi'"))
+	assert.Equal(t, "$2\r\nhi\r\n", handle(srv, cl, "EVALSHA", sha, "0"))
+	assert.Equal(t, "*2\r\n:1\r\n:0\r\n", handle(srv, cl, "SCRIPT", "EXISTS", strings.ToUpper(sha), "nosuch"))
+	assert.Contains(t, handle(srv, cl, "INFO", "memory"), "number_of_cached_scripts:1\r\n")
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "SCRIPT", "LOAD", "return ("), "-ERR Error compiling script"))
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "SCRIPT", "FLUSH", "async"))
+	assert.Equal(t, "*1\r\n:0\r\n", handle(srv, cl, "SCRIPT", "EXISTS", sha))
+	assert.Equal(t, errNoScript+"\r\n", handle(srv, cl, "EVALSHA", sha, "0"))
+	// a new state is created for the next scripts
+	assert.Nil(t, srv.scripts.L)
+	assert.Equal(t, "$2\r\nhi\r\n", handle(srv, cl, "EVAL", "return 'hi'", "0"))
+}
+
+func TestScriptCommandParamErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	tests := []struct {
+		args []string
+		res  string
+	}{
+		{[]string{"SCRIPT"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"SCRIPT", "LOAD"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"SCRIPT", "EXISTS"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"SCRIPT", "FLUSH", "now"}, "-ERR SCRIPT FLUSH only support SYNC|ASYNC option\r\n"},
+		{[]string{"SCRIPT", "FLUSH", "sync", "async"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"SCRIPT", "KILL", "x"}, "-ERR incorrect number of params\r\n"},
+		{[]string{"SCRIPT", "nosuch"}, "-ERR unknown subcommand 'nosuch'\r\n"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.res, handle(srv, cl, test.args...), strings.Join(test.args, " "))
+	}
+}
@@ -0,0 +1,244 @@
+package redis_go
+
+import (
+	"bufio"
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestLuaToResp(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	tests := []struct {
+		script string
+		res    string
+	}{
+		{"return 3.99", ":3"},
+		{"return -2", ":-2"},
+		{"return 'a'", "$1\r\na"},
+		{"return true", ":1"},
+		{"return false", "$-1"},
+		{"return nil", "$-1"},
+		{"return {1, 'b', {2}}", "*3\r\n:1\r\n$1\r\nb\r\n*1\r\n:2"},
+		// arrays stop at the first nil
+		{"return {1, nil, 3}", "*1\r\n:1"},
+		{"return {ok = 'FINE'}", "+FINE"},
+		{"return {err = 'BAD\\r\\nthing'}", "-BAD  thing"},
+		{"return function() end", "$-1"},
+	}
+	for _, test := range tests {
+		assert.Nil(t, L.DoString(test.script), test.script)
+		assert.Equal(t, test.res, luaToResp(L.Get(-1)), test.script)
+		L.SetTop(0)
+	}
+}
+
+func TestReplyToLua(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	toLua := func(res string) lua.LValue {
+		reply, err := readReply(bufio.NewReader(strings.NewReader(res + "\r\n")))
+		assert.Nil(t, err)
+		return replyToLua(L, reply)
+	}
+	assert.Equal(t, lua.LNumber(5), toLua(":5"))
+	assert.Equal(t, lua.LString("abc"), toLua("$3\r\nabc"))
+	assert.Equal(t, lua.LFalse, toLua("$-1"))
+	assert.Equal(t, lua.LFalse, toLua("*-1"))
+
+	ok := toLua("+OK").(*lua.LTable)
+	assert.Equal(t, lua.LString("OK"), ok.RawGetString("ok"))
+	e := toLua("-ERR bad").(*lua.LTable)
+	assert.Equal(t, lua.LString("ERR bad"), e.RawGetString("err"))
+	// a bulk string is not a status, whatever it holds
+	assert.Equal(t, lua.LString("OK"), toLua("$2\r\nOK"))
+
+	arr := toLua("*2\r\n:1\r\n*1\r\n$1\r\nx").(*lua.LTable)
+	assert.Equal(t, 2, arr.Len())
+	assert.Equal(t, lua.LNumber(1), arr.RawGetInt(1))
+	assert.Equal(t, lua.LString("x"), arr.RawGetInt(2).(*lua.LTable).RawGetInt(1))
+}
+
+func TestScriptGlobalsProtected(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	res := handle(srv, cl, "EVAL", "x = 1", "0")
+	assert.True(t, strings.HasPrefix(res, "-ERR user_script:1: Script attempted to create global variable 'x' script: "), res)
+	res = handle(srv, cl, "EVAL", "return y", "0")
+	assert.True(t, strings.HasPrefix(res, "-ERR user_script:1: Script attempted to access nonexistent global variable 'y'"), res)
+	// the libraries reaching to the file system are not there
+	res = handle(srv, cl, "EVAL", "return dofile('/etc/passwd')", "0")
+	assert.True(t, strings.HasPrefix(res, "-ERR user_script:1: Script attempted to access nonexistent global variable 'dofile'"), res)
+
+	assert.Equal(t, "$4\r\ntrue\r\n", handle(srv, cl, "EVAL", "local x = 1 return tostring(x == 1)", "0"))
+	assert.Equal(t, "$3\r\nabc\r\n", handle(srv, cl, "EVAL", "return string.lower(table.concat({'A', 'B', 'C'}))", "0"))
+	assert.Equal(t, ":3\r\n", handle(srv, cl, "EVAL", "return math.floor(3.7)", "0"))
+}
+
+func TestScriptRedisCall(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "EVAL", "return redis.call('set', KEYS[1], ARGV[1])", "1", "k", "v"))
+	v, _ := srv.Db(cl).Get("k")
+	assert.Equal(t, "v", v)
+	assert.Equal(t, "$-1\r\n", handle(srv, cl, "EVAL", "return redis.call('get', 'nokey')", "0"))
+	assert.Equal(t, ":16\r\n", handle(srv, cl, "EVAL", "return redis.call('set', 'n', 16) and tonumber(ARGV[1])", "0", "16"))
+
+	// the numbers are given as strings
+	v, _ = srv.Db(cl).Get("n")
+	assert.Equal(t, "16", v)
+
+	// the values read are strings, which a script can check before updating
+	checkAndSet := "if redis.call('get', KEYS[1]) == ARGV[1] then return redis.call('set', KEYS[1], ARGV[2]) end " +
+		"return type(redis.call('get', KEYS[1]))"
+	assert.Equal(t, "$6\r\nstring\r\n", handle(srv, cl, "EVAL", checkAndSet, "1", "k", "other", "w"))
+	assert.Equal(t, "+OK\r\n", handle(srv, cl, "EVAL", checkAndSet, "1", "k", "v", "w"))
+	v, _ = srv.Db(cl).Get("k")
+	assert.Equal(t, "w", v)
+
+	// the scripts run on the database of the caller
+	handle(srv, cl, "SELECT", "2")
+	handle(srv, cl, "EVAL", "return redis.call('set', 'db2', 'x')", "0")
+	assert.True(t, srv.dbs[2].Exists("db2"))
+	assert.False(t, srv.dbs[0].Exists("db2"))
+}
+
+func TestScriptRedisCallErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	tests := []struct {
+		script string
+		res    string
+	}{
+		{"return redis.pcall('nosuch')", "-ERR Unknown Redis command called from script"},
+		{"return redis.call('nosuch')", "-ERR Unknown Redis command called from script script: "},
+		{"return redis.pcall()", "-ERR Please specify at least one argument for this redis lib call"},
+		{"return redis.pcall('get', {})", "-ERR Lua redis lib command arguments must be strings or integers"},
+		{"return redis.pcall('get')", "-ERR incorrect number of params"},
+		{"return redis.pcall('subscribe', 'a')", "-ERR This Redis command is not allowed from script"},
+		{"return redis.pcall('eval', 'return 1', '0')", "-ERR This Redis command is not allowed from script"},
+		// the errors of redis.call can be caught
+		{"local ok, e = pcall(redis.call, 'nosuch') return e", "-ERR Unknown Redis command called from script"},
+		{"local e = redis.pcall('nosuch') return e.err", "$44\r\nERR Unknown Redis command called from script\r\n"},
+		{"return redis.error_reply('MY error')", "-MY error"},
+		{"return redis.status_reply('FINE')", "+FINE"},
+		{"error('boom')", "-ERR user_script:1: boom script: "},
+	}
+	for _, test := range tests {
+		res := handle(srv, cl, "EVAL", test.script, "0")
+		assert.True(t, strings.HasPrefix(res, test.res), "%s: %q", test.script, res)
+	}
+}
+
+func TestScriptReadOnly(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "SET", "k", "v")
+
+	res := handle(srv, cl, "EVAL_RO", "return redis.call('set', 'k', 'w')", "0")
+	assert.True(t, strings.HasPrefix(res, "-ERR Write commands are not allowed from read-only scripts. script: "), res)
+	assert.Equal(t, "$1\r\nv\r\n", handle(srv, cl, "EVAL_RO", "return redis.call('get', 'k')", "0"))
+	assert.Equal(t, "$1\r\nv\r\n", handle(srv, cl, "EVALSHA_RO", sha1hex("return redis.call('get', 'k')"), "0"))
+}
+
+func TestScriptAclAndCluster(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	handle(srv, cl, "ACL", "SETUSER", "u", "on", "nopass", "+eval", "+get", "~a*")
+	handle(srv, cl, "AUTH", "u", "x")
+
+	assert.Equal(t, "$-1\r\n", handle(srv, cl, "EVAL", "return redis.call('get', 'ab')", "0"))
+	assert.Equal(t, "-ERR The user executing the script can't run this command or subcommand\r\n",
+		handle(srv, cl, "EVAL", "return redis.pcall('get', 'b')", "0"))
+	assert.Equal(t, "-ERR The user executing the script can't run this command or subcommand\r\n",
+		handle(srv, cl, "EVAL", "return redis.pcall('set', 'ab', 'x')", "0"))
+
+	config := NewConfig()
+	config.ClusterEnabled = true
+	config.ClusterRequireFullCoverage = false
+	srv = NewServer(config)
+	c := srv.cluster
+	other := newClusterNode("other", nodeMaster)
+	other.ip, other.port = "127.0.0.1", 7001
+	c.nodes[other.id] = other
+	c.slots[keyHashSlot("a")] = c.myself
+	c.slots[keyHashSlot("b")] = other
+	srv.clusterUpdateState()
+	cl = ev.NewClient(1)
+	assert.Equal(t, "$-1\r\n", handle(srv, cl, "EVAL", "return redis.pcall('get', KEYS[1])", "1", "a"))
+	assert.Equal(t, "-ERR Script attempted to access a non local key in a cluster node\r\n",
+		handle(srv, cl, "EVAL", "return redis.pcall('get', 'b')", "1", "a"))
+}
+
+func TestScriptBusy(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.config.BusyReplyThreshold = 50
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	cl := ev.NewClient(1)
+	other := ev.NewClient(2)
+
+	busyScript := "-BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.\r\n"
+	var replies []string
+	conns.whileBlocked = func() {
+		replies = append(replies,
+			handle(srv, other, "GET", "k"),
+			handle(srv, other, "SHUTDOWN"),
+			handle(srv, other, "SCRIPT", "KILL"))
+		conns.whileBlocked = nil
+	}
+	start := time.Now()
+	assert.Equal(t, "-ERR Script killed by user with SCRIPT KILL...\r\n",
+		handle(srv, cl, "EVAL", "while true do end", "0"))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.Equal(t, []string{busyScript, busyScript, "+OK\r\n"}, replies)
+	assert.Equal(t, int64(2), srv.stats.byCommand["get"].rejected+srv.stats.byCommand["shutdown"].rejected)
+	assert.Equal(t, "+PONG\r\n", handle(srv, other, "PING"))
+
+	// the scripts that wrote can not be killed, but SHUTDOWN NOSAVE stops
+	// them anyway
+	replies = nil
+	conns.whileBlocked = func() {
+		replies = append(replies,
+			handle(srv, other, "SCRIPT", "KILL"),
+			handle(srv, other, "SHUTDOWN", "NOSAVE"))
+	}
+	assert.Equal(t, "-ERR Script killed by user with SCRIPT KILL...\r\n",
+		handle(srv, cl, "EVAL", "redis.call('set', 'k', 'v') while true do end", "0"))
+	assert.True(t, strings.HasPrefix(replies[0], "-UNKILLABLE "))
+	assert.Equal(t, "", replies[1])
+	assert.True(t, conns.stopped)
+}
+
+func TestScriptWriteAfterTimeout(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.config.BusyReplyThreshold = 10
+	srv.SetConnections(&fakeConnections{})
+	cl := ev.NewClient(1)
+
+	// the dataset may not change once the other clients are told the
+	// server is busy
+	script := "local i = 0 while i < 3000000 do i = i + 1 end return redis.pcall('set', 'k', 'v')"
+	res := handle(srv, cl, "EVAL", script, "0")
+	assert.Equal(t, "-BUSY Redis is busy running a script.\r\n", res)
+	assert.False(t, srv.Db(cl).Exists("k"))
+}
+
+func TestScriptNotBusy(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "-NOTBUSY No scripts in execution right now.\r\n", handle(srv, cl, "SCRIPT", "KILL"))
+	assert.Nil(t, srv.scripts.running)
+	assert.False(t, srv.scriptBusy(nil))
+}
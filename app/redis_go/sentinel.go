@@ -0,0 +1,1095 @@
+package redis_go
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sentinelHelloChannel is where the sentinels announce themselves and
+	// their config of the masters, on the masters and the replicas
+	sentinelHelloChannel = "__sentinel__:hello"
+
+	sentinelInfoPeriod  = 10 * time.Second
+	sentinelPingPeriod  = time.Second
+	sentinelAskPeriod   = time.Second
+	sentinelHelloPeriod = 2 * time.Second
+	// sentinelMaxDesync is the most a failover is delayed by, so that the
+	// sentinels do not all ask for votes at once
+	sentinelMaxDesync = time.Second
+	// sentinelElectionTimeout is how long a sentinel waits to be elected
+	// before it gives up the failover, unless the failover timeout is
+	// shorter
+	sentinelElectionTimeout = 10 * time.Second
+	// sentinelSlaveReconfTimeout is how long a replica told to replicate
+	// the promoted one has to start doing so
+	sentinelSlaveReconfTimeout = 10 * time.Second
+	// sentinelDefaultSlavePriority is the priority of a replica that does
+	// not report one
+	sentinelDefaultSlavePriority = 100
+)
+
+// The flags of an instance, as shown by SENTINEL MASTERS and the like.
+const (
+	sriMaster = 1 << iota
+	sriSlave
+	sriSentinel
+	// sriSdown instances do not answer this sentinel, and sriOdown masters
+	// do not answer a quorum of sentinels
+	sriSdown
+	sriOdown
+	// sriMasterDown sentinels told the master is down in their last reply
+	// to SENTINEL IS-MASTER-DOWN-BY-ADDR
+	sriMasterDown
+	sriFailoverInProgress
+	// sriPromoted is the replica picked to replace the master, and the
+	// sriReconf flags track the others being told to replicate it
+	sriPromoted
+	sriReconfSent
+	sriReconfInprog
+	sriReconfDone
+)
+
+var sriFlagNames = []struct {
+	flag int
+	name string
+}{
+	{sriMaster, "master"},
+	{sriSlave, "slave"},
+	{sriSentinel, "sentinel"},
+	{sriSdown, "s_down"},
+	{sriOdown, "o_down"},
+	{sriMasterDown, "master_down"},
+	{sriFailoverInProgress, "failover_in_progress"},
+	{sriPromoted, "promoted"},
+	{sriReconfSent, "reconf_sent"},
+	{sriReconfInprog, "reconf_inprog"},
+	{sriReconfDone, "reconf_done"},
+}
+
+// The states of a failover, in the order it goes through them.
+const (
+	failoverStateNone = iota
+	// failoverStateWaitStart waits for this sentinel to be elected leader
+	failoverStateWaitStart
+	failoverStateSelectSlave
+	failoverStateSendSlaveofNoone
+	failoverStateWaitPromotion
+	failoverStateReconfSlaves
+	// failoverStateUpdateConfig is once every replica replicates the
+	// promoted one, which then replaces the master
+	failoverStateUpdateConfig
+)
+
+var failoverStateNames = []string{
+	"none", "wait_start", "select_slave", "send_slaveof_noone", "wait_promotion",
+	"reconf_slaves", "update_config",
+}
+
+// sentinelInstance is a master, a replica or another sentinel, as known
+// by this sentinel.
+type sentinelInstance struct {
+	flags int
+	// name is the name of the masters, and ip:port for the others
+	name        string
+	runId       string
+	configEpoch uint64
+	ip          string
+	port        int
+	link        *sentinelLink
+	downAfter   time.Duration
+	// lastPubTime is when the last hello was sent to the instance, and
+	// lastHelloTime when the last one of a sentinel was received
+	lastPubTime   time.Time
+	lastHelloTime time.Time
+	// lastMasterDownReplyTime is when a sentinel last answered whether the
+	// master is down
+	lastMasterDownReplyTime time.Time
+	sDownSinceTime          time.Time
+	oDownSinceTime          time.Time
+	infoRefresh             time.Time
+	// roleReported is the role in the last INFO, sriMaster or sriSlave
+	roleReported     int
+	roleReportedTime time.Time
+
+	// sentinels are the other sentinels monitoring a master, by run id,
+	// and slaves its replicas, by ip:port
+	sentinels     map[string]*sentinelInstance
+	slaves        map[string]*sentinelInstance
+	quorum        int
+	parallelSyncs int
+	authPass      string
+
+	// master is the master of a replica or of a sentinel
+	master                *sentinelInstance
+	masterLinkDownTime    time.Duration
+	slavePriority         int
+	slaveReconfSentTime   time.Time
+	slaveMasterHost       string
+	slaveMasterPort       int
+	slaveMasterLinkStatus bool
+	slaveReplOffset       int64
+
+	// leader is the sentinel voted for as the leader of the failover of
+	// leaderEpoch, by this one for a master and by the sentinel otherwise
+	leader      string
+	leaderEpoch uint64
+	// failoverEpoch is the epoch of the failover in progress
+	failoverEpoch           uint64
+	failoverState           int
+	failoverStateChangeTime time.Time
+	failoverStartTime       time.Time
+	failoverTimeout         time.Duration
+	promotedSlave           *sentinelInstance
+}
+
+func newSentinelInstance(flags int, name string, ip string, port int, master *sentinelInstance) *sentinelInstance {
+	ri := &sentinelInstance{
+		flags:            flags,
+		name:             name,
+		ip:               ip,
+		port:             port,
+		link:             newSentinelLink(),
+		roleReported:     flags & (sriMaster | sriSlave),
+		roleReportedTime: time.Now(),
+		slavePriority:    sentinelDefaultSlavePriority,
+		master:           master,
+	}
+	if master != nil {
+		ri.downAfter = master.downAfter
+	}
+	return ri
+}
+
+func (ri *sentinelInstance) addr() string {
+	return net.JoinHostPort(ri.ip, strconv.Itoa(ri.port))
+}
+
+// sentinel is the state of the sentinel mode: the masters monitored, with
+// their replicas and the other sentinels monitoring them. It is only
+// accessed by the loop, the links hand over what happens on them to
+// sentinelTimer.
+type sentinel struct {
+	myid         string
+	currentEpoch uint64
+	masters      map[string]*sentinelInstance
+	mu           sync.Mutex
+	inbox        []func()
+}
+
+func newSentinel(config *Config) *sentinel {
+	sn := &sentinel{
+		myid:    randomNodeId(),
+		masters: map[string]*sentinelInstance{},
+	}
+	for _, m := range config.SentinelMasters {
+		ri := newSentinelInstance(sriMaster, m.Name, m.Ip, m.Port, nil)
+		ri.quorum = m.Quorum
+		ri.downAfter = time.Duration(m.DownAfter) * time.Millisecond
+		ri.failoverTimeout = time.Duration(m.FailoverTimeout) * time.Millisecond
+		ri.parallelSyncs = m.ParallelSyncs
+		ri.authPass = m.AuthPass
+		ri.sentinels = map[string]*sentinelInstance{}
+		ri.slaves = map[string]*sentinelInstance{}
+		sn.masters[m.Name] = ri
+	}
+	return sn
+}
+
+// post hands fn over to the loop, which runs it in sentinelTimer. It is
+// safe to call from any goroutine.
+func (sn *sentinel) post(fn func()) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	sn.inbox = append(sn.inbox, fn)
+}
+
+func (sn *sentinel) events() []func() {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+	events := sn.inbox
+	sn.inbox = nil
+	return events
+}
+
+// sortedInstances returns the instances sorted by key, so that they are
+// handled and listed in a stable order.
+func sortedInstances(instances map[string]*sentinelInstance) []*sentinelInstance {
+	keys := make([]string, 0, len(instances))
+	for k := range instances {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]*sentinelInstance, len(keys))
+	for i, k := range keys {
+		res[i] = instances[k]
+	}
+	return res
+}
+
+// sentinelTimer does the periodic work of the sentinel mode: running what
+// the links handed over, then checking on each master, its replicas and
+// its sentinels.
+func (s *Server) sentinelTimer(now time.Time) {
+	sn := s.sentinel
+	if sn == nil {
+		return
+	}
+	for _, fn := range sn.events() {
+		fn()
+	}
+	for _, master := range sortedInstances(sn.masters) {
+		s.sentinelHandleInstance(master, now)
+		for _, ri := range sortedInstances(master.slaves) {
+			s.sentinelHandleInstance(ri, now)
+		}
+		for _, ri := range sortedInstances(master.sentinels) {
+			s.sentinelHandleInstance(ri, now)
+		}
+		if master.failoverState == failoverStateUpdateConfig {
+			s.sentinelFailoverSwitchToPromotedSlave(master)
+		}
+	}
+}
+
+func (s *Server) sentinelHandleInstance(ri *sentinelInstance, now time.Time) {
+	s.sentinelReconnectInstance(ri, now)
+	s.sentinelSendPeriodicCommands(ri, now)
+	s.sentinelCheckSubjectivelyDown(ri, now)
+	if ri.flags&sriMaster == 0 {
+		return
+	}
+	s.sentinelCheckObjectivelyDown(ri, now)
+	if s.sentinelStartFailoverIfNeeded(ri, now) {
+		s.sentinelAskMasterStateToOtherSentinels(ri, true, now)
+	}
+	s.sentinelFailoverStateMachine(ri, now)
+	s.sentinelAskMasterStateToOtherSentinels(ri, false, now)
+}
+
+// sentinelEvent publishes an event on the channel named after its type,
+// such as +sdown. The message starts with the instance, if any.
+func (s *Server) sentinelEvent(typ string, ri *sentinelInstance, msg string) {
+	if ri != nil {
+		desc := sentinelInstanceDesc(ri)
+		if msg != "" {
+			desc += " " + msg
+		}
+		msg = desc
+	}
+	s.publish(typ, msg)
+}
+
+// sentinelInstanceDesc is how events name an instance, such as
+// slave 127.0.0.1:6380 127.0.0.1 6380 @ mymaster 127.0.0.1 6379.
+func sentinelInstanceDesc(ri *sentinelInstance) string {
+	typ := "master"
+	switch {
+	case ri.flags&sriSlave != 0:
+		typ = "slave"
+	case ri.flags&sriSentinel != 0:
+		typ = "sentinel"
+	}
+	desc := typ + " " + ri.name + " " + ri.ip + " " + strconv.Itoa(ri.port)
+	if ri.master != nil {
+		desc += " @ " + ri.master.name + " " + ri.master.ip + " " + strconv.Itoa(ri.master.port)
+	}
+	return desc
+}
+
+// sentinelReconnectInstance connects to the instance once its link is
+// down. The masters and the replicas get a second connection subscribed
+// to the hello channel.
+func (s *Server) sentinelReconnectInstance(ri *sentinelInstance, now time.Time) {
+	l := ri.link
+	if !l.disconnected || now.Sub(l.lastReconnTime) < sentinelPingPeriod {
+		return
+	}
+	l.lastReconnTime = now
+	sn := s.sentinel
+	onClose := func(c *sentinelConn) {
+		if l.disconnected || (l.cc != c && l.pc != c) {
+			return
+		}
+		l.disconnected = true
+		l.close()
+		l.cc, l.pc = nil, nil
+	}
+
+	var cc *sentinelConn
+	cc = sn.dialSentinelConn(ri.addr(), func(localIp string) {
+		if l.cc == cc {
+			l.ccConnTime = time.Now()
+			l.localIp = localIp
+		}
+	}, func() { onClose(cc) }, nil)
+	l.cc, l.pendingCommands, l.disconnected = cc, 0, false
+
+	authPass := ""
+	if ri.flags&sriSentinel == 0 {
+		master := ri
+		if ri.master != nil {
+			master = ri.master
+		}
+		authPass = master.authPass
+	}
+	if authPass != "" {
+		l.send([]string{"AUTH", authPass}, nil)
+	}
+	l.send([]string{"CLIENT", "SETNAME", "sentinel-" + sn.myid[:8] + "-cmd"}, nil)
+	s.sentinelSendPing(ri, now)
+
+	if ri.flags&sriSentinel != 0 {
+		return
+	}
+	var pc *sentinelConn
+	pc = sn.dialSentinelConn(ri.addr(), func(string) {}, func() { onClose(pc) },
+		func(channel string, message string) {
+			if channel == sentinelHelloChannel {
+				s.sentinelProcessHelloMessage(message)
+			}
+		})
+	l.pc = pc
+	if authPass != "" {
+		pc.send([]string{"AUTH", authPass}, nil)
+	}
+	pc.send([]string{"CLIENT", "SETNAME", "sentinel-" + sn.myid[:8] + "-pubsub"}, nil)
+	pc.send([]string{"SUBSCRIBE", sentinelHelloChannel}, nil)
+}
+
+// sentinelSendPeriodicCommands sends INFO to the masters and the
+// replicas, pings and hello messages, unless too many commands are
+// waiting for a reply already.
+func (s *Server) sentinelSendPeriodicCommands(ri *sentinelInstance, now time.Time) {
+	l := ri.link
+	if l.disconnected || l.pendingCommands >= sentinelMaxPendingCommands {
+		return
+	}
+
+	infoPeriod := sentinelInfoPeriod
+	// the replicas are watched more closely while their master fails over,
+	// to notice the promotion and the reconfiguration sooner
+	if ri.flags&sriSlave != 0 && ri.master.flags&(sriOdown|sriFailoverInProgress) != 0 {
+		infoPeriod = time.Second
+	}
+	pingPeriod := ri.downAfter
+	if pingPeriod > sentinelPingPeriod {
+		pingPeriod = sentinelPingPeriod
+	}
+
+	if ri.flags&sriSentinel == 0 && (ri.infoRefresh.IsZero() || now.Sub(ri.infoRefresh) > infoPeriod) {
+		l.send([]string{"INFO"}, func(reply interface{}) {
+			if info, ok := reply.(string); ok {
+				s.sentinelRefreshInstanceInfo(ri, info, time.Now())
+			}
+		})
+		// another INFO is not sent before this one is answered, or the
+		// period is over again
+		ri.infoRefresh = now
+	}
+	if now.Sub(l.lastPongTime) > pingPeriod && now.Sub(l.lastPingTime) > pingPeriod/2 {
+		s.sentinelSendPing(ri, now)
+	}
+	if now.Sub(ri.lastPubTime) > sentinelHelloPeriod {
+		s.sentinelSendHello(ri, now)
+	}
+}
+
+func (s *Server) sentinelSendPing(ri *sentinelInstance, now time.Time) {
+	l := ri.link
+	ok := l.send([]string{"PING"}, func(reply interface{}) {
+		now := time.Now()
+		l.lastPongTime = now
+		var status string
+		switch r := reply.(type) {
+		case replyStatus:
+			status = string(r)
+		case replyError:
+			status = string(r)
+		}
+		// an instance loading its dataset or not serving stale data is
+		// still up
+		if status == "PONG" || strings.HasPrefix(status, "LOADING") || strings.HasPrefix(status, "MASTERDOWN") {
+			l.lastAvailTime = now
+			l.actPingTime = time.Time{}
+		}
+	})
+	if !ok {
+		return
+	}
+	l.lastPingTime = now
+	if l.actPingTime.IsZero() {
+		l.actPingTime = now
+	}
+}
+
+// sentinelSendHello announces this sentinel and its config of the master
+// of the instance, as
+// ip,port,runid,current_epoch,master_name,master_ip,master_port,master_config_epoch.
+// It is published to the masters and the replicas, and sent to the other
+// sentinels directly.
+func (s *Server) sentinelSendHello(ri *sentinelInstance, now time.Time) {
+	l := ri.link
+	if l.localIp == "" {
+		return
+	}
+	master := ri
+	if ri.master != nil {
+		master = ri.master
+	}
+	ip, port := sentinelCurrentMasterAddress(master)
+	payload := strings.Join([]string{
+		l.localIp, strconv.Itoa(s.config.Port), s.sentinel.myid,
+		strconv.FormatUint(s.sentinel.currentEpoch, 10), master.name, ip, strconv.Itoa(port),
+		strconv.FormatUint(master.configEpoch, 10),
+	}, ",")
+	if l.send([]string{"PUBLISH", sentinelHelloChannel, payload}, nil) {
+		ri.lastPubTime = now
+	}
+}
+
+// sentinelCurrentMasterAddress is the address of the master, or of the
+// replica promoted once the failover got that far.
+func sentinelCurrentMasterAddress(master *sentinelInstance) (string, int) {
+	if master.flags&sriFailoverInProgress != 0 && master.promotedSlave != nil &&
+		master.failoverState >= failoverStateReconfSlaves {
+		return master.promotedSlave.ip, master.promotedSlave.port
+	}
+	return master.ip, master.port
+}
+
+// sentinelProcessHelloMessage learns about the sentinel announcing itself,
+// and switches to its config of the master when it is newer.
+func (s *Server) sentinelProcessHelloMessage(hello string) {
+	sn := s.sentinel
+	token := strings.Split(hello, ",")
+	if len(token) != 8 {
+		return
+	}
+	master := sn.masters[token[4]]
+	if master == nil || token[2] == sn.myid {
+		return
+	}
+	port, err1 := strconv.Atoi(token[1])
+	epoch, err2 := strconv.ParseUint(token[3], 10, 64)
+	masterPort, err3 := strconv.Atoi(token[6])
+	masterConfigEpoch, err4 := strconv.ParseUint(token[7], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return
+	}
+
+	si := master.sentinels[token[2]]
+	if si == nil {
+		// a sentinel restarted with another run id is known at the same
+		// address already
+		for runId, other := range master.sentinels {
+			if other.ip == token[0] && other.port == port {
+				other.link.close()
+				delete(master.sentinels, runId)
+			}
+		}
+		name := net.JoinHostPort(token[0], token[1])
+		si = newSentinelInstance(sriSentinel, name, token[0], port, master)
+		si.runId = token[2]
+		master.sentinels[si.runId] = si
+		s.sentinelEvent("+sentinel", si, "")
+	}
+
+	if epoch > sn.currentEpoch {
+		sn.currentEpoch = epoch
+		s.sentinelEvent("+new-epoch", nil, token[3])
+	}
+	if master.configEpoch < masterConfigEpoch {
+		master.configEpoch = masterConfigEpoch
+		if token[5] != master.ip || masterPort != master.port {
+			s.sentinelEvent("+config-update-from", si, "")
+			s.sentinelEvent("+switch-master", nil, master.name+" "+master.ip+" "+
+				strconv.Itoa(master.port)+" "+token[5]+" "+token[6])
+			s.sentinelResetMasterAndChangeAddress(master, token[5], masterPort)
+		}
+	}
+	si.lastHelloTime = time.Now()
+}
+
+// sentinelRefreshInstanceInfo reads the INFO of a master or a replica: its
+// run id, its role, the replicas of a master and the master of a replica.
+// It notices the promotion of the replica picked by a failover, and the
+// other replicas replicating it.
+func (s *Server) sentinelRefreshInstanceInfo(ri *sentinelInstance, info string, now time.Time) {
+	ri.infoRefresh = now
+	role := 0
+	ri.masterLinkDownTime = 0
+	for _, line := range strings.Split(info, "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "run_id" && len(value) == 40:
+			if ri.runId != "" && ri.runId != value {
+				s.sentinelEvent("+reboot", ri, "")
+			}
+			ri.runId = value
+		case name == "role" && value == "master":
+			role = sriMaster
+		case name == "role" && value == "slave":
+			role = sriSlave
+		case strings.HasPrefix(name, "slave") && ri.flags&sriMaster != 0:
+			if _, err := strconv.Atoi(name[len("slave"):]); err != nil {
+				continue
+			}
+			ip, port := "", 0
+			for _, field := range strings.Split(value, ",") {
+				k, v, _ := strings.Cut(field, "=")
+				if k == "ip" {
+					ip = v
+				} else if k == "port" {
+					port, _ = strconv.Atoi(v)
+				}
+			}
+			if ip == "" || port == 0 {
+				continue
+			}
+			addr := net.JoinHostPort(ip, strconv.Itoa(port))
+			if ri.slaves[addr] == nil {
+				slave := newSentinelInstance(sriSlave, addr, ip, port, ri)
+				ri.slaves[addr] = slave
+				s.sentinelEvent("+slave", slave, "")
+			}
+		case name == "master_link_down_since_seconds":
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				ri.masterLinkDownTime = time.Duration(n) * time.Second
+			}
+		case name == "master_host":
+			ri.slaveMasterHost = value
+		case name == "master_port":
+			ri.slaveMasterPort, _ = strconv.Atoi(value)
+		case name == "master_link_status":
+			ri.slaveMasterLinkStatus = value == "up"
+		case name == "slave_priority" || name == "replica_priority":
+			if n, err := strconv.Atoi(value); err == nil {
+				ri.slavePriority = n
+			}
+		case name == "slave_repl_offset":
+			ri.slaveReplOffset, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	if role == 0 {
+		return
+	}
+	if role != ri.roleReported {
+		ri.roleReported = role
+		ri.roleReportedTime = now
+		roleName := "master"
+		if role == sriSlave {
+			roleName = "slave"
+		}
+		s.sentinelEvent("+role-change", ri, "new reported role is "+roleName)
+	}
+	if ri.flags&sriSlave == 0 {
+		return
+	}
+
+	master := ri.master
+	if role == sriMaster && ri.flags&sriPromoted != 0 &&
+		master.flags&sriFailoverInProgress != 0 && master.failoverState == failoverStateWaitPromotion {
+		// the failover is as good as done once the replica is promoted, the
+		// other sentinels learn the new config from the hello messages
+		master.configEpoch = master.failoverEpoch
+		master.failoverState = failoverStateReconfSlaves
+		master.failoverStateChangeTime = now
+		s.sentinelEvent("+promoted-slave", ri, "")
+		s.sentinelEvent("+failover-state-reconf-slaves", master, "")
+		return
+	}
+
+	promoted := master.promotedSlave
+	if role != sriSlave || promoted == nil || ri.flags&(sriReconfSent|sriReconfInprog) == 0 ||
+		ri.slaveMasterHost != promoted.ip || ri.slaveMasterPort != promoted.port {
+		return
+	}
+	if ri.flags&sriReconfSent != 0 {
+		ri.flags &^= sriReconfSent
+		ri.flags |= sriReconfInprog
+		s.sentinelEvent("+slave-reconf-inprog", ri, "")
+	}
+	if ri.flags&sriReconfInprog != 0 && ri.slaveMasterLinkStatus {
+		ri.flags &^= sriReconfInprog
+		ri.flags |= sriReconfDone
+		s.sentinelEvent("+slave-reconf-done", ri, "")
+	}
+}
+
+// sentinelCheckSubjectivelyDown flags the instance sdown once it did not
+// answer the pings for down-after-milliseconds, or, for a master, once it
+// reports to be a replica for longer than that.
+func (s *Server) sentinelCheckSubjectivelyDown(ri *sentinelInstance, now time.Time) {
+	l := ri.link
+	var elapsed time.Duration
+	if !l.actPingTime.IsZero() {
+		elapsed = now.Sub(l.actPingTime)
+	} else if l.disconnected {
+		elapsed = now.Sub(l.lastAvailTime)
+	}
+
+	// a connection that stopped answering is closed so that it is opened
+	// again, but not too often
+	if !l.disconnected && !l.ccConnTime.IsZero() && now.Sub(l.ccConnTime) >= sentinelMinLinkReconnectPeriod &&
+		!l.actPingTime.IsZero() && now.Sub(l.actPingTime) > ri.downAfter/2 &&
+		now.Sub(l.lastPongTime) > ri.downAfter/2 {
+		l.disconnected = true
+		l.close()
+		l.cc, l.pc = nil, nil
+	}
+
+	down := elapsed > ri.downAfter ||
+		(ri.flags&sriMaster != 0 && ri.roleReported == sriSlave &&
+			now.Sub(ri.roleReportedTime) > ri.downAfter+2*sentinelInfoPeriod)
+	if down && ri.flags&sriSdown == 0 {
+		ri.flags |= sriSdown
+		ri.sDownSinceTime = now
+		s.sentinelEvent("+sdown", ri, "")
+	} else if !down && ri.flags&sriSdown != 0 {
+		ri.flags &^= sriSdown
+		s.sentinelEvent("-sdown", ri, "")
+	}
+}
+
+// sentinelCheckObjectivelyDown flags the master odown once enough
+// sentinels, this one included, see it sdown to reach the quorum.
+func (s *Server) sentinelCheckObjectivelyDown(master *sentinelInstance, now time.Time) {
+	quorum := 0
+	if master.flags&sriSdown != 0 {
+		quorum = 1
+		for _, si := range master.sentinels {
+			if si.flags&sriMasterDown != 0 {
+				quorum++
+			}
+		}
+	}
+	odown := master.flags&sriSdown != 0 && quorum >= master.quorum
+
+	if odown && master.flags&sriOdown == 0 {
+		master.flags |= sriOdown
+		master.oDownSinceTime = now
+		s.sentinelEvent("+odown", master, "#quorum "+strconv.Itoa(quorum)+"/"+strconv.Itoa(master.quorum))
+	} else if !odown && master.flags&sriOdown != 0 {
+		master.flags &^= sriOdown
+		s.sentinelEvent("-odown", master, "")
+	}
+}
+
+// sentinelAskMasterStateToOtherSentinels asks the sentinels whether they
+// see the master down, once a second while this one does or at once when
+// forced. Once a failover started, the question is a request for a vote
+// too.
+func (s *Server) sentinelAskMasterStateToOtherSentinels(master *sentinelInstance, forced bool, now time.Time) {
+	sn := s.sentinel
+	for _, si := range sortedInstances(master.sentinels) {
+		elapsed := now.Sub(si.lastMasterDownReplyTime)
+		// a reply too old is as good as none
+		if elapsed > sentinelAskPeriod*5 {
+			si.flags &^= sriMasterDown
+			si.leader = ""
+		}
+		if master.flags&sriSdown == 0 || si.link.disconnected {
+			continue
+		}
+		if !forced && elapsed < sentinelAskPeriod {
+			continue
+		}
+
+		runId := "*"
+		if master.failoverState > failoverStateNone {
+			runId = sn.myid
+		}
+		si := si
+		si.link.send([]string{
+			"SENTINEL", "is-master-down-by-addr", master.ip, strconv.Itoa(master.port),
+			strconv.FormatUint(sn.currentEpoch, 10), runId,
+		}, func(reply interface{}) {
+			r, ok := reply.([]interface{})
+			if !ok || len(r) != 3 {
+				return
+			}
+			down, ok1 := r[0].(int64)
+			leader, ok2 := r[1].(string)
+			epoch, ok3 := r[2].(int64)
+			if !ok1 || !ok2 || !ok3 {
+				return
+			}
+			si.lastMasterDownReplyTime = time.Now()
+			if down == 1 {
+				si.flags |= sriMasterDown
+			} else {
+				si.flags &^= sriMasterDown
+			}
+			if leader != "*" {
+				si.leader = leader
+				si.leaderEpoch = uint64(epoch)
+			}
+		})
+	}
+}
+
+// sentinelVoteLeader votes for the sentinel asking to lead the failover of
+// the master in reqEpoch, unless this one voted in that epoch already.
+// It returns the sentinel voted for, and in which epoch.
+func (s *Server) sentinelVoteLeader(master *sentinelInstance, reqEpoch uint64, reqRunId string) (string, uint64) {
+	sn := s.sentinel
+	if reqEpoch > sn.currentEpoch {
+		sn.currentEpoch = reqEpoch
+		s.sentinelEvent("+new-epoch", nil, strconv.FormatUint(reqEpoch, 10))
+	}
+	if master.leaderEpoch < reqEpoch && sn.currentEpoch <= reqEpoch {
+		master.leader = reqRunId
+		master.leaderEpoch = sn.currentEpoch
+		s.sentinelEvent("+vote-for-leader", nil, reqRunId+" "+strconv.FormatUint(sn.currentEpoch, 10))
+		// this sentinel does not compete with the one it voted for
+		if reqRunId != sn.myid {
+			master.failoverStartTime = time.Now().Add(time.Duration(random.Int63n(int64(sentinelMaxDesync))))
+		}
+	}
+	return master.leader, master.leaderEpoch
+}
+
+// sentinelGetLeader counts the votes of the sentinels for the failover of
+// epoch, and returns the sentinel elected, if any. It needs the votes of
+// the majority of the sentinels and of the quorum at least.
+func (s *Server) sentinelGetLeader(master *sentinelInstance, epoch uint64) string {
+	sn := s.sentinel
+	votes := map[string]int{}
+	voters := len(master.sentinels) + 1
+	for _, si := range master.sentinels {
+		if si.leader != "" && si.leaderEpoch == sn.currentEpoch {
+			votes[si.leader]++
+		}
+	}
+	winner, maxVotes := sentinelMostVoted(votes)
+
+	// this sentinel votes for the winner so far, or for itself
+	candidate := winner
+	if candidate == "" {
+		candidate = sn.myid
+	}
+	myVote, leaderEpoch := s.sentinelVoteLeader(master, epoch, candidate)
+	if myVote != "" && leaderEpoch == epoch {
+		votes[myVote]++
+		winner, maxVotes = sentinelMostVoted(votes)
+	}
+
+	if winner == "" || maxVotes < voters/2+1 || maxVotes < master.quorum {
+		return ""
+	}
+	return winner
+}
+
+// sentinelMostVoted returns the sentinel with the most votes, the lowest
+// run id among the ties.
+func sentinelMostVoted(votes map[string]int) (string, int) {
+	winner, maxVotes := "", 0
+	for runId, n := range votes {
+		if n > maxVotes || (n == maxVotes && runId < winner) {
+			winner, maxVotes = runId, n
+		}
+	}
+	return winner, maxVotes
+}
+
+// sentinelStartFailoverIfNeeded starts a failover of the master once it
+// is odown, unless one was attempted in the last two failover timeouts.
+func (s *Server) sentinelStartFailoverIfNeeded(master *sentinelInstance, now time.Time) bool {
+	if master.flags&sriOdown == 0 || master.flags&sriFailoverInProgress != 0 ||
+		now.Sub(master.failoverStartTime) < master.failoverTimeout*2 {
+		return false
+	}
+
+	sn := s.sentinel
+	master.failoverState = failoverStateWaitStart
+	master.flags |= sriFailoverInProgress
+	sn.currentEpoch++
+	master.failoverEpoch = sn.currentEpoch
+	s.sentinelEvent("+new-epoch", nil, strconv.FormatUint(sn.currentEpoch, 10))
+	s.sentinelEvent("+try-failover", master, "")
+	master.failoverStartTime = now.Add(time.Duration(random.Int63n(int64(sentinelMaxDesync))))
+	master.failoverStateChangeTime = now
+	return true
+}
+
+func (s *Server) sentinelFailoverStateMachine(master *sentinelInstance, now time.Time) {
+	if master.flags&sriFailoverInProgress == 0 {
+		return
+	}
+	switch master.failoverState {
+	case failoverStateWaitStart:
+		s.sentinelFailoverWaitStart(master, now)
+	case failoverStateSelectSlave:
+		s.sentinelFailoverSelectSlave(master, now)
+	case failoverStateSendSlaveofNoone:
+		s.sentinelFailoverSendSlaveOfNoOne(master, now)
+	case failoverStateWaitPromotion:
+		if now.Sub(master.failoverStateChangeTime) > master.failoverTimeout {
+			s.sentinelEvent("-failover-abort-slave-timeout", master, "")
+			sentinelAbortFailover(master, now)
+		}
+	case failoverStateReconfSlaves:
+		s.sentinelFailoverReconfNextSlave(master, now)
+	}
+}
+
+func (s *Server) sentinelFailoverWaitStart(master *sentinelInstance, now time.Time) {
+	leader := s.sentinelGetLeader(master, master.failoverEpoch)
+	if leader != s.sentinel.myid {
+		electionTimeout := sentinelElectionTimeout
+		if master.failoverTimeout < electionTimeout {
+			electionTimeout = master.failoverTimeout
+		}
+		if now.Sub(master.failoverStartTime) > electionTimeout {
+			s.sentinelEvent("-failover-abort-not-elected", master, "")
+			sentinelAbortFailover(master, now)
+		}
+		return
+	}
+	s.sentinelEvent("+elected-leader", master, "")
+	master.failoverState = failoverStateSelectSlave
+	master.failoverStateChangeTime = now
+	s.sentinelEvent("+failover-state-select-slave", master, "")
+}
+
+func (s *Server) sentinelFailoverSelectSlave(master *sentinelInstance, now time.Time) {
+	slave := sentinelSelectSlave(master, now)
+	if slave == nil {
+		s.sentinelEvent("-failover-abort-no-good-slave", master, "")
+		sentinelAbortFailover(master, now)
+		return
+	}
+	s.sentinelEvent("+selected-slave", slave, "")
+	slave.flags |= sriPromoted
+	master.promotedSlave = slave
+	master.failoverState = failoverStateSendSlaveofNoone
+	master.failoverStateChangeTime = now
+	s.sentinelEvent("+failover-state-send-slaveof-noone", slave, "")
+}
+
+// sentinelSelectSlave picks the replica to promote among the ones that
+// are up, answered lately, and were not disconnected from the master for
+// too long: the one with the lowest priority, then the most data, then
+// the lowest run id.
+func sentinelSelectSlave(master *sentinelInstance, now time.Time) *sentinelInstance {
+	maxMasterDownTime := master.downAfter * 10
+	if master.flags&sriSdown != 0 {
+		maxMasterDownTime += now.Sub(master.sDownSinceTime)
+	}
+	infoValidity := 3 * sentinelInfoPeriod
+	if master.flags&sriSdown != 0 {
+		infoValidity = 5 * sentinelPingPeriod
+	}
+
+	var candidates []*sentinelInstance
+	for _, slave := range master.slaves {
+		if slave.flags&(sriSdown|sriOdown) != 0 || slave.link.disconnected ||
+			now.Sub(slave.link.lastAvailTime) > 5*sentinelPingPeriod ||
+			slave.slavePriority == 0 || now.Sub(slave.infoRefresh) > infoValidity ||
+			slave.masterLinkDownTime > maxMasterDownTime {
+			continue
+		}
+		candidates = append(candidates, slave)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.slavePriority != b.slavePriority {
+			return a.slavePriority < b.slavePriority
+		}
+		if a.slaveReplOffset != b.slaveReplOffset {
+			return a.slaveReplOffset > b.slaveReplOffset
+		}
+		// a replica with no run id yet comes last
+		if (a.runId == "") != (b.runId == "") {
+			return b.runId == ""
+		}
+		return a.runId < b.runId
+	})
+	return candidates[0]
+}
+
+func (s *Server) sentinelFailoverSendSlaveOfNoOne(master *sentinelInstance, now time.Time) {
+	promoted := master.promotedSlave
+	if promoted.link.disconnected {
+		if now.Sub(master.failoverStateChangeTime) > master.failoverTimeout {
+			s.sentinelEvent("-failover-abort-slave-timeout", promoted, "")
+			sentinelAbortFailover(master, now)
+		}
+		return
+	}
+	if !sentinelSendSlaveOf(promoted, "", 0) {
+		return
+	}
+	s.sentinelEvent("+failover-state-wait-promotion", promoted, "")
+	master.failoverState = failoverStateWaitPromotion
+	master.failoverStateChangeTime = now
+}
+
+// sentinelSendSlaveOf turns the instance into a replica of host:port, or
+// into a master when host is empty.
+func sentinelSendSlaveOf(ri *sentinelInstance, host string, port int) bool {
+	argv := []string{"REPLICAOF", "NO", "ONE"}
+	if host != "" {
+		argv = []string{"REPLICAOF", host, strconv.Itoa(port)}
+	}
+	return ri.link.send(argv, nil)
+}
+
+// sentinelFailoverReconfNextSlave tells the replicas to replicate the
+// promoted one, parallel-syncs at a time.
+func (s *Server) sentinelFailoverReconfNextSlave(master *sentinelInstance, now time.Time) {
+	promoted := master.promotedSlave
+	inProgress := 0
+	for _, slave := range master.slaves {
+		if slave.flags&(sriReconfSent|sriReconfInprog) != 0 {
+			inProgress++
+		}
+	}
+
+	for _, slave := range sortedInstances(master.slaves) {
+		if inProgress >= master.parallelSyncs {
+			break
+		}
+		if slave.flags&(sriPromoted|sriReconfDone) != 0 {
+			continue
+		}
+		// a replica that did not start replicating in time is given up on
+		if slave.flags&sriReconfSent != 0 && now.Sub(slave.slaveReconfSentTime) > sentinelSlaveReconfTimeout {
+			s.sentinelEvent("-slave-reconf-sent-timeout", slave, "")
+			slave.flags &^= sriReconfSent
+			slave.flags |= sriReconfDone
+			continue
+		}
+		if slave.flags&(sriReconfSent|sriReconfInprog) != 0 || slave.link.disconnected {
+			continue
+		}
+		if sentinelSendSlaveOf(slave, promoted.ip, promoted.port) {
+			slave.flags |= sriReconfSent
+			slave.slaveReconfSentTime = now
+			s.sentinelEvent("+slave-reconf-sent", slave, "")
+			inProgress++
+		}
+	}
+	s.sentinelFailoverDetectEnd(master, now)
+}
+
+// sentinelFailoverDetectEnd ends the failover once every replica that is
+// up replicates the promoted one, or once the failover timed out.
+func (s *Server) sentinelFailoverDetectEnd(master *sentinelInstance, now time.Time) {
+	promoted := master.promotedSlave
+	if promoted == nil || promoted.flags&sriSdown != 0 {
+		return
+	}
+	notReconfigured := 0
+	for _, slave := range master.slaves {
+		if slave.flags&(sriPromoted|sriReconfDone|sriSdown) == 0 {
+			notReconfigured++
+		}
+	}
+	timeout := now.Sub(master.failoverStateChangeTime) > master.failoverTimeout
+	if timeout {
+		notReconfigured = 0
+		s.sentinelEvent("-failover-end-for-timeout", master, "")
+	}
+	if notReconfigured > 0 {
+		return
+	}
+	s.sentinelEvent("+failover-end", master, "")
+	master.failoverState = failoverStateUpdateConfig
+	master.failoverStateChangeTime = now
+
+	// the replicas left behind are told all at once
+	if !timeout {
+		return
+	}
+	for _, slave := range sortedInstances(master.slaves) {
+		if slave.flags&(sriPromoted|sriReconfDone|sriReconfSent) != 0 || slave.link.disconnected {
+			continue
+		}
+		if sentinelSendSlaveOf(slave, promoted.ip, promoted.port) {
+			slave.flags |= sriReconfSent
+			s.sentinelEvent("+slave-reconf-sent-be", slave, "")
+		}
+	}
+}
+
+func sentinelAbortFailover(master *sentinelInstance, now time.Time) {
+	master.flags &^= sriFailoverInProgress
+	master.failoverState = failoverStateNone
+	master.failoverStateChangeTime = now
+	if master.promotedSlave != nil {
+		master.promotedSlave.flags &^= sriPromoted
+		master.promotedSlave = nil
+	}
+}
+
+func (s *Server) sentinelFailoverSwitchToPromotedSlave(master *sentinelInstance) {
+	promoted := master.promotedSlave
+	s.sentinelEvent("+switch-master", nil, master.name+" "+master.ip+" "+strconv.Itoa(master.port)+" "+
+		promoted.ip+" "+strconv.Itoa(promoted.port))
+	s.sentinelResetMasterAndChangeAddress(master, promoted.ip, promoted.port)
+}
+
+// sentinelResetMasterAndChangeAddress makes ip:port the master, once it
+// replaced the master after a failover. The old master and the other
+// replicas become its replicas, and the sentinels are kept.
+func (s *Server) sentinelResetMasterAndChangeAddress(master *sentinelInstance, ip string, port int) {
+	newAddr := net.JoinHostPort(ip, strconv.Itoa(port))
+	var addrs [][2]string
+	for _, slave := range sortedInstances(master.slaves) {
+		slave.link.close()
+		if slave.addr() != newAddr {
+			addrs = append(addrs, [2]string{slave.ip, strconv.Itoa(slave.port)})
+		}
+	}
+	if master.addr() != newAddr {
+		addrs = append(addrs, [2]string{master.ip, strconv.Itoa(master.port)})
+	}
+
+	master.link.close()
+	master.link = newSentinelLink()
+	master.flags = sriMaster
+	master.ip, master.port = ip, port
+	master.runId = ""
+	master.infoRefresh = time.Time{}
+	master.roleReported = sriMaster
+	master.roleReportedTime = time.Now()
+	master.leader = ""
+	master.failoverState = failoverStateNone
+	master.failoverStateChangeTime = time.Time{}
+	master.failoverStartTime = time.Time{}
+	master.promotedSlave = nil
+	for _, si := range master.sentinels {
+		si.flags &^= sriMasterDown
+		si.leader = ""
+	}
+
+	master.slaves = map[string]*sentinelInstance{}
+	for _, a := range addrs {
+		port, _ := strconv.Atoi(a[1])
+		addr := net.JoinHostPort(a[0], a[1])
+		master.slaves[addr] = newSentinelInstance(sriSlave, addr, a[0], port, master)
+	}
+}
+
+// sentinelMasterByAddr returns the master monitored at ip:port, if any.
+func (sn *sentinel) masterByAddr(ip string, port int) *sentinelInstance {
+	for _, master := range sn.masters {
+		if master.ip == ip && master.port == port {
+			return master
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errNoSuchMasterName = "-ERR No such master with that name"
+
+type SentinelCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	args       []string
+	// port and epoch are read from the arguments of IS-MASTER-DOWN-BY-ADDR
+	port  int
+	epoch uint64
+}
+
+func NewSentinelCommand(rr RespReader) *SentinelCommand {
+	return &SentinelCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *SentinelCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	c.args, err = readBulkStrings(c.reader, len-1)
+	if err != nil {
+		return
+	}
+
+	n := len - 1
+	switch c.subcommand {
+	case "MASTERS", "MYID":
+		if n != 0 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "MASTER", "REPLICAS", "SLAVES", "SENTINELS", "GET-MASTER-ADDR-BY-NAME":
+		if n != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+	case "IS-MASTER-DOWN-BY-ADDR":
+		if n != 4 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		port, err := strconv.Atoi(c.args[1])
+		epoch, errEpoch := strconv.ParseUint(c.args[2], 10, 64)
+		if err != nil || errEpoch != nil {
+			return fmt.Errorf("value is not an integer or out of range")
+		}
+		c.port, c.epoch = port, epoch
+	default:
+		return fmt.Errorf("unknown subcommand '%s'", sub)
+	}
+	return nil
+}
+
+func (c *SentinelCommand) Execute(srv *Server, cl *ev.Client) string {
+	sn := srv.sentinel
+	if c.subcommand == "MASTERS" {
+		masters := sortedInstances(sn.masters)
+		elems := make([]string, len(masters))
+		for i, master := range masters {
+			elems[i] = sentinelInstanceReply(master, cl)
+		}
+		return encodeArray(elems)
+	}
+	if c.subcommand == "MYID" {
+		return encodeBulkString(sn.myid)
+	}
+	if c.subcommand == "IS-MASTER-DOWN-BY-ADDR" {
+		return srv.sentinelIsMasterDownByAddr(c.args[0], c.port, c.epoch, c.args[3])
+	}
+
+	master := sn.masters[c.args[0]]
+	if c.subcommand == "GET-MASTER-ADDR-BY-NAME" {
+		if master == nil {
+			return "$-1"
+		}
+		ip, port := sentinelCurrentMasterAddress(master)
+		return encodeBulkStrings([]string{ip, strconv.Itoa(port)})
+	}
+	if master == nil {
+		return errNoSuchMasterName
+	}
+
+	var instances []*sentinelInstance
+	switch c.subcommand {
+	case "MASTER":
+		return sentinelInstanceReply(master, cl)
+	case "REPLICAS", "SLAVES":
+		instances = sortedInstances(master.slaves)
+	case "SENTINELS":
+		instances = sortedInstances(master.sentinels)
+	}
+	elems := make([]string, len(instances))
+	for i, ri := range instances {
+		elems[i] = sentinelInstanceReply(ri, cl)
+	}
+	return encodeArray(elems)
+}
+
+// sentinelIsMasterDownByAddr answers whether this sentinel sees the master
+// at ip:port sdown. When runId is not *, the sentinel asks for a vote too,
+// and the reply tells the sentinel voted for in the epoch.
+func (s *Server) sentinelIsMasterDownByAddr(ip string, port int, epoch uint64, runId string) string {
+	master := s.sentinel.masterByAddr(ip, port)
+	down := 0
+	if master != nil && master.flags&sriSdown != 0 {
+		down = 1
+	}
+	leader, leaderEpoch := "*", uint64(0)
+	if master != nil && runId != "*" {
+		leader, leaderEpoch = s.sentinelVoteLeader(master, epoch, runId)
+		if leader == "" {
+			leader = "*"
+		}
+	}
+	return encodeArray([]string{
+		encodeInt(down), encodeBulkString(leader), ":" + strconv.FormatUint(leaderEpoch, 10),
+	})
+}
+
+// sentinelInstanceReply describes the instance as a map of its fields, as
+// SENTINEL MASTERS, REPLICAS and SENTINELS do.
+func sentinelInstanceReply(ri *sentinelInstance, cl *ev.Client) string {
+	now := time.Now()
+	since := func(t time.Time) string {
+		if t.IsZero() {
+			return "0"
+		}
+		return strconv.FormatInt(now.Sub(t).Milliseconds(), 10)
+	}
+	l := ri.link
+	fields := []string{
+		"name", ri.name,
+		"ip", ri.ip,
+		"port", strconv.Itoa(ri.port),
+		"runid", ri.runId,
+		"flags", sentinelInstanceFlags(ri),
+		"link-pending-commands", strconv.Itoa(l.pendingCommands),
+		"link-refcount", "1",
+		"last-ping-sent", since(l.actPingTime),
+		"last-ok-ping-reply", since(l.lastAvailTime),
+		"last-ping-reply", since(l.lastPongTime),
+	}
+	if ri.flags&sriSdown != 0 {
+		fields = append(fields, "s-down-time", since(ri.sDownSinceTime))
+	}
+	if ri.flags&sriOdown != 0 {
+		fields = append(fields, "o-down-time", since(ri.oDownSinceTime))
+	}
+	fields = append(fields, "down-after-milliseconds", strconv.FormatInt(ri.downAfter.Milliseconds(), 10))
+
+	if ri.flags&(sriMaster|sriSlave) != 0 {
+		role := "master"
+		if ri.roleReported == sriSlave {
+			role = "slave"
+		}
+		fields = append(fields,
+			"info-refresh", since(ri.infoRefresh),
+			"role-reported", role,
+			"role-reported-time", since(ri.roleReportedTime))
+	}
+	if ri.flags&sriMaster != 0 {
+		fields = append(fields,
+			"config-epoch", strconv.FormatUint(ri.configEpoch, 10),
+			"num-slaves", strconv.Itoa(len(ri.slaves)),
+			"num-other-sentinels", strconv.Itoa(len(ri.sentinels)),
+			"quorum", strconv.Itoa(ri.quorum),
+			"failover-timeout", strconv.FormatInt(ri.failoverTimeout.Milliseconds(), 10),
+			"parallel-syncs", strconv.Itoa(ri.parallelSyncs))
+		if ri.failoverState != failoverStateNone {
+			fields = append(fields, "failover-state", failoverStateNames[ri.failoverState])
+		}
+	}
+	if ri.flags&sriSlave != 0 {
+		linkStatus := "err"
+		if ri.slaveMasterLinkStatus {
+			linkStatus = "ok"
+		}
+		fields = append(fields,
+			"master-link-down-time", strconv.FormatInt(ri.masterLinkDownTime.Milliseconds(), 10),
+			"master-link-status", linkStatus,
+			"master-host", ri.slaveMasterHost,
+			"master-port", strconv.Itoa(ri.slaveMasterPort),
+			"slave-priority", strconv.Itoa(ri.slavePriority),
+			"slave-repl-offset", strconv.FormatInt(ri.slaveReplOffset, 10))
+	}
+	if ri.flags&sriSentinel != 0 {
+		leader := ri.leader
+		if leader == "" {
+			leader = "*"
+		}
+		fields = append(fields,
+			"last-hello-message", since(ri.lastHelloTime),
+			"voted-leader", leader,
+			"voted-leader-epoch", strconv.FormatUint(ri.leaderEpoch, 10))
+	}
+
+	elems := make([]string, len(fields))
+	for i, f := range fields {
+		elems[i] = encodeBulkString(f)
+	}
+	return encodeMap(cl.Resp, elems)
+}
+
+// sentinelInstanceFlags lists the flags of the instance, as in
+// master,s_down,o_down.
+func sentinelInstanceFlags(ri *sentinelInstance) string {
+	var flags []string
+	for _, f := range sriFlagNames {
+		if ri.flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	if ri.link.disconnected {
+		flags = append(flags, "disconnected")
+	}
+	return strings.Join(flags, ",")
+}
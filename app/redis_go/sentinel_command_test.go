@@ -0,0 +1,87 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSentinelTestServer() *Server {
+	config := NewConfig()
+	config.Sentinel = true
+	config.SentinelMasters = []*SentinelMasterConfig{{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2,
+		DownAfter: 30000, FailoverTimeout: 180000, ParallelSyncs: 1}}
+	return NewServer(config)
+}
+
+func TestSentinelCommand(t *testing.T) {
+	srv := newSentinelTestServer()
+	cl := ev.NewClient(5)
+
+	assert.Equal(t, encodeBulkString(srv.sentinel.myid)+"\r\n", handle(srv, cl, "SENTINEL", "MYID"))
+	assert.Equal(t, "*2\r\n$9\r\n127.0.0.1\r\n$4\r\n6379\r\n",
+		handle(srv, cl, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"))
+	assert.Equal(t, "$-1\r\n", handle(srv, cl, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "nosuch"))
+
+	masters := handle(srv, cl, "SENTINEL", "MASTERS")
+	assert.True(t, strings.HasPrefix(masters, "*1\r\n*"))
+	assert.Contains(t, masters, "$4\r\nname\r\n$8\r\nmymaster\r\n")
+	assert.Contains(t, masters, "$5\r\nflags\r\n$19\r\nmaster,disconnected\r\n")
+	assert.Contains(t, masters, "$6\r\nquorum\r\n$1\r\n2\r\n")
+	assert.Contains(t, masters, "$23\r\ndown-after-milliseconds\r\n$5\r\n30000\r\n")
+
+	master := srv.sentinel.masters["mymaster"]
+	master.slaves["127.0.0.1:6380"] = newSentinelInstance(sriSlave, "127.0.0.1:6380", "127.0.0.1", 6380, master)
+	replicas := handle(srv, cl, "SENTINEL", "REPLICAS", "mymaster")
+	assert.True(t, strings.HasPrefix(replicas, "*1\r\n*"))
+	assert.Contains(t, replicas, "$5\r\nflags\r\n$18\r\nslave,disconnected\r\n")
+	assert.Equal(t, replicas, handle(srv, cl, "SENTINEL", "SLAVES", "mymaster"))
+	assert.Equal(t, "*0\r\n", handle(srv, cl, "SENTINEL", "SENTINELS", "mymaster"))
+
+	cl.Resp = 3
+	assert.True(t, strings.HasPrefix(handle(srv, cl, "SENTINEL", "MASTER", "mymaster"), "%"))
+
+	assert.Equal(t, "-ERR No such master with that name\r\n", handle(srv, cl, "SENTINEL", "SENTINELS", "nosuch"))
+	assert.Equal(t, "-ERR unknown subcommand 'nosuch'\r\n", handle(srv, cl, "SENTINEL", "nosuch"))
+	assert.Equal(t, "-ERR incorrect number of params\r\n", handle(srv, cl, "SENTINEL", "MASTER"))
+}
+
+func TestSentinelIsMasterDownByAddr(t *testing.T) {
+	srv := newSentinelTestServer()
+	cl := ev.NewClient(5)
+
+	assert.Equal(t, "*3\r\n:0\r\n$1\r\n*\r\n:0\r\n",
+		handle(srv, cl, "SENTINEL", "IS-MASTER-DOWN-BY-ADDR", "127.0.0.1", "6379", "0", "*"))
+
+	srv.sentinel.masters["mymaster"].flags |= sriSdown
+	assert.Equal(t, "*3\r\n:1\r\n$1\r\na\r\n:5\r\n",
+		handle(srv, cl, "SENTINEL", "IS-MASTER-DOWN-BY-ADDR", "127.0.0.1", "6379", "5", "a"))
+	// the vote of the epoch is kept
+	assert.Equal(t, "*3\r\n:1\r\n$1\r\na\r\n:5\r\n",
+		handle(srv, cl, "SENTINEL", "IS-MASTER-DOWN-BY-ADDR", "127.0.0.1", "6379", "5", "b"))
+	assert.Equal(t, "*3\r\n:0\r\n$1\r\n*\r\n:0\r\n",
+		handle(srv, cl, "SENTINEL", "IS-MASTER-DOWN-BY-ADDR", "127.0.0.1", "6380", "5", "b"))
+}
+
+func TestSentinelModeCommands(t *testing.T) {
+	srv := newSentinelTestServer()
+	cl := ev.NewClient(5)
+
+	assert.Equal(t, "+PONG\r\n", handle(srv, cl, "PING"))
+	assert.Equal(t, "-ERR unknown command set\r\n", handle(srv, cl, "set", "a", "b"))
+	assert.Equal(t, "-ERR Only HELLO messages are accepted by Sentinel instances.\r\n",
+		handle(srv, cl, "PUBLISH", "ch", "msg"))
+
+	info := readBulkReply(t, handle(srv, cl, "INFO"))
+	assert.Equal(t, []string{"Server", "Clients", "Stats", "Cpu", "Sentinel"}, infoSectionNames(info))
+	assert.Contains(t, info, "redis_mode:sentinel\r\n")
+	assert.Contains(t, info, "sentinel_masters:1\r\n")
+	assert.Contains(t, info, "master0:name=mymaster,status=ok,address=127.0.0.1:6379,slaves=0,sentinels=1\r\n")
+
+	// and the other way around
+	srv = NewServer(NewConfig())
+	assert.Equal(t, "-ERR unknown command SENTINEL\r\n", handle(srv, cl, "SENTINEL", "MASTERS"))
+	assert.NotContains(t, readBulkReply(t, handle(srv, cl, "INFO", "all")), "# Sentinel")
+}
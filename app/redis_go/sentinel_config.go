@@ -0,0 +1,120 @@
+package redis_go
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SentinelPort is the port of sentinels unless configured otherwise
+	SentinelPort = 26379
+
+	sentinelDefaultDownAfter       = 30000
+	sentinelDefaultFailoverTimeout = 3 * 60 * 1000
+	sentinelDefaultParallelSyncs   = 1
+)
+
+var (
+	errSentinelDirective = errors.New("Unrecognized sentinel configuration statement.")
+	errNoSuchMaster      = errors.New("No such master with specified name.")
+)
+
+// SentinelMasterConfig is a master monitored by a sentinel, as configured
+// by the sentinel directives. Times are in milliseconds.
+type SentinelMasterConfig struct {
+	Name   string
+	Ip     string
+	Port   int
+	Quorum int
+	// DownAfter is the time after which a master not answering is
+	// subjectively down
+	DownAfter       int64
+	FailoverTimeout int64
+	// ParallelSyncs is the number of replicas reconfigured at once after a
+	// failover
+	ParallelSyncs int
+	// AuthPass is the password the master and its replicas require
+	AuthPass string
+}
+
+func (c *Config) sentinelMaster(name string) *SentinelMasterConfig {
+	for _, m := range c.SentinelMasters {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// loadSentinelDirective applies a sentinel line of the config, such as
+// sentinel monitor mymaster 127.0.0.1 6379 2. A bare sentinel line, which
+// --sentinel turns into, enables sentinel mode.
+func loadSentinelDirective(config *Config, args []string) error {
+	if len(args) == 0 {
+		config.Sentinel = true
+		return nil
+	}
+
+	directive := strings.ToLower(args[0])
+	if directive == "monitor" {
+		if len(args) != 5 {
+			return errSentinelDirective
+		}
+		port, err := strconv.Atoi(args[3])
+		if err != nil || port <= 0 || port > 65535 || net.ParseIP(args[2]) == nil {
+			return errors.New("Invalid IP address or port specified")
+		}
+		quorum, err := strconv.Atoi(args[4])
+		if err != nil || quorum <= 0 {
+			return errors.New("Quorum must be 1 or greater.")
+		}
+		if config.sentinelMaster(args[1]) != nil {
+			return errors.New("Duplicated master name.")
+		}
+		config.SentinelMasters = append(config.SentinelMasters, &SentinelMasterConfig{
+			Name:            args[1],
+			Ip:              args[2],
+			Port:            port,
+			Quorum:          quorum,
+			DownAfter:       sentinelDefaultDownAfter,
+			FailoverTimeout: sentinelDefaultFailoverTimeout,
+			ParallelSyncs:   sentinelDefaultParallelSyncs,
+		})
+		return nil
+	}
+
+	if len(args) != 3 {
+		return errSentinelDirective
+	}
+	m := config.sentinelMaster(args[1])
+	if m == nil {
+		return errNoSuchMaster
+	}
+	if directive == "auth-pass" {
+		m.AuthPass = args[2]
+		return nil
+	}
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	switch directive {
+	case "down-after-milliseconds":
+		if err != nil || n <= 0 {
+			return errors.New("negative or zero time parameter.")
+		}
+		m.DownAfter = n
+	case "failover-timeout":
+		if err != nil || n <= 0 {
+			return errors.New("negative or zero time parameter.")
+		}
+		m.FailoverTimeout = n
+	case "parallel-syncs":
+		if err != nil || n <= 0 {
+			return errors.New("parallel-syncs must be 1 or greater.")
+		}
+		m.ParallelSyncs = int(n)
+	default:
+		return errSentinelDirective
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package redis_go
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSentinelDirectives(t *testing.T) {
+	config := NewConfig()
+	err := loadConfigString(config, "", "sentinel\n"+
+		"sentinel monitor mymaster 127.0.0.1 6379 2\n"+
+		"sentinel down-after-milliseconds mymaster 5000\n"+
+		"sentinel failover-timeout mymaster 60000\n"+
+		"sentinel parallel-syncs mymaster 3\n"+
+		"sentinel auth-pass mymaster secret\n"+
+		"sentinel monitor other 10.0.0.1 6380 1", 0)
+	assert.NoError(t, err)
+	assert.True(t, config.Sentinel)
+	assert.Equal(t, []*SentinelMasterConfig{
+		{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2, DownAfter: 5000, FailoverTimeout: 60000,
+			ParallelSyncs: 3, AuthPass: "secret"},
+		{Name: "other", Ip: "10.0.0.1", Port: 6380, Quorum: 1, DownAfter: sentinelDefaultDownAfter,
+			FailoverTimeout: sentinelDefaultFailoverTimeout, ParallelSyncs: sentinelDefaultParallelSyncs},
+	}, config.SentinelMasters)
+}
+
+func TestLoadSentinelDirectiveErrors(t *testing.T) {
+	cases := map[string]string{
+		"sentinel monitor m 127.0.0.1 6379":                                         "Unrecognized sentinel configuration statement.",
+		"sentinel monitor m host 6379 2":                                            "Invalid IP address or port specified",
+		"sentinel monitor m 127.0.0.1 70000 2":                                      "Invalid IP address or port specified",
+		"sentinel monitor m 127.0.0.1 6379 0":                                       "Quorum must be 1 or greater.",
+		"sentinel down-after-milliseconds nosuch 10":                                "No such master with specified name.",
+		"sentinel monitor m 127.0.0.1 6379 2\nsentinel monitor m 127.0.0.1 6380 2":  "Duplicated master name.",
+		"sentinel monitor m 127.0.0.1 6379 2\nsentinel down-after-milliseconds m 0": "negative or zero time parameter.",
+		"sentinel monitor m 127.0.0.1 6379 2\nsentinel failover-timeout m x":        "negative or zero time parameter.",
+		"sentinel monitor m 127.0.0.1 6379 2\nsentinel nosuch m 1":                  "Unrecognized sentinel configuration statement.",
+		"sentinel monitor m 127.0.0.1 6379 2\nsentinel parallel-syncs m 0":          "parallel-syncs must be 1 or greater.",
+	}
+	for text, msg := range cases {
+		err := loadConfigString(NewConfig(), "", text, 0)
+		assert.NotNil(t, err, text)
+		if err != nil {
+			assert.Contains(t, err.Error(), msg, text)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package redis_go
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sentinelConnBuffer is the number of commands queued on a connection
+	// before the next ones are refused
+	sentinelConnBuffer = 128
+	// sentinelMaxPendingCommands bounds the commands waiting for a reply
+	// on a link, no periodic command is sent past it
+	sentinelMaxPendingCommands = 100
+	// sentinelMinLinkReconnectPeriod is how long a link is kept before it
+	// is closed for not answering the pings
+	sentinelMinLinkReconnectPeriod = 15 * time.Second
+)
+
+// sentinelRequest is a command sent to an instance, and what to do with
+// the reply, or the error when the connection failed meanwhile.
+type sentinelRequest struct {
+	argv []string
+	cb   func(reply interface{}, err error)
+}
+
+// sentinelConn is a connection to an instance, served by goroutines of
+// its own. What happens on it is handed over to the loop through the
+// inbox of the sentinel, as closures it runs.
+type sentinelConn struct {
+	sentinel *sentinel
+	reqs     chan sentinelRequest
+	done     chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	conn     net.Conn
+	onClose  func()
+}
+
+// dialSentinelConn connects to addr. onConnect is given the local address
+// of the connection. With onMessage set, the connection is meant to be
+// subscribed to channels: once it is, the messages are handed to
+// onMessage.
+func (sn *sentinel) dialSentinelConn(addr string, onConnect func(localIp string), onClose func(),
+	onMessage func(channel string, message string)) *sentinelConn {
+	c := &sentinelConn{
+		sentinel: sn,
+		reqs:     make(chan sentinelRequest, sentinelConnBuffer),
+		done:     make(chan struct{}),
+		onClose:  onClose,
+	}
+	go func() {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			c.close()
+			return
+		}
+		c.mu.Lock()
+		select {
+		case <-c.done:
+			c.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		c.conn = conn
+		c.mu.Unlock()
+
+		localIp, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+		sn.post(func() { onConnect(localIp) })
+		c.serve(conn, onMessage)
+	}()
+	return c
+}
+
+// serve sends the requests one at a time, each once the previous one is
+// replied to. Once subscribed, the replies are read by readMessages.
+func (c *sentinelConn) serve(conn net.Conn, onMessage func(channel string, message string)) {
+	r := bufio.NewReader(conn)
+	subscribed := false
+	for {
+		var req sentinelRequest
+		select {
+		case req = <-c.reqs:
+		case <-c.done:
+			return
+		}
+		_, err := conn.Write([]byte(encodeBulkStrings(req.argv) + "\r\n"))
+		var reply interface{}
+		if err == nil && !subscribed {
+			reply, err = readReply(r)
+		}
+		if req.cb != nil {
+			c.sentinel.post(func() { req.cb(reply, err) })
+		}
+		if err != nil {
+			c.close()
+			return
+		}
+		if onMessage != nil && !subscribed && strings.EqualFold(req.argv[0], "subscribe") {
+			subscribed = true
+			go c.readMessages(r, onMessage)
+		}
+	}
+}
+
+func (c *sentinelConn) readMessages(r *bufio.Reader, onMessage func(channel string, message string)) {
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			c.close()
+			return
+		}
+		msg, ok := reply.([]interface{})
+		if !ok || len(msg) != 3 || msg[0] != "message" {
+			continue
+		}
+		channel, _ := msg[1].(string)
+		message, _ := msg[2].(string)
+		c.sentinel.post(func() { onMessage(channel, message) })
+	}
+}
+
+// send queues a command, and reports whether it could be.
+func (c *sentinelConn) send(argv []string, cb func(reply interface{}, err error)) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.reqs <- sentinelRequest{argv: argv, cb: cb}:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the connection, and has the loop run onClose.
+func (c *sentinelConn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+		c.sentinel.post(c.onClose)
+	})
+}
+
+// sentinelLink is the connections of the sentinel to an instance: one for
+// the commands, and one subscribed to the hello channel for the masters
+// and replicas. It is only accessed by the loop.
+type sentinelLink struct {
+	cc           *sentinelConn
+	pc           *sentinelConn
+	disconnected bool
+	// pendingCommands are the commands sent that were not answered yet
+	pendingCommands int
+	ccConnTime      time.Time
+	// lastReconnTime is when the link was last opened, it is not tried
+	// more than once a ping period
+	lastReconnTime time.Time
+	// localIp is the address of the sentinel on the connection, which it
+	// announces in its hello messages
+	localIp string
+	// actPingTime is when the ping waiting for a reply was sent, zero when
+	// there is none, and lastPingTime when the last one was sent
+	actPingTime  time.Time
+	lastPingTime time.Time
+	// lastPongTime is when the instance last replied to a ping, and
+	// lastAvailTime when it last did with a valid reply
+	lastPongTime  time.Time
+	lastAvailTime time.Time
+}
+
+func newSentinelLink() *sentinelLink {
+	now := time.Now()
+	return &sentinelLink{
+		disconnected: true,
+		lastPongTime: now,
+		// the instance is available until proven otherwise
+		lastAvailTime: now,
+	}
+}
+
+// send sends a command on the connection of the commands, and runs cb
+// with the reply, unless the connection failed.
+func (l *sentinelLink) send(argv []string, cb func(reply interface{})) bool {
+	if l.disconnected || l.cc == nil {
+		return false
+	}
+	cc := l.cc
+	ok := cc.send(argv, func(reply interface{}, err error) {
+		// the count starts over with a new connection
+		if l.cc == cc {
+			l.pendingCommands--
+		}
+		if err == nil && cb != nil {
+			cb(reply)
+		}
+	})
+	if ok {
+		l.pendingCommands++
+	}
+	return ok
+}
+
+func (l *sentinelLink) close() {
+	if l.cc != nil {
+		l.cc.close()
+	}
+	if l.pc != nil {
+		l.pc.close()
+	}
+}
@@ -0,0 +1,411 @@
+package redis_go
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWorld is a set of fake redis instances, replicating each other as
+// far as INFO and REPLICAOF tell. All of them are served under mu.
+type fakeWorld struct {
+	mu        sync.Mutex
+	instances map[int]*fakeRedis
+}
+
+type fakeRedis struct {
+	world      *fakeWorld
+	ln         net.Listener
+	port       int
+	runId      string
+	masterPort int
+	offset     int64
+	down       bool
+	conns      []net.Conn
+	// subscribers are the connections subscribed to the hello channel
+	subscribers []net.Conn
+}
+
+func (w *fakeWorld) start(t *testing.T, masterPort int) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	r := &fakeRedis{
+		world:      w,
+		ln:         ln,
+		port:       ln.Addr().(*net.TCPAddr).Port,
+		runId:      randomNodeId(),
+		masterPort: masterPort,
+	}
+	w.mu.Lock()
+	w.instances[r.port] = r
+	w.mu.Unlock()
+	t.Cleanup(r.kill)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			w.mu.Lock()
+			r.conns = append(r.conns, conn)
+			w.mu.Unlock()
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	for {
+		req, err := readReply(br)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		var argv []string
+		for _, a := range req.([]interface{}) {
+			argv = append(argv, a.(string))
+		}
+		r.world.mu.Lock()
+		conn.Write([]byte(r.reply(conn, argv) + "\r\n"))
+		r.world.mu.Unlock()
+	}
+}
+
+func (r *fakeRedis) reply(conn net.Conn, argv []string) string {
+	switch strings.ToUpper(argv[0]) {
+	case "PING":
+		return "+PONG"
+	case "INFO":
+		return encodeBulkString(r.info())
+	case "REPLICAOF":
+		r.masterPort = 0
+		if strings.ToUpper(argv[1]) != "NO" {
+			r.masterPort, _ = strconv.Atoi(argv[2])
+		}
+		return "+OK"
+	case "SUBSCRIBE":
+		r.subscribers = append(r.subscribers, conn)
+		return encodeArray([]string{encodeBulkString("subscribe"), encodeBulkString(argv[1]), encodeInt(1)})
+	case "PUBLISH":
+		msg := encodeBulkStrings([]string{"message", argv[1], argv[2]}) + "\r\n"
+		for _, sub := range r.subscribers {
+			sub.Write([]byte(msg))
+		}
+		return encodeInt(len(r.subscribers))
+	}
+	return "+OK"
+}
+
+func (r *fakeRedis) info() string {
+	info := "# Server\r\nrun_id:" + r.runId + "\r\n# Replication\r\n"
+	if r.masterPort == 0 {
+		info += "role:master\r\n"
+		n := 0
+		for _, other := range r.world.instances {
+			if other.masterPort == r.port && !other.down {
+				info += fmt.Sprintf("slave%d:ip=127.0.0.1,port=%d,state=online,offset=%d,lag=0\r\n",
+					n, other.port, other.offset)
+				n++
+			}
+		}
+		return info
+	}
+	status := "down"
+	if master := r.world.instances[r.masterPort]; master != nil && !master.down {
+		status = "up"
+	}
+	return info + fmt.Sprintf("role:slave\r\nmaster_host:127.0.0.1\r\nmaster_port:%d\r\n"+
+		"master_link_status:%s\r\nslave_priority:100\r\nslave_repl_offset:%d\r\n",
+		r.masterPort, status, r.offset)
+}
+
+// kill stops the instance, closing its connections.
+func (r *fakeRedis) kill() {
+	r.world.mu.Lock()
+	defer r.world.mu.Unlock()
+	r.down = true
+	r.ln.Close()
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+}
+
+func (r *fakeRedis) getMasterPort() int {
+	r.world.mu.Lock()
+	defer r.world.mu.Unlock()
+	return r.masterPort
+}
+
+// testSentinel is a sentinel served on the loopback. mu serializes the
+// requests and sentinelTimer, as the event loop would.
+type testSentinel struct {
+	*Server
+	mu sync.Mutex
+}
+
+func newTestSentinel(t *testing.T, masterPort int) *testSentinel {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	config := NewConfig()
+	config.Port = ln.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, loadConfigString(config, "", "sentinel\n"+
+		"sentinel monitor mymaster 127.0.0.1 "+strconv.Itoa(masterPort)+" 2\n"+
+		"sentinel down-after-milliseconds mymaster 300\n"+
+		"sentinel failover-timeout mymaster 2000", 0))
+	s := &testSentinel{Server: NewServer(config)}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				cl := ev.NewClient(5)
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := r.Peek(1); err != nil {
+						return
+					}
+					s.mu.Lock()
+					res := s.Handle(cl, r)
+					s.mu.Unlock()
+					if _, err := conn.Write([]byte(res)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+// runSentinels runs the timers of the sentinels until cond holds.
+func runSentinels(t *testing.T, sentinels []*testSentinel, cond func() bool) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range sentinels {
+			s.mu.Lock()
+			s.sentinelTimer(time.Now())
+			s.mu.Unlock()
+		}
+		for _, s := range sentinels {
+			s.mu.Lock()
+		}
+		done := cond()
+		for _, s := range sentinels {
+			s.mu.Unlock()
+		}
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the sentinels did not converge")
+}
+
+func TestSentinelFailover(t *testing.T) {
+	world := &fakeWorld{instances: map[int]*fakeRedis{}}
+	master := world.start(t, 0)
+	replicas := []*fakeRedis{world.start(t, master.port), world.start(t, master.port)}
+	replicas[1].offset = 100
+
+	sentinels := []*testSentinel{
+		newTestSentinel(t, master.port), newTestSentinel(t, master.port), newTestSentinel(t, master.port),
+	}
+	runSentinels(t, sentinels, func() bool {
+		for _, s := range sentinels {
+			m := s.sentinel.masters["mymaster"]
+			if len(m.sentinels) != 2 || len(m.slaves) != 2 {
+				return false
+			}
+		}
+		return true
+	})
+
+	cl, sub := ev.NewClient(5), ev.NewClient(6)
+	s := sentinels[0]
+	s.mu.Lock()
+	s.subscribe(sub, "+switch-master", false)
+	reply := handle(s.Server, cl, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster")
+	assert.Equal(t, encodeBulkStrings([]string{"127.0.0.1", strconv.Itoa(master.port)})+"\r\n", reply)
+	s.mu.Unlock()
+
+	master.kill()
+	promoted := strconv.Itoa(replicas[1].port)
+	runSentinels(t, sentinels, func() bool {
+		for _, s := range sentinels {
+			m := s.sentinel.masters["mymaster"]
+			if m.port != replicas[1].port || m.failoverState != failoverStateNone {
+				return false
+			}
+		}
+		return replicas[0].getMasterPort() == replicas[1].port
+	})
+
+	// the replica with the most data is promoted, and the other one told to
+	// replicate it
+	assert.Equal(t, 0, replicas[1].getMasterPort())
+	for _, s := range sentinels {
+		s.mu.Lock()
+		reply := handle(s.Server, cl, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster")
+		assert.Equal(t, encodeBulkStrings([]string{"127.0.0.1", promoted})+"\r\n", reply)
+		// the old master is a replica of the new one, to be once it is back
+		m := s.sentinel.masters["mymaster"]
+		assert.NotNil(t, m.slaves[net.JoinHostPort("127.0.0.1", strconv.Itoa(master.port))])
+		assert.NotNil(t, m.slaves[net.JoinHostPort("127.0.0.1", strconv.Itoa(replicas[0].port))])
+		assert.NotZero(t, m.configEpoch)
+		s.mu.Unlock()
+	}
+
+	msg := encodePush(2, []string{
+		encodeBulkString("message"), encodeBulkString("+switch-master"),
+		encodeBulkString(fmt.Sprintf("mymaster 127.0.0.1 %d 127.0.0.1 %s", master.port, promoted)),
+	}) + "\r\n"
+	assert.Equal(t, len(msg), sub.PendingOutput())
+}
+
+func TestSentinelObjectivelyDown(t *testing.T) {
+	config := NewConfig()
+	config.Sentinel = true
+	config.SentinelMasters = []*SentinelMasterConfig{{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2}}
+	srv := NewServer(config)
+	master := srv.sentinel.masters["mymaster"]
+	other := newSentinelInstance(sriSentinel, "127.0.0.1:26380", "127.0.0.1", 26380, master)
+	master.sentinels["a"] = other
+
+	now := time.Now()
+	srv.sentinelCheckObjectivelyDown(master, now)
+	assert.Zero(t, master.flags&sriOdown)
+
+	// sdown alone is short of the quorum
+	master.flags |= sriSdown
+	srv.sentinelCheckObjectivelyDown(master, now)
+	assert.Zero(t, master.flags&sriOdown)
+
+	other.flags |= sriMasterDown
+	srv.sentinelCheckObjectivelyDown(master, now)
+	assert.NotZero(t, master.flags&sriOdown)
+
+	master.flags &^= sriSdown
+	srv.sentinelCheckObjectivelyDown(master, now)
+	assert.Zero(t, master.flags&sriOdown)
+}
+
+func TestSentinelVoteLeader(t *testing.T) {
+	config := NewConfig()
+	config.Sentinel = true
+	config.SentinelMasters = []*SentinelMasterConfig{{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2}}
+	srv := NewServer(config)
+	master := srv.sentinel.masters["mymaster"]
+
+	leader, epoch := srv.sentinelVoteLeader(master, 3, "a")
+	assert.Equal(t, "a", leader)
+	assert.Equal(t, uint64(3), epoch)
+	assert.Equal(t, uint64(3), srv.sentinel.currentEpoch)
+
+	// one vote per epoch
+	leader, epoch = srv.sentinelVoteLeader(master, 3, "b")
+	assert.Equal(t, "a", leader)
+	assert.Equal(t, uint64(3), epoch)
+
+	leader, epoch = srv.sentinelVoteLeader(master, 4, "b")
+	assert.Equal(t, "b", leader)
+	assert.Equal(t, uint64(4), epoch)
+}
+
+func TestSentinelSelectSlave(t *testing.T) {
+	config := NewConfig()
+	config.Sentinel = true
+	config.SentinelMasters = []*SentinelMasterConfig{{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2,
+		DownAfter: 1000}}
+	srv := NewServer(config)
+	master := srv.sentinel.masters["mymaster"]
+	now := time.Now()
+	addSlave := func(port int, priority int, offset int64) *sentinelInstance {
+		ri := newSentinelInstance(sriSlave, strconv.Itoa(port), "127.0.0.1", port, master)
+		ri.link.disconnected = false
+		ri.infoRefresh = now
+		ri.slavePriority = priority
+		ri.slaveReplOffset = offset
+		master.slaves[ri.name] = ri
+		return ri
+	}
+	assert.Nil(t, sentinelSelectSlave(master, now))
+
+	addSlave(6380, 100, 10)
+	best := addSlave(6381, 100, 20)
+	addSlave(6382, 0, 30)
+	assert.Equal(t, best, sentinelSelectSlave(master, now))
+
+	// a lower priority wins over more data
+	low := addSlave(6383, 10, 0)
+	assert.Equal(t, low, sentinelSelectSlave(master, now))
+
+	low.flags |= sriSdown
+	best.link.disconnected = true
+	assert.Equal(t, 6380, sentinelSelectSlave(master, now).port)
+}
+
+func TestSentinelProcessHello(t *testing.T) {
+	config := NewConfig()
+	config.Sentinel = true
+	config.SentinelMasters = []*SentinelMasterConfig{{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2}}
+	srv := NewServer(config)
+	master := srv.sentinel.masters["mymaster"]
+	runId := randomNodeId()
+
+	srv.sentinelProcessHelloMessage("127.0.0.1,26380," + runId + ",0,mymaster,127.0.0.1,6379,0")
+	assert.Len(t, master.sentinels, 1)
+	assert.Equal(t, 26380, master.sentinels[runId].port)
+
+	// a newer config of the master is switched to
+	srv.sentinelProcessHelloMessage("127.0.0.1,26380," + runId + ",2,mymaster,127.0.0.1,6380,2")
+	assert.Equal(t, uint64(2), srv.sentinel.currentEpoch)
+	assert.Equal(t, uint64(2), master.configEpoch)
+	assert.Equal(t, 6380, master.port)
+	assert.NotNil(t, master.slaves["127.0.0.1:6379"])
+
+	// the hello of unknown masters, or of this sentinel, are ignored
+	srv.sentinelProcessHelloMessage("127.0.0.1,26381," + randomNodeId() + ",0,other,127.0.0.1,6379,0")
+	srv.sentinelProcessHelloMessage("127.0.0.1,26379," + srv.sentinel.myid + ",0,mymaster,127.0.0.1,6379,0")
+	srv.sentinelProcessHelloMessage("garbage")
+	assert.Len(t, master.sentinels, 1)
+}
+
+func TestSentinelRefreshInstanceInfo(t *testing.T) {
+	config := NewConfig()
+	config.Sentinel = true
+	config.SentinelMasters = []*SentinelMasterConfig{{Name: "mymaster", Ip: "127.0.0.1", Port: 6379, Quorum: 2}}
+	srv := NewServer(config)
+	master := srv.sentinel.masters["mymaster"]
+	runId := randomNodeId()
+
+	srv.sentinelRefreshInstanceInfo(master, "# Server\r\nrun_id:"+runId+"\r\n# Replication\r\nrole:master\r\n"+
+		"connected_slaves:1\r\nslave0:ip=127.0.0.1,port=6380,state=online,offset=5,lag=0\r\n", time.Now())
+	assert.Equal(t, runId, master.runId)
+	slave := master.slaves["127.0.0.1:6380"]
+	assert.NotNil(t, slave)
+
+	srv.sentinelRefreshInstanceInfo(slave, "role:slave\r\nmaster_host:127.0.0.1\r\nmaster_port:6379\r\n"+
+		"master_link_status:up\r\nslave_priority:50\r\nslave_repl_offset:5\r\n", time.Now())
+	assert.Equal(t, sriSlave, slave.roleReported)
+	assert.Equal(t, 6379, slave.slaveMasterPort)
+	assert.True(t, slave.slaveMasterLinkStatus)
+	assert.Equal(t, 50, slave.slavePriority)
+	assert.Equal(t, int64(5), slave.slaveReplOffset)
+}
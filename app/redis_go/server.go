@@ -0,0 +1,364 @@
+package redis_go
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"redis-go/app/ev"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// beforeSleepBudget bounds the time spent on housekeeping each time the
+// event loop is about to wait for events.
+const beforeSleepBudget = time.Millisecond
+
+// Connections is the view of the event loop the server needs to report on
+// the connections, run its cron and apply the configs set at runtime.
+type Connections interface {
+	Clients() []*ev.Client
+	MaxClients() int
+	Stats() ev.Stats
+	ResetStats()
+	Stop()
+	ClientsCron()
+	AddPeriodicTimer(period time.Duration, fn func()) int64
+	CancelTimer(id int64) bool
+	SetIdleTimeout(d time.Duration)
+	SetKeepAlive(d time.Duration)
+	ChangeMaxClients(n int) error
+	ChangePort(port int) error
+	ChangeTls(port int, config *tls.Config) error
+	ProcessEventsWhileBlocked() error
+}
+
+// Server holds the state shared by all the connections.
+type Server struct {
+	config         *Config
+	dbs            []*Db
+	evictionPool   *evictionPool
+	nextEvictionDb int
+	conns          Connections
+	stats          *serverStats
+	slowlog        slowlog
+	latency        *latencyMonitor
+	monitors       []*ev.Client
+	pubsub         *pubsub
+	tracking       *tracking
+	cluster        *cluster
+	sentinel       *sentinel
+	scripts        *scriptEngine
+	functions      *functionEngine
+	pause          clientPause
+	acl            *acl
+	// tls is set once TLS is enabled. It is read by the goroutine handling
+	// SIGHUP too, see ReloadTls.
+	tls atomic.Pointer[TlsContext]
+	// cronTimer is the timer of the event loop running Cron
+	cronTimer int64
+	startTime time.Time
+	// runId identifies this run of the server
+	runId string
+	// startupMemory is the heap in use once the server is set up, and
+	// peakMemory the most seen since
+	startupMemory uint64
+	peakMemory    uint64
+}
+
+func NewServer(config *Config) *Server {
+	id := make([]byte, 20)
+	random.Read(id)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := &Server{
+		config:        config,
+		dbs:           make([]*Db, config.Databases),
+		evictionPool:  newEvictionPool(),
+		pubsub:        newPubsub(),
+		tracking:      newTracking(),
+		scripts:       newScriptEngine(),
+		functions:     newFunctionEngine(),
+		stats:         newServerStats(),
+		latency:       newLatencyMonitor(),
+		acl:           newAcl(config.RequirePass),
+		startTime:     time.Now(),
+		runId:         hex.EncodeToString(id),
+		startupMemory: ms.HeapAlloc,
+		peakMemory:    ms.HeapAlloc,
+	}
+	for i := range s.dbs {
+		s.dbs[i] = NewDb()
+		s.dbs[i].id = i
+		s.dbs[i].notify = s.notifyKeyspaceEvent
+		s.dbs[i].modified = func(key string) {
+			s.signalModifiedKey(nil, key)
+		}
+	}
+	if config.ClusterEnabled {
+		s.cluster = newCluster(config)
+		s.dbs[0].indexSlots()
+	}
+	if config.Sentinel {
+		s.sentinel = newSentinel(config)
+	}
+	return s
+}
+
+// SetConnections registers the event loop holding the connections, and
+// has it run Cron hz times per second.
+func (s *Server) SetConnections(conns Connections) {
+	s.conns = conns
+	s.scheduleCron()
+}
+
+func (s *Server) scheduleCron() {
+	s.cronTimer = s.conns.AddPeriodicTimer(time.Second/time.Duration(s.config.Hz), s.Cron)
+}
+
+// TlsConfig returns the configuration to accept TLS connections with,
+// loading the certificates the first time.
+func (s *Server) TlsConfig() (*tls.Config, error) {
+	if ctx := s.tls.Load(); ctx != nil {
+		return ctx.ServerConfig(), nil
+	}
+	ctx, err := NewTlsContext(s.config)
+	if err != nil {
+		return nil, err
+	}
+	s.tls.Store(ctx)
+	return ctx.ServerConfig(), nil
+}
+
+// ReloadTls reads the certificate files again, and reports whether TLS is
+// enabled. It is safe to call from any goroutine.
+func (s *Server) ReloadTls() (bool, error) {
+	ctx := s.tls.Load()
+	if ctx == nil {
+		return false, nil
+	}
+	return true, ctx.Reload()
+}
+
+// Clients returns the connected clients.
+func (s *Server) Clients() []*ev.Client {
+	if s.conns == nil {
+		return nil
+	}
+	return s.conns.Clients()
+}
+
+// ResetStats clears the counters reported by INFO.
+func (s *Server) ResetStats() {
+	s.stats = newServerStats()
+	for _, db := range s.dbs {
+		db.resetStats()
+	}
+	if s.conns != nil {
+		s.conns.ResetStats()
+	}
+	s.peakMemory = 0
+}
+
+// maxClients is the limit of clients the event loop enforces, which is
+// lower than configured when the open files limit did not allow for more.
+func (s *Server) maxClients() int {
+	if s.conns == nil {
+		return s.config.MaxClients
+	}
+	return s.conns.MaxClients()
+}
+
+func (s *Server) netStats() ev.Stats {
+	if s.conns == nil {
+		return ev.Stats{}
+	}
+	return s.conns.Stats()
+}
+
+// commandAvailable reports whether the command runs in the mode of the
+// server: sentinel mode only runs the commands flagged CmdSentinel.
+func (s *Server) commandAvailable(spec *CommandSpec) bool {
+	if s.sentinel != nil {
+		return spec.Is(CmdSentinel)
+	}
+	return !spec.Is(CmdOnlySentinel)
+}
+
+// Handle reads a command from the request and runs it on behalf of the
+// client. It is the handler of the event loop.
+func (s *Server) Handle(cl *ev.Client, sr ev.StringReader) string {
+	rr := NewRespReader(sr)
+	cr := NewCommandReader(rr)
+
+	var res string
+	c, err := cr.Read()
+	if err == nil && !s.commandAvailable(c.Spec()) {
+		// the command is rejected as if there were no such command
+		err = fmt.Errorf("unknown command %s", c.Argv()[0])
+	}
+	noAuth := err == nil && s.authRequired(cl) && !c.Spec().Is(CmdNoAuth)
+	noPerm := ""
+	if err == nil && !noAuth {
+		noPerm = s.aclCheck(c, cl)
+	}
+	busy := err == nil && !noAuth && noPerm == "" && s.scriptBusy(c)
+	// a RESP2 connection subscribed to channels only receives messages
+	subscribed := err == nil && !noAuth && noPerm == "" && !busy &&
+		cl.Resp == 2 && subscriptions(cl) > 0 && !c.Spec().Is(CmdSubscribed)
+	redirect := ""
+	if err == nil && !noAuth && noPerm == "" && !busy && !subscribed {
+		redirect = s.clusterRedirect(c, cl)
+	}
+	if err == nil && !noAuth && noPerm == "" && !busy && !subscribed && redirect == "" && s.shouldPause(c.Spec(), c.Argv()) {
+		cl.Defer()
+		return ""
+	}
+
+	skip := cl.Reply == ev.ReplySkip
+	if skip {
+		cl.Reply = ev.ReplyOn
+	}
+	switch {
+	case err != nil:
+		if c != nil {
+			s.stats.reject(c.Spec().Name)
+		}
+		// TODO: Move to resp protocol
+		res = "-ERR " + err.Error()
+	case noAuth:
+		s.stats.reject(c.Spec().Name)
+		res = "-NOAUTH Authentication required."
+	case noPerm != "":
+		s.stats.reject(c.Spec().Name)
+		res = noPerm
+	case busy:
+		s.stats.reject(c.Spec().Name)
+		res = s.scripts.running.busyReply()
+	case subscribed:
+		s.stats.reject(c.Spec().Name)
+		res = fmt.Sprintf("-ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET "+
+			"are allowed in this context", aclCommandName(c.Spec(), c.Argv()))
+	case redirect != "":
+		s.stats.reject(c.Spec().Name)
+		cl.Asking = false
+		res = redirect
+	default:
+		res = s.Execute(c, cl)
+	}
+	s.stats.errorReply(res)
+
+	switch {
+	case res == "":
+		// SHUTDOWN closes the connection without a reply
+		return ""
+	case cl.Reply == ev.ReplySkipNext:
+		// the reply of CLIENT REPLY SKIP itself is skipped too
+		cl.Reply = ev.ReplySkip
+		return ""
+	case cl.Reply == ev.ReplyOff, skip:
+		return ""
+	}
+	return res + "\r\n"
+}
+
+// Execute runs a command read by CommandReader on behalf of the client.
+func (s *Server) Execute(c Command, cl *ev.Client) string {
+	spec := c.Spec()
+	if !s.freeMemoryIfNeeded() && spec.Is(CmdDenyOom) {
+		s.stats.reject(spec.Name)
+		return "-OOM command not allowed when used memory > 'maxmemory'."
+	}
+
+	db := cl.Db
+	start := time.Now()
+	res := c.Execute(s, cl)
+	d := time.Since(start)
+	s.feedMonitors(c, cl, db, start)
+	if spec != nil && cl.Tracking != nil {
+		s.trackCommand(c, cl)
+	}
+	if spec != nil && spec.Name != "asking" {
+		// ASKING only holds for the next command
+		cl.Asking = false
+	}
+	if spec != nil {
+		cl.LastCmd = spec.Name
+		s.stats.call(spec.Name, d, res)
+		s.logSlow(c, cl, d)
+		s.latencyAddSampleIfNeeded(latencyEventCommand, d)
+	}
+	return res
+}
+
+// Shutdown makes the event loop stop once the running command is done,
+// and stops the running script if any. Nothing needs saving first, as
+// there is no persistence.
+func (s *Server) Shutdown() {
+	fmt.Println("User requested shutdown...")
+	if r := s.scripts.running; r != nil {
+		r.kill()
+	}
+	if s.conns != nil {
+		s.conns.Stop()
+	}
+}
+
+// Db returns the database currently selected by the client.
+func (s *Server) Db(c *ev.Client) *Db {
+	return s.dbs[c.Db]
+}
+
+func (s *Server) DbAt(idx int) (*Db, bool) {
+	if idx < 0 || idx >= len(s.dbs) {
+		return nil, false
+	}
+	return s.dbs[idx], true
+}
+
+func (s *Server) SwapDb(a int, b int) bool {
+	if _, ok := s.DbAt(a); !ok {
+		return false
+	}
+	if _, ok := s.DbAt(b); !ok {
+		return false
+	}
+	s.dbs[a], s.dbs[b] = s.dbs[b], s.dbs[a]
+	s.dbs[a].id, s.dbs[b].id = a, b
+	return true
+}
+
+func (s *Server) FlushAll() {
+	for _, db := range s.dbs {
+		db.Flush()
+	}
+}
+
+// BeforeSleep does the housekeeping that is left for when the event loop is
+// idle: removing expired keys and moving resizing dicts forward. It reports
+// whether there is work left, in which case the loop should only poll for
+// events instead of blocking. Keys are not expired while clients are
+// paused, so that the dataset does not change during the pause.
+func (s *Server) BeforeSleep() bool {
+	start := time.Now()
+	deadline := start.Add(beforeSleepBudget)
+	pending := false
+	if !s.isPaused() {
+		for _, db := range s.dbs {
+			if db.ActiveExpire(deadline) {
+				pending = true
+			}
+		}
+	}
+
+	expired := time.Now()
+	s.latencyAddSampleIfNeeded(latencyEventExpireCycle, expired.Sub(start))
+	for _, db := range s.dbs {
+		if db.Rehash(deadline) {
+			pending = true
+		}
+	}
+	s.latencyAddSampleIfNeeded(latencyEventRehash, time.Since(expired))
+	return pending
+}
@@ -0,0 +1,60 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strings"
+)
+
+// ShutdownCommand stops the server. There is no persistence nor
+// replication, so there is never a snapshot to save or replicas to wait
+// for, and the flags only change which combinations are accepted.
+type ShutdownCommand struct {
+	BaseCommand
+	reader RespReader
+	abort  bool
+}
+
+func NewShutdownCommand(rr RespReader) *ShutdownCommand {
+	return &ShutdownCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+	}
+}
+
+func (c *ShutdownCommand) ReadParams(len int) error {
+	save, noSave := false, false
+	others := false
+	for i := 0; i < len; i++ {
+		arg, err := c.reader.ReadBulkString()
+		if err != nil {
+			return err
+		}
+		switch strings.ToUpper(arg) {
+		case "SAVE":
+			save = true
+		case "NOSAVE":
+			noSave = true
+		case "NOW", "FORCE":
+			others = true
+		case "ABORT":
+			c.abort = true
+		default:
+			return fmt.Errorf("syntax error")
+		}
+	}
+	if (save && noSave) || (c.abort && (save || noSave || others)) {
+		return fmt.Errorf("syntax error")
+	}
+	return nil
+}
+
+func (c *ShutdownCommand) Execute(srv *Server, cl *ev.Client) string {
+	if c.abort {
+		// a shutdown never waits, so there is none to abort
+		return "-ERR No shutdown in progress."
+	}
+	srv.Shutdown()
+	// the connection is closed without a reply
+	return ""
+}
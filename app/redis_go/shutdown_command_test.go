@@ -0,0 +1,39 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownCommandParamErrors(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	cl := ev.NewClient(1)
+
+	for _, args := range [][]string{
+		{"SAVE", "NOSAVE"},
+		{"ABORT", "NOW"},
+		{"NOSAVE", "ABORT"},
+		{"LATER"},
+	} {
+		res := handle(srv, cl, append([]string{"SHUTDOWN"}, args...)...)
+		assert.Equal(t, "-ERR syntax error\r\n", res, args)
+	}
+	assert.False(t, conns.stopped)
+}
+
+func TestShutdownCommand(t *testing.T) {
+	srv := NewServer(NewConfig())
+	conns := &fakeConnections{}
+	srv.SetConnections(conns)
+	cl := ev.NewClient(1)
+
+	assert.Equal(t, "-ERR No shutdown in progress.\r\n", handle(srv, cl, "SHUTDOWN", "ABORT"))
+	assert.False(t, conns.stopped)
+
+	assert.Equal(t, "", handle(srv, cl, "SHUTDOWN", "NOSAVE", "NOW", "FORCE"))
+	assert.True(t, conns.stopped)
+}
@@ -0,0 +1,102 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"time"
+)
+
+const (
+	// slowlogMaxArgc and slowlogMaxArgLen bound the size of an entry, so
+	// that a huge command does not stay in memory through the slow log.
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	argv     []string
+	addr     string
+	name     string
+}
+
+func (e *slowlogEntry) encode() string {
+	return encodeArray([]string{
+		encodeInt(int(e.id)),
+		encodeInt(int(e.time.Unix())),
+		encodeInt(int(e.duration.Microseconds())),
+		encodeBulkStrings(e.argv),
+		encodeBulkString(e.addr),
+		encodeBulkString(e.name),
+	})
+}
+
+// slowlog keeps the most recent commands that ran for longer than
+// slowlog-log-slower-than, newest first.
+type slowlog struct {
+	entries []*slowlogEntry
+	nextId  int64
+}
+
+func (l *slowlog) add(argv []string, cl *ev.Client, d time.Duration, maxLen int) {
+	e := &slowlogEntry{
+		id:       l.nextId,
+		time:     time.Now(),
+		duration: d,
+		argv:     slowlogArgv(argv),
+		addr:     cl.Addr,
+		name:     cl.Name,
+	}
+	l.nextId++
+
+	l.entries = append([]*slowlogEntry{e}, l.entries...)
+	l.trim(maxLen)
+}
+
+func (l *slowlog) trim(maxLen int) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	if len(l.entries) > maxLen {
+		l.entries = l.entries[:maxLen]
+	}
+}
+
+func (l *slowlog) reset() {
+	l.entries = nil
+}
+
+// slowlogArgv copies argv, truncating it and its arguments when too long.
+func slowlogArgv(argv []string) []string {
+	argc := len(argv)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+
+	res := make([]string, argc)
+	for i := 0; i < argc; i++ {
+		if i == argc-1 && argc != len(argv) {
+			res[i] = fmt.Sprintf("... (%d more arguments)", len(argv)-argc+1)
+			break
+		}
+		arg := argv[i]
+		if len(arg) > slowlogMaxArgLen {
+			arg = arg[:slowlogMaxArgLen] + "... (" +
+				strconv.Itoa(len(arg)-slowlogMaxArgLen) + " more bytes)"
+		}
+		res[i] = arg
+	}
+	return res
+}
+
+// logSlow adds the command to the slow log if it ran for long enough.
+func (s *Server) logSlow(c Command, cl *ev.Client, d time.Duration) {
+	threshold := s.config.SlowlogLogSlowerThan
+	if threshold < 0 || d.Microseconds() < threshold {
+		return
+	}
+	s.slowlog.add(c.Argv(), cl, d, s.config.SlowlogMaxLen)
+}
@@ -0,0 +1,81 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+)
+
+type SlowlogCommand struct {
+	BaseCommand
+	reader     RespReader
+	subcommand string
+	count      int
+}
+
+func NewSlowlogCommand(rr RespReader) *SlowlogCommand {
+	return &SlowlogCommand{
+		BaseCommand: NewBaseCommand(),
+		reader:      rr,
+		count:       10,
+	}
+}
+
+func (c *SlowlogCommand) ReadParams(len int) (err error) {
+	if len < 1 {
+		return fmt.Errorf("incorrect number of params")
+	}
+
+	sub, err := c.reader.ReadBulkString()
+	if err != nil {
+		return
+	}
+	c.subcommand = strings.ToUpper(sub)
+
+	switch c.subcommand {
+	case "LEN", "RESET":
+		if len != 1 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		return nil
+	case "GET":
+		if len > 2 {
+			return fmt.Errorf("incorrect number of params")
+		}
+		if len == 1 {
+			return nil
+		}
+		str, err := c.reader.ReadBulkString()
+		if err != nil {
+			return err
+		}
+		// -1 returns the whole log
+		c.count, err = strconv.Atoi(str)
+		if err != nil || c.count < -1 {
+			return fmt.Errorf("count should be greater than or equal to -1")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown subcommand '%s'", sub)
+}
+
+func (c *SlowlogCommand) Execute(srv *Server, cl *ev.Client) string {
+	switch c.subcommand {
+	case "LEN":
+		return encodeInt(len(srv.slowlog.entries))
+	case "RESET":
+		srv.slowlog.reset()
+		return "+OK"
+	}
+
+	entries := srv.slowlog.entries
+	if c.count >= 0 && c.count < len(entries) {
+		entries = entries[:c.count]
+	}
+	elems := make([]string, len(entries))
+	for i, e := range entries {
+		elems[i] = e.encode()
+	}
+	return encodeArray(elems)
+}
@@ -0,0 +1,74 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"redis-go/app/mocks"
+	"strings"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandSlowlog(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	for i := 0; i < 3; i++ {
+		srv.slowlog.add([]string{"PING"}, cl, time.Second, 10)
+	}
+
+	lc := SlowlogCommand{subcommand: "LEN"}
+	assert.Equal(t, ":3", lc.Execute(srv, cl))
+
+	gc := SlowlogCommand{subcommand: "GET", count: 2}
+	assert.True(t, strings.HasPrefix(gc.Execute(srv, cl), "*2\r\n*6\r\n:2\r\n"))
+	gc.count = -1
+	assert.True(t, strings.HasPrefix(gc.Execute(srv, cl), "*3\r\n"))
+
+	rc := SlowlogCommand{subcommand: "RESET"}
+	assert.Equal(t, "+OK", rc.Execute(srv, cl))
+	assert.Equal(t, ":0", lc.Execute(srv, cl))
+	assert.Equal(t, "*0", gc.Execute(srv, cl))
+}
+
+func TestSlowlogReadParamsGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSlowlogCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("get", nil)
+	assert.Nil(t, sc.ReadParams(1))
+	assert.Equal(t, "GET", sc.subcommand)
+	assert.Equal(t, 10, sc.count)
+}
+
+func TestSlowlogReadParamsGetCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSlowlogCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("get", nil)
+	mrr.EXPECT().ReadBulkString().Return("-1", nil)
+	assert.Nil(t, sc.ReadParams(2))
+	assert.Equal(t, -1, sc.count)
+}
+
+func TestSlowlogReadParamsGetCountError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSlowlogCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("get", nil)
+	mrr.EXPECT().ReadBulkString().Return("-2", nil)
+	assert.NotNil(t, sc.ReadParams(2))
+}
+
+func TestSlowlogReadParamsUnknownSubcommand(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mrr := mocks.NewMockRespReader(ctrl)
+
+	sc := NewSlowlogCommand(mrr)
+	mrr.EXPECT().ReadBulkString().Return("foo", nil)
+	assert.NotNil(t, sc.ReadParams(1))
+}
@@ -0,0 +1,90 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowlogAdd(t *testing.T) {
+	var l slowlog
+	cl := ev.NewClient(1)
+	cl.Addr = "127.0.0.1:5000"
+	cl.Name = "worker"
+
+	l.add([]string{"GET", "a"}, cl, time.Millisecond, 2)
+	l.add([]string{"GET", "b"}, cl, time.Millisecond, 2)
+	l.add([]string{"GET", "c"}, cl, 2*time.Millisecond, 2)
+
+	assert.Equal(t, 2, len(l.entries))
+	assert.Equal(t, int64(2), l.entries[0].id)
+	assert.Equal(t, []string{"GET", "c"}, l.entries[0].argv)
+	assert.Equal(t, int64(1), l.entries[1].id)
+	assert.Equal(t, "127.0.0.1:5000", l.entries[0].addr)
+	assert.Equal(t, "worker", l.entries[0].name)
+
+	l.reset()
+	assert.Empty(t, l.entries)
+	l.add([]string{"GET", "d"}, cl, time.Millisecond, 2)
+	// ids keep increasing across resets
+	assert.Equal(t, int64(3), l.entries[0].id)
+}
+
+func TestSlowlogArgvTruncated(t *testing.T) {
+	argv := []string{"SET", "key", strings.Repeat("x", 200)}
+	res := slowlogArgv(argv)
+	assert.Equal(t, strings.Repeat("x", 128)+"... (72 more bytes)", res[2])
+
+	argv = []string{"MSET"}
+	for i := 0; i < 40; i++ {
+		argv = append(argv, strconv.Itoa(i))
+	}
+	res = slowlogArgv(argv)
+	assert.Equal(t, slowlogMaxArgc, len(res))
+	assert.Equal(t, "29", res[30])
+	assert.Equal(t, "... (10 more arguments)", res[31])
+}
+
+func TestSlowlogEntryEncode(t *testing.T) {
+	e := slowlogEntry{
+		id:       7,
+		time:     time.Unix(1700000000, 0),
+		duration: 15 * time.Millisecond,
+		argv:     []string{"PING"},
+		addr:     "127.0.0.1:5000",
+	}
+	assert.Equal(t, "*6\r\n:7\r\n:1700000000\r\n:15000\r\n*1\r\n$4\r\nPING\r\n"+
+		"$14\r\n127.0.0.1:5000\r\n$0\r\n", e.encode())
+}
+
+func TestServerLogSlow(t *testing.T) {
+	srv := NewServer(NewConfig())
+	cl := ev.NewClient(1)
+	c := &PingCommand{}
+	c.setArgv([]string{"PING"})
+
+	srv.logSlow(c, cl, 5*time.Millisecond)
+	assert.Empty(t, srv.slowlog.entries)
+
+	srv.logSlow(c, cl, 10*time.Millisecond)
+	assert.Equal(t, 1, len(srv.slowlog.entries))
+
+	srv.config.SlowlogLogSlowerThan = -1
+	srv.logSlow(c, cl, time.Second)
+	assert.Equal(t, 1, len(srv.slowlog.entries))
+}
+
+func TestServerExecuteLogsSlow(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SlowlogLogSlowerThan = 0
+	srv := NewServer(cfg)
+	cl := ev.NewClient(1)
+
+	handle(srv, cl, "SET", "hello", "world")
+	assert.Equal(t, 1, len(srv.slowlog.entries))
+	assert.Equal(t, []string{"SET", "hello", "world"}, srv.slowlog.entries[0].argv)
+}
@@ -0,0 +1,113 @@
+package redis_go
+
+import (
+	"strings"
+	"time"
+)
+
+// commandStats are the counters kept for each command.
+type commandStats struct {
+	calls int64
+	// rejected calls never ran, because of invalid arguments or because
+	// they were refused, failed calls ran and replied with an error
+	rejected int64
+	failed   int64
+	duration time.Duration
+	latency  latencyHistogram
+}
+
+// serverStats are the counters reported by INFO, on top of the ones kept
+// by each Db and by the event loop.
+type serverStats struct {
+	commands int64
+	evicted  int64
+	// errors counts the error replies by their code, such as ERR or OOM
+	errors       map[string]int64
+	errorReplies int64
+	// byCommand is keyed by the command name
+	byCommand map[string]*commandStats
+	// rates sampled by the cron
+	opsPerSec    instantaneousMetric
+	inputPerSec  instantaneousMetric
+	outputPerSec instantaneousMetric
+}
+
+// instantaneousSamples is the number of samples an instantaneousMetric
+// averages.
+const instantaneousSamples = 16
+
+// instantaneousMetric estimates the recent rate of a counter from the
+// samples the cron takes of it.
+type instantaneousMetric struct {
+	lastTime  time.Time
+	lastValue int64
+	samples   [instantaneousSamples]float64
+	idx       int
+}
+
+func (m *instantaneousMetric) track(value int64, now time.Time) {
+	if elapsed := now.Sub(m.lastTime); !m.lastTime.IsZero() && elapsed > 0 {
+		m.samples[m.idx] = float64(value-m.lastValue) / elapsed.Seconds()
+		m.idx = (m.idx + 1) % instantaneousSamples
+	}
+	m.lastTime = now
+	m.lastValue = value
+}
+
+// rate is per second.
+func (m *instantaneousMetric) rate() float64 {
+	sum := 0.0
+	for _, s := range m.samples {
+		sum += s
+	}
+	return sum / instantaneousSamples
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		errors:    make(map[string]int64),
+		byCommand: make(map[string]*commandStats),
+	}
+}
+
+func (st *serverStats) command(name string) *commandStats {
+	cs, ok := st.byCommand[name]
+	if !ok {
+		cs = &commandStats{}
+		st.byCommand[name] = cs
+	}
+	return cs
+}
+
+// call records a command that ran for d.
+func (st *serverStats) call(name string, d time.Duration, res string) {
+	st.commands++
+	cs := st.command(name)
+	cs.calls++
+	cs.duration += d
+	cs.latency.record(d)
+	if isErrorReply(res) {
+		cs.failed++
+	}
+}
+
+func (st *serverStats) reject(name string) {
+	st.command(name).rejected++
+}
+
+// errorReply counts a reply if it is an error.
+func (st *serverStats) errorReply(res string) {
+	if !isErrorReply(res) {
+		return
+	}
+	code := res[1:]
+	if i := strings.IndexAny(code, " \r\n"); i >= 0 {
+		code = code[:i]
+	}
+	st.errors[code]++
+	st.errorReplies++
+}
+
+func isErrorReply(res string) bool {
+	return strings.HasPrefix(res, "-")
+}
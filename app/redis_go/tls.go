@@ -0,0 +1,129 @@
+package redis_go
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// IsValidTlsAuthClients checks the value of tls-auth-clients: yes requires
+// the clients to send a certificate signed by the CA, optional only
+// verifies the ones they send, and no does not ask for any.
+func IsValidTlsAuthClients(v string) bool {
+	switch v {
+	case "yes", "no", "optional":
+		return true
+	}
+	return false
+}
+
+// tlsSettings are the configs TLS is set up from.
+type tlsSettings struct {
+	certFile    string
+	keyFile     string
+	caCertFile  string
+	authClients string
+}
+
+func tlsSettingsOf(config *Config) tlsSettings {
+	return tlsSettings{
+		certFile:    config.TlsCertFile,
+		keyFile:     config.TlsKeyFile,
+		caCertFile:  config.TlsCaCertFile,
+		authClients: config.TlsAuthClients,
+	}
+}
+
+// TlsContext holds the TLS configuration built from the certificate files,
+// and builds it again on Reload, so that certificates can be renewed
+// without a restart. It keeps its own copy of the settings, as Reload runs
+// on the goroutine handling the signals while CONFIG SET changes the
+// config on the loop.
+type TlsContext struct {
+	mu       sync.Mutex
+	settings tlsSettings
+	current  atomic.Pointer[tls.Config]
+}
+
+func NewTlsContext(config *Config) (*TlsContext, error) {
+	t := &TlsContext{}
+	return t, t.Configure(config)
+}
+
+// Configure builds the TLS configuration from the settings of config. The
+// configuration and the settings in use are kept when they are not valid.
+func (t *TlsContext) Configure(config *Config) error {
+	settings := tlsSettingsOf(config)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, err := loadTlsConfig(settings)
+	if err != nil {
+		return err
+	}
+	t.settings = settings
+	t.current.Store(c)
+	return nil
+}
+
+// Reload reads the certificate files again. The connections established
+// already are not affected, and the configuration in use is kept when the
+// files are not valid.
+func (t *TlsContext) Reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, err := loadTlsConfig(t.settings)
+	if err != nil {
+		return err
+	}
+	t.current.Store(c)
+	return nil
+}
+
+// ServerConfig is the configuration to accept connections with. Each
+// handshake uses the configuration loaded last.
+func (t *TlsContext) ServerConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return t.current.Load(), nil
+		},
+	}
+}
+
+func loadTlsConfig(settings tlsSettings) (*tls.Config, error) {
+	if settings.certFile == "" || settings.keyFile == "" {
+		return nil, fmt.Errorf("tls-cert-file and tls-key-file are required for TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(settings.certFile, settings.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate %s: %w", settings.certFile, err)
+	}
+
+	c := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch settings.authClients {
+	case "no":
+		return c, nil
+	case "optional":
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if settings.caCertFile == "" {
+		return nil, fmt.Errorf("tls-ca-cert-file is required to verify the clients when tls-auth-clients is enabled")
+	}
+	pem, err := os.ReadFile(settings.caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificate %s: %w", settings.caCertFile, err)
+	}
+	c.ClientCAs = x509.NewCertPool()
+	if !c.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", settings.caCertFile)
+	}
+	return c, nil
+}
@@ -0,0 +1,133 @@
+package redis_go
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to dir,
+// and returns their paths.
+func writeTestCertificate(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func currentCertName(t *testing.T, ctx *TlsContext) string {
+	c, err := ctx.ServerConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestIsValidTlsAuthClients(t *testing.T) {
+	assert.True(t, IsValidTlsAuthClients("yes"))
+	assert.True(t, IsValidTlsAuthClients("optional"))
+	assert.True(t, IsValidTlsAuthClients("no"))
+	assert.False(t, IsValidTlsAuthClients("maybe"))
+}
+
+func TestNewTlsContext(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NewConfig()
+	_, err := NewTlsContext(cfg)
+	assert.EqualError(t, err, "tls-cert-file and tls-key-file are required for TLS")
+
+	cfg.TlsCertFile, cfg.TlsKeyFile = writeTestCertificate(t, dir, "server")
+	_, err = NewTlsContext(cfg)
+	assert.EqualError(t, err, "tls-ca-cert-file is required to verify the clients when tls-auth-clients is enabled")
+
+	cfg.TlsCaCertFile = filepath.Join(dir, "missing.crt")
+	_, err = NewTlsContext(cfg)
+	assert.Error(t, err)
+
+	cfg.TlsCaCertFile = cfg.TlsKeyFile
+	_, err = NewTlsContext(cfg)
+	assert.EqualError(t, err, "no certificate found in "+cfg.TlsKeyFile)
+
+	cfg.TlsCaCertFile, _ = writeTestCertificate(t, dir, "ca")
+	ctx, err := NewTlsContext(cfg)
+	assert.NoError(t, err)
+	c := ctx.current.Load()
+	assert.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+	assert.NotNil(t, c.ClientCAs)
+
+	cfg.TlsAuthClients = "optional"
+	assert.NoError(t, ctx.Configure(cfg))
+	assert.Equal(t, tls.VerifyClientCertIfGiven, ctx.current.Load().ClientAuth)
+
+	// no CA is needed when the clients are not verified
+	cfg.TlsAuthClients = "no"
+	cfg.TlsCaCertFile = ""
+	assert.NoError(t, ctx.Configure(cfg))
+	assert.Equal(t, tls.NoClientCert, ctx.current.Load().ClientAuth)
+	assert.Nil(t, ctx.current.Load().ClientCAs)
+}
+
+func TestTlsContextReload(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NewConfig()
+	cfg.TlsAuthClients = "no"
+	cfg.TlsCertFile, cfg.TlsKeyFile = writeTestCertificate(t, dir, "old")
+	ctx, err := NewTlsContext(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", currentCertName(t, ctx))
+
+	newCert, newKey := writeTestCertificate(t, dir, "new")
+	os.Rename(newCert, cfg.TlsCertFile)
+	os.Rename(newKey, cfg.TlsKeyFile)
+	assert.NoError(t, ctx.Reload())
+	assert.Equal(t, "new", currentCertName(t, ctx))
+
+	// a broken file leaves the certificate in use
+	os.WriteFile(cfg.TlsCertFile, []byte("garbage"), 0644)
+	assert.Error(t, ctx.Reload())
+	assert.Equal(t, "new", currentCertName(t, ctx))
+}
+
+func TestTlsContextConfigureKeepsSettings(t *testing.T) {
+	dir := t.TempDir()
+	cfg := NewConfig()
+	cfg.TlsAuthClients = "no"
+	cfg.TlsCertFile, cfg.TlsKeyFile = writeTestCertificate(t, dir, "old")
+	ctx, err := NewTlsContext(cfg)
+	assert.NoError(t, err)
+
+	// invalid settings are not taken, so that Reload uses the old ones
+	bad := *cfg
+	bad.TlsCertFile = filepath.Join(dir, "missing.crt")
+	assert.Error(t, ctx.Configure(&bad))
+	assert.NoError(t, ctx.Reload())
+	assert.Equal(t, "old", currentCertName(t, ctx))
+}
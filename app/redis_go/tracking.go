@@ -0,0 +1,273 @@
+package redis_go
+
+import (
+	"fmt"
+	"redis-go/app/ev"
+	"sort"
+	"strings"
+)
+
+// trackingChannel is the channel a RESP2 connection subscribes to, to get
+// the invalidation messages redirected to it.
+const trackingChannel = "__redis__:invalidate"
+
+// tracking is the state of client side caching. In the default mode, the
+// keys read by the clients with CLIENT TRACKING on are remembered in keys,
+// and they are told once when one of them changes. In the BCAST mode, they
+// are told about every change of the keys with one of their prefixes. The
+// keys are shared by the dbs, as in redis.
+type tracking struct {
+	// keys are the ids of the clients that read each key, and items the
+	// sum of them
+	keys  map[string]map[int64]bool
+	items int
+	// prefixes are the clients in BCAST mode by prefix
+	prefixes map[string]map[int64]*ev.Client
+	// clients are the clients with tracking on, by id
+	clients map[int64]*ev.Client
+}
+
+func newTracking() *tracking {
+	return &tracking{
+		keys:     map[string]map[int64]bool{},
+		prefixes: map[string]map[int64]*ev.Client{},
+		clients:  map[int64]*ev.Client{},
+	}
+}
+
+// checkPrefixes reports the prefixes that overlap, either with the ones
+// the client tracks already or among themselves, as a client may only be
+// told once about a key.
+func checkPrefixes(cl *ev.Client, prefixes []string) error {
+	overlap := func(a string, b string) bool {
+		return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+	}
+	for i, p := range prefixes {
+		if cl.Tracking != nil {
+			for _, old := range cl.Tracking.Prefixes {
+				if overlap(old, p) {
+					return fmt.Errorf("Prefix '%s' overlaps with an existing prefix '%s'. "+
+						"Prefixes for a single client must not overlap.", p, old)
+				}
+			}
+		}
+		for _, other := range prefixes[i+1:] {
+			if overlap(other, p) {
+				return fmt.Errorf("Prefix '%s' overlaps with another provided prefix '%s'. "+
+					"Prefixes for a single client must not overlap.", p, other)
+			}
+		}
+	}
+	return nil
+}
+
+// enableTracking turns tracking on with the options of t, or updates them
+// when it is on already, adding the prefixes to the ones tracked. BCAST
+// without prefixes tracks all the keys.
+func (s *Server) enableTracking(cl *ev.Client, t ev.Tracking) {
+	prefixes := t.Prefixes
+	if t.Bcast && len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	t.Prefixes = nil
+	if cl.Tracking != nil {
+		t.Prefixes = cl.Tracking.Prefixes
+	}
+	t.Caching = false
+	cl.Tracking = &t
+	s.tracking.clients[cl.Id] = cl
+
+	for _, p := range prefixes {
+		if containsString(t.Prefixes, p) {
+			continue
+		}
+		t.Prefixes = append(t.Prefixes, p)
+		clients, ok := s.tracking.prefixes[p]
+		if !ok {
+			clients = map[int64]*ev.Client{}
+			s.tracking.prefixes[p] = clients
+		}
+		clients[cl.Id] = cl
+	}
+}
+
+// disableTracking turns tracking off. The keys the client read are left
+// in the table, and skipped once they change.
+func (s *Server) disableTracking(cl *ev.Client) {
+	if cl.Tracking == nil {
+		return
+	}
+	for _, p := range cl.Tracking.Prefixes {
+		delete(s.tracking.prefixes[p], cl.Id)
+		if len(s.tracking.prefixes[p]) == 0 {
+			delete(s.tracking.prefixes, p)
+		}
+	}
+	delete(s.tracking.clients, cl.Id)
+	cl.Tracking = nil
+}
+
+// trackingRememberKeys records the keys read by a command of a client in
+// the default mode. With OPTIN they are only recorded after CLIENT CACHING
+// YES, and with OPTOUT they are unless after CLIENT CACHING NO.
+func (s *Server) trackingRememberKeys(cl *ev.Client, keys []string) {
+	t := cl.Tracking
+	if t == nil || t.Bcast || t.OptIn && !t.Caching || t.OptOut && t.Caching {
+		return
+	}
+	for _, key := range keys {
+		ids, ok := s.tracking.keys[key]
+		if !ok {
+			ids = map[int64]bool{}
+			s.tracking.keys[key] = ids
+		}
+		if !ids[cl.Id] {
+			ids[cl.Id] = true
+			s.tracking.items++
+		}
+	}
+	s.trackingLimitKeys()
+}
+
+// trackingLimitKeys keeps the table within tracking-table-max-keys, by
+// invalidating keys as if they had changed.
+func (s *Server) trackingLimitKeys() {
+	max := s.config.TrackingTableMaxKeys
+	if max == 0 {
+		return
+	}
+	for key := range s.tracking.keys {
+		if len(s.tracking.keys) <= max {
+			return
+		}
+		s.trackingInvalidateKey(nil, key)
+	}
+}
+
+// trackingInvalidateKey tells the clients tracking key that it changed,
+// because of a command of cl or, when cl is nil, because it expired or
+// was evicted. The clients with NOLOOP are not told about their own
+// changes.
+func (s *Server) trackingInvalidateKey(cl *ev.Client, key string) {
+	for p, clients := range s.tracking.prefixes {
+		if !strings.HasPrefix(key, p) {
+			continue
+		}
+		for _, c := range clients {
+			if c.Tracking.NoLoop && c == cl {
+				continue
+			}
+			s.sendInvalidation(c, encodeBulkStrings([]string{key}))
+		}
+	}
+
+	ids, ok := s.tracking.keys[key]
+	if !ok {
+		return
+	}
+	delete(s.tracking.keys, key)
+	s.tracking.items -= len(ids)
+	for id := range ids {
+		c, ok := s.tracking.clients[id]
+		if !ok || c.Tracking.Bcast || c.Tracking.NoLoop && c == cl {
+			continue
+		}
+		s.sendInvalidation(c, encodeBulkStrings([]string{key}))
+	}
+}
+
+// trackingInvalidateAll tells every client tracking keys that they all
+// changed, as the dbs were flushed, and empties the table.
+func (s *Server) trackingInvalidateAll() {
+	for _, c := range s.tracking.clients {
+		s.sendInvalidation(c, "")
+	}
+	s.tracking.keys = map[string]map[int64]bool{}
+	s.tracking.items = 0
+}
+
+// sendInvalidation sends the keys that changed to the client tracking
+// them, or to the client it redirects to. An empty keys stands for all the
+// keys. RESP3 clients get them as a push, RESP2 ones only when redirected
+// to a client subscribed to __redis__:invalidate, as a message.
+func (s *Server) sendInvalidation(cl *ev.Client, keys string) {
+	target := cl
+	if cl.Tracking.Redirect != 0 {
+		target = s.clientById(cl.Tracking.Redirect)
+		if target == nil {
+			cl.Tracking.RedirectBroken = true
+			if cl.Resp == 3 {
+				cl.Push(encodePush(3, []string{
+					encodeBulkString("tracking-redir-broken"), encodeInt(int(cl.Tracking.Redirect)),
+				}) + "\r\n")
+			}
+			return
+		}
+	}
+
+	if keys == "" {
+		keys = "$-1"
+		if target.Resp == 3 {
+			keys = "_"
+		}
+	}
+	switch {
+	case target.Resp == 3:
+		target.Push(encodePush(3, []string{encodeBulkString("invalidate"), keys}) + "\r\n")
+	case target != cl && target.Channels[trackingChannel]:
+		target.Push(encodeArray([]string{
+			encodeBulkString("message"), encodeBulkString(trackingChannel), keys,
+		}) + "\r\n")
+	}
+}
+
+// clientById returns the connected client with the id, or nil.
+func (s *Server) clientById(id int64) *ev.Client {
+	if c, ok := s.tracking.clients[id]; ok {
+		return c
+	}
+	for _, c := range s.Clients() {
+		if c.Id == id && !c.IsClosing() {
+			return c
+		}
+	}
+	return nil
+}
+
+// trackCommand remembers the keys read by a command of a client with
+// tracking on, then forgets the CLIENT CACHING given for the command.
+func (s *Server) trackCommand(c Command, cl *ev.Client) {
+	spec := c.Spec()
+	argv := c.Argv()
+	if spec.Is(CmdReadOnly) {
+		s.trackingRememberKeys(cl, spec.Keys(argv))
+	}
+	caching := spec.Name == "client" && len(argv) > 1 && strings.EqualFold(argv[1], "caching")
+	if cl.Tracking != nil && !caching {
+		cl.Tracking.Caching = false
+	}
+}
+
+// signalModifiedKey is called each time a key changes, by a command of cl
+// or, when cl is nil, by the server itself.
+func (s *Server) signalModifiedKey(cl *ev.Client, key string) {
+	if len(s.tracking.keys) > 0 || len(s.tracking.prefixes) > 0 {
+		s.trackingInvalidateKey(cl, key)
+	}
+}
+
+// trackingPrefixes returns the prefixes the client tracks, sorted.
+func trackingPrefixes(t *ev.Tracking) []string {
+	prefixes := append([]string{}, t.Prefixes...)
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
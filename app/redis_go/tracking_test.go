@@ -0,0 +1,207 @@
+package redis_go
+
+import (
+	"redis-go/app/ev"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// invalidateLen is the length of the RESP3 push of an invalidation of key.
+func invalidateLen(key string) int {
+	return len(encodePush(3, []string{encodeBulkString("invalidate"), encodeBulkStrings([]string{key})}) + "\r\n")
+}
+
+func TestCheckPrefixes(t *testing.T) {
+	cl := ev.NewClient(1)
+	assert.NoError(t, checkPrefixes(cl, []string{"a:", "b:"}))
+	assert.EqualError(t, checkPrefixes(cl, []string{"a:", "a:b"}),
+		"Prefix 'a:' overlaps with another provided prefix 'a:b'. Prefixes for a single client must not overlap.")
+
+	cl.Tracking = &ev.Tracking{Bcast: true, Prefixes: []string{"user:"}}
+	assert.EqualError(t, checkPrefixes(cl, []string{"u"}),
+		"Prefix 'u' overlaps with an existing prefix 'user:'. Prefixes for a single client must not overlap.")
+}
+
+func TestServerTrackingDefaultMode(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Id = 1
+	a.Resp = 3
+	b := ev.NewClient(2)
+	b.Id = 2
+	srv.enableTracking(a, ev.Tracking{})
+
+	srv.trackingRememberKeys(a, []string{"k", "j"})
+	srv.trackingRememberKeys(a, []string{"k"})
+	assert.Equal(t, 2, len(srv.tracking.keys))
+	assert.Equal(t, 2, srv.tracking.items)
+
+	// told once, until the key is read again
+	srv.signalModifiedKey(b, "k")
+	assert.Equal(t, invalidateLen("k"), a.PendingOutput())
+	srv.signalModifiedKey(b, "k")
+	assert.Equal(t, invalidateLen("k"), a.PendingOutput())
+	assert.Equal(t, 1, srv.tracking.items)
+
+	srv.disableTracking(a)
+	srv.signalModifiedKey(b, "j")
+	assert.Equal(t, invalidateLen("k"), a.PendingOutput())
+	assert.Empty(t, srv.tracking.keys)
+	assert.Empty(t, srv.tracking.clients)
+}
+
+func TestServerTrackingNoLoop(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Resp = 3
+	srv.enableTracking(a, ev.Tracking{NoLoop: true})
+
+	srv.trackingRememberKeys(a, []string{"k"})
+	srv.signalModifiedKey(a, "k")
+	assert.Equal(t, 0, a.PendingOutput())
+	assert.Empty(t, srv.tracking.keys)
+}
+
+func TestServerTrackingOptInOptOut(t *testing.T) {
+	srv := NewServer(NewConfig())
+	in := ev.NewClient(1)
+	in.Id = 1
+	out := ev.NewClient(2)
+	out.Id = 2
+	srv.enableTracking(in, ev.Tracking{OptIn: true})
+	srv.enableTracking(out, ev.Tracking{OptOut: true})
+
+	srv.trackingRememberKeys(in, []string{"a"})
+	srv.trackingRememberKeys(out, []string{"b"})
+	assert.Equal(t, []string{"b"}, trackedKeys(srv))
+
+	in.Tracking.Caching = true
+	out.Tracking.Caching = true
+	srv.trackingRememberKeys(in, []string{"c"})
+	srv.trackingRememberKeys(out, []string{"d"})
+	assert.Equal(t, []string{"b", "c"}, trackedKeys(srv))
+}
+
+func TestServerTrackingBcast(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Id = 1
+	a.Resp = 3
+	srv.enableTracking(a, ev.Tracking{Bcast: true, Prefixes: []string{"user:"}})
+	srv.enableTracking(a, ev.Tracking{Bcast: true, Prefixes: []string{"user:", "item:"}})
+	assert.Equal(t, []string{"item:", "user:"}, trackingPrefixes(a.Tracking))
+	assert.Equal(t, 2, len(srv.tracking.prefixes))
+
+	// keys are not remembered, every change under a prefix is told
+	srv.trackingRememberKeys(a, []string{"user:1"})
+	assert.Empty(t, srv.tracking.keys)
+	srv.signalModifiedKey(nil, "user:1")
+	srv.signalModifiedKey(nil, "user:1")
+	srv.signalModifiedKey(nil, "other")
+	assert.Equal(t, 2*invalidateLen("user:1"), a.PendingOutput())
+
+	srv.disableTracking(a)
+	assert.Empty(t, srv.tracking.prefixes)
+
+	srv.enableTracking(a, ev.Tracking{Bcast: true})
+	assert.Equal(t, []string{""}, a.Tracking.Prefixes)
+}
+
+func TestServerTrackingRedirect(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Id = 1
+	a.Resp = 3
+	b := ev.NewClient(2)
+	b.Id = 2
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{a, b}})
+
+	// a RESP2 connection only gets the messages once subscribed
+	srv.enableTracking(a, ev.Tracking{Redirect: 2})
+	srv.trackingRememberKeys(a, []string{"k"})
+	srv.signalModifiedKey(nil, "k")
+	assert.Equal(t, 0, a.PendingOutput()+b.PendingOutput())
+
+	srv.subscribe(b, trackingChannel, false)
+	srv.trackingRememberKeys(a, []string{"k"})
+	srv.signalModifiedKey(nil, "k")
+	message := encodeArray([]string{
+		encodeBulkString("message"), encodeBulkString(trackingChannel), encodeBulkStrings([]string{"k"}),
+	}) + "\r\n"
+	assert.Equal(t, len(message), b.PendingOutput())
+
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{a}})
+	srv.trackingRememberKeys(a, []string{"k"})
+	srv.signalModifiedKey(nil, "k")
+	assert.True(t, a.Tracking.RedirectBroken)
+	assert.Equal(t, len(">2\r\n$21\r\ntracking-redir-broken\r\n:2\r\n"), a.PendingOutput())
+}
+
+func TestServerTrackingInvalidateAll(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Resp = 3
+	srv.enableTracking(a, ev.Tracking{})
+	srv.trackingRememberKeys(a, []string{"k"})
+
+	srv.trackingInvalidateAll()
+	assert.Equal(t, len(">2\r\n$10\r\ninvalidate\r\n_\r\n"), a.PendingOutput())
+	assert.Empty(t, srv.tracking.keys)
+	assert.Equal(t, 0, srv.tracking.items)
+}
+
+func TestServerTrackingLimitKeys(t *testing.T) {
+	srv := NewServer(NewConfig())
+	srv.config.TrackingTableMaxKeys = 2
+	a := ev.NewClient(1)
+	a.Resp = 3
+	srv.enableTracking(a, ev.Tracking{})
+
+	srv.trackingRememberKeys(a, []string{"a", "b", "c"})
+	assert.Equal(t, 2, len(srv.tracking.keys))
+	assert.Equal(t, 2, srv.tracking.items)
+	assert.Equal(t, 1, a.PendingOutput()/invalidateLen("a"))
+}
+
+func TestServerTrackingCommands(t *testing.T) {
+	srv := NewServer(NewConfig())
+	a := ev.NewClient(1)
+	a.Id = 1
+	a.Resp = 3
+	b := ev.NewClient(2)
+	b.Id = 2
+	srv.SetConnections(&fakeConnections{clients: []*ev.Client{a, b}})
+	srv.enableTracking(a, ev.Tracking{})
+
+	handle(srv, a, "GET", "k")
+	assert.Equal(t, []string{"k"}, trackedKeys(srv))
+	handle(srv, b, "SET", "k", "v")
+	assert.Equal(t, invalidateLen("k"), a.PendingOutput())
+
+	handle(srv, a, "GET", "k")
+	handle(srv, b, "FLUSHALL")
+	assert.Equal(t, invalidateLen("k")+len(">2\r\n$10\r\ninvalidate\r\n_\r\n"), a.PendingOutput())
+
+	// CLIENT CACHING only applies to the command right after it
+	srv.enableTracking(b, ev.Tracking{OptIn: true})
+	handle(srv, b, "CLIENT", "CACHING", "YES")
+	assert.True(t, b.Tracking.Caching)
+	handle(srv, b, "PING")
+	handle(srv, b, "GET", "x")
+	assert.False(t, b.Tracking.Caching)
+	assert.Empty(t, srv.tracking.keys)
+
+	srv.ClientClosed(b)
+	assert.Nil(t, b.Tracking)
+}
+
+func trackedKeys(srv *Server) []string {
+	var keys []string
+	for key := range srv.tracking.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,28 +1,87 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/signal"
 	"redis-go/app/ev"
 	redis "redis-go/app/redis_go"
+	"syscall"
+	"time"
 )
 
+// main runs the server with the config of the file given as first
+// argument, if any, and of the options following it, such as --port 7000,
+// as redis-server does. --sentinel runs it in sentinel mode, on the
+// sentinel port unless another is set.
 func main() {
+	cfg := redis.NewConfig()
+	for _, arg := range os.Args[1:] {
+		if arg == "--sentinel" {
+			cfg.Port = redis.SentinelPort
+		}
+	}
+	file, options := redis.ParseArgs(os.Args[1:])
+	if err := redis.LoadConfig(cfg, file, options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.Port == 0 && cfg.TlsPort == 0 {
+		panic("port and tls-port can not both be 0")
+	}
+	if cfg.TlsPort == cfg.Port {
+		panic("tls-port should differ from port")
+	}
+
 	sc := &ev.Syscalls{}
 	el := ev.NewSocketEventLoop(sc)
-	data := make(map[string]string)
-
-	err := el.Run(func(sr ev.StringReader) string {
-		rr := redis.NewRespReader(sr)
-		cr := redis.NewCommandReader(rr)
+	srv := redis.NewServer(cfg)
+	if cfg.AclFile != "" {
+		if err := srv.LoadAclFile(); err != nil {
+			panic(err)
+		}
+	}
+	if err := srv.StartCluster(); err != nil {
+		panic(err)
+	}
+	el.SetBeforeSleep(srv.BeforeSleep)
+	el.SetOnClose(srv.ClientClosed)
+	el.SetPort(cfg.Port)
+	el.SetIdleTimeout(time.Duration(cfg.Timeout) * time.Second)
+	el.SetKeepAlive(time.Duration(cfg.TcpKeepAlive) * time.Second)
+	el.SetMaxClients(cfg.MaxClients)
+	srv.SetConnections(&el)
 
-		c, err := cr.Read()
-		// TODO: Move to resp protocol
+	if cfg.TlsPort > 0 {
+		tlsConfig, err := srv.TlsConfig()
 		if err != nil {
-			return "-ERR " + err.Error() + "\r\n"
+			panic(err)
+		}
+		el.SetTls(cfg.TlsPort, tlsConfig)
+	}
+
+	// SIGHUP reloads the TLS certificates, the other signals shut down
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		for sig := range sigs {
+			if sig != syscall.SIGHUP {
+				fmt.Printf("Received %s, scheduling shutdown...\n", sig)
+				el.Stop()
+				return
+			}
+			enabled, err := srv.ReloadTls()
+			if err != nil {
+				fmt.Printf("Failed to reload TLS certificates: %s\n", err)
+			} else if enabled {
+				fmt.Println("TLS certificates reloaded")
+			}
 		}
-		return c.Execute(&data) + "\r\n"
-	})
+	}()
 
+	err := el.Run(srv.Handle)
 	if err != nil {
 		panic(err)
 	}
+	fmt.Println("Server is now ready to exit, bye bye...")
 }
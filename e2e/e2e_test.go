@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"strconv"
@@ -41,12 +42,299 @@ func TestSetGet(t *testing.T) {
 	assert.Equal(t, "Hamilton", read(t, rw))
 }
 
+func TestSelect(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "SELECT", "9")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "FLUSHDB")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "SET", "Max", "Verstappen")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "DBSIZE")
+	assert.Equal(t, "1", read(t, rw))
+	write(t, rw, "MOVE", "Max", "10")
+	assert.Equal(t, "1", read(t, rw))
+	write(t, rw, "DBSIZE")
+	assert.Equal(t, "0", read(t, rw))
+	write(t, rw, "SWAPDB", "9", "10")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "GET", "Max")
+	assert.Equal(t, "Verstappen", read(t, rw))
+}
+
+func TestScan(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "SELECT", "11")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "FLUSHDB")
+	assert.Equal(t, "OK", read(t, rw))
+	for i := 0; i < 50; i++ {
+		write(t, rw, "SET", "scan:"+str(i), "v")
+		assert.Equal(t, "OK", read(t, rw))
+	}
+
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		write(t, rw, "SCAN", cursor, "MATCH", "scan:*", "COUNT", "7")
+		res := readArray(t, rw)
+		cursor = res[0]
+		for _, k := range res[1:] {
+			seen[k] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 50, len(seen))
+}
+
+func TestActiveExpire(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "SELECT", "12")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "FLUSHDB")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "SET", "Kimi", "Raikkonen", "PX", "100")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "RANDOMKEY")
+	assert.Equal(t, "Kimi", read(t, rw))
+
+	time.Sleep(200 * time.Millisecond)
+	// the key is removed while the loop is idle after the PING, without
+	// being accessed
+	write(t, rw, "PING")
+	assert.Equal(t, "PONG", read(t, rw))
+	write(t, rw, "DBSIZE")
+	assert.Equal(t, "0", read(t, rw))
+}
+
 type resp struct {
 	connectTime int
 	getSetTime  int
 	err         error
 }
 
+func TestMemory(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "SET", "Charles", "Leclerc")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "MEMORY", "USAGE", "Charles")
+	n, err := strconv.Atoi(read(t, rw))
+	assert.Nil(t, err)
+	assert.Greater(t, n, len("Charles")+len("Leclerc"))
+
+	write(t, rw, "MEMORY", "STATS")
+	stats := readArray(t, rw)
+	assert.Contains(t, stats, "keys.count")
+	assert.Contains(t, stats, "clients.normal")
+}
+
+func TestInfo(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "PING")
+	assert.Equal(t, "PONG", read(t, rw))
+	write(t, rw, "INFO", "stats", "commandstats")
+	info := readBulk(t, rw)
+	assert.Contains(t, info, "# Stats\r\n")
+	assert.Contains(t, info, "cmdstat_ping:calls=")
+	assert.NotContains(t, info, "# Server\r\n")
+}
+
+func TestMonitor(t *testing.T) {
+	mon, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, mon, "MONITOR")
+	assert.Equal(t, "OK", read(t, mon))
+
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "SET", "Lando", "Nor\tris")
+	assert.Equal(t, "OK", read(t, rw))
+
+	line := read(t, mon)
+	assert.Regexp(t, `^\d+\.\d{6} \[0 127\.0\.0\.1:\d+\] "SET" "Lando" "Nor\\tris"$`, line)
+}
+
+func TestClient(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "CLIENT", "SETNAME", "e2e")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "CLIENT", "ID")
+	id := read(t, rw)
+
+	other, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, other, "CLIENT", "ID")
+	otherId := read(t, other)
+
+	write(t, rw, "CLIENT", "LIST", "ID", id)
+	assert.Regexp(t, `^id=`+id+` addr=127\.0\.0\.1:\d+ laddr=127\.0\.0\.1:6379 .* name=e2e `, readBulk(t, rw))
+
+	// the write waits for the pause to end
+	write(t, rw, "CLIENT", "PAUSE", "100", "WRITE")
+	assert.Equal(t, "OK", read(t, rw))
+	start := time.Now()
+	write(t, other, "SET", "Max", "Verstappen")
+	assert.Equal(t, "OK", read(t, other))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	write(t, rw, "CLIENT", "KILL", "ID", otherId)
+	assert.Equal(t, "1", read(t, rw))
+	_, err = other.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAcl(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "ACL", "SETUSER", "e2e", "on", ">pass", "~e2e:*", "+get", "+set")
+	assert.Equal(t, "OK", read(t, rw))
+
+	write(t, rw, "AUTH", "e2e", "pass")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "SET", "e2e:Lewis", "Hamilton")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "GET", "Lewis")
+	assert.Equal(t, "NOPERM this user has no permissions to access one of the keys used as arguments", read(t, rw))
+	write(t, rw, "DBSIZE")
+	assert.Equal(t, "NOPERM this user has no permissions to run the 'dbsize' command", read(t, rw))
+
+	write(t, rw, "AUTH", "default", "")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "ACL", "DELUSER", "e2e")
+	assert.Equal(t, "1", read(t, rw))
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	sub, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, sub, "SUBSCRIBE", "__keyevent@13__:expired")
+	assert.Equal(t, []string{"subscribe", "__keyevent@13__:expired", "1"}, readArray(t, sub))
+
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "CONFIG", "SET", "notify-keyspace-events", "Ex")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "SELECT", "13")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "SET", "Nico", "Rosberg", "PX", "50")
+	assert.Equal(t, "OK", read(t, rw))
+
+	// the key expires while nobody accesses it
+	assert.Equal(t, []string{"message", "__keyevent@13__:expired", "Nico"}, readArray(t, sub))
+	write(t, rw, "CONFIG", "SET", "notify-keyspace-events", "")
+	assert.Equal(t, "OK", read(t, rw))
+}
+
+func TestClientTracking(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "HELLO", "3")
+	assert.Equal(t, "3", readArray(t, rw)[5])
+	write(t, rw, "SET", "Lewis", "Hamilton")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "CLIENT", "TRACKING", "on")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "GET", "Lewis")
+	assert.Equal(t, "Hamilton", read(t, rw))
+
+	other, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, other, "SET", "Lewis", "Verstappen")
+	assert.Equal(t, "OK", read(t, other))
+
+	// the key was read, then changed by another connection
+	assert.Equal(t, []string{"invalidate", "Lewis"}, readArray(t, rw))
+	write(t, rw, "CLIENT", "TRACKING", "off")
+	assert.Equal(t, "OK", read(t, rw))
+}
+
+func TestConfig(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "CONFIG", "SET", "port", "6390", "hz", "20")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "CONFIG", "GET", "port")
+	assert.Equal(t, "2", read(t, rw))
+	assert.Equal(t, "port", read(t, rw))
+	assert.Equal(t, "6390", read(t, rw))
+
+	// the clients connected already are kept
+	other, err := connectTo(6390)
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, other, "CONFIG", "SET", "port", "6379")
+	assert.Equal(t, "OK", read(t, other))
+	write(t, rw, "PING")
+	assert.Equal(t, "PONG", read(t, rw))
+}
+
+func TestScriptKill(t *testing.T) {
+	rw, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, rw, "CONFIG", "SET", "busy-reply-threshold", "100")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "EVAL", "return redis.call('set', KEYS[1], ARGV[1])", "1", "George", "Russell")
+	assert.Equal(t, "OK", read(t, rw))
+	write(t, rw, "EVAL", "while true do end", "0")
+
+	// the other connections are served once the script runs for long
+	other, err := connect()
+	if err != nil {
+		t.Error(err)
+	}
+	write(t, other, "GET", "George")
+	assert.Equal(t, "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.",
+		read(t, other))
+	write(t, other, "SCRIPT", "KILL")
+	assert.Equal(t, "OK", read(t, other))
+	assert.Equal(t, "ERR Script killed by user with SCRIPT KILL...", read(t, rw))
+	write(t, other, "GET", "George")
+	assert.Equal(t, "Russell", read(t, other))
+	write(t, rw, "CONFIG", "SET", "busy-reply-threshold", "5000")
+	assert.Equal(t, "OK", read(t, rw))
+}
+
 func TestSetGetMulti(t *testing.T) {
 	rchan := make(chan resp)
 	n := 500
@@ -122,6 +410,62 @@ func read(t *testing.T, r *bufio.ReadWriter) string {
 	return s
 }
 
+// readBulk reads a bulk string reply that may span several lines.
+func readBulk(t *testing.T, r *bufio.ReadWriter) string {
+	s, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Read error %v", err)
+	}
+	if s[0] != '$' {
+		t.Fatalf("Expected bulk string, got %s", s)
+	}
+
+	n, err := strconv.Atoi(s[1 : len(s)-2])
+	if err != nil {
+		t.Fatalf("Invalid bulk string length %s", s)
+	}
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		t.Fatalf("Read error %v", err)
+	}
+	return string(b[:n])
+}
+
+// readArray reads an array reply, flattening nested arrays into a single
+// list of strings. RESP3 pushes and maps are read as arrays, the keys and
+// values of a map in turn.
+func readArray(t *testing.T, r *bufio.ReadWriter) []string {
+	s, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Read error %v", err)
+	}
+	if s[0] != '*' && s[0] != '>' && s[0] != '%' {
+		t.Fatalf("Expected array, got %s", s)
+	}
+
+	n, err := strconv.Atoi(s[1 : len(s)-2])
+	if err != nil {
+		t.Fatalf("Invalid array length %s", s)
+	}
+	if s[0] == '%' {
+		n *= 2
+	}
+
+	res := []string{}
+	for i := 0; i < n; i++ {
+		b, err := r.Peek(1)
+		if err != nil {
+			t.Fatalf("Read error %v", err)
+		}
+		if b[0] == '*' || b[0] == '>' || b[0] == '%' {
+			res = append(res, readArray(t, r)...)
+		} else {
+			res = append(res, read(t, r))
+		}
+	}
+	return res
+}
+
 func write(t *testing.T, w *bufio.ReadWriter, s ...string) {
 	_, err := w.WriteString("*" + str(len(s)) + "\r\n")
 	if err != nil {
@@ -141,7 +485,11 @@ func str(n int) string {
 }
 
 func connect() (*bufio.ReadWriter, error) {
-	conn, err := net.Dial("tcp", "0.0.0.0:6379")
+	return connectTo(6379)
+}
+
+func connectTo(port int) (*bufio.ReadWriter, error) {
+	conn, err := net.Dial("tcp", "0.0.0.0:"+strconv.Itoa(port))
 	if err != nil {
 		fmt.Println("Exiting due to error", err)
 		return nil, err